@@ -0,0 +1,413 @@
+// Command socli runs SO contract plugins on a local chain kept in a
+// directory, so a contract can be tried against the real state semantics
+// without a node. Every deploy, upgrade and invoke is the only transaction
+// of a new block, query runs on the head block without changing it.
+//
+//	go build -buildmode=plugin -o simple.so simpleDemo.go
+//	socli deploy simple.so Simple
+//	socli invoke savePersonInfo tom '{"age":1}'
+//	socli query queryPersonInfo tom
+//	socli history tom
+//	socli events 2
+//	socli state dump
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"gopkg.in/urfave/cli.v1"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/public"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+	"pdx-chain-so/so"
+)
+
+var (
+	dataDirFlag = cli.StringFlag{
+		Name:  "datadir",
+		Usage: "directory of the local chain",
+		Value: "socli-data",
+	}
+	contractFlag = cli.StringFlag{
+		Name:  "contract",
+		Usage: "name of the contract, its address is derived from the name",
+		Value: "contract",
+	}
+	gasFlag = cli.Uint64Flag{
+		Name:  "gas",
+		Usage: "gas limit of a transaction, 0 for no limit",
+	}
+	versionFlag = cli.StringFlag{
+		Name:  "version",
+		Usage: "version of the contract",
+		Value: "1.0",
+	}
+)
+
+func main() {
+	if err := newApp().Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, "socli:", err)
+		os.Exit(1)
+	}
+}
+
+func newApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = "socli"
+	app.Usage = "run SO contracts on a local chain"
+	app.Flags = []cli.Flag{dataDirFlag, contractFlag, gasFlag}
+	app.Commands = []cli.Command{
+		{
+			Name:      "deploy",
+			Usage:     "deploy a contract plugin and run its Init with args",
+			ArgsUsage: "<plugin> <symbol> [args...]",
+			Flags:     []cli.Flag{versionFlag},
+			Action:    deploy,
+		},
+		{
+			Name:      "upgrade",
+			Usage:     "replace the plugin of the contract and run its Upgrade with args",
+			ArgsUsage: "<plugin> <symbol> [args...]",
+			Flags:     []cli.Flag{versionFlag},
+			Action:    upgrade,
+		},
+		{
+			Name:      "invoke",
+			Usage:     "invoke a contract function in a new block",
+			ArgsUsage: "<fn> [args...]",
+			Action:    invoke,
+		},
+		{
+			Name:      "query",
+			Usage:     "invoke a contract function on the head block without committing",
+			ArgsUsage: "<fn> [args...]",
+			Action:    query,
+		},
+		{
+			Name:      "history",
+			Usage:     "print the modifications of a key, newest first",
+			ArgsUsage: "<key>",
+			Action:    history,
+		},
+		{
+			Name:      "events",
+			Usage:     "print the events of a block, the head block by default",
+			ArgsUsage: "[block]",
+			Action:    events,
+		},
+		{
+			Name:  "state",
+			Usage: "inspect the contract state",
+			Subcommands: []cli.Command{
+				{
+					Name:   "dump",
+					Usage:  "print every key of the contract with its value",
+					Action: dump,
+				},
+			},
+		},
+	}
+	return app
+}
+
+// newRegistry returns the registry the contracts are loaded into.
+var newRegistry = so.NewRegistry
+
+// env is the local chain and the contract a command works on, the output
+// of the command goes to out.
+type env struct {
+	store    *Store
+	registry *so.Registry
+	events   *so.EventStore
+	name     string
+	addr     common.Address
+	gas      uint64
+	out      io.Writer
+}
+
+func openEnv(c *cli.Context) (*env, error) {
+	store, err := OpenStore(c.GlobalString(dataDirFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+	public.BC = chain{store: store}
+	name := c.GlobalString(contractFlag.Name)
+	return &env{
+		store:    store,
+		registry: newRegistry(),
+		events:   so.NewEventStore(store),
+		name:     name,
+		addr:     common.BytesToAddress(crypto.Keccak256([]byte(name))),
+		gas:      c.GlobalUint64(gasFlag.Name),
+		out:      c.App.Writer,
+	}, nil
+}
+
+// load loads the plugin of the deployed contract.
+func (e *env) load() error {
+	rec, err := e.store.contract(e.name)
+	if err == leveldb.ErrNotFound {
+		return fmt.Errorf("contract %q is not deployed", e.name)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = e.registry.Load(rec.Plugin, rec.Symbol)
+	return err
+}
+
+// head opens the state of the head block.
+func (e *env) head() (*state.MStateDB, *Database, *so.TxContext, error) {
+	num, err := e.store.Head()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rec, err := e.store.block(num)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	st, sdb, err := e.store.StateAt(num)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	dbs, err := state.NewMStateDB(st, 1)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ctx := &so.TxContext{BlockNumber: num, Timestamp: rec.Time, GasLimit: e.gas}
+	return dbs[0], sdb, ctx, nil
+}
+
+// transact runs fn as the transaction of a new block on top of the head
+// block and commits the block, also when fn fails.
+func (e *env) transact(args [][]byte, fn func(db *state.MStateDB, ctx *so.TxContext) (*so.InvokeResult, error)) error {
+	db, sdb, ctx, err := e.head()
+	if err != nil {
+		return err
+	}
+	enc, err := rlp.EncodeToBytes(args)
+	if err != nil {
+		return err
+	}
+	ctx.BlockNumber++
+	ctx.Timestamp = uint64(time.Now().Unix())
+	ctx.TxID = crypto.Keccak256Hash(common.Uint64ToByte(ctx.BlockNumber), enc)
+	db.Prepare(ctx.TxID, common.Hash{}, 0)
+
+	result, invokeErr := fn(db, ctx)
+	root, err := db.Commit(false)
+	if err != nil {
+		return err
+	}
+	if err := sdb.Commit(ctx.BlockNumber, root, &blockRecord{Time: ctx.Timestamp, TxHash: ctx.TxID}); err != nil {
+		return err
+	}
+	hash := chain{store: e.store}.GetBlockByNumber(ctx.BlockNumber).Hash()
+	if err := e.events.AddBlock(ctx.BlockNumber, hash, db.Logs()); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.out, "block %d tx %s\n", ctx.BlockNumber, ctx.TxID.Hex())
+	printResult(e.out, result)
+	for _, ev := range db.Logs() {
+		fmt.Fprintf(e.out, "event %s %s\n", ev.Name, ev.Payload)
+	}
+	return invokeErr
+}
+
+func printResult(w io.Writer, result *so.InvokeResult) {
+	fmt.Fprintf(w, "status %d", result.Status)
+	if result.Message != "" {
+		fmt.Fprintf(w, " %s", result.Message)
+	}
+	fmt.Fprintf(w, ", gas used %d\n", result.Meter.GasUsed())
+	if len(result.Payload) > 0 {
+		fmt.Fprintf(w, "%s\n", result.Payload)
+	}
+}
+
+func byteArgs(args []string) [][]byte {
+	out := make([][]byte, len(args))
+	for i, a := range args {
+		out[i] = []byte(a)
+	}
+	return out
+}
+
+func deploy(c *cli.Context) error {
+	return lifecycle(c, false)
+}
+
+func upgrade(c *cli.Context) error {
+	return lifecycle(c, true)
+}
+
+func lifecycle(c *cli.Context, upgrade bool) error {
+	if c.NArg() < 2 {
+		return fmt.Errorf("%s needs a plugin and a symbol", c.Command.Name)
+	}
+	e, err := openEnv(c)
+	if err != nil {
+		return err
+	}
+	defer e.store.Close()
+	plugin, err := filepath.Abs(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	symbol, version, args := c.Args().Get(1), c.String(versionFlag.Name), byteArgs(c.Args()[2:])
+	if upgrade {
+		if err := e.load(); err != nil {
+			return err
+		}
+	}
+	err = e.transact(args, func(db *state.MStateDB, ctx *so.TxContext) (*so.InvokeResult, error) {
+		if upgrade {
+			return e.registry.Upgrade(db, e.addr, ctx, version, plugin, symbol, args)
+		}
+		return e.registry.Deploy(db, e.addr, ctx, version, plugin, symbol, args)
+	})
+	if err != nil {
+		return err
+	}
+	return e.store.putContract(e.name, &contractRecord{Address: e.addr, Plugin: plugin, Symbol: symbol})
+}
+
+func invoke(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return fmt.Errorf("invoke needs a function")
+	}
+	e, err := openEnv(c)
+	if err != nil {
+		return err
+	}
+	defer e.store.Close()
+	if err := e.load(); err != nil {
+		return err
+	}
+	args := byteArgs(c.Args())
+	return e.transact(args, func(db *state.MStateDB, ctx *so.TxContext) (*so.InvokeResult, error) {
+		return e.registry.Invoke(db, e.addr, ctx, args)
+	})
+}
+
+func query(c *cli.Context) error {
+	if c.NArg() < 1 {
+		return fmt.Errorf("query needs a function")
+	}
+	e, err := openEnv(c)
+	if err != nil {
+		return err
+	}
+	defer e.store.Close()
+	if err := e.load(); err != nil {
+		return err
+	}
+	db, _, ctx, err := e.head()
+	if err != nil {
+		return err
+	}
+	//富查询只在只读查询中可用,文档库由头块状态重建
+	e.registry.Documents = so.NewDocumentStore()
+	if err := e.registry.Documents.Rebuild(db, e.addr); err != nil {
+		return err
+	}
+	result, err := e.registry.Query(db, e.addr, ctx, byteArgs(c.Args()))
+	printResult(e.out, result)
+	return err
+}
+
+func history(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("history needs a key")
+	}
+	e, err := openEnv(c)
+	if err != nil {
+		return err
+	}
+	defer e.store.Close()
+	db, _, ctx, err := e.head()
+	if err != nil {
+		return err
+	}
+	stub := so.NewSoCallStubWithContext(so.NewHandler(db), nil, e.addr, ctx)
+	it, err := stub.GetHistoryForKey(c.Args().Get(0), 0, ctx.BlockNumber+1)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.HasNext() {
+		rec, err := it.Next()
+		if err != nil {
+			return err
+		}
+		if rec.IsDelete {
+			fmt.Fprintf(e.out, "block %d tx %s deleted\n", rec.BlockNum, rec.TxHash.Hex())
+			continue
+		}
+		fmt.Fprintf(e.out, "block %d tx %s %s\n", rec.BlockNum, rec.TxHash.Hex(), rec.Value)
+	}
+	return nil
+}
+
+func events(c *cli.Context) error {
+	if c.NArg() > 1 {
+		return fmt.Errorf("events takes at most a block number")
+	}
+	e, err := openEnv(c)
+	if err != nil {
+		return err
+	}
+	defer e.store.Close()
+	num, err := e.store.Head()
+	if err != nil {
+		return err
+	}
+	if c.NArg() == 1 {
+		if num, err = strconv.ParseUint(c.Args().Get(0), 10, 64); err != nil {
+			return fmt.Errorf("invalid block number %q", c.Args().Get(0))
+		}
+	}
+	evs, err := e.events.GetEvents(num)
+	if err != nil {
+		return err
+	}
+	for _, ev := range evs {
+		fmt.Fprintf(e.out, "block %d tx %s event %s %s\n", ev.BlockNumber, ev.TxHash.Hex(), ev.Name, ev.Payload)
+	}
+	return nil
+}
+
+func dump(c *cli.Context) error {
+	e, err := openEnv(c)
+	if err != nil {
+		return err
+	}
+	defer e.store.Close()
+	db, _, ctx, err := e.head()
+	if err != nil {
+		return err
+	}
+	stub := so.NewSoCallStubWithContext(so.NewHandler(db), nil, e.addr, ctx)
+	it, err := stub.GetStateByRange("", "")
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.out, "%s = %s\n", kv.Key, kv.Value)
+	}
+	return nil
+}
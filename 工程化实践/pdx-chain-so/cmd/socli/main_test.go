@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/so"
+)
+
+// testContract puts, gets and deletes the keys named by its arguments.
+type testContract struct{}
+
+func (testContract) Run(stub interface{}) so.Response {
+	s := stub.(so.StubInterface)
+	fn, args := s.GetFunctionAndParameters()
+	switch fn {
+	case "put":
+		if err := s.PutState(args[0], args[1]); err != nil {
+			return so.FromError(err)
+		}
+		s.SetEvent("put", args[0])
+		return so.Success(nil)
+	case "get":
+		v, err := s.GetState(args[0])
+		if err != nil {
+			return so.FromError(err)
+		}
+		return so.Success(v)
+	case "del":
+		if err := s.DelState(args[0]); err != nil {
+			return so.FromError(err)
+		}
+		return so.Success(nil)
+	}
+	return so.Error("unknown function " + fn)
+}
+
+// testChain is a local chain in a temporary directory with a plugin file
+// whose contract is registered in place of opening the file.
+type testChain struct {
+	t      *testing.T
+	dir    string
+	plugin string
+}
+
+func newTestChain(t *testing.T) *testChain {
+	dir, err := ioutil.TempDir("", "socli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	plugin := filepath.Join(dir, "contract.so")
+	if err := ioutil.WriteFile(plugin, []byte("build 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash := crypto.Keccak256Hash([]byte("build 1"))
+	newRegistry = func() *so.Registry {
+		r := so.NewRegistry()
+		r.Register(hash, "Contract", testContract{})
+		return r
+	}
+	t.Cleanup(func() { newRegistry = so.NewRegistry })
+	return &testChain{t: t, dir: dir, plugin: plugin}
+}
+
+// run runs socli with args on the chain and returns its output.
+func (c *testChain) run(args ...string) (string, error) {
+	app := newApp()
+	var out bytes.Buffer
+	app.Writer = &out
+	err := app.Run(append([]string{"socli", "--datadir", filepath.Join(c.dir, "data")}, args...))
+	return out.String(), err
+}
+
+func (c *testChain) mustRun(args ...string) string {
+	c.t.Helper()
+	out, err := c.run(args...)
+	if err != nil {
+		c.t.Fatalf("socli %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return out
+}
+
+func TestCommands(t *testing.T) {
+	c := newTestChain(t)
+	if _, err := c.run("invoke", "get", "a"); err == nil || !strings.Contains(err.Error(), "not deployed") {
+		t.Errorf("invoke before deploy = %v", err)
+	}
+
+	if out := c.mustRun("deploy", c.plugin, "Contract"); !strings.HasPrefix(out, "block 1 tx ") {
+		t.Errorf("deploy output = %q", out)
+	}
+	//每次调用自动推进一个区块
+	for i, args := range [][]string{{"put", "a", "1"}, {"put", "a", "2"}, {"put", "b", "3"}, {"del", "a"}} {
+		out := c.mustRun(append([]string{"invoke"}, args...)...)
+		if want := "block " + string(rune('2'+i)) + " tx "; !strings.HasPrefix(out, want) {
+			t.Errorf("invoke %v output = %q, want prefix %q", args, out, want)
+		}
+	}
+	if out := c.mustRun("invoke", "put", "c", "4"); !strings.Contains(out, "\nevent put c\n") {
+		t.Errorf("invoke output without its event: %q", out)
+	}
+	//事件随区块保存,之后的命令仍能读到
+	if out := c.mustRun("events"); !strings.HasPrefix(out, "block 6 tx ") || !strings.HasSuffix(out, " event put c\n") {
+		t.Errorf("events of the head block = %q", out)
+	}
+	if out := c.mustRun("events", "3"); !strings.HasSuffix(out, " event put a\n") {
+		t.Errorf("events of block 3 = %q", out)
+	}
+	if out := c.mustRun("events", "5"); out != "" {
+		t.Errorf("events of block 5 = %q, want none", out)
+	}
+
+	if out := c.mustRun("query", "get", "b"); !strings.HasPrefix(out, "status 200") || !strings.HasSuffix(out, "\n3\n") {
+		t.Errorf("query output = %q", out)
+	}
+	//查询不产生区块
+	c.mustRun("query", "get", "b")
+	if out := c.mustRun("invoke", "get", "b"); !strings.HasPrefix(out, "block 7 tx ") {
+		t.Errorf("block after queries = %q, want block 7", out)
+	}
+
+	var blocks []string
+	for _, line := range strings.Split(strings.TrimSpace(c.mustRun("history", "a")), "\n") {
+		f := strings.Fields(line)
+		if len(f) != 5 {
+			t.Fatalf("history line %q", line)
+		}
+		blocks = append(blocks, f[1]+" "+f[4])
+	}
+	if got := strings.Join(blocks, ","); got != "5 deleted,3 2,2 1" {
+		t.Errorf("history of a = %s", got)
+	}
+
+	if out := c.mustRun("state", "dump"); out != "b = 3\nc = 4\n" {
+		t.Errorf("state dump = %q", out)
+	}
+
+	//失败的调用同样产生区块,但不改变状态
+	if _, err := c.run("invoke", "nope"); err == nil {
+		t.Error("invoke of an unknown function succeeded")
+	}
+	if out := c.mustRun("query", "get", "b"); !strings.HasSuffix(out, "\n3\n") {
+		t.Errorf("state after a failed invoke: %q", out)
+	}
+	if out := c.mustRun("invoke", "get", "b"); !strings.HasPrefix(out, "block 9 tx ") {
+		t.Errorf("block after a failed invoke = %q, want block 9", out)
+	}
+}
+
+func TestContractNames(t *testing.T) {
+	c := newTestChain(t)
+	c.mustRun("deploy", c.plugin, "Contract")
+	c.mustRun("--contract", "other", "deploy", c.plugin, "Contract")
+	c.mustRun("invoke", "put", "k", "first")
+	c.mustRun("--contract", "other", "invoke", "put", "k", "second")
+
+	if out := c.mustRun("state", "dump"); out != "k = first\n" {
+		t.Errorf("dump of the default contract = %q", out)
+	}
+	if out := c.mustRun("--contract", "other", "state", "dump"); out != "k = second\n" {
+		t.Errorf("dump of contract other = %q", out)
+	}
+	if _, err := c.run("deploy", c.plugin, "Contract"); err == nil {
+		t.Error("second deploy under the same name succeeded")
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/core/types"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/ethdb"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+	"pdx-chain-so/pkg/pdx-chain/trie"
+)
+
+// Keys of the store. Trie values are versioned by block number:
+//
+//	"s" ns key-length key ^number -> value, empty for a deleted key
+//	"r" root                      -> number of the block with that state root
+//	"b" number                    -> blockRecord
+//	"h"                           -> number of the head block
+//	"c" name                      -> contractRecord
+//	"pdx-so-events" number        -> events of the block, see so.EventStore
+//
+// The number of a value is inverted so the newest version of a key sorts
+// first, ns is the zero hash for the account trie and the address hash of
+// the account for a storage trie.
+var (
+	valuePrefix    = []byte("s")
+	rootPrefix     = []byte("r")
+	blockPrefix    = []byte("b")
+	headKey        = []byte("h")
+	contractPrefix = []byte("c")
+)
+
+var (
+	errNoProof = errors.New("the local chain keeps no Merkle proofs")
+	errNoNodes = errors.New("the local chain keeps no trie nodes to iterate")
+)
+
+// blockRecord is what the store keeps of a block.
+type blockRecord struct {
+	Root   common.Hash
+	Time   uint64
+	TxHash common.Hash
+}
+
+// contractRecord locates the plugin of a deployed contract.
+type contractRecord struct {
+	Address common.Address
+	Plugin  string
+	Symbol  string
+}
+
+// Store keeps the state of every block in a leveldb directory. It is the
+// state.Database of the local chain and the public.BC its contracts see.
+type Store struct {
+	db *leveldb.DB
+}
+
+func OpenStore(dir string) (*Store, error) {
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db}
+	if _, err := s.Head(); err == leveldb.ErrNotFound {
+		//创世块,空状态
+		if err := s.writeBlock(new(leveldb.Batch), 0, &blockRecord{}); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Head returns the number of the last block.
+func (s *Store) Head() (uint64, error) {
+	enc, err := s.db.Get(headKey, nil)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(enc), nil
+}
+
+func (s *Store) block(num uint64) (*blockRecord, error) {
+	enc, err := s.db.Get(append(common.CopyBytes(blockPrefix), common.Uint64ToByte(num)...), nil)
+	if err != nil {
+		return nil, err
+	}
+	rec := new(blockRecord)
+	if err := rlp.DecodeBytes(enc, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (s *Store) writeBlock(batch *leveldb.Batch, num uint64, rec *blockRecord) error {
+	enc, err := rlp.EncodeToBytes(rec)
+	if err != nil {
+		return err
+	}
+	batch.Put(append(common.CopyBytes(blockPrefix), common.Uint64ToByte(num)...), enc)
+	batch.Put(append(common.CopyBytes(rootPrefix), rec.Root[:]...), common.Uint64ToByte(num))
+	batch.Put(headKey, common.Uint64ToByte(num))
+	return s.db.Write(batch, nil)
+}
+
+// StateAt opens the state of block num, its changes are kept by the
+// returned database until Commit.
+func (s *Store) StateAt(num uint64) (*state.StateDB, *Database, error) {
+	rec, err := s.block(num)
+	if err != nil {
+		return nil, nil, err
+	}
+	db := &Database{store: s, version: num}
+	st, err := state.New(rec.Root, db)
+	if err != nil {
+		return nil, nil, err
+	}
+	return st, db, nil
+}
+
+// Has, Get, Put and Delete make the store the so.EventDatabase of the
+// events of its blocks.
+func (s *Store) Has(key []byte) (bool, error) {
+	return s.db.Has(key, nil)
+}
+
+func (s *Store) Get(key []byte) ([]byte, error) {
+	return s.db.Get(key, nil)
+}
+
+func (s *Store) Put(key []byte, value []byte) error {
+	return s.db.Put(key, value, nil)
+}
+
+func (s *Store) Delete(key []byte) error {
+	return s.db.Delete(key, nil)
+}
+
+func (s *Store) contract(name string) (*contractRecord, error) {
+	enc, err := s.db.Get(append(common.CopyBytes(contractPrefix), name...), nil)
+	if err != nil {
+		return nil, err
+	}
+	rec := new(contractRecord)
+	if err := rlp.DecodeBytes(enc, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+func (s *Store) putContract(name string, rec *contractRecord) error {
+	enc, err := rlp.EncodeToBytes(rec)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(append(common.CopyBytes(contractPrefix), name...), enc, nil)
+}
+
+// chain serves the blocks of the store to the history queries of the so
+// package.
+type chain struct {
+	store *Store
+}
+
+func (c chain) GetBlockByNumber(number uint64) *types.Block {
+	rec, err := c.store.block(number)
+	if err != nil {
+		return nil
+	}
+	return types.NewBlockWithHeader(&types.Header{
+		Number:     new(big.Int).SetUint64(number),
+		Root:       rec.Root,
+		TxHash:     rec.TxHash,
+		Time:       new(big.Int).SetUint64(rec.Time),
+		Difficulty: new(big.Int),
+	})
+}
+
+func (c chain) GetCommitBlock(height uint64) *types.Block {
+	return c.GetBlockByNumber(height)
+}
+
+func (c chain) StateAt(root common.Hash) (*state.StateDB, error) {
+	enc, err := c.store.db.Get(append(common.CopyBytes(rootPrefix), root[:]...), nil)
+	if err != nil {
+		return nil, err
+	}
+	st, _, err := c.store.StateAt(binary.BigEndian.Uint64(enc))
+	return st, err
+}
+
+func (c chain) State() (*state.StateDB, error) {
+	head, err := c.store.Head()
+	if err != nil {
+		return nil, err
+	}
+	st, _, err := c.store.StateAt(head)
+	return st, err
+}
+
+// Database is a state.Database reading the tries of the store as of one
+// block and buffering their updates until Commit.
+type Database struct {
+	store   *Store
+	version uint64
+	tries   []*kvTrie
+}
+
+func (db *Database) OpenTrie(root common.Hash) (state.Trie, error) {
+	return db.open(common.Hash{}, root), nil
+}
+
+func (db *Database) OpenStorageTrie(addrHash, root common.Hash) (state.Trie, error) {
+	return db.open(addrHash, root), nil
+}
+
+func (db *Database) open(ns, root common.Hash) *kvTrie {
+	t := &kvTrie{db: db, ns: ns, base: root, dirty: make(map[string][]byte)}
+	db.tries = append(db.tries, t)
+	return t
+}
+
+func (db *Database) CopyTrie(t state.Trie) state.Trie {
+	kt := t.(*kvTrie)
+	c := &kvTrie{db: kt.db, ns: kt.ns, base: kt.base, dirty: make(map[string][]byte, len(kt.dirty))}
+	for k, v := range kt.dirty {
+		c.dirty[k] = v
+	}
+	return c
+}
+
+func (db *Database) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
+	return nil, nil
+}
+
+func (db *Database) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
+	return 0, nil
+}
+
+// TrieDB returns nil, the tries of the store are flat and have no nodes.
+func (db *Database) TrieDB() *trie.Database {
+	return nil
+}
+
+// Commit writes the updates of the tries as block num with the given state
+// root, which the caller computed with IntermediateRoot, and makes it the
+// head block.
+func (db *Database) Commit(num uint64, root common.Hash, rec *blockRecord) error {
+	batch := new(leveldb.Batch)
+	for _, t := range db.tries {
+		for k, v := range t.dirty {
+			batch.Put(valueKey(t.ns, []byte(k), num), v)
+		}
+	}
+	rec.Root = root
+	return db.store.writeBlock(batch, num, rec)
+}
+
+func valueKey(ns common.Hash, key []byte, num uint64) []byte {
+	k := make([]byte, 0, len(valuePrefix)+common.HashLength+2+len(key)+8)
+	k = append(k, valuePrefix...)
+	k = append(k, ns[:]...)
+	k = append(k, byte(len(key)>>8), byte(len(key)))
+	k = append(k, key...)
+	return append(k, common.Uint64ToByte(^num)...)
+}
+
+// kvTrie is a flat trie stored in versions. Its hash chains the hash it was
+// opened with and its pending updates, so every state has its own root
+// without the cost of a Merkle trie.
+type kvTrie struct {
+	db    *Database
+	ns    common.Hash
+	base  common.Hash
+	dirty map[string][]byte
+}
+
+func (t *kvTrie) TryGet(key []byte) ([]byte, error) {
+	if v, ok := t.dirty[string(key)]; ok {
+		return v, nil
+	}
+	seek := valueKey(t.ns, key, t.db.version)
+	it := t.db.store.db.NewIterator(&util.Range{Start: seek}, nil)
+	defer it.Release()
+	if !it.Next() || len(it.Key()) != len(seek) || !bytes.Equal(it.Key()[:len(seek)-8], seek[:len(seek)-8]) {
+		return nil, it.Error()
+	}
+	if len(it.Value()) == 0 {
+		return nil, nil
+	}
+	return common.CopyBytes(it.Value()), nil
+}
+
+func (t *kvTrie) TryUpdate(key, value []byte) error {
+	t.dirty[string(key)] = common.CopyBytes(value)
+	return nil
+}
+
+func (t *kvTrie) TryDelete(key []byte) error {
+	t.dirty[string(key)] = []byte{}
+	return nil
+}
+
+func (t *kvTrie) Hash() common.Hash {
+	if len(t.dirty) == 0 {
+		return t.base
+	}
+	keys := make([]string, 0, len(t.dirty))
+	for k := range t.dirty {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	data := [][]byte{t.base[:]}
+	for _, k := range keys {
+		data = append(data, []byte(k), t.dirty[k])
+	}
+	enc, _ := rlp.EncodeToBytes(data)
+	return crypto.Keccak256Hash(enc)
+}
+
+// Commit returns the hash of the trie, its updates are written by
+// Database.Commit together with the block.
+func (t *kvTrie) Commit(onleaf trie.LeafCallback) (common.Hash, error) {
+	return t.Hash(), nil
+}
+
+// Prove fails, a flat trie has no nodes to prove its values with.
+func (t *kvTrie) Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error {
+	return errNoProof
+}
+
+// NodeIterator returns an iterator failing with errNoNodes, a flat trie has
+// no nodes to walk.
+func (t *kvTrie) NodeIterator(startKey []byte) trie.NodeIterator {
+	return noNodes{}
+}
+
+func (t *kvTrie) GetKey(key []byte) []byte {
+	return key
+}
+
+// noNodes is the iterator of a kvTrie, it ends at once with errNoNodes.
+type noNodes struct {
+	trie.NodeIterator
+}
+
+func (noNodes) Next(bool) bool { return false }
+
+func (noNodes) Error() error { return errNoNodes }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+)
+
+func TestStoreVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "socli-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := common.HexToAddress("0x10")
+	slot := common.HexToHash("0x1")
+
+	//区块n把槽位写为n,第3块删除账户的值
+	var roots []common.Hash
+	for num := uint64(1); num <= 3; num++ {
+		st, sdb, err := s.StateAt(num - 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if num < 3 {
+			st.SetState(addr, slot, common.Hash{31: byte(num)})
+		} else {
+			st.SetState(addr, slot, common.Hash{})
+		}
+		root, err := st.Commit(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sdb.Commit(num, root, &blockRecord{Time: num}); err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+	if roots[0] == roots[1] || roots[1] == roots[2] {
+		t.Errorf("blocks with different states share a root: %x", roots)
+	}
+	s.Close()
+
+	s, err = OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if head, err := s.Head(); err != nil || head != 3 {
+		t.Fatalf("head after reopening = %d, %v", head, err)
+	}
+	for num, want := range []uint64{0, 1, 2, 0} {
+		st, _, err := s.StateAt(uint64(num))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := uint64(st.GetState(addr, slot)[31]); got != want {
+			t.Errorf("slot at block %d = %d, want %d", num, got, want)
+		}
+	}
+	st, err := chain{store: s}.StateAt(roots[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := uint64(st.GetState(addr, slot)[31]); got != 1 {
+		t.Errorf("slot at the root of block 1 = %d, want 1", got)
+	}
+	if b := (chain{store: s}).GetBlockByNumber(2); b == nil || b.Root() != roots[1] || b.Time().Uint64() != 2 {
+		t.Errorf("block 2 = %v", b)
+	}
+	if (chain{store: s}).GetBlockByNumber(4) != nil {
+		t.Error("block beyond the head found")
+	}
+}
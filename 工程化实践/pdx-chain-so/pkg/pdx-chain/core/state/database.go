@@ -17,8 +17,14 @@
 package state
 
 import (
+	"fmt"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+
 	"pdx-chain-so/pkg/pdx-chain/common"
-	//"pdx-chain-so/pkg/pdx-chain/ethdb"
+	"pdx-chain-so/pkg/pdx-chain/ethdb"
+	"pdx-chain-so/pkg/pdx-chain/trie"
 )
 
 // Trie cache generation limit after which to evict trie nodes from memory.
@@ -51,7 +57,7 @@ type Database interface {
 	ContractCodeSize(addrHash, codeHash common.Hash) (int, error)
 
 	// TrieDB retrieves the low level trie database used for data storage.
-	//TrieDB() *trie.Database
+	TrieDB() *trie.Database
 }
 
 // Trie is a Ethereum Merkle Trie.
@@ -59,116 +65,112 @@ type Trie interface {
 	TryGet(key []byte) ([]byte, error)
 	TryUpdate(key, value []byte) error
 	TryDelete(key []byte) error
-	//Commit(onleaf trie.LeafCallback) (common.Hash, error)
+	Commit(onleaf trie.LeafCallback) (common.Hash, error)
 	Hash() common.Hash
-	//NodeIterator(startKey []byte) trie.NodeIterator
+	NodeIterator(startKey []byte) trie.NodeIterator
 	GetKey([]byte) []byte // TODO(fjl): remove this when SecureTrie is removed
-	//Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error
+	Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error
 }
 
 // NewDatabase creates a backing store for state. The returned database is safe for
 // concurrent use and retains cached trie nodes in memory. The pool is an optional
 // intermediate trie-node memory pool between the low level storage layer and the
 // high level trie abstraction.
-//func NewDatabase(db ethdb.Database) Database {
-//	csc, _ := lru.New(codeSizeCacheSize)
-//	return &cachingDB{
-//		db:            trie.NewDatabase(db),
-//		codeSizeCache: csc,
-//	}
-//}
-
-//type cachingDB struct {
-//	db            *trie.Database
-//	mu            sync.Mutex
-//	pastTries     []*trie.SecureTrie
-//	codeSizeCache *lru.Cache
-//}
-//
-//// OpenTrie opens the main account trie.
-//func (db *cachingDB) OpenTrie(root common.Hash) (Trie, error) {
-//	db.mu.Lock()
-//	defer db.mu.Unlock()
-//
-//	for i := len(db.pastTries) - 1; i >= 0; i-- {
-//		if db.pastTries[i].Hash() == root {
-//
-//			return cachedTrie{db.pastTries[i].Copy(), db}, nil
-//		}
-//	}
-//	tr, err := trie.NewSecure(root, db.db)
-//	if err != nil {
-//		return nil, err
-//	}
-//	return cachedTrie{tr, db}, nil
-//}
-//
-//func (db *cachingDB) pushTrie(t *trie.SecureTrie) {
-//	db.mu.Lock()
-//	defer db.mu.Unlock()
-//
-//	if len(db.pastTries) >= maxPastTries {
-//		copy(db.pastTries, db.pastTries[1:])
-//		db.pastTries[len(db.pastTries)-1] = t
-//	} else {
-//		db.pastTries = append(db.pastTries, t)
-//	}
-//}
-//
-//// OpenStorageTrie opens the storage trie of an account.
-//func (db *cachingDB) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
-//	return trie.NewSecure(root, db.db)
-//}
-//
-//// CopyTrie returns an independent copy of the given trie.
-//func (db *cachingDB) CopyTrie(t Trie) Trie {
-//	switch t := t.(type) {
-//	case cachedTrie:
-//		return cachedTrie{t.SecureTrie.Copy(), db}
-//	case *trie.SecureTrie:
-//		return t.Copy()
-//	default:
-//		panic(fmt.Errorf("unknown trie type %T", t))
-//	}
-//}
-//
-//// ContractCode retrieves a particular contract's code.
-//func (db *cachingDB) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
-//	code, err := db.db.Node(codeHash)
-//	if err == nil {
-//		db.codeSizeCache.Add(codeHash, len(code))
-//	}
-//	return code, err
-//}
-//
-//// ContractCodeSize retrieves a particular contracts code's size.
-//func (db *cachingDB) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
-//	if cached, ok := db.codeSizeCache.Get(codeHash); ok {
-//		return cached.(int), nil
-//	}
-//	code, err := db.ContractCode(addrHash, codeHash)
-//	return len(code), err
-//}
-//
-//// TrieDB retrieves any intermediate trie-node caching layer.
-//func (db *cachingDB) TrieDB() *trie.Database {
-//	return db.db
-//}
-//
-//// cachedTrie inserts its trie into a cachingDB on commit.
-//type cachedTrie struct {
-//	*trie.SecureTrie
-//	db *cachingDB
-//}
-//
-//func (m cachedTrie) Commit(onleaf trie.LeafCallback) (common.Hash, error) {
-//	root, err := m.SecureTrie.Commit(onleaf)
-//	if err == nil {
-//		m.db.pushTrie(m.SecureTrie)
-//	}
-//	return root, err
-//}
-//
-//func (m cachedTrie) Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error {
-//	return m.SecureTrie.Prove(key, fromLevel, proofDb)
-//}
+func NewDatabase(db ethdb.Database) Database {
+	csc, _ := lru.New(codeSizeCacheSize)
+	return &cachingDB{
+		db:            trie.NewDatabase(db),
+		codeSizeCache: csc,
+	}
+}
+
+type cachingDB struct {
+	db            *trie.Database
+	mu            sync.Mutex
+	pastTries     []*trie.SecureTrie
+	codeSizeCache *lru.Cache
+}
+
+// OpenTrie opens the main account trie.
+func (db *cachingDB) OpenTrie(root common.Hash) (Trie, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for i := len(db.pastTries) - 1; i >= 0; i-- {
+		if db.pastTries[i].Hash() == root {
+
+			return cachedTrie{db.pastTries[i].Copy(), db}, nil
+		}
+	}
+	tr, err := trie.NewSecure(root, db.db)
+	if err != nil {
+		return nil, err
+	}
+	return cachedTrie{tr, db}, nil
+}
+
+func (db *cachingDB) pushTrie(t *trie.SecureTrie) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(db.pastTries) >= maxPastTries {
+		copy(db.pastTries, db.pastTries[1:])
+		db.pastTries[len(db.pastTries)-1] = t
+	} else {
+		db.pastTries = append(db.pastTries, t)
+	}
+}
+
+// OpenStorageTrie opens the storage trie of an account.
+func (db *cachingDB) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
+	return trie.NewSecure(root, db.db)
+}
+
+// CopyTrie returns an independent copy of the given trie.
+func (db *cachingDB) CopyTrie(t Trie) Trie {
+	switch t := t.(type) {
+	case cachedTrie:
+		return cachedTrie{t.SecureTrie.Copy(), db}
+	case *trie.SecureTrie:
+		return t.Copy()
+	default:
+		panic(fmt.Errorf("unknown trie type %T", t))
+	}
+}
+
+// ContractCode retrieves a particular contract's code.
+func (db *cachingDB) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
+	code, err := db.db.Node(codeHash)
+	if err == nil {
+		db.codeSizeCache.Add(codeHash, len(code))
+	}
+	return code, err
+}
+
+// ContractCodeSize retrieves a particular contracts code's size.
+func (db *cachingDB) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
+	if cached, ok := db.codeSizeCache.Get(codeHash); ok {
+		return cached.(int), nil
+	}
+	code, err := db.ContractCode(addrHash, codeHash)
+	return len(code), err
+}
+
+// TrieDB retrieves any intermediate trie-node caching layer.
+func (db *cachingDB) TrieDB() *trie.Database {
+	return db.db
+}
+
+// cachedTrie inserts its trie into a cachingDB on commit.
+type cachedTrie struct {
+	*trie.SecureTrie
+	db *cachingDB
+}
+
+func (m cachedTrie) Commit(onleaf trie.LeafCallback) (common.Hash, error) {
+	root, err := m.SecureTrie.Commit(onleaf)
+	if err == nil {
+		m.db.pushTrie(m.SecureTrie)
+	}
+	return root, err
+}
@@ -0,0 +1,257 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/common/hexutil"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+	"pdx-chain-so/pkg/pdx-chain/trie"
+)
+
+// importFlushSize is the size of the trie nodes Import keeps in memory before
+// writing them to disk.
+const importFlushSize = 64 * 1024 * 1024
+
+var ErrDumpRootMismatch = errors.New("dump: imported state root differs")
+
+// DumpEntry is a line of a state dump, a dump is a stream of JSON encoded
+// entries separated by newlines.
+//
+// The first line of a dump written by Dump holds the StateRoot only. Every
+// account follows with a line holding its Address, Nonce, Balance as a
+// decimal string, Root, CodeHash and Code, then a line with its Address, Key
+// and Value for each entry of its storage. An entry of the PDX storage holds
+// the value itself, one written by SetState its rlp encoding.
+//
+// A dump written by hand, e.g. the genesis state of a test network, may leave
+// out the StateRoot line and the Root and CodeHash of accounts, Import then
+// has nothing to check them against.
+type DumpEntry struct {
+	StateRoot *common.Hash    `json:"stateRoot,omitempty"`
+	Address   *common.Address `json:"address,omitempty"`
+	Nonce     uint64          `json:"nonce,omitempty"`
+	Balance   string          `json:"balance,omitempty"`
+	Root      *common.Hash    `json:"root,omitempty"`
+	CodeHash  *common.Hash    `json:"codeHash,omitempty"`
+	Code      hexutil.Bytes   `json:"code,omitempty"`
+	Key       *common.Hash    `json:"key,omitempty"`
+	Value     hexutil.Bytes   `json:"value,omitempty"`
+}
+
+// Dump writes the accounts and storage of the state with the given root to
+// w, in the order of their hashed keys. The addresses and keys are recovered
+// from the preimages kept by the database, Dump fails if one is missing.
+func Dump(db Database, root common.Hash, w io.Writer) error {
+	tr, err := db.OpenTrie(root)
+	if err != nil {
+		return err
+	}
+	//空状态的根为零值时记录空树的根
+	root = tr.Hash()
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(&DumpEntry{StateRoot: &root}); err != nil {
+		return err
+	}
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		var data Account
+		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
+			return fmt.Errorf("dump: invalid account %x: %v", it.Key, err)
+		}
+		key := tr.GetKey(it.Key)
+		if len(key) != common.AddressLength {
+			return fmt.Errorf("dump: missing preimage of account %x", it.Key)
+		}
+		addr := common.BytesToAddress(key)
+		addrHash := common.BytesToHash(it.Key)
+		codeHash := common.BytesToHash(data.CodeHash)
+		entry := &DumpEntry{
+			Address:  &addr,
+			Nonce:    data.Nonce,
+			Balance:  data.Balance.String(),
+			Root:     &data.Root,
+			CodeHash: &codeHash,
+		}
+		if !bytes.Equal(data.CodeHash, emptyCodeHash) {
+			if entry.Code, err = db.ContractCode(addrHash, codeHash); err != nil {
+				return fmt.Errorf("dump: missing code of account %x: %v", addr, err)
+			}
+		}
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+		if err := dumpStorage(db, addr, addrHash, data.Root, enc); err != nil {
+			return err
+		}
+	}
+	return it.Err
+}
+
+func dumpStorage(db Database, addr common.Address, addrHash, root common.Hash, enc *json.Encoder) error {
+	if root == emptyRoot || root == (common.Hash{}) {
+		return nil
+	}
+	tr, err := db.OpenStorageTrie(addrHash, root)
+	if err != nil {
+		return err
+	}
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		key := tr.GetKey(it.Key)
+		if len(key) != common.HashLength {
+			return fmt.Errorf("dump: missing preimage of storage key %x of account %x", it.Key, addr)
+		}
+		k := common.BytesToHash(key)
+		if err := enc.Encode(&DumpEntry{Address: &addr, Key: &k, Value: it.Value}); err != nil {
+			return err
+		}
+	}
+	return it.Err
+}
+
+// importAccount is the account Import is rebuilding, its storage entries
+// follow it in the dump.
+type importAccount struct {
+	entry   *DumpEntry
+	data    Account
+	storage Trie
+}
+
+// Import rebuilds the state of a dump read from r in db and writes it to the
+// disk database of db, returning its root. If the dump holds the root of the
+// state, of an account or the hash of its code, the rebuilt value must
+// match it. The storage entries of an account must follow the line of the
+// account and an account must not appear twice.
+func Import(db Database, r io.Reader) (common.Hash, error) {
+	tr, err := db.OpenTrie(common.Hash{})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	var (
+		dec  = json.NewDecoder(r)
+		want *common.Hash
+		cur  *importAccount
+		// 上次分批落盘后导入的存储树根与代码
+		pending []common.Hash
+	)
+	for n := 1; ; n++ {
+		entry := new(DumpEntry)
+		if err := dec.Decode(entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return common.Hash{}, fmt.Errorf("dump entry %d: %v", n, err)
+		}
+		switch {
+		case entry.StateRoot != nil:
+			if n != 1 {
+				return common.Hash{}, fmt.Errorf("dump entry %d: state root after the first line", n)
+			}
+			want = entry.StateRoot
+		case entry.Address != nil && entry.Key != nil:
+			if cur == nil || *cur.entry.Address != *entry.Address {
+				return common.Hash{}, fmt.Errorf("dump entry %d: storage of %x does not follow its account", n, *entry.Address)
+			}
+			if err := cur.storage.TryUpdate(entry.Key[:], entry.Value); err != nil {
+				return common.Hash{}, err
+			}
+		case entry.Address != nil:
+			if err := importFlush(db, tr, cur, &pending); err != nil {
+				return common.Hash{}, err
+			}
+			if cur, err = importOpen(db, tr, entry); err != nil {
+				return common.Hash{}, fmt.Errorf("dump entry %d: %v", n, err)
+			}
+		default:
+			return common.Hash{}, fmt.Errorf("dump entry %d: neither a state root nor an account", n)
+		}
+	}
+	if err := importFlush(db, tr, cur, &pending); err != nil {
+		return common.Hash{}, err
+	}
+	root, err := tr.Commit(referenceAccount(db))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if want != nil && *want != root {
+		return common.Hash{}, ErrDumpRootMismatch
+	}
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		return common.Hash{}, err
+	}
+	return root, nil
+}
+
+func importOpen(db Database, tr Trie, entry *DumpEntry) (*importAccount, error) {
+	if enc, err := tr.TryGet(entry.Address[:]); err != nil {
+		return nil, err
+	} else if len(enc) > 0 {
+		return nil, fmt.Errorf("account %x appears twice", *entry.Address)
+	}
+	acc := &importAccount{entry: entry, data: Account{Nonce: entry.Nonce, Balance: new(big.Int), CodeHash: emptyCodeHash}}
+	if entry.Balance != "" {
+		if _, ok := acc.data.Balance.SetString(entry.Balance, 10); !ok || acc.data.Balance.Sign() < 0 {
+			return nil, fmt.Errorf("invalid balance %q of %x", entry.Balance, *entry.Address)
+		}
+	}
+	if len(entry.Code) > 0 {
+		acc.data.CodeHash = crypto.Keccak256(entry.Code)
+		db.TrieDB().InsertBlob(common.BytesToHash(acc.data.CodeHash), entry.Code)
+	}
+	if entry.CodeHash != nil && *entry.CodeHash != common.BytesToHash(acc.data.CodeHash) {
+		return nil, fmt.Errorf("code hash of %x differs", *entry.Address)
+	}
+	var err error
+	acc.storage, err = db.OpenStorageTrie(crypto.Keccak256Hash(entry.Address[:]), common.Hash{})
+	return acc, err
+}
+
+// importFlush commits the storage of the account and writes the account to
+// the account trie tr. The storage roots and code hashes in pending are
+// written to disk together once the trie database grows too large.
+func importFlush(db Database, tr Trie, acc *importAccount, pending *[]common.Hash) error {
+	if acc == nil {
+		return nil
+	}
+	root, err := acc.storage.Commit(nil)
+	if err != nil {
+		return err
+	}
+	if acc.entry.Root != nil && *acc.entry.Root == (common.Hash{}) && root == emptyRoot {
+		//存储从未打开过的账户根为零值,原样保留以重建相同的账户
+		root = common.Hash{}
+	}
+	if acc.entry.Root != nil && *acc.entry.Root != root {
+		return fmt.Errorf("dump: storage root of %x differs", *acc.entry.Address)
+	}
+	acc.data.Root = root
+	enc, err := rlp.EncodeToBytes(&acc.data)
+	if err != nil {
+		return err
+	}
+	if err := tr.TryUpdate(acc.entry.Address[:], enc); err != nil {
+		return err
+	}
+	if root != emptyRoot && root != (common.Hash{}) {
+		*pending = append(*pending, root)
+	}
+	if code := common.BytesToHash(acc.data.CodeHash); code != emptyCode {
+		*pending = append(*pending, code)
+	}
+	//账户多的导入分批落盘,账户树本身在最后提交
+	if db.TrieDB().Size() > importFlushSize {
+		for _, hash := range *pending {
+			if err := db.TrieDB().Commit(hash, false); err != nil {
+				return err
+			}
+		}
+		*pending = (*pending)[:0]
+	}
+	return nil
+}
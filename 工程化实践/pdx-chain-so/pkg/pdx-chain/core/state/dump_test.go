@@ -0,0 +1,145 @@
+package state_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/ethdb/memorydb"
+)
+
+func TestDumpImport(t *testing.T) {
+	diskdb := memorydb.New()
+	db := state.NewDatabase(diskdb)
+	st, _ := state.New(common.Hash{}, db)
+	accounts := testAccounts()
+	for _, acc := range accounts {
+		writeAccount(st, acc)
+	}
+	root, err := st.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var dump bytes.Buffer
+	if err := state.Dump(state.NewDatabase(diskdb), root, &dump); err != nil {
+		t.Fatalf("dump error: %v", err)
+	}
+	// 1 state root, 3 accounts, 1 SetState and 2*50 PDX storage entries
+	if lines := strings.Count(dump.String(), "\n"); lines != 1+3+1+100 {
+		t.Errorf("dump has %d lines, want %d", lines, 1+3+1+100)
+	}
+
+	imported := memorydb.New()
+	got, err := state.Import(state.NewDatabase(imported), bytes.NewReader(dump.Bytes()))
+	if err != nil {
+		t.Fatalf("import error: %v", err)
+	}
+	if got != root {
+		t.Fatalf("imported root %x, want %x", got, root)
+	}
+	checkAccounts(t, testChain{imported}, root, accounts)
+
+	var again bytes.Buffer
+	if err := state.Dump(state.NewDatabase(imported), root, &again); err != nil {
+		t.Fatalf("dump of the imported state: %v", err)
+	}
+	if !bytes.Equal(dump.Bytes(), again.Bytes()) {
+		t.Errorf("dump of the imported state differs:\n%s\nwant:\n%s", again.Bytes(), dump.Bytes())
+	}
+
+	// A changed value no longer matches the roots of the dump.
+	changed := strings.Replace(dump.String(), `"value":"0x76616c7565203`, `"value":"0x76616c7565213`, 1)
+	if changed == dump.String() {
+		t.Fatal("no PDX storage value to change in the dump")
+	}
+	if _, err := state.Import(state.NewDatabase(memorydb.New()), strings.NewReader(changed)); err == nil {
+		t.Error("import of a changed dump succeeded")
+	}
+	// So does a changed root.
+	lines := strings.SplitN(dump.String(), "\n", 2)
+	changed = `{"stateRoot":"` + crypto.Keccak256Hash([]byte("root")).Hex() + `"}` + "\n" + lines[1]
+	if _, err := state.Import(state.NewDatabase(memorydb.New()), strings.NewReader(changed)); !errors.Is(err, state.ErrDumpRootMismatch) {
+		t.Errorf("import with another state root = %v, want %v", err, state.ErrDumpRootMismatch)
+	}
+}
+
+// Tests that a dump written by hand, without the roots and code hashes,
+// imports to the state written through StateDB.
+func TestImportGenesis(t *testing.T) {
+	key1 := crypto.Keccak256Hash([]byte("key1"))
+	key2 := crypto.Keccak256Hash([]byte("key2"))
+	genesis := `{"address":"0x0000000000000000000000000000000000000001","nonce":3,"balance":"100"}
+{"address":"0x0000000000000000000000000000000000000002","code":"0x636f6465"}
+{"address":"0x0000000000000000000000000000000000000002","key":"` + key1.Hex() + `","value":"0x76616c756531"}
+{"address":"0x0000000000000000000000000000000000000002","key":"` + key2.Hex() + `","value":"0x76616c756532"}
+`
+	accounts := []*testAccount{
+		{addr: common.HexToAddress("0x01"), nonce: 3, balance: 100},
+		{addr: common.HexToAddress("0x02"), code: []byte("code"), pdx: map[common.Hash][]byte{
+			key1: []byte("value1"),
+			key2: []byte("value2"),
+		}},
+	}
+	diskdb := memorydb.New()
+	root, err := state.Import(state.NewDatabase(diskdb), strings.NewReader(genesis))
+	if err != nil {
+		t.Fatalf("import error: %v", err)
+	}
+	checkAccounts(t, testChain{diskdb}, root, accounts)
+
+	st, _ := state.New(common.Hash{}, state.NewDatabase(memorydb.New()))
+	for _, acc := range accounts {
+		writeAccount(st, acc)
+	}
+	if want := st.IntermediateRoot(false); root != want {
+		t.Errorf("imported root %x, want %x", root, want)
+	}
+
+	// The empty dump imports to the empty state.
+	root, err = state.Import(state.NewDatabase(memorydb.New()), strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("import of the empty dump: %v", err)
+	}
+	if empty, _ := state.New(common.Hash{}, state.NewDatabase(memorydb.New())); root != empty.IntermediateRoot(false) {
+		t.Errorf("empty dump imported to %x", root)
+	}
+}
+
+func TestImportIllegal(t *testing.T) {
+	const (
+		account1 = `{"address":"0x0000000000000000000000000000000000000001","balance":"1"}` + "\n"
+		account2 = `{"address":"0x0000000000000000000000000000000000000002","balance":"2"}` + "\n"
+		storage1 = `{"address":"0x0000000000000000000000000000000000000001","key":"0x0000000000000000000000000000000000000000000000000000000000000001","value":"0x01"}` + "\n"
+		root     = `{"stateRoot":"0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"}` + "\n"
+	)
+	tests := []struct {
+		name string
+		dump string
+		err  string
+	}{
+		{"storage after another account", account1 + account2 + storage1, "does not follow its account"},
+		{"storage before its account", storage1 + account1, "does not follow its account"},
+		{"account twice in a row", account1 + account1, "appears twice"},
+		{"account twice", account1 + account2 + account1, "appears twice"},
+		{"state root after an account", account1 + root, "state root after the first line"},
+		{"negative balance", `{"address":"0x0000000000000000000000000000000000000001","balance":"-1"}`, "invalid balance"},
+		{"code hash differs", `{"address":"0x0000000000000000000000000000000000000001","code":"0x01","codeHash":"0x0000000000000000000000000000000000000000000000000000000000000001"}`, "code hash"},
+		{"storage root differs", `{"address":"0x0000000000000000000000000000000000000001","root":"0x0000000000000000000000000000000000000000000000000000000000000001"}`, "storage root"},
+		{"neither root nor account", `{"nonce":1}`, "neither a state root nor an account"},
+		{"not json", `{"address"`, "dump entry 1"},
+	}
+	for _, tt := range tests {
+		_, err := state.Import(state.NewDatabase(memorydb.New()), strings.NewReader(tt.dump))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: import error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
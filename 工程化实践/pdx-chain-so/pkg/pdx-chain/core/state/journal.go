@@ -216,6 +216,16 @@ func (ch refundChange) dirtied() *common.Address {
 	return nil
 }
 
+func (ch addLogChange) revert(s *StateDB) {
+	logs := s.logs[ch.txhash]
+	if len(logs) == 1 {
+		delete(s.logs, ch.txhash)
+	} else {
+		s.logs[ch.txhash] = logs[:len(logs)-1]
+	}
+	s.logSize--
+}
+
 func (ch addLogChange) dirtied() *common.Address {
 	return nil
 }
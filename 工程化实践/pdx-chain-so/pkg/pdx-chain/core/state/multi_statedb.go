@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"math/big"
 	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/types"
 
 	"pdx-chain-so/pkg/pdx-chain/rlp"
 	"sync"
@@ -30,12 +31,40 @@ import (
 var ErrMStateDBDeadLock = errors.New("deadlock occurred")
 
 
+// lockKey is what a transaction locks, an account or, with pdx set, a key of
+// the PDX storage of the account.
+//
+// The balance, nonce and code of an account and its existence are guarded by
+// the lock of the account, held exclusively. The PDX storage is guarded by
+// the locks of its keys, shared for reading and exclusive for writing, with
+// the lock of the account shared, so transactions using different keys of a
+// so, or only reading the same keys, run at the same time.
+type lockKey struct {
+	addr common.Address
+	key  common.Hash
+	pdx  bool
+}
+
+// txLock is a lock of the lock table of an MContext.
+type txLock struct {
+	owner   common.Hash              // 独占的交易
+	readers map[common.Hash]struct{} // 共享的交易
+}
+
+// lockWait is the lock a transaction waits for.
+type lockWait struct {
+	key       lockKey
+	exclusive bool
+}
+
 // MContext multi-goroutine execution context
 type MContext struct {
 	// Locked list by running Txs
-	lockedAccount map[common.Address]common.Hash   //add->交易hash
-	accountLock   map[common.Address]*sync.Mutex   //add->lock
-	txLockQueue   map[common.Hash][]common.Address //交易hash->有关的地址
+	locks    map[lockKey]*txLock
+	txLocks  map[common.Hash][]lockKey //交易hash->持有的锁
+	waiting  map[common.Hash]lockWait  //交易hash->等待的锁
+	lockCond *sync.Cond                //锁被释放时通知等待的交易
+	onLocks  func()                    //锁表变化时在mLock之外调用,见NotifyLockChanges
 	// can be executed and verified in order
 	executedTxs []common.Hash
 
@@ -48,6 +77,10 @@ type MContext struct {
 
 	// lock StateDB Trie
 	trieLock sync.RWMutex
+
+	// guards the PDX storage of the state objects, which transactions holding
+	// different keys of the same account use at the same time
+	storageLock sync.Mutex
 }
 
 // MStateDB multi-goroutine executable StateDB
@@ -63,11 +96,12 @@ func NewMStateDB(st *StateDB, num int) ([]*MStateDB, error) {
 	}
 
 	mctx := &MContext{
-		lockedAccount: make(map[common.Address]common.Hash),
-		accountLock:   make(map[common.Address]*sync.Mutex),
-		txLockQueue:   make(map[common.Hash][]common.Address),
-		stateObjects:  make(map[common.Address]*stateObject),
+		locks:        make(map[lockKey]*txLock),
+		txLocks:      make(map[common.Hash][]lockKey),
+		waiting:      make(map[common.Hash]lockWait),
+		stateObjects: make(map[common.Address]*stateObject),
 	}
+	mctx.lockCond = sync.NewCond(&mctx.mLock)
 
 	var mdb []*MStateDB
 	for i := 0; i < num; i++ {
@@ -76,6 +110,7 @@ func NewMStateDB(st *StateDB, num int) ([]*MStateDB, error) {
 			trie:              st.trie,
 			stateObjects:      make(map[common.Address]*stateObject),
 			stateObjectsDirty: make(map[common.Address]struct{}),
+			logs:              make(map[common.Hash][]*types.Log),
 			preimages:         make(map[common.Hash][]byte),
 			journal:           newJournal(),
 		},
@@ -90,6 +125,21 @@ func (self *MStateDB) DB() *StateDB {
 	return self.stdb
 }
 
+// AddLog records an event emitted by the current transaction.
+func (self *MStateDB) AddLog(log *types.Log) {
+	self.stdb.AddLog(log)
+}
+
+// GetLogs returns the events emitted by the transaction with the given hash.
+func (self *MStateDB) GetLogs(hash common.Hash) []*types.Log {
+	return self.stdb.GetLogs(hash)
+}
+
+// Logs returns the events emitted by all transactions.
+func (self *MStateDB) Logs() []*types.Log {
+	return self.stdb.Logs()
+}
+
 // AddPreimage records a SHA3 preimage seen by the VM.
 func (self *MStateDB) AddPreimage(hash common.Hash, preimage []byte) {
 	self.stdb.AddPreimage(hash, preimage)
@@ -119,123 +169,183 @@ func (self *MStateDB) Empty(addr common.Address) bool {
 	return so == nil || so.empty()
 }
 
-// example: tx1: A -> B(locked) -> C(locking)
-//          tx2: X -> C(locked) -> B/D(locking)
-//          tx3: D -> B(locking)
-// txLockQueue[tx1]: A B C
-//            [tx2]: X C B/D
-//            [tx3]: D B
-// lockedAccount[A]: tx1
-//              [B]: tx1
-//              [C]: tx2
-//              [D]: tx3
-//              [X]: tx2
-func (self *MStateDB) _checkDeadLock(lockingAddr common.Address, lockQueue []common.Address, addr common.Address) bool {
-	tx := self.ctx.lockedAccount[lockingAddr]
-	for tx != self.ctx.lockedAccount[addr] {
-
-		for _, acc := range lockQueue {
-			if acc == lockingAddr {
-				return true
+func (self *MStateDB) requestAndLock(addr common.Address) {
+	self.lock(lockKey{addr: addr}, true)
+}
+
+// requestAndLockKey locks the key of the PDX storage of addr, exclusively
+// for writing it, and shares the lock of the account.
+func (self *MStateDB) requestAndLockKey(addr common.Address, key common.Hash, exclusive bool) {
+	self.lock(lockKey{addr: addr}, false)
+	self.lock(lockKey{addr: addr, key: key, pdx: true}, exclusive)
+}
+
+// lock takes the lock k for the current transaction, waiting until the
+// transactions holding it release it. A shared lock held by the transaction
+// alone is turned into an exclusive one. If waiting would close a cycle of
+// waiting transactions it panics with ErrMStateDBDeadLock instead, the
+// transaction must then be rolled back and release its locks.
+func (self *MStateDB) lock(k lockKey, exclusive bool) {
+	tx := self.stdb.thash
+	var notify func()
+	defer func() {
+		if notify != nil {
+			notify()
+		}
+	}()
+	self.ctx.mLock.Lock()
+	defer self.ctx.mLock.Unlock()
+
+	l := self.ctx.locks[k]
+	if l == nil {
+		l = &txLock{readers: make(map[common.Hash]struct{})}
+		self.ctx.locks[k] = l
+	}
+	_, shared := l.readers[tx]
+	if l.owner == tx || (shared && !exclusive) {
+		//当前交易已持有该锁
+		return
+	}
+	for blockers := self.ctx.blockers(k, tx, exclusive); len(blockers) > 0; blockers = self.ctx.blockers(k, tx, exclusive) {
+		if self.ctx.reaches(blockers, tx) {
+			//等待会形成环,死锁 返回panic
+			if _, ok := self.ctx.waiting[tx]; ok {
+				delete(self.ctx.waiting, tx)
+				self.ctx.lockCond.Broadcast()
 			}
+			panic(ErrMStateDBDeadLock)
 		}
-		//tx1[len(tx1)-1]
-		addr = lockingAddr
-		tx = self.ctx.lockedAccount[lockingAddr]
-		txQueue := self.ctx.txLockQueue[tx]
-		if len(txQueue) > 1 {
-			lockingAddr = txQueue[len(txQueue)-1]
-		} else {
-			return false
+		if _, ok := self.ctx.waiting[tx]; !ok {
+			self.ctx.waiting[tx] = lockWait{key: k, exclusive: exclusive}
+			if fn := self.ctx.onLocks; fn != nil {
+				//通知期间锁表可能已变化,重新检查后再等待
+				self.ctx.mLock.Unlock()
+				fn()
+				self.ctx.mLock.Lock()
+				continue
+			}
 		}
+		self.ctx.lockCond.Wait()
+	}
+	delete(self.ctx.waiting, tx)
+	if len(self.ctx.waiting) > 0 {
+		//等待中的交易可能因此改为等待当前交易
+		notify = self.ctx.onLocks
 	}
 
-	return false
+	if !shared {
+		self.ctx.txLocks[tx] = append(self.ctx.txLocks[tx], k)
+	}
+	if exclusive {
+		delete(l.readers, tx)
+		l.owner = tx
+	} else {
+		l.readers[tx] = struct{}{}
+	}
 }
 
-func (self *MStateDB) requestAndLock(addr common.Address) {
-	//not locked by tx, lock it
-	self.ctx.mLock.Lock()
+// blockers returns the transactions tx waits for to take the lock k. A
+// shared lock also waits for the transactions waiting to take it exclusively,
+// which would otherwise wait for ever behind the transactions sharing it.
+// called with mLock held
+func (ctx *MContext) blockers(k lockKey, tx common.Hash, exclusive bool) []common.Hash {
+	l := ctx.locks[k]
+	var txs []common.Hash
+	if l.owner != (common.Hash{}) && l.owner != tx {
+		txs = append(txs, l.owner)
+	}
+	if exclusive {
+		for r := range l.readers {
+			if r != tx {
+				txs = append(txs, r)
+			}
+		}
+		return txs
+	}
+	for w, wait := range ctx.waiting {
+		if w != tx && wait.key == k && wait.exclusive {
+			txs = append(txs, w)
+		}
+	}
+	return txs
+}
 
-	if self.ctx.lockedAccount[addr] == self.stdb.thash {
-		//对应的相同的交易,直接返回
-		// this tx holds the account lock, so just return
-		self.ctx.mLock.Unlock()
-		return
+// reaches reports whether one of the transactions from is tx or waits for
+// it, directly or behind other waiting transactions.
+// called with mLock held
+func (ctx *MContext) reaches(from []common.Hash, tx common.Hash) bool {
+	seen := make(map[common.Hash]bool)
+	for len(from) > 0 {
+		h := from[len(from)-1]
+		from = from[:len(from)-1]
+		if h == tx {
+			return true
+		}
+		if seen[h] {
+			continue
+		}
+		seen[h] = true
+		if w, ok := ctx.waiting[h]; ok {
+			from = append(from, ctx.blockers(w.key, h, w.exclusive)...)
+		}
+	}
+	return false
+}
 
-	} else if (self.ctx.lockedAccount[addr] == common.Hash{}) {
-		//没有对应的交易,进行加锁
-		// account is unlocked, lock it
-		self.ctx.lockedAccount[addr] = self.stdb.thash
-		aLock := &sync.Mutex{}
-		aLock.Lock()
-		//log.Info("lockedaccount", "addr", addr, "lock", aLock)
-		self.ctx.accountLock[addr] = aLock
-		//当前交易加入要使用的地址
-		self.ctx.txLockQueue[self.stdb.thash] = append(self.ctx.txLockQueue[self.stdb.thash], addr)
-		self.ctx.mLock.Unlock()
+// BlockedTxs returns the transactions waiting for an account or key locked
+// by the current transaction, directly or behind other waiting transactions.
+func (self *MStateDB) BlockedTxs() []common.Hash {
+	self.ctx.mLock.Lock()
+	defer self.ctx.mLock.Unlock()
 
-	} else {
-		//对应的不上当前交易,检查有没有死锁
-		// account locked by other tx(goroutine)
-		// check whether deadlock occurs after locking
-		tx1 := self.ctx.lockedAccount[addr]             //当前地址对应的交易
-		tx1_LQ := self.ctx.txLockQueue[tx1]             //当前地址对应的交易对应的地址
-		tx2_LQ := self.ctx.txLockQueue[self.stdb.thash] //执行交易对应的地址
-		if len(tx1_LQ) > 1 && len(tx2_LQ) > 0 && self._checkDeadLock(tx1_LQ[len(tx1_LQ)-1], tx2_LQ, addr) {
-			//死锁 返回panic
-			self.ctx.mLock.Unlock()
-			//log.Debug("deadlock occurred:", "lockedAccount", self.ctx.lockedAccount, "txLockQueue", self.ctx.txLockQueue)
-			panic(ErrMStateDBDeadLock)
-		} else {
-			//没有死锁
-			//当前交易加入要使用的地址
-			self.ctx.txLockQueue[self.stdb.thash] = append(self.ctx.txLockQueue[self.stdb.thash], addr)
-			//取出地址对应锁进行加锁
-			aLock := self.ctx.accountLock[addr]
-			self.ctx.mLock.Unlock()
-			// locking
-			aLock.Lock()
-			self.ctx.mLock.Lock()
-			//当前地址对应当前执行交易
-			self.ctx.lockedAccount[addr] = self.stdb.thash
-
-			//if tx1 == self.ctx.lockedAccount[addr] {
-			//	self.ctx.lockedAccount[addr] = self.stdb.thash
-			//} else {
-			//	//deadlock???
-			//	log.Info("maybe deadlock", "thash:", self.ctx.lockedAccount[addr])
-			//}
-			//self.ctx.lockedAccount[addr] = self.stdb.thash
-			self.ctx.mLock.Unlock()
+	var blocked []common.Hash
+	for tx, w := range self.ctx.waiting {
+		if tx != self.stdb.thash && self.ctx.reaches(self.ctx.blockers(w.key, tx, w.exclusive), self.stdb.thash) {
+			blocked = append(blocked, tx)
 		}
 	}
+	return blocked
+}
+
+// NotifyLockChanges makes the views created together with self call fn
+// whenever a transaction starts waiting for a lock, takes a lock other
+// transactions wait for, or releases its locks, so a scheduler waiting on
+// BlockedTxs can check it again. fn is called without the locks of the
+// views held, a nil fn stops the notifications.
+func (self *MStateDB) NotifyLockChanges(fn func()) {
+	self.ctx.mLock.Lock()
+	defer self.ctx.mLock.Unlock()
+	self.ctx.onLocks = fn
 }
 
 func (self *MStateDB) UnLockAccounts(addTx bool) {
 	self.ctx.mLock.Lock()
+	notify := self.ctx.onLocks
+	defer func() {
+		if notify != nil {
+			notify()
+		}
+	}()
+	defer self.ctx.mLock.Unlock()
 
-	accounts := self.ctx.txLockQueue[self.stdb.thash]
+	tx := self.stdb.thash
 	if addTx {
 		// 之所以这样改，因为打块执行交易是并行，在多桶并行时，原来的累积顺序CumulativeGasUsed与交易执行顺序executedTxs可能不一致，
 		// 所以放到此处，用来保证累积CumulativeGasUsed的值与交易的执行顺序executedTxs是一致的（此处用到了全局锁）。
 		// 此处修改废弃，统一到所有交易执行完成后，进行累加
 		//*CumulativeGasUsed += gas
 		//receipt.CumulativeGasUsed = *CumulativeGasUsed
-		self.ctx.executedTxs = append(self.ctx.executedTxs, self.stdb.thash)
+		self.ctx.executedTxs = append(self.ctx.executedTxs, tx)
 	}
-	var accountLocks []*sync.Mutex
-	for _, acc := range accounts {
-		al := self.ctx.accountLock[acc]
-		accountLocks = append(accountLocks, al)
-		//delete(self.ctx.accountLock, acc)
-	}
-	delete(self.ctx.txLockQueue, self.stdb.thash)
-	self.ctx.mLock.Unlock()
-
-	for _, al := range accountLocks {
-		al.Unlock()
+	for _, k := range self.ctx.txLocks[tx] {
+		l := self.ctx.locks[k]
+		if l.owner == tx {
+			l.owner = common.Hash{}
+		}
+		delete(l.readers, tx)
 	}
+	delete(self.ctx.txLocks, tx)
+	self.ctx.lockCond.Broadcast()
 }
 
 func (self *MStateDB) GetTxs() []common.Hash {
@@ -307,10 +417,15 @@ func (self *MStateDB) GetState(addr common.Address, bhash common.Hash) common.Ha
 	return common.Hash{}
 }
 
+// GetPDXState returns the value of key b in the PDX storage of a. It shares
+// the lock of the key, other transactions may read it or use the other keys
+// of a meanwhile.
 func (self *MStateDB) GetPDXState(a common.Address, b common.Hash) []byte {
-	self.requestAndLock(a)
-	stateObject := self.getStateObject(a)
+	self.requestAndLockKey(a, b, false)
+	stateObject := self.lookupStateObject(a)
 	if stateObject != nil {
+		self.ctx.storageLock.Lock()
+		defer self.ctx.storageLock.Unlock()
 		return stateObject.GetPDXState(self.stdb.db, b)
 	}
 	return []byte{}
@@ -384,11 +499,24 @@ func (self *MStateDB) SetState(addr common.Address, key, value common.Hash) {
 	}
 }
 
+// SetPDXState sets the value of key in the PDX storage of addr. It locks the
+// key exclusively and shares the lock of the account, unless the account does
+// not exist yet and is created under the exclusive lock of the account.
 func (self *MStateDB) SetPDXState(addr common.Address, key common.Hash, value []byte) {
-	stateObject := self.GetOrNewStateObject(addr)
-	if stateObject != nil {
-		stateObject.SetPDXState(self.stdb.db, key, value)
-	}
+	self.requestAndLockKey(addr, key, true)
+	stateObject := self.lookupStateObject(addr)
+	if stateObject == nil {
+		stateObject = self.GetOrNewStateObject(addr)
+	}
+	self.ctx.storageLock.Lock()
+	defer self.ctx.storageLock.Unlock()
+	//对象由持有其他key的交易共用,修改记入本视图的journal而不是stateObject.db的
+	self.stdb.journal.append(pdxStorageChange{
+		account:  &stateObject.address,
+		key:      key,
+		prevalue: stateObject.GetPDXState(self.stdb.db, key),
+	})
+	stateObject.setPDXState(key, value)
 }
 
 // Suicide marks the given account as suicided.
@@ -442,8 +570,19 @@ func (self *MStateDB) deleteStateObject(stateObject *stateObject) {
 
 // Retrieve a state object given by the address. Returns nil if not found.
 func (self *MStateDB) getStateObject(addr common.Address) (stateObject *stateObject) {
-	if obj := self.stdb.stateObjects[addr]; obj != nil {
+	obj := self.lookupStateObject(addr)
+	if obj != nil {
+		//持有账户锁,对象的修改记入本视图
 		obj.db = self.stdb
+	}
+	return obj
+}
+
+// lookupStateObject is getStateObject for the access to the PDX storage
+// under the lock of a key. It leaves the db of the object alone, which the
+// holder of the lock of the account may be using.
+func (self *MStateDB) lookupStateObject(addr common.Address) *stateObject {
+	if obj := self.stdb.stateObjects[addr]; obj != nil {
 		if obj.deleted {
 			return nil
 		}
@@ -454,7 +593,6 @@ func (self *MStateDB) getStateObject(addr common.Address) (stateObject *stateObj
 	self.ctx.stLock.RLock()
 	if obj := self.ctx.stateObjects[addr]; obj != nil {
 		self.stdb.stateObjects[addr] = obj
-		obj.db = self.stdb
 		if obj.deleted {
 			self.ctx.stLock.RUnlock()
 			return nil
@@ -479,8 +617,18 @@ func (self *MStateDB) getStateObject(addr common.Address) (stateObject *stateObj
 	}
 	// Insert into the live set.
 	obj := newObject(self.stdb, addr, data)
+	self.ctx.stLock.Lock()
+	if cur := self.ctx.stateObjects[addr]; cur != nil {
+		//持有不同key的交易同时加载了账户,使用先加入的对象
+		obj = cur
+	} else {
+		self.ctx.stateObjects[addr] = obj
+	}
+	self.ctx.stLock.Unlock()
 	self.stdb.setStateObject(obj)
-	self.setStateObject(obj)
+	if obj.deleted {
+		return nil
+	}
 	return obj
 }
 
@@ -541,8 +689,29 @@ func (self *MStateDB) Snapshot() int {
 }
 
 // RevertToSnapshot reverts all state changes made since the given revision.
+// The accounts created or reset since are also restored in the state
+// objects shared by the goroutines.
 func (self *MStateDB) RevertToSnapshot(revid int) {
+	var changes []journalEntry
+	for _, rev := range self.stdb.validRevisions {
+		if rev.id == revid {
+			changes = self.stdb.journal.entries[rev.journalIndex:]
+			break
+		}
+	}
+	self.ctx.stLock.Lock()
+	for i := len(changes) - 1; i >= 0; i-- {
+		switch ch := changes[i].(type) {
+		case createObjectChange:
+			delete(self.ctx.stateObjects, *ch.account)
+		case resetObjectChange:
+			self.ctx.stateObjects[ch.prev.Address()] = ch.prev
+		}
+	}
+	self.ctx.stLock.Unlock()
+	self.ctx.storageLock.Lock()
 	self.stdb.RevertToSnapshot(revid)
+	self.ctx.storageLock.Unlock()
 }
 
 // GetRefund returns the current value of the refund counter.
@@ -586,8 +755,81 @@ func (s *MStateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	return s.stdb.trie.Hash()
 }
 
+// IntermediateRootOf finalises the views created together by NewMStateDB
+// and returns the root hash of the state trie they share.
+func IntermediateRootOf(dbs []*MStateDB, deleteEmptyObjects bool) common.Hash {
+	for _, db := range dbs {
+		db.Finalise(deleteEmptyObjects)
+	}
+	return dbs[0].stdb.trie.Hash()
+}
+
+// Commit finalises the view and writes the state objects shared by the
+// views to the trie database, the other views must have been finalised
+// before. CommitOf does both for all the views.
+func (s *MStateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
+	s.Finalise(deleteEmptyObjects)
+
+	s.ctx.stLock.RLock()
+	defer s.ctx.stLock.RUnlock()
+	//账户对象由各goroutine共享,在这里统一提交
+	for _, stateObject := range s.ctx.stateObjects {
+		if stateObject.deleted {
+			continue
+		}
+		if stateObject.code != nil && stateObject.dirtyCode {
+			s.stdb.db.TrieDB().InsertBlob(common.BytesToHash(stateObject.CodeHash()), stateObject.code)
+			stateObject.dirtyCode = false
+		}
+		if stateObject.trie == nil {
+			//存储没有被读写过
+			continue
+		}
+		if err := stateObject.CommitTrie(s.stdb.db); err != nil {
+			return common.Hash{}, err
+		}
+		s.updateStateObject(stateObject)
+	}
+	for addr := range s.stdb.stateObjectsDirty {
+		delete(s.stdb.stateObjectsDirty, addr)
+	}
+	if s.stdb.dbErr != nil {
+		return common.Hash{}, s.stdb.dbErr
+	}
+	s.ctx.trieLock.Lock()
+	defer s.ctx.trieLock.Unlock()
+	return s.stdb.trie.Commit(referenceAccount(s.stdb.db))
+}
+
+// CommitOf finalises the views created together by NewMStateDB and writes
+// the state they share to the trie database.
+func CommitOf(dbs []*MStateDB, deleteEmptyObjects bool) (common.Hash, error) {
+	for _, db := range dbs[1:] {
+		db.Finalise(deleteEmptyObjects)
+		if err := db.stdb.Error(); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	return dbs[0].Commit(deleteEmptyObjects)
+}
+
 // Prepare sets the current transaction hash and index and block hash which is
 // used when the EVM emits new state logs.
 func (self *MStateDB) Prepare(thash, bhash common.Hash, ti int) {
 	self.stdb.Prepare(thash, bhash, ti)
 }
+
+// TxHash returns the hash of the transaction set by the last Prepare call.
+func (self *MStateDB) TxHash() common.Hash {
+	return self.stdb.TxHash()
+}
+
+// TxIndex returns the index of the transaction set by the last Prepare call.
+func (self *MStateDB) TxIndex() int {
+	return self.stdb.TxIndex()
+}
+
+// BlockHash returns the block hash set by the last Prepare call.
+func (self *MStateDB) BlockHash() common.Hash {
+	return self.stdb.BlockHash()
+}
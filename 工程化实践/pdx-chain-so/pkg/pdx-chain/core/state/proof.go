@@ -0,0 +1,125 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/ethdb/memorydb"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+	"pdx-chain-so/pkg/pdx-chain/trie"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	ErrPDXProofMismatch = errors.New("pdx proof: proven value differs")
+	ErrPDXProofMissing  = errors.New("pdx proof: no proof")
+)
+
+// PDXProof proves a value of the PDX storage of an account against a state
+// root. Account holds the nodes of the account trie on the path to the
+// address, Storage those of the storage trie of the account on the path to
+// the key, it is empty when the account does not exist.
+type PDXProof struct {
+	Account [][]byte
+	Storage [][]byte
+}
+
+// proofList collects the nodes written by Trie.Prove.
+type proofList [][]byte
+
+func (n *proofList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
+func (n *proofList) Delete(key []byte) error {
+	panic("not supported")
+}
+
+// GetProof returns the Merkle proof for a given account.
+func (self *StateDB) GetProof(a common.Address) ([][]byte, error) {
+	var proof proofList
+	err := self.trie.Prove(crypto.Keccak256(a.Bytes()), 0, &proof)
+	return [][]byte(proof), err
+}
+
+// GetStorageProof returns the storage proof for a given key.
+func (self *StateDB) GetStorageProof(a common.Address, key common.Hash) ([][]byte, error) {
+	var proof proofList
+	trie := self.StorageTrie(a)
+	if trie == nil {
+		return proof, errors.New("storage trie for requested address does not exist")
+	}
+	err := trie.Prove(crypto.Keccak256(key.Bytes()), 0, &proof)
+	return [][]byte(proof), err
+}
+
+// GetPDXProof returns the proof of the PDX storage value of key in the
+// account of addr. It proves the root of the state as of the last Commit or
+// IntermediateRoot, for a state opened by StateAt the Root of the header.
+func (self *StateDB) GetPDXProof(addr common.Address, key common.Hash) (*PDXProof, error) {
+	account, err := self.GetProof(addr)
+	if err != nil {
+		return nil, err
+	}
+	proof := &PDXProof{Account: account}
+	if !self.Exist(addr) {
+		//账户不存在,账户证明即可证明值为空
+		return proof, nil
+	}
+	if proof.Storage, err = self.GetStorageProof(addr, key); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// VerifyPDXProof checks that proof proves value as the PDX storage value of
+// key in the account of addr in the state with the given root. An empty
+// value is proven by the absence of the key or of the account.
+func VerifyPDXProof(root common.Hash, addr common.Address, key common.Hash, value []byte, proof *PDXProof) error {
+	if proof == nil {
+		return ErrPDXProofMissing
+	}
+	enc, err := verifyProof(root, crypto.Keccak256(addr.Bytes()), proof.Account)
+	if err != nil {
+		return err
+	}
+	var stored []byte
+	if len(enc) > 0 {
+		var data Account
+		if err := rlp.DecodeBytes(enc, &data); err != nil {
+			return err
+		}
+		stored, err = verifyProof(data.Root, crypto.Keccak256(key.Bytes()), proof.Storage)
+		if err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(stored, value) && (len(stored) != 0 || len(value) != 0) {
+		return ErrPDXProofMismatch
+	}
+	return nil
+}
+
+// verifyProof returns the value of key proven by nodes in the trie with the
+// given root. An empty trie has no nodes, nor has the storage trie of an
+// account whose storage was never opened, its root is zero.
+func verifyProof(root common.Hash, key []byte, nodes [][]byte) ([]byte, error) {
+	if root == emptyRoot || root == (common.Hash{}) {
+		return nil, nil
+	}
+	return trie.VerifyProof(root, key, proofNodes(nodes))
+}
+
+// proofNodes returns a database of the nodes by their hash.
+func proofNodes(nodes [][]byte) *memorydb.Database {
+	db := memorydb.New()
+	for _, n := range nodes {
+		db.Put(crypto.Keccak256(n), n)
+	}
+	return db
+}
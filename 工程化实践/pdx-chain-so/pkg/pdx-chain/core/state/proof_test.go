@@ -0,0 +1,151 @@
+package state_test
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/ethdb/memorydb"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+	"pdx-chain-so/pkg/pdx-chain/trie"
+)
+
+// proofNodes collects the nodes written by Prove.
+type proofNodes [][]byte
+
+func (n *proofNodes) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
+func (n *proofNodes) Delete(key []byte) error {
+	panic("not supported")
+}
+
+// newProofState commits the test accounts and reopens their state the way a
+// node serving proofs does.
+func newProofState(t *testing.T) (*state.StateDB, common.Hash, []*testAccount) {
+	t.Helper()
+	diskdb := memorydb.New()
+	db := state.NewDatabase(diskdb)
+	st, _ := state.New(common.Hash{}, db)
+	accounts := testAccounts()
+	for _, acc := range accounts {
+		writeAccount(st, acc)
+	}
+	root, err := st.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		t.Fatal(err)
+	}
+	st, err = testChain{diskdb}.StateAt(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st, root, accounts
+}
+
+func TestPDXProof(t *testing.T) {
+	st, root, accounts := newProofState(t)
+	contract := accounts[2].addr
+	key := crypto.Keccak256Hash([]byte("key7"))
+	missing := crypto.Keccak256Hash([]byte("missing"))
+
+	tests := []struct {
+		name  string
+		addr  common.Address
+		key   common.Hash
+		value []byte
+	}{
+		{"existing key", contract, key, []byte("value 7")},
+		{"missing key", contract, missing, nil},
+		{"missing account", common.HexToAddress("0xdead"), key, nil},
+		{"account without storage", accounts[0].addr, key, nil},
+	}
+	for _, tt := range tests {
+		proof, err := st.GetPDXProof(tt.addr, tt.key)
+		if err != nil {
+			t.Fatalf("%s: proof error: %v", tt.name, err)
+		}
+		if err := state.VerifyPDXProof(root, tt.addr, tt.key, tt.value, proof); err != nil {
+			t.Errorf("%s: proof of %q does not verify: %v", tt.name, tt.value, err)
+		}
+		if err := state.VerifyPDXProof(root, tt.addr, tt.key, []byte("forged"), proof); err != state.ErrPDXProofMismatch {
+			t.Errorf("%s: proof of a forged value = %v, want %v", tt.name, err, state.ErrPDXProofMismatch)
+		}
+	}
+
+	// An account whose storage was never opened, as rebuilt by Import, has
+	// a zero storage root.
+	tr, _ := trie.NewSecure(common.Hash{}, trie.NewDatabase(memorydb.New()))
+	enc, _ := rlp.EncodeToBytes(&state.Account{Balance: big.NewInt(1), CodeHash: crypto.Keccak256(nil)})
+	tr.Update(contract[:], enc)
+	var nodes proofNodes
+	if err := tr.Prove(crypto.Keccak256(contract[:]), 0, &nodes); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.VerifyPDXProof(tr.Hash(), contract, key, nil, &state.PDXProof{Account: nodes}); err != nil {
+		t.Errorf("proof of the account with a zero storage root does not verify: %v", err)
+	}
+
+	// The proof of an empty value in the empty state has no nodes.
+	empty, _ := state.New(common.Hash{}, state.NewDatabase(memorydb.New()))
+	proof, err := empty.GetPDXProof(contract, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, root := range []common.Hash{empty.IntermediateRoot(false), {}} {
+		if err := state.VerifyPDXProof(root, contract, key, nil, proof); err != nil {
+			t.Errorf("proof against empty root %x does not verify: %v", root, err)
+		}
+	}
+}
+
+func TestPDXProofTampered(t *testing.T) {
+	st, root, accounts := newProofState(t)
+	contract := accounts[2].addr
+	key := crypto.Keccak256Hash([]byte("key7"))
+
+	if err := state.VerifyPDXProof(root, contract, key, []byte("value 7"), nil); !errors.Is(err, state.ErrPDXProofMissing) {
+		t.Errorf("nil proof = %v, want %v", err, state.ErrPDXProofMissing)
+	}
+	tamper := []struct {
+		name   string
+		change func(p *state.PDXProof)
+	}{
+		{"storage node changed", func(p *state.PDXProof) { p.Storage[len(p.Storage)-1][5]++ }},
+		{"account node changed", func(p *state.PDXProof) { p.Account[0][5]++ }},
+		{"storage proof dropped", func(p *state.PDXProof) { p.Storage = nil }},
+		{"account proof dropped", func(p *state.PDXProof) { p.Account = nil }},
+	}
+	for _, tt := range tamper {
+		proof, err := st.GetPDXProof(contract, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.change(proof)
+		if err := state.VerifyPDXProof(root, contract, key, []byte("value 7"), proof); err == nil {
+			t.Errorf("%s: tampered proof verified", tt.name)
+		}
+	}
+
+	// A valid proof of the key of another account does not prove the key of
+	// the contract.
+	other, err := st.GetPDXProof(accounts[1].addr, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.VerifyPDXProof(root, contract, key, []byte("value of the contract"), other); err == nil {
+		t.Error("proof of another account verified")
+	}
+	// Nor does it prove the key against another root.
+	proof, _ := st.GetPDXProof(contract, key)
+	if err := state.VerifyPDXProof(crypto.Keccak256Hash([]byte("root")), contract, key, []byte("value 7"), proof); err == nil {
+		t.Error("proof against another root verified")
+	}
+}
@@ -22,9 +22,11 @@ import (
 	"fmt"
 	"math/big"
 	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/types"
 	"pdx-chain-so/pkg/pdx-chain/crypto"
 	//"pdx-chain-so/pkg/pdx-chain/log"
 	"pdx-chain-so/pkg/pdx-chain/rlp"
+	"pdx-chain-so/pkg/pdx-chain/trie"
 	"runtime"
 	"sort"
 	"sync"
@@ -71,6 +73,7 @@ type StateDB struct {
 
 	thash, bhash common.Hash
 	txIndex      int
+	logs         map[common.Hash][]*types.Log
 	logSize      uint
 	preimages    map[common.Hash][]byte
 
@@ -94,6 +97,7 @@ func New(root common.Hash, db Database) (*StateDB, error) {
 		trie:              tr,
 		stateObjects:      make(map[common.Address]*stateObject),
 		stateObjectsDirty: make(map[common.Address]struct{}),
+		logs:              make(map[common.Hash][]*types.Log),
 		preimages:         make(map[common.Hash][]byte),
 		journal:           newJournal(),
 	}, nil
@@ -105,6 +109,7 @@ func NewCopy(state *StateDB) *StateDB {
 		trie:              state.trie,
 		stateObjects:      make(map[common.Address]*stateObject),
 		stateObjectsDirty: make(map[common.Address]struct{}),
+		logs:              make(map[common.Hash][]*types.Log),
 		preimages:         make(map[common.Hash][]byte),
 		journal:           newJournal(),
 	}
@@ -138,6 +143,34 @@ func (self *StateDB) Error() error {
 }
 
 
+// AddLog records an event emitted by the current transaction.
+func (self *StateDB) AddLog(log *types.Log) {
+	self.journal.append(addLogChange{txhash: self.thash})
+
+	log.TxHash = self.thash
+	log.BlockHash = self.bhash
+	log.TxIndex = uint(self.txIndex)
+	log.Index = self.logSize
+	self.logs[self.thash] = append(self.logs[self.thash], log)
+	self.logSize++
+}
+
+// GetLogs returns the events emitted by the transaction with the given hash.
+func (self *StateDB) GetLogs(hash common.Hash) []*types.Log {
+	return self.logs[hash]
+}
+
+// Logs returns the events emitted by all transactions, ordered by their
+// index in the block.
+func (self *StateDB) Logs() []*types.Log {
+	var logs []*types.Log
+	for _, lgs := range self.logs {
+		logs = append(logs, lgs...)
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Index < logs[j].Index })
+	return logs
+}
+
 // AddPreimage records a SHA3 preimage seen by the VM.
 func (self *StateDB) AddPreimage(hash common.Hash, preimage []byte) {
 	if _, ok := self.preimages[hash]; !ok {
@@ -491,6 +524,7 @@ func (self *StateDB) Copy() *StateDB {
 		stateObjects:      make(map[common.Address]*stateObject, len(self.journal.dirties)),
 		stateObjectsDirty: make(map[common.Address]struct{}, len(self.journal.dirties)),
 		refund:            self.refund,
+		logs:              make(map[common.Hash][]*types.Log, len(self.logs)),
 		logSize:           self.logSize,
 		preimages:         make(map[common.Hash][]byte),
 		journal:           newJournal(),
@@ -516,7 +550,14 @@ func (self *StateDB) Copy() *StateDB {
 		}
 	}
 
-
+	for hash, logs := range self.logs {
+		cpy := make([]*types.Log, len(logs))
+		for i, l := range logs {
+			cpy[i] = new(types.Log)
+			*cpy[i] = *l
+		}
+		state.logs[hash] = cpy
+	}
 	for hash, preimage := range self.preimages {
 		state.preimages[hash] = preimage
 	}
@@ -601,6 +642,71 @@ func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) common.Hash {
 	return h
 }
 
+// Commit writes the state to the trie database of the underlying Database
+// and returns the new root, from which the state can be opened again. The
+// nodes are written to disk by the Commit of TrieDB.
+func (s *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error) {
+	defer s.clearJournalAndRefund()
+
+	for addr := range s.journal.dirties {
+		s.stateObjectsDirty[addr] = struct{}{}
+	}
+	// Commit objects to the trie.
+	for addr, stateObject := range s.stateObjects {
+		_, isDirty := s.stateObjectsDirty[addr]
+		switch {
+		case stateObject.suicided || (isDirty && deleteEmptyObjects && stateObject.empty()):
+			// If the object has been removed, don't bother syncing it
+			// and just mark it for deletion in the trie.
+			s.deleteStateObject(stateObject)
+		case isDirty:
+			// Write any contract code associated with the state object
+			if stateObject.code != nil && stateObject.dirtyCode {
+				s.db.TrieDB().InsertBlob(common.BytesToHash(stateObject.CodeHash()), stateObject.code)
+				stateObject.dirtyCode = false
+			}
+			// Write any storage changes in the state object to its storage trie.
+			if err := stateObject.CommitTrie(s.db); err != nil {
+				return common.Hash{}, err
+			}
+			// Update the object in the main account trie.
+			s.updateStateObject(stateObject)
+		}
+		delete(s.stateObjectsDirty, addr)
+	}
+	//读取账户时的错误在这里返回
+	if s.dbErr != nil {
+		return common.Hash{}, s.dbErr
+	}
+	// Write trie changes.
+	return s.trie.Commit(referenceAccount(s.db))
+}
+
+// referenceAccount returns the callback committing an account trie with,
+// it references the storage trie and the code of every account leaf from
+// the node holding the leaf, so TrieDB commits them with the state. It is
+// nil for a Database without trie database.
+func referenceAccount(db Database) trie.LeafCallback {
+	triedb := db.TrieDB()
+	if triedb == nil {
+		return nil
+	}
+	return func(leaf []byte, parent common.Hash) error {
+		var account Account
+		if err := rlp.DecodeBytes(leaf, &account); err != nil {
+			return nil
+		}
+		if account.Root != emptyRoot && account.Root != (common.Hash{}) {
+			triedb.Reference(account.Root, parent)
+		}
+		code := common.BytesToHash(account.CodeHash)
+		if code != emptyCode {
+			triedb.Reference(code, parent)
+		}
+		return nil
+	}
+}
+
 // Prepare sets the current transaction hash and index and block hash which is
 // used when the EVM emits new state logs.
 func (self *StateDB) Prepare(thash, bhash common.Hash, ti int) {
@@ -609,6 +715,21 @@ func (self *StateDB) Prepare(thash, bhash common.Hash, ti int) {
 	self.txIndex = ti
 }
 
+// TxHash returns the hash of the transaction set by the last Prepare call.
+func (self *StateDB) TxHash() common.Hash {
+	return self.thash
+}
+
+// TxIndex returns the index of the transaction set by the last Prepare call.
+func (self *StateDB) TxIndex() int {
+	return self.txIndex
+}
+
+// BlockHash returns the block hash set by the last Prepare call.
+func (self *StateDB) BlockHash() common.Hash {
+	return self.bhash
+}
+
 func (s *StateDB) clearJournalAndRefund() {
 	s.journal = newJournal()
 	s.validRevisions = s.validRevisions[:0]
@@ -0,0 +1,217 @@
+package state_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/public"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/core/types"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/ethdb"
+	"pdx-chain-so/pkg/pdx-chain/ethdb/memorydb"
+)
+
+// testChain reopens the committed states of a disk database, every StateAt
+// starts from an empty trie cache so only what is on disk is read.
+type testChain struct {
+	diskdb ethdb.Database
+}
+
+var _ public.PublicBlockChain = testChain{}
+
+func (c testChain) GetBlockByNumber(number uint64) *types.Block { return nil }
+func (c testChain) GetCommitBlock(height uint64) *types.Block   { return nil }
+func (c testChain) State() (*state.StateDB, error)              { return c.StateAt(common.Hash{}) }
+
+func (c testChain) StateAt(root common.Hash) (*state.StateDB, error) {
+	return state.New(root, state.NewDatabase(c.diskdb))
+}
+
+// testAccount is the content of an account the tests write and compare.
+type testAccount struct {
+	addr    common.Address
+	nonce   uint64
+	balance int64
+	code    []byte
+	storage map[common.Hash]common.Hash
+	pdx     map[common.Hash][]byte
+}
+
+func testAccounts() []*testAccount {
+	accounts := []*testAccount{
+		{addr: common.HexToAddress("0x01"), nonce: 3, balance: 100},
+		{addr: common.HexToAddress("0x02"), nonce: 1, code: []byte("code of the contract"),
+			storage: map[common.Hash]common.Hash{common.HexToHash("0x01"): common.HexToHash("0xff")},
+			pdx:     make(map[common.Hash][]byte)},
+		{addr: common.HexToAddress("0x03"), pdx: make(map[common.Hash][]byte)},
+	}
+	for i := 0; i < 50; i++ {
+		key := crypto.Keccak256Hash([]byte(fmt.Sprintf("key%d", i)))
+		accounts[1].pdx[key] = []byte("value of the contract")
+		accounts[2].pdx[key] = []byte(fmt.Sprintf("value %d", i))
+	}
+	return accounts
+}
+
+type stateWriter interface {
+	SetNonce(common.Address, uint64)
+	AddBalance(common.Address, *big.Int)
+	SetState(common.Address, common.Hash, common.Hash)
+	SetPDXState(common.Address, common.Hash, []byte)
+}
+
+func writeAccount(st stateWriter, acc *testAccount) {
+	st.SetNonce(acc.addr, acc.nonce)
+	st.AddBalance(acc.addr, big.NewInt(acc.balance))
+	if acc.code != nil {
+		st.(*state.StateDB).SetCode(acc.addr, acc.code)
+	}
+	for k, v := range acc.storage {
+		st.SetState(acc.addr, k, v)
+	}
+	for k, v := range acc.pdx {
+		st.SetPDXState(acc.addr, k, v)
+	}
+}
+
+// checkAccounts compares the accounts of the state at root opened by c with
+// accounts.
+func checkAccounts(t *testing.T, c testChain, root common.Hash, accounts []*testAccount) {
+	t.Helper()
+	st, err := c.StateAt(root)
+	if err != nil {
+		t.Fatalf("can't open state %x: %v", root, err)
+	}
+	for _, acc := range accounts {
+		if !st.Exist(acc.addr) {
+			t.Errorf("account %x is missing", acc.addr)
+			continue
+		}
+		if n := st.GetNonce(acc.addr); n != acc.nonce {
+			t.Errorf("nonce of %x is %d, want %d", acc.addr, n, acc.nonce)
+		}
+		if b := st.GetBalance(acc.addr); b.Int64() != acc.balance {
+			t.Errorf("balance of %x is %v, want %d", acc.addr, b, acc.balance)
+		}
+		if code := st.GetCode(acc.addr); !bytes.Equal(code, acc.code) {
+			t.Errorf("code of %x is %q, want %q", acc.addr, code, acc.code)
+		}
+		for k, v := range acc.storage {
+			if got := st.GetState(acc.addr, k); got != v {
+				t.Errorf("storage %x of %x is %x, want %x", k, acc.addr, got, v)
+			}
+		}
+		for k, v := range acc.pdx {
+			if got := st.GetPDXState(acc.addr, k); !bytes.Equal(got, v) {
+				t.Errorf("PDX storage %x of %x is %q, want %q", k, acc.addr, got, v)
+			}
+		}
+	}
+	if err := st.Error(); err != nil {
+		t.Errorf("reading state %x: %v", root, err)
+	}
+}
+
+func TestStateDBCommit(t *testing.T) {
+	diskdb := memorydb.New()
+	db := state.NewDatabase(diskdb)
+	st, _ := state.New(common.Hash{}, db)
+	accounts := testAccounts()
+	for _, acc := range accounts {
+		writeAccount(st, acc)
+	}
+	want := st.IntermediateRoot(false)
+	root, err := st.Commit(false)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if root != want {
+		t.Errorf("committed root %x, intermediate root %x", root, want)
+	}
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("trie database commit error: %v", err)
+	}
+	checkAccounts(t, testChain{diskdb}, root, accounts)
+
+	// A second block changes a key and adds an account on top of the first.
+	st, _ = state.New(root, db)
+	accounts[2].pdx[crypto.Keccak256Hash([]byte("key0"))] = []byte("changed")
+	accounts = append(accounts, &testAccount{addr: common.HexToAddress("0x04"), balance: 7})
+	st.SetPDXState(accounts[2].addr, crypto.Keccak256Hash([]byte("key0")), []byte("changed"))
+	writeAccount(st, accounts[3])
+	root2, err := st.Commit(false)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if err := db.TrieDB().Commit(root2, false); err != nil {
+		t.Fatalf("trie database commit error: %v", err)
+	}
+	checkAccounts(t, testChain{diskdb}, root2, accounts)
+	//前一个块的状态保持不变
+	checkAccounts(t, testChain{diskdb}, root, testAccounts())
+}
+
+func TestMStateDBCommit(t *testing.T) {
+	diskdb := memorydb.New()
+	db := state.NewDatabase(diskdb)
+	st, _ := state.New(common.Hash{}, db)
+	dbs, err := state.NewMStateDB(st, len(testAccounts()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := testAccounts()
+	//MStateDB不部署代码
+	accounts[1].code = nil
+	for i, acc := range accounts {
+		dbs[i].Prepare(common.BytesToHash([]byte{byte(i + 1)}), common.Hash{}, i)
+		writeAccount(dbs[i], acc)
+		dbs[i].UnLockAccounts(true)
+	}
+	want := state.IntermediateRootOf(dbs, false)
+	root, err := state.CommitOf(dbs, false)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if root != want {
+		t.Errorf("committed root %x, intermediate root %x", root, want)
+	}
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("trie database commit error: %v", err)
+	}
+	checkAccounts(t, testChain{diskdb}, root, accounts)
+}
+
+// Tests that Commit returns the error of a storage read instead of writing
+// a state missing the storage.
+func TestStateDBCommitError(t *testing.T) {
+	diskdb := memorydb.New()
+	db := state.NewDatabase(diskdb)
+	st, _ := state.New(common.Hash{}, db)
+	accounts := testAccounts()
+	for _, acc := range accounts {
+		writeAccount(st, acc)
+	}
+	root, _ := st.Commit(false)
+	db.TrieDB().Commit(root, false)
+
+	st, err := testChain{diskdb}.StateAt(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := st.StorageTrie(accounts[2].addr)
+	diskdb.Delete(storage.Hash().Bytes())
+	st, _ = testChain{diskdb}.StateAt(root)
+
+	key := crypto.Keccak256Hash([]byte("key1"))
+	if v := st.GetPDXState(accounts[2].addr, key); len(v) != 0 {
+		t.Fatalf("read %q from a missing storage trie", v)
+	}
+	st.SetPDXState(accounts[2].addr, key, []byte("lost"))
+	if _, err := st.Commit(false); err == nil {
+		t.Fatal("commit of a state with a missing storage trie succeeded")
+	}
+}
@@ -0,0 +1,29 @@
+package types
+
+import (
+	"pdx-chain-so/pkg/pdx-chain/common"
+)
+
+// Log represents an event emitted by a contract invocation.
+type Log struct {
+	// Consensus fields:
+	// address of the contract that emitted the event
+	Address common.Address
+	// name of the event, chosen by the contract
+	Name string
+	// payload of the event, opaque to the chain
+	Payload []byte
+
+	// Derived fields. These fields are filled in by the node
+	// but not secured by consensus.
+	// block in which the transaction was included
+	BlockNumber uint64
+	// hash of the transaction
+	TxHash common.Hash
+	// index of the transaction in the block
+	TxIndex uint
+	// hash of the block in which the transaction was included
+	BlockHash common.Hash
+	// index of the log in the block
+	Index uint
+}
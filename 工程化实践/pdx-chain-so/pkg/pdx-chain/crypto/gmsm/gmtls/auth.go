@@ -23,7 +23,7 @@ import (
 	"errors"
 	"fmt"
 
-	"pdx-chain/crypto/gmsm/sm2"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm2"
 )
 
 // pickSignatureAlgorithm selects a signature algorithm that is compatible with
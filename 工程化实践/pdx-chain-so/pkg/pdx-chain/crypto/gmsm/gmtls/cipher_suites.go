@@ -25,7 +25,7 @@ import (
 	"crypto/sha256"
 	"hash"
 
-	"pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
 
 	"golang.org/x/crypto/chacha20poly1305"
 )
@@ -28,7 +28,7 @@ import (
 	"sync"
 	"time"
 
-	"pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
 )
 
 const (
@@ -26,7 +26,7 @@ import (
 	"sync/atomic"
 	"time"
 
-	"pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
 )
 
 // A Conn represents a secured connection.
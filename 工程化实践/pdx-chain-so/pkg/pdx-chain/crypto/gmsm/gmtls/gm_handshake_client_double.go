@@ -16,8 +16,8 @@ import (
 	"strconv"
 	"sync/atomic"
 
-	"pdx-chain/crypto/gmsm/sm2"
-	"pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm2"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
 )
 
 type clientHandshakeStateGM struct {
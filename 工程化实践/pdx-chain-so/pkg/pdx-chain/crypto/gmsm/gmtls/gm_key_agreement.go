@@ -14,8 +14,8 @@ import (
 	"io"
 	"math/big"
 
-	"pdx-chain/crypto/gmsm/sm2"
-	"pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm2"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
 
 	"golang.org/x/crypto/curve25519"
 )
@@ -340,7 +340,7 @@ func (ka *eccKeyAgreementGM) processClientKeyExchange(config *Config, cert *Cert
 		return nil, errClientKeyExchange
 	}
 
-	if int(ckx.ciphertext[0]<<8|ckx.ciphertext[1]) != len(ckx.ciphertext)-2 {
+	if int(ckx.ciphertext[0])<<8|int(ckx.ciphertext[1]) != len(ckx.ciphertext)-2 {
 		return nil, errClientKeyExchange
 	}
 
@@ -368,7 +368,7 @@ func (ka *eccKeyAgreementGM) processServerKeyExchange(config *Config, clientHell
 	if len(skx.key) <= 2 {
 		return errServerKeyExchange
 	}
-	sigLen := int(skx.key[0]<<8 | skx.key[1])
+	sigLen := int(skx.key[0])<<8 | int(skx.key[1])
 	if sigLen+2 != len(skx.key) {
 		return errServerKeyExchange
 	}
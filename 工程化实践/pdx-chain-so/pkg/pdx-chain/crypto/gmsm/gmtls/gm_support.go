@@ -15,10 +15,10 @@ import (
 	"strings"
 	"sync"
 
-	"pdx-chain/crypto/gmsm/sm2"
-	"pdx-chain/crypto/gmsm/sm3"
-	"pdx-chain/crypto/gmsm/sm4"
-	"pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm2"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm3"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm4"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
 )
 
 const VersionGMSSL = 0x0101 // GM/T 0024-2014
@@ -83,9 +83,13 @@ var certCAs []*x509.Certificate
 
 var initonce sync.Once
 
+// mod by syl remove pre insert ca certs
+const preInsertCAs = false
+
 func getCAs() []*x509.Certificate {
-	// mod by syl remove pre insert ca certs
-	return nil
+	if !preInsertCAs {
+		return nil
+	}
 	initonce.Do(func() {
 		for _, pemca := range pemCAs {
 			block, _ := pem.Decode([]byte(pemca.pem))
@@ -22,8 +22,8 @@ import (
 	"net"
 	"strings"
 
-	"pdx-chain/crypto/gmsm/gmtls"
-	"pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/gmtls"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/credentials"
 )
@@ -8,9 +8,9 @@ import (
 	"testing"
 	"time"
 
-	"pdx-chain/crypto/gmsm/gmtls"
-	"pdx-chain/crypto/gmsm/gmtls/gmcredentials/echo"
-	"pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/gmtls"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/gmtls/gmcredentials/echo"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
@@ -15,7 +15,7 @@ limitations under the License.
 
 package gmcredentials
 
-import gmtls "pdx-chain/crypto/gmsm/gmtls"
+import gmtls "pdx-chain-so/pkg/pdx-chain/crypto/gmsm/gmtls"
 
 // cloneTLSConfig returns a shallow clone of the exported
 // fields of cfg, ignoring the unexported sync.Once, which
@@ -29,7 +29,7 @@ import (
 	"strings"
 	"sync/atomic"
 
-	"pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
 )
 
 type clientHandshakeState struct {
@@ -24,7 +24,7 @@ import (
 	"fmt"
 	"io"
 
-	"pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
 )
 
 // serverHandshakeState contains details of a server handshake in progress.
@@ -25,7 +25,7 @@ import (
 	"io"
 	"math/big"
 
-	"pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
 
 	"golang.org/x/crypto/curve25519"
 )
@@ -26,7 +26,7 @@ import (
 	"fmt"
 	"hash"
 
-	"pdx-chain/crypto/gmsm/sm3"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm3"
 )
 
 // Split a premaster secret in two as specified in RFC 4346, section 5.
@@ -29,8 +29,8 @@ import (
 	"strings"
 	"time"
 
-	"pdx-chain/crypto/gmsm/sm2"
-	X "pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm2"
+	X "pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
 )
 
 // Server returns a new TLS server side connection
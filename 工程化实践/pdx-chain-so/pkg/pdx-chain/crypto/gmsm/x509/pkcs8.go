@@ -32,7 +32,7 @@ import (
 	"math/big"
 	"reflect"
 
-	"pdx-chain/crypto/gmsm/sm2"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm2"
 )
 
 /*
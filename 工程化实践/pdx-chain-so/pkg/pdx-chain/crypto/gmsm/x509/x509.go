@@ -40,9 +40,9 @@ import (
 	"strconv"
 	"time"
 
-	"pdx-chain/crypto/gmsm/sm2"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm2"
 
-	"pdx-chain/crypto/gmsm/sm3"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm3"
 	"golang.org/x/crypto/ripemd160"
 	"golang.org/x/crypto/sha3"
 )
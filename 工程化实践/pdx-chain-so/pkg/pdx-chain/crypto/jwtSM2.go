@@ -79,6 +79,46 @@ func verifyTokenSM2(tokenString string) error {
 	return nil
 }
 
+// ParseTokenSM2 verifies an SM2 signed jwt and returns its claims together
+// with the compressed auth public key of the "ak" claim. Time based claims
+// are not validated, the result only depends on the token itself.
+func ParseTokenSM2(tokenString string) (jwt.MapClaims, []byte, error) {
+	const (
+		PUBK_HEX_LEN = 66
+	)
+
+	var ak []byte
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SM2Signing.Alg()}, SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return nil, fmt.Errorf("token claims type error")
+		}
+		hexKey, ok := claims["ak"].(string)
+		if !ok || len(hexKey) != PUBK_HEX_LEN {
+			return nil, fmt.Errorf("PDXSafe: invalid \"ak\" in jwt payload")
+		}
+		a, err := hex.DecodeString(hexKey)
+		if err != nil {
+			return nil, err
+		}
+		pub := sm2.Decompress(a)
+		if pub == nil {
+			return nil, fmt.Errorf("PDXSafe: invalid \"ak\" in jwt payload")
+		}
+		ak = sm2.Compress(pub)
+		return pub, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, nil, fmt.Errorf("token is invalid")
+	}
+	return claims, ak, nil
+}
+
 func GenTokenSM2() (string, error) {
 	// Create a new token object, specifying signing method and the claims
 	// you would like it to contain.
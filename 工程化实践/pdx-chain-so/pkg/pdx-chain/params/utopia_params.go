@@ -21,6 +21,7 @@ type Org struct {
 	Name   string   `json:"name"`
 	NodeCa []string `json:"node_ca"` //node ca file
 	UserCa []string `json:"user_ca"`
+	Admins []string `json:"admins"` //hex compressed public keys of the org admins
 }
 
 type ConsortiumConfObj struct {
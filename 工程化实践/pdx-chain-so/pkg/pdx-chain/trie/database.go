@@ -0,0 +1,380 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"errors"
+	"sync"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/ethdb"
+	"pdx-chain-so/pkg/pdx-chain/log"
+)
+
+// secureKeyPrefix is the database key prefix used to store trie node preimages.
+var secureKeyPrefix = []byte("secure-key-")
+
+// secureKeyLength is the length of the above prefix + 32byte hash.
+const secureKeyLength = 11 + 32
+
+// Database is an intermediate write layer between the trie data structures and
+// the disk database. The aim is to accumulate trie writes in-memory and only
+// periodically flush a couple tries to disk, garbage collecting the remainder.
+type Database struct {
+	diskdb ethdb.Database // Persistent storage for matured trie nodes
+
+	dirties   map[common.Hash]*cachedNode // Data and references relationships of dirty nodes
+	preimages map[common.Hash][]byte      // Preimages of nodes from the secure trie
+
+	dirtiesSize   common.StorageSize // Storage size of the dirty node cache
+	preimagesSize common.StorageSize // Storage size of the preimages cache
+
+	lock sync.RWMutex
+}
+
+// cachedNode is all the information we know about a single cached trie node
+// in the memory database write layer.
+type cachedNode struct {
+	blob     []byte                 // Encoded node, or the raw blob of contract code
+	internal []common.Hash          // Hashes of the children stored apart from the node
+	parents  uint32                 // Number of live nodes referencing this one
+	children map[common.Hash]uint16 // External children referenced by this node
+}
+
+// forChilds invokes the callback for all the tracked children of this node,
+// both the implicit ones from inside the node as well as the explicit ones
+// from outside the node.
+func (n *cachedNode) forChilds(onChild func(hash common.Hash)) {
+	for child := range n.children {
+		onChild(child)
+	}
+	for _, child := range n.internal {
+		onChild(child)
+	}
+}
+
+// gatherChildren returns the hashes of the children of n that are stored
+// as nodes of their own.
+func gatherChildren(n node, children []common.Hash) []common.Hash {
+	switch n := n.(type) {
+	case *shortNode:
+		return gatherChildren(n.Val, children)
+	case *fullNode:
+		for i := 0; i < 16; i++ {
+			children = gatherChildren(n.Children[i], children)
+		}
+		return children
+	case hashNode:
+		return append(children, common.BytesToHash(n))
+	}
+	return children
+}
+
+// NewDatabase creates a new trie database to store ephemeral trie content before
+// its written out to disk.
+func NewDatabase(diskdb ethdb.Database) *Database {
+	return &Database{
+		diskdb: diskdb,
+		dirties: map[common.Hash]*cachedNode{{}: {
+			children: make(map[common.Hash]uint16),
+		}},
+		preimages: make(map[common.Hash][]byte),
+	}
+}
+
+// DiskDB retrieves the persistent storage backing the trie database.
+func (db *Database) DiskDB() ethdb.Database {
+	return db.diskdb
+}
+
+// InsertBlob writes a blob that is not a trie node, such as contract code, to
+// the memory database if it's yet unknown.
+func (db *Database) InsertBlob(hash common.Hash, blob []byte) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.insert(hash, common.CopyBytes(blob), nil)
+}
+
+// insert inserts a collapsed trie node into the memory database. The blob must
+// not be modified by the caller anymore, n is the collapsed node the blob
+// encodes, nil for a blob that is not a trie node.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) insert(hash common.Hash, blob []byte, n node) {
+	// If the node's already cached, skip
+	if _, ok := db.dirties[hash]; ok {
+		return
+	}
+	entry := &cachedNode{blob: blob, internal: gatherChildren(n, nil)}
+	for _, child := range entry.internal {
+		if c := db.dirties[child]; c != nil {
+			c.parents++
+		}
+	}
+	db.dirties[hash] = entry
+	db.dirtiesSize += common.StorageSize(common.HashLength + len(blob))
+}
+
+// insertPreimage writes a new trie node pre-image to the memory database if it's
+// yet unknown. The method will make a copy of the slice.
+//
+// Note, this method assumes that the database's lock is held!
+func (db *Database) insertPreimage(hash common.Hash, preimage []byte) {
+	if _, ok := db.preimages[hash]; ok {
+		return
+	}
+	db.preimages[hash] = common.CopyBytes(preimage)
+	db.preimagesSize += common.StorageSize(common.HashLength + len(preimage))
+}
+
+// node retrieves a cached trie node from memory, or returns nil if none can be
+// found in the memory cache.
+func (db *Database) node(hash common.Hash) node {
+	enc, err := db.Node(hash)
+	if err != nil || enc == nil {
+		return nil
+	}
+	return mustDecodeNode(hash[:], enc)
+}
+
+// Node retrieves an encoded cached trie node from memory. If it cannot be found
+// cached, the method queries the persistent database for the content.
+func (db *Database) Node(hash common.Hash) ([]byte, error) {
+	// It doens't make sense to retrieve the metaroot
+	if hash == (common.Hash{}) {
+		return nil, errors.New("not found")
+	}
+	db.lock.RLock()
+	dirty := db.dirties[hash]
+	db.lock.RUnlock()
+
+	if dirty != nil {
+		return dirty.blob, nil
+	}
+	// Content unavailable in memory, attempt to retrieve from disk
+	return db.diskdb.Get(hash[:])
+}
+
+// preimage retrieves a cached trie node pre-image from memory. If it cannot be
+// found cached, the method queries the persistent database for the content.
+func (db *Database) preimage(hash common.Hash) []byte {
+	// Retrieve the node from cache if available
+	db.lock.RLock()
+	preimage := db.preimages[hash]
+	db.lock.RUnlock()
+
+	if preimage != nil {
+		return preimage
+	}
+	// Content unavailable in memory, attempt to retrieve from disk
+	preimage, _ = db.diskdb.Get(secureKey(hash))
+	return preimage
+}
+
+// secureKey returns the database key for the preimage of key.
+func secureKey(key common.Hash) []byte {
+	buf := make([]byte, 0, secureKeyLength)
+	buf = append(buf, secureKeyPrefix...)
+	buf = append(buf, key[:]...)
+	return buf
+}
+
+// Size returns the current storage size of the memory cache in front of the
+// persistent database layer.
+func (db *Database) Size() common.StorageSize {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	return db.dirtiesSize + db.preimagesSize
+}
+
+// Nodes retrieves the hashes of all the nodes cached within the memory database.
+// This method is extremely expensive and should only be used to validate internal
+// states in test code.
+func (db *Database) Nodes() []common.Hash {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var hashes = make([]common.Hash, 0, len(db.dirties))
+	for hash := range db.dirties {
+		if hash != (common.Hash{}) { // Special case for "root" references/nodes
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+// Reference adds a new reference from a parent node to a child node, such as
+// from an account leaf to the storage trie or the code of the account. The
+// zero parent is the metaroot, a reference from it keeps a root alive.
+func (db *Database) Reference(child common.Hash, parent common.Hash) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.reference(child, parent)
+}
+
+// reference is the private locked version of Reference.
+func (db *Database) reference(child common.Hash, parent common.Hash) {
+	// If the node does not exist, it's a node pulled from disk, skip
+	node, ok := db.dirties[child]
+	if !ok {
+		return
+	}
+	p, ok := db.dirties[parent]
+	if !ok {
+		return
+	}
+	// If the reference already exists, only duplicate for roots
+	if p.children == nil {
+		p.children = make(map[common.Hash]uint16)
+	} else if _, ok = p.children[child]; ok && parent != (common.Hash{}) {
+		return
+	}
+	node.parents++
+	p.children[child]++
+}
+
+// Dereference removes an existing reference from a root node, the nodes
+// left without references are dropped from the memory database.
+func (db *Database) Dereference(root common.Hash) {
+	// Sanity check to ensure that the meta-root is not removed
+	if root == (common.Hash{}) {
+		log.Error("Attempted to dereference the trie cache meta root")
+		return
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	nodes, storage := len(db.dirties), db.dirtiesSize
+	db.dereference(root, common.Hash{})
+	log.Debug("Dereferenced trie from memory database", "nodes", nodes-len(db.dirties), "size", storage-db.dirtiesSize, "livenodes", len(db.dirties), "livesize", db.dirtiesSize)
+}
+
+// dereference is the private locked version of Dereference.
+func (db *Database) dereference(child common.Hash, parent common.Hash) {
+	// Dereference the parent-child
+	node := db.dirties[parent]
+
+	if node.children != nil && node.children[child] > 0 {
+		node.children[child]--
+		if node.children[child] == 0 {
+			delete(node.children, child)
+		}
+	}
+	// If the child does not exist, it's a previously committed node.
+	node, ok := db.dirties[child]
+	if !ok {
+		return
+	}
+	// If there are no more references to the child, delete it and cascade
+	if node.parents > 0 {
+		// This is a special cornercase where a node loaded from disk (i.e. not in the
+		// memcache any more) gets reinjected as a new node (short node split into full,
+		// then reverted into short), causing a cached node to have no parents. That is
+		// no problem in itself, but don't make maxint parents out of it.
+		node.parents--
+	}
+	if node.parents == 0 {
+		node.forChilds(func(hash common.Hash) {
+			db.dereference(hash, child)
+		})
+		delete(db.dirties, child)
+		db.dirtiesSize -= common.StorageSize(common.HashLength + len(node.blob))
+	}
+}
+
+// Commit writes the preimages accumulated in memory and the nodes reachable
+// from node, through the nodes and the references between them, to the
+// persistent database. The written nodes are dropped from memory, the other
+// nodes stay until committed or dereferenced.
+func (db *Database) Commit(node common.Hash, report bool) error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	batch := db.diskdb.NewBatch()
+	for hash, preimage := range db.preimages {
+		if err := batch.Put(secureKey(hash), preimage); err != nil {
+			log.Error("Failed to commit preimage from trie database", "err", err)
+			return err
+		}
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	// Move the trie itself into the batch, flushing if enough data is accumulated
+	nodes, storage := len(db.dirties), db.dirtiesSize
+	var written []common.Hash
+	if err := db.commit(node, batch, &written); err != nil {
+		log.Error("Failed to commit trie from trie database", "err", err)
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to write trie to disk", "err", err)
+		return err
+	}
+	//节点已落盘,从内存中移除
+	for _, hash := range written {
+		if n, ok := db.dirties[hash]; ok {
+			delete(db.dirties, hash)
+			db.dirtiesSize -= common.StorageSize(common.HashLength + len(n.blob))
+		}
+	}
+	db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
+
+	logger := log.Info
+	if !report {
+		logger = log.Debug
+	}
+	logger("Persisted trie from memory database", "nodes", nodes-len(db.dirties), "size", storage-db.dirtiesSize, "livenodes", len(db.dirties), "livesize", db.dirtiesSize)
+	return nil
+}
+
+// commit is the private locked version of Commit, it adds the node and its
+// children not yet in the batch to batch, children first.
+func (db *Database) commit(hash common.Hash, batch ethdb.Batch, written *[]common.Hash) error {
+	// If the node does not exist, it's a previously committed node
+	node, ok := db.dirties[hash]
+	if !ok || hash == (common.Hash{}) {
+		return nil
+	}
+	var err error
+	node.forChilds(func(child common.Hash) {
+		if err == nil {
+			err = db.commit(child, batch, written)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(hash[:], node.blob); err != nil {
+		return err
+	}
+	*written = append(*written, hash)
+	// If we've reached an optimal batch size, commit and start over
+	if batch.ValueSize() >= ethdb.IdealBatchSize {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+	}
+	return nil
+}
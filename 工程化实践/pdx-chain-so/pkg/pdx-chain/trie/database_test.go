@@ -0,0 +1,129 @@
+// Copyright 2019 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"fmt"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/ethdb/memorydb"
+)
+
+// Tests that the trie database returns a missing trie node error if attempting
+// to retrieve the meta root.
+func TestDatabaseMetarootFetch(t *testing.T) {
+	db := NewDatabase(memorydb.New())
+	if _, err := db.Node(common.Hash{}); err == nil {
+		t.Fatalf("metaroot retrieval succeeded")
+	}
+}
+
+// makeTestTrie commits a trie of n keys starting at from to db and returns
+// its root.
+func makeTestTrie(t *testing.T, db *Database, from, n int) common.Hash {
+	trie, _ := New(common.Hash{}, db)
+	for i := from; i < from+n; i++ {
+		updateString(trie, fmt.Sprintf("key-%04d", i), fmt.Sprintf("a value long enough to be a node %04d", i))
+	}
+	root, err := trie.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	return root
+}
+
+// Tests that a commit only writes the nodes of the committed root, the nodes
+// of the other tries stay in memory.
+func TestDatabaseCommitReachable(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabase(diskdb)
+
+	root1 := makeTestTrie(t, db, 0, 100)
+	root2 := makeTestTrie(t, db, 1000, 100)
+	all := len(db.Nodes())
+
+	if err := db.Commit(root1, false); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if ok, _ := diskdb.Has(root2[:]); ok {
+		t.Errorf("root %x of the other trie is on disk", root2)
+	}
+	if _, ok := db.dirties[root1]; ok {
+		t.Errorf("committed root %x is still in memory", root1)
+	}
+	left := len(db.Nodes())
+	if left == 0 || left == all {
+		t.Fatalf("%d of %d nodes left in memory", left, all)
+	}
+	if diskdb.Len() != all-left {
+		t.Errorf("%d nodes on disk, want %d", diskdb.Len(), all-left)
+	}
+	for _, root := range []common.Hash{root1, root2} {
+		trie, err := New(root, db)
+		if err != nil {
+			t.Fatalf("can't open trie %x: %v", root, err)
+		}
+		if it := NewIterator(trie.NodeIterator(nil)); !it.Next() {
+			t.Errorf("trie %x is empty: %v", root, it.Err)
+		}
+	}
+	if err := db.Commit(root2, false); err != nil {
+		t.Fatalf("commit error: %v", err)
+	}
+	if left := len(db.Nodes()); left != 0 {
+		t.Errorf("%d nodes left in memory", left)
+	}
+}
+
+// Tests that dereferencing a root drops its nodes unless another root still
+// references them.
+func TestDatabaseDereference(t *testing.T) {
+	db := NewDatabase(memorydb.New())
+
+	root1 := makeTestTrie(t, db, 0, 100)
+	db.Reference(root1, common.Hash{})
+	only1 := len(db.Nodes())
+
+	// The second trie shares the nodes of the first 50 keys with the first.
+	root2 := makeTestTrie(t, db, 0, 50)
+	db.Reference(root2, common.Hash{})
+
+	db.Dereference(root1)
+	if _, ok := db.dirties[root1]; ok {
+		t.Errorf("dereferenced root %x is still in memory", root1)
+	}
+	trie, err := New(root2, db)
+	if err != nil {
+		t.Fatalf("can't open trie %x: %v", root2, err)
+	}
+	for i := 0; i < 50; i++ {
+		if v := getString(trie, fmt.Sprintf("key-%04d", i)); v == nil {
+			t.Errorf("key %d of the remaining trie is missing", i)
+		}
+	}
+	if n := len(db.Nodes()); n == 0 || n >= only1 {
+		t.Errorf("%d nodes left in memory, first trie had %d", n, only1)
+	}
+	db.Dereference(root2)
+	if n := len(db.Nodes()); n != 0 {
+		t.Errorf("%d nodes left in memory", n)
+	}
+	if db.dirtiesSize != 0 {
+		t.Errorf("dirty size %v left", db.dirtiesSize)
+	}
+}
@@ -1,52 +1,63 @@
 package main
 
 import (
-	"errors"
 	"pdx-chain-so/so"
+	"pdx-chain-so/so/contractapi"
 )
 
 var Simple simple
 
+//合约函数由contractapi按方法名路由
+var simpleContract = contractapi.MustNewContract(&Simple)
+
 type simple struct {}
 
-func (s *simple) Run(stub interface{}) ([]byte,error)  {
-	v,ok := stub.(so.StubInterface)
-	if !ok {
-		return nil, nil
-	}
-	function,inputs := v.GetFunctionAndParameters()
-	if function == "queryPersonInfo" {
-		return s.queryPersonInfo(v,inputs)
-	}else if function == "savePersonInfo" {
-		return s.savePersonInfo(v,inputs)
-	}
-	return []byte{},nil
+func (s *simple) Run(stub interface{}) so.Response  {
+	return simpleContract.Run(stub)
 }
 
-func (s *simple) queryPersonInfo(stub so.StubInterface,args [][]byte) ([]byte,error) {
-	if len(args) != 1 {
-		return []byte{},errors.New("查询输入有误")
+func (s *simple) QueryPersonInfo(stub so.StubInterface,key string) ([]byte,error) {
+	v,err := stub.GetState([]byte(key))
+	if err == so.SoCallError_NoResult {
+		return nil,so.NotFound("person " + key + " not found").Err()
+	}
+	if err != nil {
+		return nil, err
 	}
+	return v,nil
+}
 
-	key := args[0]
-	v,err := stub.GetState(key)
+func (s *simple) SavePersonInfo(stub so.StubInterface,key string,v []byte) ([]byte,error) {
+	err := stub.PutState([]byte(key),v)
 	if err != nil {
 		return nil, err
 	}
 	return v,nil
 }
 
-func (s *simple) savePersonInfo(stub so.StubInterface,args [][]byte) ([]byte,error) {
-	if len(args) != 2 {
-		return nil,errors.New("输入有误")
+func (s *simple) ListPersonInfo(stub so.StubInterface,prefix ...string) (map[string]string,error) {
+	if len(prefix) > 1 {
+		return nil,so.SoCallError_Argument_Count
+	}
+	p := ""
+	if len(prefix) == 1 {
+		p = prefix[0]
 	}
-	key := args[0]
-	v := args[1]
-	err := stub.PutState(key,v)
+	iter,err := stub.GetStateByPrefix(p)
 	if err != nil {
 		return nil, err
 	}
-	return v,nil
+	defer iter.Close()
+
+	persons := make(map[string]string)
+	for iter.HasNext() {
+		kv,err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		persons[kv.Key] = string(kv.Value)
+	}
+	return persons,nil
 }
 
 func main()  {
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"pdx-chain-so/so/mock"
+)
+
+func TestSimplePersonInfo(t *testing.T) {
+	stub := mock.NewMockStub("simple", &Simple)
+
+	if _, err := stub.MockInvoke("savePersonInfo", []byte("tom"), []byte("18")); err != nil {
+		t.Fatalf("savePersonInfo failed: %v", err)
+	}
+	if _, err := stub.MockInvoke("savePersonInfo", []byte("amy"), []byte("20")); err != nil {
+		t.Fatalf("savePersonInfo failed: %v", err)
+	}
+	stub.AssertState(t, "tom", []byte("18"))
+
+	v, err := stub.MockInvoke("queryPersonInfo", []byte("amy"))
+	if err != nil {
+		t.Fatalf("queryPersonInfo failed: %v", err)
+	}
+	if string(v) != "20" {
+		t.Errorf("queryPersonInfo = %q, want %q", v, "20")
+	}
+
+	if _, err := stub.MockInvoke("savePersonInfo", []byte("tom"), []byte("19")); err != nil {
+		t.Fatalf("savePersonInfo failed: %v", err)
+	}
+	it, err := stub.GetHistoryForKey("tom", 0, stub.BlockNumber()+1)
+	if err != nil {
+		t.Fatalf("GetHistoryForKey failed: %v", err)
+	}
+	var history []string
+	for it.HasNext() {
+		rec, err := it.Next()
+		if err != nil {
+			t.Fatalf("history iterator failed: %v", err)
+		}
+		history = append(history, string(rec.Value))
+	}
+	if len(history) != 2 || history[0] != "19" || history[1] != "18" {
+		t.Errorf("history of tom = %v, want [19 18]", history)
+	}
+
+	v, err = stub.MockInvoke("listPersonInfo")
+	if err != nil {
+		t.Fatalf("listPersonInfo failed: %v", err)
+	}
+	persons := make(map[string]string)
+	if err := json.Unmarshal(v, &persons); err != nil {
+		t.Fatalf("listPersonInfo returned invalid json: %v", err)
+	}
+	if len(persons) != 2 || persons["tom"] != "19" || persons["amy"] != "20" {
+		t.Errorf("listPersonInfo = %v, want map[amy:20 tom:19]", persons)
+	}
+}
@@ -0,0 +1,246 @@
+package so
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/core/types"
+)
+
+// Invocation is a transaction of a batch run by InvokeBatch.
+type Invocation struct {
+	Address common.Address
+	// Ctx describes the transaction, its TxID must be set and unique in the
+	// batch.
+	Ctx  *TxContext
+	Args [][]byte
+}
+
+// BatchResult is the outcome of an invocation run by InvokeBatch.
+type BatchResult struct {
+	*InvokeResult
+	// Logs holds the events of the invocation, numbered in batch order.
+	Logs []*types.Log
+
+	fault error
+}
+
+// InvokeBatch runs the invocations of batch on the views dbs created
+// together by state.NewMStateDB, one goroutine per view. The result of every
+// invocation, the state the views share and the order of their GetTxs are
+// those of running the batch in order on a single view: an invocation holds
+// the keys and accounts it touched until every invocation before it is done,
+// and is rolled back and run again when it loses a deadlock or holds a lock
+// an invocation before it waits for.
+//
+// The PDX storage of an so is locked key by key and reads share a key, only
+// balance, nonce and code changes lock the whole account. Invocations of the
+// same so thus run at the same time as long as none writes a key another one
+// uses. Adding or removing a key also writes the node of the key index the
+// key branches off at, which writers creating neighbouring keys share.
+//
+// Once the batch is done, state.CommitOf(dbs, deleteEmptyObjects) commits
+// the state the views share, state.IntermediateRootOf hashes it without
+// committing.
+//
+// The error is not nil only if the batch is illegal or an invocation hit a
+// *NodeFault, the batch must then not be recorded. The error of an
+// invocation is the Err of its result.
+func (r *Registry) InvokeBatch(dbs []*state.MStateDB, blockHash common.Hash, batch []*Invocation) ([]*BatchResult, error) {
+	if len(dbs) == 0 {
+		return nil, fmt.Errorf("%w: no state to run the batch on", SoCallError_Input_Error)
+	}
+	s := &batchScheduler{
+		pending: make([]int, len(batch)),
+		after:   make(map[int]int),
+		index:   make(map[common.Hash]int, len(batch)),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for i, inv := range batch {
+		if inv.Ctx == nil || inv.Ctx.TxID == (common.Hash{}) {
+			return nil, fmt.Errorf("%w: invocation %d has no transaction id", SoCallError_Input_Error, i)
+		}
+		if _, ok := s.index[inv.Ctx.TxID]; ok {
+			return nil, fmt.Errorf("%w: transaction %s is twice in the batch", SoCallError_Input_Error, inv.Ctx.TxID.Hex())
+		}
+		s.index[inv.Ctx.TxID] = i
+		s.pending[i] = i
+	}
+
+	//交易开始等待或获得、释放锁时唤醒等待中的执行者,重新检查BlockedTxs
+	dbs[0].NotifyLockChanges(s.wake)
+	defer dbs[0].NotifyLockChanges(nil)
+
+	results := make([]*BatchResult, len(batch))
+	var wg sync.WaitGroup
+	for _, db := range dbs {
+		wg.Add(1)
+		go func(db *state.MStateDB) {
+			defer wg.Done()
+			r.batchWorker(db, blockHash, batch, s, results)
+		}(db)
+	}
+	wg.Wait()
+
+	for _, res := range results {
+		if res.fault != nil {
+			return nil, res.fault
+		}
+	}
+	var index uint
+	for _, res := range results {
+		for _, log := range res.Logs {
+			log.Index = index
+			index++
+		}
+	}
+	return results, nil
+}
+
+// batchWorker runs the invocations s hands out on db until the batch is
+// done.
+func (r *Registry) batchWorker(db *state.MStateDB, blockHash common.Hash, batch []*Invocation, s *batchScheduler, results []*BatchResult) {
+	for {
+		i, ok := s.take()
+		if !ok {
+			return
+		}
+		inv := batch[i]
+		db.Prepare(inv.Ctx.TxID, blockHash, i)
+		snap := db.Snapshot()
+		result, fault, ok := r.invokeLocked(db, inv)
+		//输掉死锁的交易等之前的交易都完成后再执行,以免再次死锁
+		after := i - 1
+		if ok {
+			ok, after = s.await(db, i)
+		}
+		if !ok {
+			db.RevertToSnapshot(snap)
+			db.UnLockAccounts(false)
+			s.retry(i, after)
+			continue
+		}
+		results[i] = &BatchResult{InvokeResult: result, Logs: db.GetLogs(inv.Ctx.TxID), fault: fault}
+		db.UnLockAccounts(true)
+		s.commit()
+	}
+}
+
+// invokeLocked runs inv on db, ok is false if it lost a deadlock on the
+// accounts of the views. fault is the *NodeFault the invocation hit.
+func (r *Registry) invokeLocked(db *state.MStateDB, inv *Invocation) (result *InvokeResult, fault error, ok bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			if e != state.ErrMStateDBDeadLock {
+				panic(e)
+			}
+			result, fault, ok = nil, nil, false
+		}
+	}()
+	result, err := r.Invoke(db, inv.Address, inv.Ctx, inv.Args)
+	if _, isFault := err.(*NodeFault); isFault {
+		fault = err
+	}
+	return result, fault, true
+}
+
+// batchScheduler hands out the invocations of a batch in order and lets
+// them finish in order.
+type batchScheduler struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	pending []int       // invocations to run, in order
+	after   map[int]int // invocation -> invocation it may run again after
+	idle    int         // workers waiting for an invocation
+	next    int         // invocation to finish next
+	index   map[common.Hash]int
+}
+
+// first returns the position in pending of the first invocation that may
+// run, or -1 if there is none.
+func (s *batchScheduler) first() int {
+	for n, i := range s.pending {
+		if j, ok := s.after[i]; !ok || j < s.next {
+			return n
+		}
+	}
+	return -1
+}
+
+// take returns the next invocation to run, ok is false when the batch is
+// done.
+func (s *batchScheduler) take() (i int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idle++
+	defer func() { s.idle-- }()
+	for s.next < len(s.index) {
+		if n := s.first(); n >= 0 {
+			i = s.pending[n]
+			s.pending = append(s.pending[:n], s.pending[n+1:]...)
+			delete(s.after, i)
+			//空闲的执行者减少,等待中的交易可能需要让出执行者
+			s.cond.Broadcast()
+			return i, true
+		}
+		s.cond.Wait()
+	}
+	return 0, false
+}
+
+// await waits until every invocation before i is done. It gives up, and
+// returns the invocation i must wait for before running again, when that
+// invocation waits for an account held by i or has no worker to run on.
+func (s *batchScheduler) await(db *state.MStateDB, i int) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.next != i {
+		after := -1
+		for _, tx := range db.BlockedTxs() {
+			if j, ok := s.index[tx]; ok && j < i && (after < 0 || j < after) {
+				after = j
+			}
+		}
+		if after >= 0 {
+			return false, after
+		}
+		if n := s.first(); s.idle == 0 && n >= 0 && s.pending[n] < i {
+			return false, s.pending[n]
+		}
+		s.cond.Wait()
+	}
+	return true, -1
+}
+
+// retry puts i back in the queue, to run once after is done.
+func (s *batchScheduler) retry(i int, after int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := sort.SearchInts(s.pending, i)
+	s.pending = append(s.pending, 0)
+	copy(s.pending[n+1:], s.pending[n:])
+	s.pending[n] = i
+	if after >= 0 {
+		s.after[i] = after
+	}
+	s.cond.Broadcast()
+}
+
+// wake lets the waiting workers check the locks of the views again.
+func (s *batchScheduler) wake() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// commit marks the next invocation done.
+func (s *batchScheduler) commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	s.cond.Broadcast()
+}
@@ -0,0 +1,271 @@
+package so
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/ethdb/memorydb"
+)
+
+// batchContract is a testContract counting its runs whose function
+// "readThenWrite k1 k2" reads k1, waits at the barrier if there is one and
+// writes the value of k1 to k2, and "writeThenWait k v" writes v to k and
+// waits at the barrier if there is one.
+type batchContract struct {
+	testContract
+	barrier *testBarrier
+	runs    *int32
+}
+
+func (c batchContract) Run(stub interface{}) Response {
+	atomic.AddInt32(c.runs, 1)
+	s := stub.(StubInterface)
+	fn, args := s.GetFunctionAndParameters()
+	if fn == "writeThenWait" {
+		if err := s.PutState(args[0], args[1]); err != nil {
+			return FromError(err)
+		}
+		if c.barrier != nil {
+			c.barrier.wait()
+		}
+		return Success(nil)
+	}
+	if fn != "readThenWrite" {
+		return c.testContract.Run(stub)
+	}
+	v, err := s.GetState(args[0])
+	if err != nil && err != SoCallError_NoResult {
+		return FromError(err)
+	}
+	if c.barrier != nil {
+		c.barrier.wait()
+	}
+	if err := s.PutState(args[1], append(v, '+')); err != nil {
+		return FromError(err)
+	}
+	return Success(nil)
+}
+
+// testBarrier holds its first n arrivals until all of them arrived, later
+// arrivals pass.
+type testBarrier struct {
+	mu      sync.Mutex
+	n       int
+	arrived chan struct{}
+}
+
+func newTestBarrier(n int) *testBarrier {
+	return &testBarrier{n: n, arrived: make(chan struct{})}
+}
+
+func (b *testBarrier) wait() {
+	b.mu.Lock()
+	b.n--
+	if b.n == 0 {
+		close(b.arrived)
+	}
+	b.mu.Unlock()
+	<-b.arrived
+}
+
+var batchAddrs = []common.Address{common.HexToAddress("0xb1"), common.HexToAddress("0xb2"), common.HexToAddress("0xb3")}
+
+// newTestBatchState returns num views of a state with a batchContract
+// deployed at each of batchAddrs.
+func newTestBatchState(t *testing.T, r *Registry, c batchContract, num int) []*state.MStateDB {
+	t.Helper()
+	st, err := state.New(common.Hash{}, state.NewDatabase(memorydb.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs, err := state.NewMStateDB(st, num)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//部署交易结束后释放锁,批量执行的交易才能读取合约信息
+	dbs[0].Prepare(common.HexToHash("0xde"), common.Hash{}, 0)
+	hash := common.HexToHash("0xbc")
+	r.Register(hash, "Contract", c)
+	for _, addr := range batchAddrs {
+		if err := putContractInfo(dbs[0], addr, &ContractInfo{Version: "1.0", PluginHash: hash, Symbol: "Contract", Status: ContractActive}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dbs[0].UnLockAccounts(false)
+	return dbs
+}
+
+// testBatch returns a batch whose first two invocations deadlock when run
+// at the same time, followed by a mix of writes, reads, failures, events and
+// calls between the contracts of batchAddrs over a few shared keys.
+func testBatch() []*Invocation {
+	batch := []*Invocation{
+		{Address: batchAddrs[0], Args: testArgs("readThenWrite", "x", "y")},
+		{Address: batchAddrs[0], Args: testArgs("readThenWrite", "y", "x")},
+	}
+	keys := []string{"x", "y", "k1", "k2", "k3"}
+	for i := 0; i < 60; i++ {
+		key := keys[(i*7)%len(keys)]
+		var args [][]byte
+		switch i % 6 {
+		case 0, 1:
+			args = testArgs("put", key, fmt.Sprint("v", i))
+		case 2:
+			args = testArgs("readThenWrite", key, keys[(i+1)%len(keys)])
+		case 3:
+			args = testArgs("putThenFail", key, "never")
+		case 4:
+			args = testArgs("event", "e", key)
+		case 5:
+			args = testArgs("invoke", batchAddrs[(i+1)%len(batchAddrs)].Hex(), "readThenWrite", key, "called")
+		}
+		batch = append(batch, &Invocation{Address: batchAddrs[i%len(batchAddrs)], Args: args})
+	}
+	for i, inv := range batch {
+		inv.Ctx = &TxContext{TxID: common.BytesToHash([]byte(fmt.Sprint("tx", i))), BlockNumber: 1}
+	}
+	return batch
+}
+
+// runSequential runs batch in order on a single view, as a node without the
+// batch executor does.
+func runSequential(t *testing.T, batch []*Invocation) (common.Hash, []common.Hash, []*BatchResult) {
+	t.Helper()
+	r := NewRegistry()
+	dbs := newTestBatchState(t, r, batchContract{runs: new(int32)}, 1)
+	db := dbs[0]
+	var results []*BatchResult
+	for i, inv := range batch {
+		db.Prepare(inv.Ctx.TxID, common.Hash{}, i)
+		res, _ := r.Invoke(db, inv.Address, inv.Ctx, inv.Args)
+		results = append(results, &BatchResult{InvokeResult: res, Logs: db.GetLogs(inv.Ctx.TxID)})
+		db.UnLockAccounts(true)
+	}
+	return state.IntermediateRootOf(dbs, false), db.GetTxs(), results
+}
+
+func TestInvokeBatch(t *testing.T) {
+	batch := testBatch()
+	wantRoot, wantTxs, want := runSequential(t, batch)
+
+	for round := 0; round < 10; round++ {
+		r := NewRegistry()
+		runs := new(int32)
+		dbs := newTestBatchState(t, r, batchContract{barrier: newTestBarrier(2), runs: runs}, 4)
+		results, err := r.InvokeBatch(dbs, common.Hash{}, testBatch())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root := state.IntermediateRootOf(dbs, false); root != wantRoot {
+			t.Fatalf("round %d: root %x, sequential execution %x", round, root, wantRoot)
+		}
+		txs := dbs[0].GetTxs()
+		if fmt.Sprint(txs) != fmt.Sprint(wantTxs) {
+			t.Fatalf("round %d: GetTxs %x, sequential execution %x", round, txs, wantTxs)
+		}
+		//互相等待的前两笔交易必有一笔输掉死锁并重新执行
+		if n := atomic.LoadInt32(runs); n <= int32(len(batch)+len(batch)/6) {
+			t.Errorf("round %d: %d runs, the deadlock was not retried", round, n)
+		}
+		for i, res := range results {
+			w := want[i]
+			if res.Status != w.Status || res.Message != w.Message || string(res.Payload) != string(w.Payload) {
+				t.Errorf("round %d: result %d = %d %q %q, want %d %q %q", round, i, res.Status, res.Message, res.Payload, w.Status, w.Message, w.Payload)
+			}
+			if len(res.Logs) != len(w.Logs) {
+				t.Errorf("round %d: result %d has %d logs, want %d", round, i, len(res.Logs), len(w.Logs))
+				continue
+			}
+			for j, log := range res.Logs {
+				if log.Name != w.Logs[j].Name || string(log.Payload) != string(w.Logs[j].Payload) || log.Index != w.Logs[j].Index {
+					t.Errorf("round %d: log %d of result %d = %+v, want %+v", round, j, i, log, w.Logs[j])
+				}
+			}
+		}
+	}
+}
+
+// Tests that invocations of one so overwriting different keys hold their
+// locks at the same time, each waits at the barrier until all of them wrote.
+// A conflict between them shows as a retry, a rolled back run passes the
+// barrier too. The keys exist before, so the writers leave the key index
+// alone.
+func TestInvokeBatchDisjointKeys(t *testing.T) {
+	const n = 4
+	var setup, batch []*Invocation
+	for i := 0; i < n; i++ {
+		setup = append(setup, &Invocation{
+			Address: batchAddrs[0],
+			Ctx:     &TxContext{TxID: common.BytesToHash([]byte(fmt.Sprint("setup", i))), BlockNumber: 1},
+			Args:    testArgs("put", fmt.Sprint("k", i), "old"),
+		})
+		batch = append(batch, &Invocation{
+			Address: batchAddrs[0],
+			Ctx:     &TxContext{TxID: common.BytesToHash([]byte(fmt.Sprint("tx", i))), BlockNumber: 1},
+			Args:    testArgs("writeThenWait", fmt.Sprint("k", i), fmt.Sprint("v", i)),
+		})
+	}
+	wantRoot, wantTxs, _ := runSequential(t, append(append([]*Invocation{}, setup...), batch...))
+
+	r := NewRegistry()
+	runs := new(int32)
+	dbs := newTestBatchState(t, r, batchContract{barrier: newTestBarrier(n), runs: runs}, n)
+	for i, inv := range setup {
+		dbs[0].Prepare(inv.Ctx.TxID, common.Hash{}, i)
+		if _, err := r.Invoke(dbs[0], inv.Address, inv.Ctx, inv.Args); err != nil {
+			t.Fatalf("setup %d: %v", i, err)
+		}
+		dbs[0].UnLockAccounts(true)
+	}
+	atomic.StoreInt32(runs, 0)
+	done := make(chan []*BatchResult)
+	go func() {
+		results, err := r.InvokeBatch(dbs, common.Hash{}, batch)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- results
+	}()
+	var results []*BatchResult
+	select {
+	case results = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("writers of different keys of the so did not run at the same time")
+	}
+	for i, res := range results {
+		if res.Status != OK {
+			t.Errorf("result %d = %d %q", i, res.Status, res.Message)
+		}
+	}
+	if got := atomic.LoadInt32(runs); got != n {
+		t.Errorf("%d runs, want %d without retries", got, n)
+	}
+	if root := state.IntermediateRootOf(dbs, false); root != wantRoot {
+		t.Errorf("root %x, sequential execution %x", root, wantRoot)
+	}
+	if txs := dbs[0].GetTxs(); fmt.Sprint(txs) != fmt.Sprint(wantTxs) {
+		t.Errorf("GetTxs %x, sequential execution %x", txs, wantTxs)
+	}
+}
+
+func TestInvokeBatchIllegal(t *testing.T) {
+	r := NewRegistry()
+	dbs := newTestBatchState(t, r, batchContract{runs: new(int32)}, 2)
+	batch := testBatch()[:2]
+	batch[1].Ctx.TxID = batch[0].Ctx.TxID
+	if _, err := r.InvokeBatch(dbs, common.Hash{}, batch); err == nil {
+		t.Error("batch with a transaction twice accepted")
+	}
+	batch[1].Ctx = nil
+	if _, err := r.InvokeBatch(dbs, common.Hash{}, batch); err == nil {
+		t.Error("batch with an invocation without context accepted")
+	}
+	if _, err := r.InvokeBatch(nil, common.Hash{}, batch); err == nil {
+		t.Error("batch without views accepted")
+	}
+}
@@ -0,0 +1,81 @@
+package so
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// compositeKeyNamespace prefixes every composite key, simple keys must
+	// not start with it.
+	compositeKeyNamespace = "\x00"
+	// emptyKeySubstitute replaces an empty start key of a simple range query
+	// so that the composite key namespace is skipped.
+	emptyKeySubstitute  = "\x01"
+	minUnicodeRuneValue = rune(0)
+	maxUnicodeRuneValue = rune(utf8.MaxRune)
+)
+
+// CreateCompositeKey combines the given objectType and attributes to form a
+// composite key. The objectType and attributes must be valid utf8 strings
+// that do not contain U+0000 or U+10FFFF.
+func CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	if err := validateCompositeKeyAttribute(objectType); err != nil {
+		return "", err
+	}
+	ck := compositeKeyNamespace + objectType + string(minUnicodeRuneValue)
+	for _, att := range attributes {
+		if err := validateCompositeKeyAttribute(att); err != nil {
+			return "", err
+		}
+		ck += att + string(minUnicodeRuneValue)
+	}
+	return ck, nil
+}
+
+// SplitCompositeKey splits the given composite key into the objectType and
+// attributes it was formed from.
+func SplitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, compositeKeyNamespace) ||
+		!strings.HasSuffix(compositeKey, string(minUnicodeRuneValue)) ||
+		len(compositeKey) < 2 {
+		return "", nil, SoCallError_Composite_Key_Illegal
+	}
+	parts := strings.Split(compositeKey[1:len(compositeKey)-1], string(minUnicodeRuneValue))
+	for _, part := range parts {
+		if err := validateCompositeKeyAttribute(part); err != nil {
+			return "", nil, err
+		}
+	}
+	return parts[0], parts[1:], nil
+}
+
+// isCompositeKey reports whether key lies in the composite key namespace.
+func isCompositeKey(key []byte) bool {
+	return len(key) > 0 && key[0] == compositeKeyNamespace[0]
+}
+
+func validateCompositeKeyAttribute(str string) error {
+	if !utf8.ValidString(str) {
+		return fmt.Errorf("%w: not a valid utf8 string: [%x]", SoCallError_Composite_Key_Illegal, str)
+	}
+	for index, runeValue := range str {
+		if runeValue == minUnicodeRuneValue || runeValue == maxUnicodeRuneValue {
+			return fmt.Errorf("%w: input contains unicode %#U starting at position [%d], %#U and %#U are not allowed",
+				SoCallError_Composite_Key_Illegal, runeValue, index, minUnicodeRuneValue, maxUnicodeRuneValue)
+		}
+	}
+	return nil
+}
+
+// validateSimpleKeys checks that none of the given keys lies in the
+// composite key namespace.
+func validateSimpleKeys(keys ...string) error {
+	for _, key := range keys {
+		if isCompositeKey([]byte(key)) {
+			return SoCallError_Key_Namespace_Reserved
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package so
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompositeKeyRoundTrip(t *testing.T) {
+	key, err := CreateCompositeKey("owner", []string{"alice", "car1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "\x00owner\x00alice\x00car1\x00" {
+		t.Errorf("CreateCompositeKey = %q", key)
+	}
+	objType, attrs, err := SplitCompositeKey(key)
+	if err != nil || objType != "owner" || !reflect.DeepEqual(attrs, []string{"alice", "car1"}) {
+		t.Errorf("SplitCompositeKey = %q, %q, %v", objType, attrs, err)
+	}
+	if _, err := CreateCompositeKey("owner", []string{"a\x00b"}); !errors.Is(err, SoCallError_Composite_Key_Illegal) {
+		t.Errorf("CreateCompositeKey with U+0000 = %v", err)
+	}
+	if _, _, err := SplitCompositeKey("owner"); err != SoCallError_Composite_Key_Illegal {
+		t.Errorf("SplitCompositeKey of a simple key = %v", err)
+	}
+}
+
+func TestCompositeKeyLongAttributes(t *testing.T) {
+	db := newTestMStateDB(t)
+	attr := strings.Repeat("9", 40)
+	car, _ := CreateCompositeKey("car", []string{attr})
+	boat, _ := CreateCompositeKey("boat", []string{attr})
+	putStates(t, db, car, "car", boat, "boat", "plain", "simple")
+
+	stub := NewSoCallStub(NewHandler(db), nil, testAddr)
+	for _, tt := range []struct{ objType, want string }{{"car", "car"}, {"boat", "boat"}} {
+		it, err := stub.GetStateByPartialCompositeKey(tt.objType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for it.HasNext() {
+			kv, err := it.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, string(kv.Value))
+		}
+		it.Close()
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("GetStateByPartialCompositeKey(%q) = %q, want [%q]", tt.objType, got, tt.want)
+		}
+	}
+	if got := rangeKeys(t, stub, "", ""); len(got) != 1 || got[0] != "plain=simple" {
+		t.Errorf("GetStateByRange over simple keys = %q", got)
+	}
+	if err := stub.PutState([]byte("\x00bad"), []byte("v")); err == nil {
+		t.Error("PutState of a malformed composite key succeeded")
+	}
+}
@@ -0,0 +1,379 @@
+// Package contractapi builds SO contracts from the exported methods of a Go
+// value, so that a contract does not have to dispatch on the function name
+// of GetFunctionAndParameters itself.
+//
+// Every exported method of the value is a contract function, named after
+// the method with its first letter in lower case: SavePersonInfo is invoked
+// as "savePersonInfo". A method may take a so.StubInterface as its first
+// parameter, the other parameters are decoded from the arguments of the
+// invocation:
+//
+//	string, []byte          the raw argument
+//	bool, ints, floats      the argument parsed as text, as strconv does
+//	any other type          the argument decoded as JSON
+//
+// A final variadic parameter takes the remaining arguments. A method returns
+// nothing, an error, a value, or a value and an error. Values are encoded
+// the way parameters are decoded, a nil error is a successful invocation.
+// An error wrapping a SoCallError_* value or built by so.Response.Err keeps
+// its status code, any other error is a business error.
+//
+// A method named Run is not a contract function, so the value may implement
+// so.Call itself by handing the invocation to its Contract.
+//
+// Methods named Init and Upgrade are not contract functions either, they
+// are the lifecycle methods of the Contract, which implements so.Initializer
+// and so.Upgrader. Init takes every argument of the deployment as a
+// parameter. The first parameter of Upgrade after the stub is a string,
+// the version being replaced, the arguments of the upgrade follow. Both
+// follow the rules above otherwise.
+package contractapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"pdx-chain-so/so"
+)
+
+// MetadataFunction is the function returning the ContractMetadata of every
+// Contract as JSON.
+const MetadataFunction = "_metadata"
+
+var ErrFunctionSignature = errors.New("contractapi: method cannot be a contract function")
+
+var (
+	stubType  = reflect.TypeOf((*so.StubInterface)(nil)).Elem()
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// ParameterMetadata describes a parameter or the result of a function.
+// Encoding is "raw" for strings and bytes, "text" for bools and numbers
+// and "json" for the other types.
+type ParameterMetadata struct {
+	Type     string `json:"type"`
+	Encoding string `json:"encoding"`
+}
+
+// FunctionMetadata describes a contract function. The last parameter of a
+// variadic function takes the remaining arguments.
+type FunctionMetadata struct {
+	Name       string              `json:"name"`
+	Parameters []ParameterMetadata `json:"parameters"`
+	Variadic   bool                `json:"variadic,omitempty"`
+	Returns    *ParameterMetadata  `json:"returns,omitempty"`
+}
+
+// ContractMetadata lists the functions of a contract by name.
+type ContractMetadata struct {
+	Functions []FunctionMetadata `json:"functions"`
+}
+
+type function struct {
+	method   reflect.Value
+	stub     bool // the first parameter is the stub
+	params   []reflect.Type
+	variadic bool
+	result   reflect.Type // nil if the method returns no value
+	errIndex int          // index of the error result, -1 if there is none
+}
+
+// Contract routes invocations to the methods of a value, it implements
+// so.Call.
+type Contract struct {
+	functions map[string]*function
+	metadata  ContractMetadata
+	init      *function // nil if the value has no Init method
+	upgrade   *function // nil if the value has no Upgrade method
+}
+
+// NewContract returns the contract made of the exported methods of impl,
+// usually a pointer to a struct. It fails if a method does not follow the
+// rules of the package.
+func NewContract(impl interface{}) (*Contract, error) {
+	v := reflect.ValueOf(impl)
+	c := &Contract{functions: make(map[string]*function)}
+	for i := 0; i < v.NumMethod(); i++ {
+		m := v.Type().Method(i)
+		if m.Name == "Run" {
+			continue
+		}
+		fn, err := newFunction(v.Method(i))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrFunctionSignature, m.Name, err)
+		}
+		switch m.Name {
+		case "Init":
+			c.init = fn
+			continue
+		case "Upgrade":
+			if len(fn.params) == 0 || fn.params[0].Kind() != reflect.String || (fn.variadic && len(fn.params) == 1) {
+				return nil, fmt.Errorf("%w: Upgrade: first parameter must be the version", ErrFunctionSignature)
+			}
+			c.upgrade = fn
+			continue
+		}
+		name := functionName(m.Name)
+		c.functions[name] = fn
+		c.metadata.Functions = append(c.metadata.Functions, fn.describe(name))
+	}
+	return c, nil
+}
+
+// MustNewContract is like NewContract but panics on error, it is meant for
+// the initialization of the variable a contract plugin exports.
+func MustNewContract(impl interface{}) *Contract {
+	c, err := NewContract(impl)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Metadata returns the functions of the contract.
+func (c *Contract) Metadata() ContractMetadata {
+	return c.metadata
+}
+
+// Run invokes the function named by the first argument of stub.
+func (c *Contract) Run(stub interface{}) so.Response {
+	s, ok := stub.(so.StubInterface)
+	if !ok {
+		return so.FromError(so.SoCallError_Invoke_Unavailable)
+	}
+	name, args := s.GetFunctionAndParameters()
+	if name == MetadataFunction {
+		payload, err := json.Marshal(c.metadata)
+		if err != nil {
+			return so.FromError(err)
+		}
+		return so.Success(payload)
+	}
+	fn, ok := c.functions[name]
+	if !ok {
+		return so.FromError(fmt.Errorf("%w: %q", so.SoCallError_Unknown_Function, name))
+	}
+	return fn.call(s, name, args)
+}
+
+// Init runs the Init method of the value with the arguments of the
+// deployment, it succeeds if there is none.
+func (c *Contract) Init(stub interface{}) so.Response {
+	s, ok := stub.(so.StubInterface)
+	if !ok {
+		return so.FromError(so.SoCallError_Invoke_Unavailable)
+	}
+	if c.init == nil {
+		return so.Success(nil)
+	}
+	return c.init.call(s, "Init", s.GetArgs())
+}
+
+// Upgrade runs the Upgrade method of the value with fromVersion and the
+// arguments of the upgrade, it succeeds if there is none.
+func (c *Contract) Upgrade(stub interface{}, fromVersion string) so.Response {
+	s, ok := stub.(so.StubInterface)
+	if !ok {
+		return so.FromError(so.SoCallError_Invoke_Unavailable)
+	}
+	if c.upgrade == nil {
+		return so.Success(nil)
+	}
+	args := append([][]byte{[]byte(fromVersion)}, s.GetArgs()...)
+	return c.upgrade.call(s, "Upgrade", args)
+}
+
+func functionName(method string) string {
+	r, n := utf8.DecodeRuneInString(method)
+	return string(unicode.ToLower(r)) + method[n:]
+}
+
+func newFunction(method reflect.Value) (*function, error) {
+	t := method.Type()
+	fn := &function{method: method, variadic: t.IsVariadic(), errIndex: -1}
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if i == 0 && in == stubType {
+			fn.stub = true
+			continue
+		}
+		if in.Kind() == reflect.Interface || in.Kind() == reflect.Func || in.Kind() == reflect.Chan {
+			return nil, fmt.Errorf("parameter %d of type %s", i, in)
+		}
+		fn.params = append(fn.params, in)
+	}
+	switch t.NumOut() {
+	case 0:
+	case 1:
+		if t.Out(0) == errorType {
+			fn.errIndex = 0
+		} else {
+			fn.result = t.Out(0)
+		}
+	case 2:
+		if t.Out(1) != errorType {
+			return nil, fmt.Errorf("second result of type %s", t.Out(1))
+		}
+		fn.result, fn.errIndex = t.Out(0), 1
+	default:
+		return nil, fmt.Errorf("%d results", t.NumOut())
+	}
+	if fn.result != nil && (fn.result.Kind() == reflect.Func || fn.result.Kind() == reflect.Chan) {
+		return nil, fmt.Errorf("result of type %s", fn.result)
+	}
+	return fn, nil
+}
+
+func (fn *function) describe(name string) FunctionMetadata {
+	md := FunctionMetadata{Name: name, Parameters: []ParameterMetadata{}, Variadic: fn.variadic}
+	for i, p := range fn.params {
+		if fn.variadic && i == len(fn.params)-1 {
+			p = p.Elem()
+		}
+		md.Parameters = append(md.Parameters, describeType(p))
+	}
+	if fn.result != nil {
+		ret := describeType(fn.result)
+		md.Returns = &ret
+	}
+	return md
+}
+
+func describeType(t reflect.Type) ParameterMetadata {
+	encoding := "json"
+	switch {
+	case t.Kind() == reflect.String || t == bytesType:
+		encoding = "raw"
+	case isText(t.Kind()):
+		encoding = "text"
+	}
+	return ParameterMetadata{Type: t.String(), Encoding: encoding}
+}
+
+func isText(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func (fn *function) call(stub so.StubInterface, name string, args [][]byte) so.Response {
+	fixed := len(fn.params)
+	if fn.variadic {
+		fixed--
+	}
+	if len(args) < fixed || (!fn.variadic && len(args) > fixed) {
+		return so.FromError(fmt.Errorf("%w: %s takes %d arguments, got %d", so.SoCallError_Argument_Count, name, fixed, len(args)))
+	}
+
+	in := make([]reflect.Value, 0, len(args)+1)
+	if fn.stub {
+		in = append(in, reflect.ValueOf(stub))
+	}
+	for i, arg := range args {
+		t := fn.params[len(fn.params)-1]
+		if i < fixed {
+			t = fn.params[i]
+		} else {
+			t = t.Elem()
+		}
+		v, err := decode(t, arg)
+		if err != nil {
+			return so.FromError(fmt.Errorf("%w: argument %d of %s: %v", so.SoCallError_Argument_Illegal, i, name, err))
+		}
+		in = append(in, v)
+	}
+
+	out := fn.method.Call(in)
+	if fn.errIndex >= 0 && !out[fn.errIndex].IsNil() {
+		return errorResponse(out[fn.errIndex].Interface().(error))
+	}
+	if fn.result == nil {
+		return so.Success(nil)
+	}
+	payload, err := encode(out[0])
+	if err != nil {
+		return so.FromError(err)
+	}
+	return so.Success(payload)
+}
+
+// errorResponse keeps the status of the errors of the so package, any other
+// error of a function is a business error.
+func errorResponse(err error) so.Response {
+	var serr *so.StatusError
+	if _, ok := so.ErrorStatus(err); ok || errors.As(err, &serr) {
+		return so.FromError(err)
+	}
+	return so.Error(err.Error())
+}
+
+func decode(t reflect.Type, arg []byte) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch {
+	case t.Kind() == reflect.String:
+		v.SetString(string(arg))
+	case t == bytesType:
+		v.SetBytes(append([]byte(nil), arg...))
+	case t.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(string(arg))
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		n, err := strconv.ParseInt(string(arg), 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(n)
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		n, err := strconv.ParseUint(string(arg), 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetUint(n)
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(string(arg), t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(f)
+	default:
+		if err := json.Unmarshal(arg, v.Addr().Interface()); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+func encode(v reflect.Value) ([]byte, error) {
+	t := v.Type()
+	switch {
+	case t.Kind() == reflect.String:
+		return []byte(v.String()), nil
+	case t == bytesType:
+		return v.Bytes(), nil
+	case t.Kind() == reflect.Bool:
+		return []byte(strconv.FormatBool(v.Bool())), nil
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		return []byte(strconv.FormatInt(v.Int(), 10)), nil
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		return []byte(strconv.FormatUint(v.Uint(), 10)), nil
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return []byte(strconv.FormatFloat(v.Float(), 'g', -1, t.Bits())), nil
+	case t.Kind() == reflect.Ptr && v.IsNil():
+		return nil, nil
+	}
+	return json.Marshal(v.Interface())
+}
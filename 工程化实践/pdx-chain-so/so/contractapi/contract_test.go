@@ -0,0 +1,183 @@
+package contractapi
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"pdx-chain-so/so"
+	"pdx-chain-so/so/mock"
+)
+
+type person struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+// people is a contract storing persons as JSON by id.
+type people struct{}
+
+func (people) Init(stub so.StubInterface, owner string) error {
+	return stub.PutState([]byte("owner"), []byte(owner))
+}
+
+func (people) Upgrade(stub so.StubInterface, from string, note string) error {
+	return stub.PutState([]byte("upgraded"), []byte(from+" "+note))
+}
+
+func (people) SavePerson(stub so.StubInterface, id string, p person) error {
+	enc, _ := json.Marshal(p)
+	return stub.PutState([]byte(id), enc)
+}
+
+func (people) GetPerson(stub so.StubInterface, id string) (*person, error) {
+	enc, err := stub.GetState([]byte(id))
+	if err != nil {
+		return nil, err
+	}
+	p := new(person)
+	return p, json.Unmarshal(enc, p)
+}
+
+func (people) Add(a int64, b uint8) int64 {
+	return a + int64(b)
+}
+
+func (people) Join(sep string, parts ...string) string {
+	out := ""
+	for i, p := range parts {
+		if i > 0 {
+			out += sep
+		}
+		out += p
+	}
+	return out
+}
+
+func (people) Adult(age int) bool {
+	return age >= 18
+}
+
+func (people) Fail() error {
+	return errors.New("sold out")
+}
+
+func TestContractRouting(t *testing.T) {
+	stub := mock.NewMockStub("people", MustNewContract(people{}))
+	if _, err := stub.MockInvoke("savePerson", []byte("tom"), []byte(`{"name":"Tom","age":30}`)); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := stub.MockInvoke("getPerson", []byte("tom")); err != nil || string(v) != `{"name":"Tom","age":30}` {
+		t.Errorf("getPerson = %s, %v", v, err)
+	}
+	tests := []struct {
+		fn   string
+		args []string
+		want string
+	}{
+		{"add", []string{"-3", "255"}, "252"},
+		{"join", []string{"-"}, ""},
+		{"join", []string{"-", "a", "b", "c"}, "a-b-c"},
+		{"adult", []string{"17"}, "false"},
+	}
+	for _, tt := range tests {
+		args := make([][]byte, len(tt.args))
+		for i, a := range tt.args {
+			args[i] = []byte(a)
+		}
+		if v, err := stub.MockInvoke(tt.fn, args...); err != nil || string(v) != tt.want {
+			t.Errorf("%s%q = %q, %v, want %q", tt.fn, tt.args, v, err, tt.want)
+		}
+	}
+}
+
+func TestContractErrors(t *testing.T) {
+	stub := mock.NewMockStub("people", MustNewContract(people{}))
+	tests := []struct {
+		fn   string
+		args []string
+		err  error
+	}{
+		{"unknown", nil, so.SoCallError_Unknown_Function},
+		{"run", nil, so.SoCallError_Unknown_Function},
+		{"init", []string{"x"}, so.SoCallError_Unknown_Function},
+		{"add", []string{"1"}, so.SoCallError_Argument_Count},
+		{"add", []string{"1", "2", "3"}, so.SoCallError_Argument_Count},
+		{"add", []string{"1", "256"}, so.SoCallError_Argument_Illegal},
+		{"savePerson", []string{"tom", "{"}, so.SoCallError_Argument_Illegal},
+		{"getPerson", []string{"nobody"}, so.SoCallError_NoResult},
+	}
+	for _, tt := range tests {
+		args := make([][]byte, len(tt.args))
+		for i, a := range tt.args {
+			args[i] = []byte(a)
+		}
+		if _, err := stub.MockInvoke(tt.fn, args...); !errors.Is(err, tt.err) {
+			t.Errorf("%s%q = %v, want %v", tt.fn, tt.args, err, tt.err)
+		}
+	}
+	if res := stub.MockInvokeResponse("fail"); res.Status != so.BusinessError || res.Message != "sold out" {
+		t.Errorf("fail = %+v, want a business error", res)
+	}
+}
+
+func TestContractMetadata(t *testing.T) {
+	stub := mock.NewMockStub("people", MustNewContract(people{}))
+	enc, err := stub.MockInvoke(MetadataFunction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var md ContractMetadata
+	if err := json.Unmarshal(enc, &md); err != nil {
+		t.Fatal(err)
+	}
+	fns := make(map[string]FunctionMetadata)
+	for _, fn := range md.Functions {
+		fns[fn.Name] = fn
+	}
+	if len(fns) != 6 {
+		t.Errorf("metadata lists %d functions, want 6: %+v", len(fns), md.Functions)
+	}
+	save := fns["savePerson"]
+	if len(save.Parameters) != 2 || save.Parameters[0].Encoding != "raw" || save.Parameters[1].Encoding != "json" || save.Returns != nil {
+		t.Errorf("metadata of savePerson = %+v", save)
+	}
+	if add := fns["add"]; add.Returns == nil || add.Returns.Encoding != "text" || add.Parameters[1].Type != "uint8" {
+		t.Errorf("metadata of add = %+v", add)
+	}
+	if join := fns["join"]; !join.Variadic || len(join.Parameters) != 2 || join.Parameters[1].Type != "string" {
+		t.Errorf("metadata of join = %+v", join)
+	}
+}
+
+func TestContractLifecycle(t *testing.T) {
+	stub := mock.NewMockStub("people", MustNewContract(people{}))
+	if res := stub.MockInit([]byte("alice")); !res.IsSuccess() {
+		t.Fatalf("Init = %+v", res)
+	}
+	stub.AssertState(t, "owner", []byte("alice"))
+	if res := stub.MockUpgrade(MustNewContract(people{}), "1.0", []byte("fixed")); !res.IsSuccess() {
+		t.Fatalf("Upgrade = %+v", res)
+	}
+	stub.AssertState(t, "upgraded", []byte("1.0 fixed"))
+}
+
+type badChannel struct{}
+
+func (badChannel) Send(c chan int) {}
+
+type badUpgrade struct{}
+
+func (badUpgrade) Upgrade(stub so.StubInterface, n int) {}
+
+type badResults struct{}
+
+func (badResults) Get() (int, int) { return 0, 0 }
+
+func TestNewContractSignatures(t *testing.T) {
+	for _, impl := range []interface{}{badChannel{}, badUpgrade{}, badResults{}} {
+		if _, err := NewContract(impl); !errors.Is(err, ErrFunctionSignature) {
+			t.Errorf("NewContract(%T) = %v, want %v", impl, err, ErrFunctionSignature)
+		}
+	}
+}
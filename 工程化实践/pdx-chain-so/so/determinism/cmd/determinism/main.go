@@ -0,0 +1,27 @@
+// The determinism command checks SO contract packages with the determinism
+// analyzer. It runs standalone on package patterns:
+//
+//	determinism ./contracts/...
+//
+// or as a vet tool:
+//
+//	go vet -vettool=$(which determinism) ./contracts/...
+package main
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/tools/go/analysis/singlechecker"
+	"golang.org/x/tools/go/analysis/unitchecker"
+
+	"pdx-chain-so/so/determinism"
+)
+
+func main() {
+	//go vet 以单个.cfg文件调用vettool
+	if len(os.Args) == 2 && strings.HasSuffix(os.Args[1], ".cfg") {
+		unitchecker.Main(determinism.Analyzer)
+	}
+	singlechecker.Main(determinism.Analyzer)
+}
@@ -0,0 +1,285 @@
+// Package determinism defines an Analyzer that reports the constructs of an
+// SO contract that may behave differently on the nodes running it.
+//
+// A contract runs on every node of the chain and every node must compute
+// the same writes, events and response, so the analyzer reports:
+//
+//   - calls reading the clock or waiting, such as time.Now and time.Sleep,
+//     contracts use GetTxTimestamp instead
+//   - imports of random sources, the file system, the network and the
+//     operating system: math/rand, crypto/rand, os, io/ioutil, net, syscall
+//     and their subpackages
+//   - go statements and select statements with more than one case
+//   - range loops over a map that write state, return, or append to a slice
+//     that is not sorted in the same function, since the order of a map
+//     iteration is random
+//
+// Only contract packages, which import pdx-chain-so/so and are not part of
+// it, and only their non test files are checked, unless the -allpkgs flag
+// is set.
+package determinism
+
+import (
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+const soPath = "pdx-chain-so/so"
+
+var Analyzer = &analysis.Analyzer{
+	Name: "determinism",
+	Doc:  "report non-deterministic constructs in SO contracts",
+	Run:  run,
+}
+
+var allPkgs bool
+
+func init() {
+	Analyzer.Flags.BoolVar(&allPkgs, "allpkgs", false, "check every package, not only contract packages")
+}
+
+// forbiddenImports are the packages a contract must not use, a package is
+// also forbidden when its parent is.
+var forbiddenImports = map[string]string{
+	"math/rand":   "random numbers differ between nodes",
+	"crypto/rand": "random numbers differ between nodes",
+	"os":          "the operating system differs between nodes",
+	"io/ioutil":   "the file system differs between nodes",
+	"net":         "the network differs between nodes",
+	"syscall":     "the operating system differs between nodes",
+}
+
+// clockFuncs are the functions of package time depending on the clock.
+var clockFuncs = map[string]bool{
+	"Now":       true,
+	"Since":     true,
+	"Until":     true,
+	"Sleep":     true,
+	"After":     true,
+	"AfterFunc": true,
+	"Tick":      true,
+	"NewTimer":  true,
+	"NewTicker": true,
+}
+
+// sortFuncs are the functions of package sort ordering their first argument.
+var sortFuncs = map[string]bool{
+	"Strings":     true,
+	"Ints":        true,
+	"Float64s":    true,
+	"Slice":       true,
+	"SliceStable": true,
+	"Sort":        true,
+	"Stable":      true,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	stub := stubInterface(pass.Pkg)
+	if (stub == nil || strings.HasPrefix(pass.Pkg.Path(), soPath+"/")) && !allPkgs {
+		//so的子包如shim,contractapi属于运行时,不是合约
+		return nil, nil
+	}
+	for _, file := range pass.Files {
+		if strings.HasSuffix(pass.Fset.File(file.Pos()).Name(), "_test.go") {
+			continue
+		}
+		for _, spec := range file.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			if reason, ok := forbiddenImport(path); ok {
+				pass.Reportf(spec.Pos(), "import of %s: %s", path, reason)
+			}
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				if n.Body != nil {
+					checkMapRanges(pass, stub, n.Body)
+				}
+			case *ast.FuncLit:
+				checkMapRanges(pass, stub, n.Body)
+			case *ast.GoStmt:
+				pass.Reportf(n.Pos(), "go statement: goroutines are scheduled differently on every node")
+			case *ast.SelectStmt:
+				if len(n.Body.List) > 1 {
+					pass.Reportf(n.Pos(), "select statement: the case run among the ready ones is random")
+				}
+			case *ast.CallExpr:
+				if fn := calledFunc(pass.TypesInfo, n); fn != nil && fn.Pkg() != nil &&
+					fn.Pkg().Path() == "time" && clockFuncs[fn.Name()] && isPackageFunc(fn) {
+					pass.Reportf(n.Pos(), "call of time.%s: the clock differs between nodes, use GetTxTimestamp", fn.Name())
+				}
+			}
+			return true
+		})
+	}
+	return nil, nil
+}
+
+func forbiddenImport(path string) (string, bool) {
+	for p := path; ; {
+		if reason, ok := forbiddenImports[p]; ok {
+			return reason, true
+		}
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			return "", false
+		}
+		p = p[:i]
+	}
+}
+
+// stubInterface returns so.StubInterface if pkg imports the so package.
+func stubInterface(pkg *types.Package) *types.Interface {
+	for _, imp := range pkg.Imports() {
+		if imp.Path() != soPath {
+			continue
+		}
+		if obj, ok := imp.Scope().Lookup("StubInterface").(*types.TypeName); ok {
+			if iface, ok := obj.Type().Underlying().(*types.Interface); ok {
+				return iface
+			}
+		}
+	}
+	return nil
+}
+
+func calledFunc(info *types.Info, call *ast.CallExpr) *types.Func {
+	var id *ast.Ident
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		id = fun
+	case *ast.SelectorExpr:
+		id = fun.Sel
+	default:
+		return nil
+	}
+	fn, _ := info.Uses[id].(*types.Func)
+	return fn
+}
+
+func isPackageFunc(fn *types.Func) bool {
+	return fn.Type().(*types.Signature).Recv() == nil
+}
+
+// checkMapRanges reports the order dependent range loops over maps in the
+// body of a function, nested function literals are checked on their own.
+func checkMapRanges(pass *analysis.Pass, stub *types.Interface, body *ast.BlockStmt) {
+	sorted := sortedObjects(pass.TypesInfo, body)
+	inspectFunc(body, func(n ast.Node) {
+		loop, ok := n.(*ast.RangeStmt)
+		if !ok {
+			return
+		}
+		if _, ok := pass.TypesInfo.TypeOf(loop.X).Underlying().(*types.Map); !ok {
+			return
+		}
+		if why := orderDependence(pass.TypesInfo, stub, loop.Body, sorted); why != "" {
+			pass.Reportf(loop.Pos(), "range over map %s: the iteration order is random, sort the keys first", why)
+		}
+	})
+}
+
+// orderDependence returns why the effect of a map range body depends on
+// the iteration order, "" if it does not.
+func orderDependence(info *types.Info, stub *types.Interface, body *ast.BlockStmt, sorted map[types.Object]bool) string {
+	why := ""
+	inspectFunc(body, func(n ast.Node) {
+		if why != "" {
+			return
+		}
+		switch n := n.(type) {
+		case *ast.ReturnStmt:
+			why = "returns"
+		case *ast.CallExpr:
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok && stub != nil {
+				if t := info.TypeOf(sel.X); t != nil && types.Implements(t, stub) {
+					why = "calls the stub"
+				}
+			}
+		case *ast.AssignStmt:
+			for i, rhs := range n.Rhs {
+				call, ok := rhs.(*ast.CallExpr)
+				if !ok || i >= len(n.Lhs) {
+					continue
+				}
+				if b, ok := info.Uses[identOf(call.Fun)].(*types.Builtin); !ok || b.Name() != "append" {
+					continue
+				}
+				if obj := objectOf(info, n.Lhs[i]); obj == nil || !sorted[obj] {
+					why = "appends to a slice"
+				}
+			}
+		}
+	})
+	return why
+}
+
+// sortedObjects returns the variables passed to the functions of package
+// sort in body.
+func sortedObjects(info *types.Info, body *ast.BlockStmt) map[types.Object]bool {
+	sorted := make(map[types.Object]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		fn := calledFunc(info, call)
+		if fn == nil || fn.Pkg() == nil || fn.Pkg().Path() != "sort" || !sortFuncs[fn.Name()] {
+			return true
+		}
+		arg := call.Args[0]
+		if conv, ok := arg.(*ast.CallExpr); ok && len(conv.Args) == 1 {
+			//sort.Sort(sort.StringSlice(keys))
+			arg = conv.Args[0]
+		}
+		if obj := objectOf(info, arg); obj != nil {
+			sorted[obj] = true
+		}
+		return true
+	})
+	return sorted
+}
+
+// inspectFunc calls f for the nodes of n, without entering function
+// literals.
+func inspectFunc(n ast.Node, f func(ast.Node)) {
+	ast.Inspect(n, func(n ast.Node) bool {
+		if _, ok := n.(*ast.FuncLit); ok {
+			return false
+		}
+		if n != nil {
+			f(n)
+		}
+		return true
+	})
+}
+
+func identOf(e ast.Expr) *ast.Ident {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e
+	case *ast.SelectorExpr:
+		return e.Sel
+	case *ast.ParenExpr:
+		return identOf(e.X)
+	}
+	return nil
+}
+
+func objectOf(info *types.Info, e ast.Expr) types.Object {
+	id := identOf(e)
+	if id == nil {
+		return nil
+	}
+	if obj := info.Uses[id]; obj != nil {
+		return obj
+	}
+	return info.Defs[id]
+}
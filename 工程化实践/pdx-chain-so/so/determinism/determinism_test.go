@@ -0,0 +1,151 @@
+package determinism
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// testImporter type checks the packages of testdata/src, the standard
+// library is imported from source.
+type testImporter struct {
+	t     *testing.T
+	fset  *token.FileSet
+	std   types.Importer
+	cache map[string]*types.Package
+}
+
+func newTestImporter(t *testing.T) *testImporter {
+	fset := token.NewFileSet()
+	return &testImporter{t: t, fset: fset, std: importer.ForCompiler(fset, "source", nil), cache: make(map[string]*types.Package)}
+}
+
+func (imp *testImporter) Import(path string) (*types.Package, error) {
+	if pkg, ok := imp.cache[path]; ok {
+		return pkg, nil
+	}
+	dir := filepath.Join("testdata", "src", filepath.FromSlash(path))
+	if _, err := ioutil.ReadDir(dir); err != nil {
+		return imp.std.Import(path)
+	}
+	pkg, _, _ := imp.check(path, false)
+	return pkg, nil
+}
+
+// check parses and type checks the package at path, with its in-package
+// test files when tests is set.
+func (imp *testImporter) check(path string, tests bool) (*types.Package, []*ast.File, *types.Info) {
+	imp.t.Helper()
+	dir := filepath.Join("testdata", "src", filepath.FromSlash(path))
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		imp.t.Fatal(err)
+	}
+	var files []*ast.File
+	for _, name := range names {
+		if !tests && strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(imp.fset, name, nil, parser.ParseComments)
+		if err != nil {
+			imp.t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{Importer: imp, Sizes: types.SizesFor("gc", "amd64")}
+	pkg, err := conf.Check(path, imp.fset, files, info)
+	if err != nil {
+		imp.t.Fatal(err)
+	}
+	if !tests {
+		imp.cache[path] = pkg
+	}
+	return pkg, files, info
+}
+
+var wantRe = regexp.MustCompile("// want `([^`]*)`")
+
+// runAnalyzer runs Analyzer on the package at path of testdata/src with its
+// test files and checks the diagnostics against the `// want` comments, a
+// diagnostic is wanted on a line whose comment pattern matches it.
+func runAnalyzer(t *testing.T, path string) {
+	t.Helper()
+	imp := newTestImporter(t)
+	pkg, files, info := imp.check(path, true)
+
+	var got []analysis.Diagnostic
+	pass := &analysis.Pass{
+		Analyzer:  Analyzer,
+		Fset:      imp.fset,
+		Files:     files,
+		Pkg:       pkg,
+		TypesInfo: info,
+		Report:    func(d analysis.Diagnostic) { got = append(got, d) },
+	}
+	if _, err := Analyzer.Run(pass); err != nil {
+		t.Fatal(err)
+	}
+
+	type line struct {
+		file string
+		line int
+	}
+	want := make(map[line]*regexp.Regexp)
+	for _, f := range files {
+		for _, group := range f.Comments {
+			for _, c := range group.List {
+				if m := wantRe.FindStringSubmatch(c.Text); m != nil {
+					pos := imp.fset.Position(c.Pos())
+					want[line{pos.Filename, pos.Line}] = regexp.MustCompile(m[1])
+				}
+			}
+		}
+	}
+	for _, d := range got {
+		pos := imp.fset.Position(d.Pos)
+		key := line{pos.Filename, pos.Line}
+		re, ok := want[key]
+		if !ok || !re.MatchString(d.Message) {
+			t.Errorf("%s: unexpected diagnostic %q", pos, d.Message)
+			continue
+		}
+		delete(want, key)
+	}
+	var missing []string
+	for key, re := range want {
+		missing = append(missing, key.file+":"+strconv.Itoa(key.line)+": no diagnostic matching "+re.String())
+	}
+	sort.Strings(missing)
+	for _, m := range missing {
+		t.Error(m)
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	runAnalyzer(t, "contract")
+	//不依赖so的包及so的子包不是合约
+	runAnalyzer(t, "plain")
+	runAnalyzer(t, "pdx-chain-so/so/shim")
+}
+
+func TestAnalyzerAllPkgs(t *testing.T) {
+	allPkgs = true
+	defer func() { allPkgs = false }()
+	runAnalyzer(t, "allpkgs")
+}
@@ -0,0 +1,10 @@
+package allpkgs
+
+import (
+	"os" // want `import of os: the operating system differs between nodes`
+	"time"
+)
+
+func Now() (time.Time, string) {
+	return time.Now(), os.Getenv("HOME") // want `call of time.Now`
+}
@@ -0,0 +1,90 @@
+package contract
+
+import (
+	"crypto/rand"        // want `import of crypto/rand: random numbers differ between nodes`
+	mrand "math/rand/v2" // want `import of math/rand/v2: random numbers differ between nodes`
+	"net/url"            // want `import of net/url: the network differs between nodes`
+	"sort"
+	"time"
+
+	"pdx-chain-so/so"
+)
+
+var _, _, _ = rand.Reader, mrand.Int, url.Parse
+
+func Clock(stub so.StubInterface) {
+	_ = time.Now()          // want `call of time.Now: the clock differs between nodes, use GetTxTimestamp`
+	time.Sleep(time.Second) // want `call of time.Sleep`
+	ts, _ := stub.GetTxTimestamp()
+	_ = time.Unix(int64(ts), 0).Add(time.Minute)
+}
+
+func Goroutines(a, b chan int) {
+	go func() {}() // want `go statement`
+	select {       // want `select statement`
+	case <-a:
+	case <-b:
+	}
+	select {
+	case <-a:
+	}
+	select { // want `select statement`
+	case <-a:
+	default:
+	}
+}
+
+func Writes(stub so.StubInterface, m map[string]string) {
+	for k, v := range m { // want `range over map calls the stub`
+		stub.PutState([]byte(k), []byte(v))
+	}
+}
+
+func First(m map[string]int) string {
+	for k := range m { // want `range over map returns`
+		return k
+	}
+	return ""
+}
+
+func Keys(m map[string]int) []string {
+	var keys []string
+	for k := range m { // want `range over map appends to a slice`
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func SortedKeys(m map[string]int) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func SortedSlice(m map[string]int) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Sort(sort.StringSlice(keys))
+	return keys
+}
+
+func Sum(m map[string]int) int {
+	n := 0
+	for _, v := range m {
+		n += v
+	}
+	return n
+}
+
+func Nested(stub so.StubInterface, m map[string]string) func() {
+	return func() {
+		for k := range m { // want `range over map calls the stub`
+			stub.PutState([]byte(k), nil)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package contract
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	_ = time.Now()
+	_ = os.Getenv("HOME")
+}
@@ -0,0 +1,6 @@
+package so
+
+type StubInterface interface {
+	GetTxTimestamp() (uint64, error)
+	PutState(key []byte, value []byte) error
+}
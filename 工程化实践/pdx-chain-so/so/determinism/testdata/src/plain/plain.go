@@ -0,0 +1,10 @@
+package plain
+
+import (
+	"math/rand"
+	"time"
+)
+
+func Now() int64 {
+	return time.Now().Unix() + rand.Int63()
+}
@@ -0,0 +1,278 @@
+package so
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+)
+
+// DocumentStore keeps the committed JSON documents of contracts and their
+// indexes, it is local to the node and serves the rich queries of
+// GetQueryResult. It only changes when Apply is called once a block is
+// accepted, so a query during a block sees the state of the blocks before
+// it, whatever the transactions of the block wrote. Since what the store
+// holds depends on the node, only the read-only invocations of
+// Registry.Query may use it, never a transaction.
+type DocumentStore struct {
+	mu        sync.RWMutex
+	contracts map[common.Address]*documents
+}
+
+// documents holds the documents of one contract.
+type documents struct {
+	docs    map[string]map[string]interface{}
+	values  map[string][]byte
+	indexes []*docIndex
+}
+
+// docIndex holds the documents having every field of an index, sorted by
+// the values of the fields and then by key.
+type docIndex struct {
+	def     *IndexDef
+	paths   [][]string
+	entries []*indexEntry
+}
+
+type indexEntry struct {
+	values []interface{}
+	key    string
+}
+
+func NewDocumentStore() *DocumentStore {
+	return &DocumentStore{
+		contracts: make(map[common.Address]*documents),
+	}
+}
+
+// Apply records the writes of a committed transaction, the host calls it
+// for the transactions of a block in order once the block is accepted. The
+// indexes declared by DefineIndex are read from db and built when new.
+func (s *DocumentStore) Apply(db *state.MStateDB, rwset *TxRWSet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ns := range rwset.NsRWSets {
+		c, err := s.contract(db, ns.Address)
+		if err != nil {
+			return err
+		}
+		for _, w := range ns.Writes {
+			c.put(w.Key, w.Value)
+		}
+	}
+	return nil
+}
+
+// Rebuild loads every document of the contract at addr from db, a node
+// calls it for the contracts it serves when the store is empty.
+func (s *DocumentStore) Rebuild(db *state.MStateDB, addr common.Address) error {
+	keys, err := keysBetween(db, addr, "", "")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.contracts, addr)
+	c, err := s.contract(db, addr)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		c.put(key, db.GetPDXState(addr, StateKeySlot([]byte(key))))
+	}
+	return nil
+}
+
+// contract returns the documents of addr with the indexes declared in db,
+// the store lock must be held.
+func (s *DocumentStore) contract(db *state.MStateDB, addr common.Address) (*documents, error) {
+	defs, err := GetIndexes(db, addr)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := s.contracts[addr]
+	if !ok {
+		c = &documents{
+			docs:   make(map[string]map[string]interface{}),
+			values: make(map[string][]byte),
+		}
+		s.contracts[addr] = c
+	}
+	for _, def := range defs[len(c.indexes):] {
+		c.addIndex(def)
+	}
+	return c, nil
+}
+
+func (c *documents) addIndex(def *IndexDef) {
+	idx := &docIndex{def: def}
+	for _, f := range def.Fields {
+		idx.paths = append(idx.paths, strings.Split(f, "."))
+	}
+	for key, doc := range c.docs {
+		idx.insert(key, doc)
+	}
+	c.indexes = append(c.indexes, idx)
+}
+
+// put stores the value of key, an empty value deletes it. Values that are
+// not JSON objects are kept but never indexed or selected.
+func (c *documents) put(key string, value []byte) {
+	if old, ok := c.docs[key]; ok {
+		for _, idx := range c.indexes {
+			idx.remove(key, old)
+		}
+		delete(c.docs, key)
+	}
+	if len(value) == 0 {
+		delete(c.values, key)
+		return
+	}
+	c.values[key] = common.CopyBytes(value)
+	doc, ok := decodeDocument(value)
+	if !ok {
+		return
+	}
+	c.docs[key] = doc
+	for _, idx := range c.indexes {
+		idx.insert(key, doc)
+	}
+}
+
+func (idx *docIndex) entry(key string, doc map[string]interface{}) *indexEntry {
+	e := &indexEntry{key: key}
+	for _, p := range idx.paths {
+		v, ok := lookupField(doc, p)
+		if !ok {
+			return nil
+		}
+		e.values = append(e.values, v)
+	}
+	return e
+}
+
+func (idx *docIndex) search(e *indexEntry) int {
+	return sort.Search(len(idx.entries), func(i int) bool {
+		return !idx.entries[i].less(e)
+	})
+}
+
+func (idx *docIndex) insert(key string, doc map[string]interface{}) {
+	e := idx.entry(key, doc)
+	if e == nil {
+		return
+	}
+	i := idx.search(e)
+	idx.entries = append(idx.entries, nil)
+	copy(idx.entries[i+1:], idx.entries[i:])
+	idx.entries[i] = e
+}
+
+func (idx *docIndex) remove(key string, doc map[string]interface{}) {
+	e := idx.entry(key, doc)
+	if e == nil {
+		return
+	}
+	i := idx.search(e)
+	if i < len(idx.entries) && idx.entries[i].key == key {
+		idx.entries = append(idx.entries[:i], idx.entries[i+1:]...)
+	}
+}
+
+func (e *indexEntry) less(o *indexEntry) bool {
+	for i := range e.values {
+		if c := compareJSON(e.values[i], o.values[i]); c != 0 {
+			return c < 0
+		}
+	}
+	return e.key < o.key
+}
+
+// candidates returns the keys the index holds for the conditions of sel on
+// the first field of the index, ok is false if sel has none.
+func (idx *docIndex) candidates(sel *selector) (keys []string, ok bool) {
+	var conds []*condition
+	for _, c := range sel.conds {
+		if reflect.DeepEqual(c.path, idx.paths[0]) && c.op != "$ne" && c.op != "$exists" {
+			conds = append(conds, c)
+		}
+	}
+	if len(conds) == 0 {
+		return nil, false
+	}
+	//按比较条件二分出首字段的取值区间,区间内再逐条过滤
+	lo, hi := 0, len(idx.entries)
+	for _, c := range conds {
+		switch c.op {
+		case "$eq", "$gte", "$gt":
+			strict := c.op == "$gt"
+			if i := sort.Search(len(idx.entries), func(i int) bool {
+				cmp := compareJSON(idx.entries[i].values[0], c.value)
+				return cmp > 0 || (cmp == 0 && !strict)
+			}); i > lo {
+				lo = i
+			}
+		}
+		switch c.op {
+		case "$eq", "$lte", "$lt":
+			strict := c.op == "$lt"
+			if i := sort.Search(len(idx.entries), func(i int) bool {
+				cmp := compareJSON(idx.entries[i].values[0], c.value)
+				return cmp > 0 || (cmp == 0 && strict)
+			}); i < hi {
+				hi = i
+			}
+		}
+	}
+	for i := lo; i < hi; i++ {
+		e := idx.entries[i]
+		matched := true
+		for _, c := range conds {
+			if !c.matchValue(e.values[0], true) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			keys = append(keys, e.key)
+		}
+	}
+	return keys, true
+}
+
+// query runs q against the documents of addr, see Query.Select. The first
+// index on a field q puts a condition on narrows the documents to look at,
+// the results do not depend on the indexes. A contract the store was never
+// rebuilt or applied for fails with SoCallError_Rich_Query_Unavailable
+// rather than looking empty.
+func (s *DocumentStore) query(addr common.Address, q *Query, pageSize int32, bookmark string) ([]*KV, *QueryResponseMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.contracts[addr]
+	if !ok {
+		return nil, nil, SoCallError_Rich_Query_Unavailable
+	}
+	var keys []string
+	found := false
+	for _, idx := range c.indexes {
+		if keys, found = idx.candidates(q.selector); found {
+			break
+		}
+	}
+	if !found {
+		keys = make([]string, 0, len(c.docs))
+		for key := range c.docs {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	kvs := make([]*KV, len(keys))
+	for i, key := range keys {
+		kvs[i] = &KV{Key: key, Value: c.values[key]}
+	}
+	results, md := q.Select(kvs, pageSize, bookmark)
+	return results, md, nil
+}
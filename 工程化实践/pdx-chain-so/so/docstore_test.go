@@ -0,0 +1,168 @@
+package so
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+)
+
+func TestDocumentStore(t *testing.T) {
+	db := newTestMStateDB(t)
+	if err := DefineIndex(db, testAddr, &IndexDef{Name: "byOwner", Fields: []string{"owner", "size"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DefineIndex(db, testAddr, &IndexDef{Name: "byOwner", Fields: []string{"size"}}); err != SoCallError_Index_Exists {
+		t.Errorf("DefineIndex of an existing name = %v, want %v", err, SoCallError_Index_Exists)
+	}
+	if err := DefineIndex(db, testAddr, &IndexDef{Name: "empty", Fields: []string{""}}); err != SoCallError_Index_Illegal {
+		t.Errorf("DefineIndex of an empty field = %v, want %v", err, SoCallError_Index_Illegal)
+	}
+	r := NewRegistry()
+	r.Documents = NewDocumentStore()
+	deployTestContract(t, r, db, testAddr)
+
+	query := func(q string) string {
+		t.Helper()
+		res, err := r.Query(db, testAddr, nil, testArgs("query", q))
+		if err != nil {
+			t.Fatalf("query %s: %v", q, err)
+		}
+		return string(res.Payload)
+	}
+	apply := func(args ...string) {
+		t.Helper()
+		res, err := r.Invoke(db, testAddr, nil, testArgs(append([]string{"put"}, args...)...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Documents.Apply(db, res.RWSet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	apply("c1", `{"owner": "tom", "size": 3}`, "c2", `{"owner": "bob", "size": 1}`, "c3", `{"owner": "tom", "size": 1}`, "raw", "not json")
+
+	byOwner := `{"selector": {"owner": "tom"}}`
+	bySize := `{"selector": {"size": {"$lt": 3}}}`
+	if got := query(byOwner); got != "c1,c3" {
+		t.Errorf("documents of tom = %q", got)
+	}
+	if got := query(bySize); got != "c2,c3" {
+		t.Errorf("small documents = %q", got)
+	}
+
+	//未提交到文档库的写入不可见
+	pending, err := r.Invoke(db, testAddr, nil, testArgs("put", "c4", `{"owner": "tom", "size": 2}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := query(byOwner); got != "c1,c3" {
+		t.Errorf("documents of tom before the block is applied = %q", got)
+	}
+	if err := r.Documents.Apply(db, pending.RWSet); err != nil {
+		t.Fatal(err)
+	}
+
+	apply("c1", `{"owner": "bob", "size": 3}`, "c3", "")
+	if got := query(byOwner); got != "c4" {
+		t.Errorf("documents of tom after an update = %q", got)
+	}
+
+	//重建的文档库与增量维护的结果一致
+	rebuilt := NewDocumentStore()
+	if err := rebuilt.Rebuild(db, testAddr); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{byOwner, bySize, `{"selector": {}}`} {
+		want := query(q)
+		r.Documents, rebuilt = rebuilt, r.Documents
+		if got := query(q); got != want {
+			t.Errorf("rebuilt store answers %s with %q, want %q", q, got, want)
+		}
+		r.Documents, rebuilt = rebuilt, r.Documents
+	}
+
+	//交易中的富查询结果取决于节点本地的文档库,因此被拒绝
+	if _, err := r.Invoke(db, testAddr, nil, testArgs("query", byOwner)); !errors.Is(err, SoCallError_Rich_Query_Read_Only) {
+		t.Errorf("rich query in a transaction = %v, want %v", err, SoCallError_Rich_Query_Read_Only)
+	}
+	//只读查询的写入不保留
+	if _, err := r.Query(db, testAddr, nil, testArgs("put", "c5", `{"owner": "tom"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if v := getTestState(db, testAddr, "c5"); v != "" {
+		t.Errorf("write of a query was kept: %q", v)
+	}
+
+	//未重建文档库的合约报错,而不是返回空结果
+	other := common.HexToAddress("0x11")
+	deployTestContract(t, r, db, other)
+	if _, err := r.Query(db, other, nil, testArgs("query", byOwner)); !errors.Is(err, SoCallError_Rich_Query_Unavailable) {
+		t.Errorf("query of a contract missing from the store = %v, want %v", err, SoCallError_Rich_Query_Unavailable)
+	}
+	r.Documents = nil
+	if _, err := r.Query(db, testAddr, nil, testArgs("query", byOwner)); !errors.Is(err, SoCallError_Rich_Query_Unavailable) {
+		t.Errorf("query without a document store = %v, want %v", err, SoCallError_Rich_Query_Unavailable)
+	}
+}
+
+func TestDocumentStoreIndexes(t *testing.T) {
+	//有无索引的查询结果必须相同
+	db := newTestMStateDB(t)
+	var kvs []string
+	for i := 0; i < 50; i++ {
+		kvs = append(kvs, fmt.Sprintf("k%02d", i), fmt.Sprintf(`{"a": %d, "b": "%c"}`, i%7, 'x'+i%3))
+	}
+	putStates(t, db, kvs...)
+	plain := NewDocumentStore()
+	if err := plain.Rebuild(db, testAddr); err != nil {
+		t.Fatal(err)
+	}
+	if err := DefineIndex(db, testAddr, &IndexDef{Name: "ab", Fields: []string{"a", "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DefineIndex(db, testAddr, &IndexDef{Name: "b", Fields: []string{"b"}}); err != nil {
+		t.Fatal(err)
+	}
+	indexed := NewDocumentStore()
+	if err := indexed.Rebuild(db, testAddr); err != nil {
+		t.Fatal(err)
+	}
+
+	queries := []string{
+		`{"selector": {"a": 3}}`,
+		`{"selector": {"a": {"$gte": 5}}}`,
+		`{"selector": {"a": {"$in": [1, 2]}, "b": "y"}}`,
+		`{"selector": {"b": {"$gt": "x"}}}`,
+		`{"selector": {"$or": [{"a": 0}, {"b": "z"}]}}`,
+		`{"selector": {"a": {"$ne": 3}}}`,
+	}
+	for _, query := range queries {
+		q, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pageSize := range []int32{0, 4} {
+			want, wantMD, err := plain.query(testAddr, q, pageSize, "k10")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, gotMD, err := indexed.query(testAddr, q, pageSize, "k10")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(keysOf(got), *gotMD) != fmt.Sprint(keysOf(want), *wantMD) {
+				t.Errorf("%s page %d: indexed %v %+v, scanned %v %+v", query, pageSize, keysOf(got), gotMD, keysOf(want), wantMD)
+			}
+		}
+	}
+}
+
+func keysOf(kvs []*KV) []string {
+	keys := make([]string, len(kvs))
+	for i, kv := range kvs {
+		keys[i] = kv.Key
+	}
+	return keys
+}
@@ -0,0 +1,226 @@
+package so
+
+import (
+	"errors"
+	"sync"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/types"
+	"pdx-chain-so/pkg/pdx-chain/ethdb"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+)
+
+var ErrSubscriptionOverflow = errors.New("Event subscription fell behind and was closed")
+
+var eventPrefix = []byte("pdx-so-events")
+
+// eventKey is the database key of the events of block num.
+func eventKey(num uint64) []byte {
+	return append(common.CopyBytes(eventPrefix), common.Uint64ToByte(num)...)
+}
+
+// EventFilter selects events by contract address and event name. An empty
+// list matches every address or name.
+type EventFilter struct {
+	Addresses []common.Address
+	Names     []string
+}
+
+// Match reports whether log is selected by the filter.
+func (f *EventFilter) Match(log *types.Log) bool {
+	if len(f.Addresses) > 0 {
+		found := false
+		for _, addr := range f.Addresses {
+			if addr == log.Address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Names) > 0 {
+		found := false
+		for _, name := range f.Names {
+			if name == log.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// EventDatabase is the key/value store an EventStore keeps the events in,
+// usually the chain database of the node.
+type EventDatabase interface {
+	ethdb.KeyValueReader
+	ethdb.KeyValueWriter
+}
+
+// EventStore keeps the events emitted by contracts in accepted blocks and
+// delivers them to subscribers. The events of a block are written to the
+// database under its number, so they outlive the process, the
+// subscriptions only see the blocks added while they last.
+type EventStore struct {
+	mu   sync.RWMutex
+	db   EventDatabase
+	subs map[*EventSubscription]struct{}
+}
+
+func NewEventStore(db EventDatabase) *EventStore {
+	return &EventStore{
+		db:   db,
+		subs: make(map[*EventSubscription]struct{}),
+	}
+}
+
+// AddBlock records the events emitted while processing the block with the
+// given number and hash, usually MStateDB.Logs(). The host calls it once the
+// block is accepted, reverted invocations have no events left by then. A
+// block added again replaces the events of the earlier one.
+func (s *EventStore) AddBlock(num uint64, hash common.Hash, logs []*types.Log) error {
+	events := make([]*types.Log, len(logs))
+	for i, l := range logs {
+		ev := *l
+		ev.BlockNumber, ev.BlockHash = num, hash
+		events[i] = &ev
+	}
+	enc, err := rlp.EncodeToBytes(events)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.db.Put(eventKey(num), enc); err != nil {
+		return err
+	}
+	for sub := range s.subs {
+		for _, ev := range events {
+			if !sub.filter.Match(ev) {
+				continue
+			}
+			select {
+			case sub.events <- ev:
+			default:
+				delete(s.subs, sub)
+				sub.close(ErrSubscriptionOverflow)
+			}
+			if sub.closed {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// GetEvents returns the events of block num, none for a block that was
+// never added.
+func (s *EventStore) GetEvents(num uint64) ([]*types.Log, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.events(num)
+}
+
+// events reads the events of block num, the store lock must be held.
+func (s *EventStore) events(num uint64) ([]*types.Log, error) {
+	key := eventKey(num)
+	if ok, err := s.db.Has(key); err != nil || !ok {
+		return nil, err
+	}
+	enc, err := s.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	var events []*types.Log
+	if err := rlp.DecodeBytes(enc, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// FilterEvents returns the events of the blocks [start, end) selected by
+// filter, in block order.
+func (s *EventStore) FilterEvents(filter EventFilter, start, end uint64) ([]*types.Log, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var events []*types.Log
+	for num := start; num < end; num++ {
+		block, err := s.events(num)
+		if err != nil {
+			return nil, err
+		}
+		for _, ev := range block {
+			if filter.Match(ev) {
+				events = append(events, ev)
+			}
+		}
+	}
+	return events, nil
+}
+
+// Subscribe delivers the events of blocks added from now on that are
+// selected by filter. Up to buffer events are queued for the subscriber, a
+// subscriber falling further behind is closed with ErrSubscriptionOverflow
+// and can catch up with FilterEvents.
+func (s *EventStore) Subscribe(filter EventFilter, buffer int) *EventSubscription {
+	sub := &EventSubscription{
+		store:  s,
+		filter: filter,
+		events: make(chan *types.Log, buffer),
+		err:    make(chan error, 1),
+	}
+	s.mu.Lock()
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+	return sub
+}
+
+// EventSubscription is a stream of events created by EventStore.Subscribe.
+type EventSubscription struct {
+	store  *EventStore
+	filter EventFilter
+	events chan *types.Log
+	err    chan error
+	closed bool
+}
+
+// Events returns the channel the selected events are delivered on, it is
+// closed when the subscription ends.
+func (sub *EventSubscription) Events() <-chan *types.Log {
+	return sub.events
+}
+
+// Err returns a channel that receives the error that ended the
+// subscription, it is closed without a value on Unsubscribe.
+func (sub *EventSubscription) Err() <-chan error {
+	return sub.err
+}
+
+// Unsubscribe stops the delivery of events.
+func (sub *EventSubscription) Unsubscribe() {
+	sub.store.mu.Lock()
+	defer sub.store.mu.Unlock()
+	if _, ok := sub.store.subs[sub]; ok {
+		delete(sub.store.subs, sub)
+		sub.close(nil)
+	}
+}
+
+// close ends the subscription, the store lock must be held.
+func (sub *EventSubscription) close(err error) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	if err != nil {
+		sub.err <- err
+	}
+	close(sub.err)
+	close(sub.events)
+}
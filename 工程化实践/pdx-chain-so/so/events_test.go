@@ -0,0 +1,128 @@
+package so
+
+import (
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/types"
+	"pdx-chain-so/pkg/pdx-chain/ethdb/memorydb"
+)
+
+func TestSetEvent(t *testing.T) {
+	db := newTestMStateDB(t)
+	r := NewRegistry()
+	deployTestContract(t, r, db, testAddr)
+
+	if _, err := r.Invoke(db, testAddr, nil, testArgs("event", "transfer", "payload")); err != nil {
+		t.Fatal(err)
+	}
+	logs := db.GetLogs(common.HexToHash("0x01"))
+	if len(logs) != 1 {
+		t.Fatalf("transaction has %d events, want 1", len(logs))
+	}
+	if l := logs[0]; l.Address != testAddr || l.Name != "transfer" || string(l.Payload) != "payload" {
+		t.Errorf("event = %+v", l)
+	}
+
+	//失败或panic的调用不留下事件
+	if _, err := r.Invoke(db, testAddr, nil, testArgs("putThenFail", "k", "v")); err == nil {
+		t.Fatal("putThenFail succeeded")
+	}
+	if _, err := r.Invoke(db, testAddr, nil, testArgs("putThenPanic", "k", "v")); err == nil {
+		t.Fatal("putThenPanic succeeded")
+	}
+	if n := len(db.Logs()); n != 1 {
+		t.Errorf("%d events after failed invocations, want 1", n)
+	}
+}
+
+func testLog(addr common.Address, name string) *types.Log {
+	return &types.Log{Address: addr, Name: name, Payload: []byte(name)}
+}
+
+func TestEventStore(t *testing.T) {
+	a, b := common.HexToAddress("0xa"), common.HexToAddress("0xb")
+	db := memorydb.New()
+	s := NewEventStore(db)
+	if err := s.AddBlock(1, common.HexToHash("0x1"), []*types.Log{testLog(a, "mint"), testLog(b, "mint")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddBlock(2, common.HexToHash("0x2"), []*types.Log{testLog(a, "burn")}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := s.GetEvents(1)
+	if err != nil || len(events) != 2 || events[0].BlockNumber != 1 || events[0].BlockHash != common.HexToHash("0x1") {
+		t.Errorf("events of block 1 = %v, %v", events, err)
+	}
+	if events, err := s.GetEvents(3); err != nil || len(events) != 0 {
+		t.Errorf("events of a missing block = %v, %v", events, err)
+	}
+	tests := []struct {
+		filter EventFilter
+		want   int
+	}{
+		{EventFilter{}, 3},
+		{EventFilter{Addresses: []common.Address{a}}, 2},
+		{EventFilter{Names: []string{"mint"}}, 2},
+		{EventFilter{Addresses: []common.Address{a}, Names: []string{"mint"}}, 1},
+		{EventFilter{Addresses: []common.Address{common.HexToAddress("0xc")}}, 0},
+	}
+	for _, tt := range tests {
+		if got, err := s.FilterEvents(tt.filter, 0, 3); err != nil || len(got) != tt.want {
+			t.Errorf("FilterEvents(%+v) returned %d events, %v, want %d", tt.filter, len(got), err, tt.want)
+		}
+	}
+	if got, err := s.FilterEvents(EventFilter{}, 2, 3); err != nil || len(got) != 1 || got[0].Name != "burn" {
+		t.Errorf("FilterEvents of block 2 = %v, %v", got, err)
+	}
+
+	//重启后从数据库读出同样的事件
+	reopened := NewEventStore(db)
+	events, err = reopened.GetEvents(1)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("events of block 1 after reopening = %v, %v", events, err)
+	}
+	if ev := events[1]; ev.Address != b || ev.Name != "mint" || string(ev.Payload) != "mint" || ev.BlockHash != common.HexToHash("0x1") {
+		t.Errorf("event after reopening = %+v", ev)
+	}
+	if got, err := reopened.FilterEvents(EventFilter{Addresses: []common.Address{a}}, 0, 3); err != nil || len(got) != 2 {
+		t.Errorf("FilterEvents after reopening returned %d events, %v, want 2", len(got), err)
+	}
+}
+
+func TestEventSubscription(t *testing.T) {
+	a, b := common.HexToAddress("0xa"), common.HexToAddress("0xb")
+	s := NewEventStore(memorydb.New())
+	sub := s.Subscribe(EventFilter{Addresses: []common.Address{a}}, 4)
+	s.AddBlock(1, common.HexToHash("0x1"), []*types.Log{testLog(a, "mint"), testLog(b, "mint"), testLog(a, "burn")})
+
+	for _, want := range []string{"mint", "burn"} {
+		if ev := <-sub.Events(); ev.Address != a || ev.Name != want || ev.BlockNumber != 1 {
+			t.Errorf("event = %+v, want %s of %x", ev, want, a)
+		}
+	}
+	sub.Unsubscribe()
+	if _, ok := <-sub.Events(); ok {
+		t.Error("events delivered after Unsubscribe")
+	}
+	if err, ok := <-sub.Err(); ok {
+		t.Errorf("Err after Unsubscribe = %v", err)
+	}
+	sub.Unsubscribe()
+	s.AddBlock(2, common.HexToHash("0x2"), []*types.Log{testLog(a, "mint")})
+
+	//订阅者落后超过缓冲时被关闭
+	slow := s.Subscribe(EventFilter{}, 1)
+	s.AddBlock(3, common.HexToHash("0x3"), []*types.Log{testLog(a, "mint"), testLog(b, "mint")})
+	if err := <-slow.Err(); err != ErrSubscriptionOverflow {
+		t.Errorf("Err of a slow subscriber = %v, want %v", err, ErrSubscriptionOverflow)
+	}
+	n := 0
+	for range slow.Events() {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("slow subscriber received %d events, want 1", n)
+	}
+}
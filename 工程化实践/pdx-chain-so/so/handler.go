@@ -1,21 +1,28 @@
 package so
 
 import (
-	"container/list"
 	"errors"
 	"pdx-chain-so/pkg/pdx-chain/common"
-	"pdx-chain-so/pkg/pdx-chain/core/public"
 	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/core/types"
 	"pdx-chain-so/pkg/pdx-chain/rlp"
 )
 
 var (
-	SoCallError_Input_Error             = errors.New("Input is illegal")
-	SoCallError_NoResult                = errors.New("No result by that given key")
-	SoCallError_Key_Value_NotMatch      = errors.New("Key value not match")
-	SoCallError_Start_FinishNum_Illegal = errors.New("Get History start and finish num is illegal")
-	SoCallError_History_Encode_Error    = errors.New("Get History result encode error")
-	SoCallError_History_Limit_Reached   = errors.New("Get History limit reached")
+	SoCallError_Input_Error               = errors.New("Input is illegal")
+	SoCallError_NoResult                  = errors.New("No result by that given key")
+	SoCallError_Key_Value_NotMatch        = errors.New("Key value not match")
+	SoCallError_Start_FinishNum_Illegal   = errors.New("Get History start and finish num is illegal")
+	SoCallError_History_Encode_Error      = errors.New("Get History result encode error")
+	SoCallError_History_Limit_Reached     = errors.New("Get History limit reached")
+	SoCallError_History_Bookmark_Illegal  = errors.New("Get History bookmark is illegal")
+	SoCallError_History_Block_Unavailable = errors.New("Get History block or its state is not available")
+	SoCallError_Chain_Unavailable         = errors.New("Blockchain is not available")
+	SoCallError_Range_Illegal             = errors.New("Get state by range start and end key is illegal")
+	SoCallError_Range_Encode_Error        = errors.New("Get state by range result encode error")
+	SoCallError_Key_Index_Error           = errors.New("Contract key index is corrupted")
+	SoCallError_Composite_Key_Illegal     = errors.New("Composite key is illegal")
+	SoCallError_Key_Namespace_Reserved    = errors.New("Key collides with a reserved namespace")
 )
 
 type messageType int
@@ -26,13 +33,34 @@ const (
 	Socall_PUT_STATES  messageType = 3
 	SoCall_DEL_STATE   messageType = 4
 	SoCall_GET_HISTORY messageType = 5
+
+	SoCall_GET_STATE_BY_RANGE messageType = 6
+	SoCall_SET_EVENT          messageType = 7
+
+	SoCall_PUT_PRIVATE_DATA      messageType = 8
+	SoCall_GET_PRIVATE_DATA      messageType = 9
+	SoCall_GET_PRIVATE_DATA_HASH messageType = 10
+
+	SoCall_GET_KEY_POLICY messageType = 11
+	SoCall_SET_KEY_POLICY messageType = 12
+
+	SoCall_GET_QUERY_RESULT messageType = 13
+
+	SoCall_GET_STATE_WITH_PROOF messageType = 23
 )
 
 var MaxSize = 5 * 1024 * 1024 * 1024
 
 type Handler struct {
-	db  *state.MStateDB
-	res chan *CallSoResMessage
+	db      *state.MStateDB
+	res     chan *CallSoResMessage
+	meter   *Meter
+	rwset   *TxRWSet
+	private *PrivateData
+	docs    *DocumentStore
+	// readOnly is set for the invocations of Registry.Query, only they
+	// may run rich queries.
+	readOnly bool
 }
 
 func NewHandler(db *state.MStateDB) *Handler {
@@ -42,23 +70,46 @@ func NewHandler(db *state.MStateDB) *Handler {
 	}
 }
 
+// NewHandlerWithMeter returns a handler charging every operation to meter.
+func NewHandlerWithMeter(db *state.MStateDB, meter *Meter) *Handler {
+	h := NewHandler(db)
+	h.meter = meter
+	return h
+}
+
 func (h *Handler) handle(message *CallSoSendMessage) (res *CallSoResMessage) {
+	if message.callType == SoCall_GET_STATE_BY_RANGE {
+		//范围查询的起止key允许为空,不做输入校验
+		return h.handleGetStateByRange(message)
+	}
+
 	var resMessage *CallSoResMessage
 	resMessage = validityInput(message.inputs[0])
 	if resMessage != nil {
 		return resMessage
 	}
-	key := common.BytesToHash(message.inputs[0])
+	key := StateKeySlot(message.inputs[0])
 
 	switch message.callType {
 
 	case SoCall_GET_STATE:
 		v := h.db.GetPDXState(message.address, key)
+		if err := h.meter.read(len(v)); err != nil {
+			return &CallSoResMessage{
+				res: nil,
+				err: err,
+			}
+		}
 		if len(v) == 0 {
 			resMessage = &CallSoResMessage{
 				res: nil,
 				err: SoCallError_NoResult,
 			}
+		} else {
+			resMessage = &CallSoResMessage{
+				res: v,
+				err: nil,
+			}
 		}
 
 		println("get state called")
@@ -70,8 +121,22 @@ func (h *Handler) handle(message *CallSoSendMessage) (res *CallSoResMessage) {
 				err: SoCallError_Key_Value_NotMatch,
 			}
 		}
+		if resMessage = validityKey(message.inputs[0]); resMessage != nil {
+			return resMessage
+		}
+		if err := h.meter.write(len(message.inputs[0]) + len(message.inputs[1])); err != nil {
+			return &CallSoResMessage{
+				res: nil,
+				err: err,
+			}
+		}
 
-		h.db.SetPDXState(message.address, key, message.inputs[1])
+		if err := h.setState(message.address, message.inputs[0], message.inputs[1]); err != nil {
+			return &CallSoResMessage{
+				res: nil,
+				err: err,
+			}
+		}
 
 		resMessage = &CallSoResMessage{
 			err: nil,
@@ -86,11 +151,21 @@ func (h *Handler) handle(message *CallSoSendMessage) (res *CallSoResMessage) {
 			}
 		}
 
-		for i := 0; i < len(message.inputs)%2; i++ {
+		//批量写入来自SOCallStub的写集,各写入在缓冲时已计费
+		for i := 0; i < len(message.inputs)/2; i++ {
+			if resMessage = validityKey(message.inputs[i*2]); resMessage != nil {
+				return resMessage
+			}
+		}
+		for i := 0; i < len(message.inputs)/2; i++ {
 			k := message.inputs[i*2]
-			tpk := common.BytesToHash(k)
 			v := message.inputs[i*2+1]
-			h.db.SetPDXState(message.address, tpk, v)
+			if err := h.setState(message.address, k, v); err != nil {
+				return &CallSoResMessage{
+					res: nil,
+					err: err,
+				}
+			}
 		}
 
 		resMessage = &CallSoResMessage{
@@ -99,7 +174,21 @@ func (h *Handler) handle(message *CallSoSendMessage) (res *CallSoResMessage) {
 		println("put states called")
 
 	case SoCall_DEL_STATE:
-		h.db.SetPDXState(message.address, key, []byte{})
+		if resMessage = validityKey(message.inputs[0]); resMessage != nil {
+			return resMessage
+		}
+		if err := h.meter.write(len(message.inputs[0])); err != nil {
+			return &CallSoResMessage{
+				res: nil,
+				err: err,
+			}
+		}
+		if err := h.setState(message.address, message.inputs[0], []byte{}); err != nil {
+			return &CallSoResMessage{
+				res: nil,
+				err: err,
+			}
+		}
 
 		resMessage = &CallSoResMessage{
 			err: nil,
@@ -108,81 +197,127 @@ func (h *Handler) handle(message *CallSoSendMessage) (res *CallSoResMessage) {
 
 	case SoCall_GET_HISTORY:
 		//查询历史
-		if len(message.inputs)%3 != 0 {
+		resMessage = h.handleGetHistory(message)
+
+	case SoCall_SET_EVENT:
+		//事件随交易记录,回滚快照时一并丢弃
+		if len(message.inputs) != 2 {
 			return &CallSoResMessage{
 				res: nil,
 				err: SoCallError_Key_Value_NotMatch,
 			}
 		}
-
-		start := message.inputs[1]
-		finish := message.inputs[2]
-
-		startNum := common.ByteToUint64(start)
-		finishNum := common.ByteToUint64(finish)
-
-		if startNum < 0 {
+		if err := h.meter.event(len(message.inputs[0]) + len(message.inputs[1])); err != nil {
 			return &CallSoResMessage{
 				res: nil,
-				err: SoCallError_Start_FinishNum_Illegal,
+				err: err,
 			}
 		}
+		h.db.AddLog(&types.Log{
+			Address: message.address,
+			Name:    string(message.inputs[0]),
+			Payload: common.CopyBytes(message.inputs[1]),
+		})
+		resMessage = &CallSoResMessage{
+			err: nil,
+		}
 
-		if finishNum < 0 {
-			return &CallSoResMessage{
-				res: nil,
-				err: SoCallError_Start_FinishNum_Illegal,
-			}
+	case SoCall_PUT_PRIVATE_DATA:
+		resMessage = h.handlePutPrivateData(message)
+
+	case SoCall_GET_PRIVATE_DATA:
+		resMessage = h.handleGetPrivateData(message)
+
+	case SoCall_GET_PRIVATE_DATA_HASH:
+		resMessage = h.handleGetPrivateDataHash(message)
+
+	case SoCall_GET_KEY_POLICY:
+		resMessage = h.handleGetKeyPolicy(message)
+
+	case SoCall_SET_KEY_POLICY:
+		resMessage = h.handleSetKeyPolicy(message)
+
+	case SoCall_GET_QUERY_RESULT:
+		resMessage = h.handleGetQueryResult(message)
+
+	case SoCall_GET_STATE_WITH_PROOF:
+		resMessage = h.handleGetStateWithProof(message)
+	}
+
+	return resMessage
+}
+
+// setState writes value under key into the contract storage and keeps the
+// key index and the key modification metadata in step, an empty value
+// deletes the key.
+func (h *Handler) setState(addr common.Address, key []byte, value []byte) error {
+	slot := StateKeySlot(key)
+	old := h.db.GetPDXState(addr, slot)
+	h.db.SetPDXState(addr, slot, value)
+	if err := updateKeyIndex(h.db, addr, key, old, value); err != nil {
+		return SoCallError_Key_Index_Error
+	}
+	if err := writeKeyMeta(h.db, addr, key, len(value) == 0); err != nil {
+		return SoCallError_History_Encode_Error
+	}
+	return nil
+}
+
+// handleGetStateByRange walks the key index of the contract and returns the
+// rlp encoded key/value pairs in [inputs[0], inputs[1]).
+func (h *Handler) handleGetStateByRange(message *CallSoSendMessage) *CallSoResMessage {
+	if len(message.inputs) != 2 {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Key_Value_NotMatch,
 		}
+	}
 
-		if startNum > finishNum {
-			return &CallSoResMessage{
-				res: nil,
-				err: SoCallError_Start_FinishNum_Illegal,
-			}
+	startKey := string(message.inputs[0])
+	endKey := string(message.inputs[1])
+	if endKey != "" && startKey > endKey {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Range_Illegal,
 		}
+	}
 
-		var totalSize uint64
-		recordList := new(list.List)
-		for i := startNum; i < finishNum; i++ {
-			block := public.BC.GetBlockByNumber(uint64(i))
-			stateDb, err := public.BC.StateAt(block.Header().Root)
-			if err != nil {
-				break
-			}
-			v := stateDb.GetPDXState(message.address, key)
-			if len(v) == 0 {
-				continue
-			}
+	keys, err := keysBetween(h.db, message.address, startKey, endKey)
+	if err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Key_Index_Error,
+		}
+	}
 
-			rEle := &RecordElement{
-				value: v,
-				num: block.NumberU64(),
-			}
-			recordList.PushFront(rEle)
-			s := rEle.Size()
-			totalSize += s
-			if totalSize >= uint64(MaxSize) {
-				println("err", "get history max size reached")
-				//log.Error("get history max size reached")
-				break
-			}
+	results := make([]*KV, 0, len(keys))
+	size := 0
+	for _, k := range keys {
+		v := h.db.GetPDXState(message.address, StateKeySlot([]byte(k)))
+		if len(v) == 0 {
+			continue
 		}
-		data, err := rlp.EncodeToBytes(recordList)
-		if err != nil {
-			return &CallSoResMessage{
-				res: nil,
-				err: SoCallError_History_Encode_Error,
-			}
+		results = append(results, &KV{Key: k, Value: v})
+		size += len(k) + len(v)
+	}
+	if err := h.meter.readRange(len(results), size); err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: err,
 		}
+	}
 
-		resMessage = &CallSoResMessage{
-			res: data,
-			err: SoCallError_History_Limit_Reached,
+	data, err := rlp.EncodeToBytes(results)
+	if err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Range_Encode_Error,
 		}
 	}
-
-	return resMessage
+	return &CallSoResMessage{
+		res: data,
+		err: nil,
+	}
 }
 
 func validityInput(input []byte) *CallSoResMessage {
@@ -195,29 +330,60 @@ func validityInput(input []byte) *CallSoResMessage {
 	return nil
 }
 
+// validityKey checks that a key written by a contract is either a simple key
+// outside the composite key namespace or a well formed composite key.
+func validityKey(key []byte) *CallSoResMessage {
+	if len(key) == 0 {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Input_Error,
+		}
+	}
+	if isCompositeKey(key) {
+		if _, _, err := SplitCompositeKey(string(key)); err != nil {
+			return &CallSoResMessage{
+				res: nil,
+				err: SoCallError_Key_Namespace_Reserved,
+			}
+		}
+	}
+	return nil
+}
+
+// RecordElement is one modification of a key returned by a history query.
 type RecordElement struct {
-	value   []byte
-	num     uint64
+	Value    []byte
+	BlockNum uint64
+	TxHash   common.Hash
+	IsDelete bool
 }
 
 func (r *RecordElement) GetValue() []byte {
-	return r.value
+	return r.Value
 }
 
 func (r *RecordElement) GetNum() uint64 {
-	return r.num
+	return r.BlockNum
+}
+
+func (r *RecordElement) GetTxHash() common.Hash {
+	return r.TxHash
+}
+
+func (r *RecordElement) GetIsDelete() bool {
+	return r.IsDelete
 }
 
 func (r *RecordElement) SetValue(v []byte) {
-	r.value = v
+	r.Value = v
 }
 
 func (r *RecordElement) SetNum(n uint64) {
-	r.num = n
+	r.BlockNum = n
 }
 
 func (r *RecordElement) Size() uint64 {
-	data,err := rlp.EncodeToBytes(r)
+	data, err := rlp.EncodeToBytes(r)
 	if err != nil {
 		return 0
 	}
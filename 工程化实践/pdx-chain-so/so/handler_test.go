@@ -0,0 +1,145 @@
+package so
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/ethdb/memorydb"
+)
+
+var testAddr = common.HexToAddress("0x10")
+
+// newTestMStateDB returns a single view of an empty in-memory state running
+// the transaction 0x01.
+func newTestMStateDB(t *testing.T) *state.MStateDB {
+	t.Helper()
+	st, err := state.New(common.Hash{}, state.NewDatabase(memorydb.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs, err := state.NewMStateDB(st, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs[0].Prepare(common.HexToHash("0x01"), common.Hash{}, 0)
+	return dbs[0]
+}
+
+// putStates writes the key/value pairs of kvs, an empty value deletes the
+// key, through a stub of the contract at testAddr and commits them.
+func putStates(t *testing.T, db *state.MStateDB, kvs ...string) {
+	t.Helper()
+	stub := NewSoCallStub(NewHandler(db), nil, testAddr)
+	for i := 0; i < len(kvs); i += 2 {
+		var err error
+		if kvs[i+1] == "" {
+			err = stub.DelState([]byte(kvs[i]))
+		} else {
+			err = stub.PutState([]byte(kvs[i]), []byte(kvs[i+1]))
+		}
+		if err != nil {
+			t.Fatalf("write %q: %v", kvs[i], err)
+		}
+	}
+	if err := stub.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+}
+
+// rangeKeys returns the pairs of GetStateByRange(start, end) as "key=value"
+// strings.
+func rangeKeys(t *testing.T, stub *SOCallStub, start, end string) []string {
+	t.Helper()
+	it, err := stub.GetStateByRange(start, end)
+	if err != nil {
+		t.Fatalf("range query: %v", err)
+	}
+	defer it.Close()
+	var kvs []string
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			t.Fatalf("range iterator: %v", err)
+		}
+		kvs = append(kvs, kv.Key+"="+string(kv.Value))
+	}
+	return kvs
+}
+
+func TestStateLongKeys(t *testing.T) {
+	db := newTestMStateDB(t)
+	tail := strings.Repeat("x", 40)
+	k1, k2 := "a"+tail, "b"+tail
+	putStates(t, db, k1, "1", k2, "2")
+
+	stub := NewSoCallStub(NewHandler(db), nil, testAddr)
+	for key, want := range map[string]string{k1: "1", k2: "2"} {
+		v, err := stub.GetState([]byte(key))
+		if err != nil || string(v) != want {
+			t.Errorf("GetState(%q) = %q, %v, want %q", key, v, err, want)
+		}
+	}
+	got := rangeKeys(t, stub, "", "")
+	if want := []string{k1 + "=1", k2 + "=2"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("GetStateByRange = %v, want %v", got, want)
+	}
+
+	putStates(t, db, k1, "")
+	if v, err := stub.GetState([]byte(k2)); err != nil || string(v) != "2" {
+		t.Errorf("GetState(%q) after deleting %q = %q, %v, want \"2\"", k2, k1, v, err)
+	}
+}
+
+// Tests that keys sharing their first 32 bytes, or longer than a slot, get
+// slots of their own and don't overwrite each other.
+func TestStateKeySlot(t *testing.T) {
+	prefix := strings.Repeat("p", 32)
+	keys := []string{
+		prefix,
+		prefix + "a",
+		prefix + "b",
+		prefix + "\x00",
+		strings.Repeat("p", 31) + "q",
+		strings.Repeat("p", 64),
+		strings.Repeat("p", 64) + "a",
+	}
+	slots := make(map[common.Hash]string)
+	for _, key := range keys {
+		slot := StateKeySlot([]byte(key))
+		if other, ok := slots[slot]; ok {
+			t.Errorf("keys %q and %q share the slot %x", key, other, slot)
+		}
+		slots[slot] = key
+	}
+	for _, reserved := range []common.Hash{keyIndexSlot, contractInfoSlot, contractVersionsSlot, keyPolicySlot(), docIndexSlot()} {
+		if key, ok := slots[reserved]; ok {
+			t.Errorf("key %q addresses the reserved slot %x", key, reserved)
+		}
+	}
+
+	db := newTestMStateDB(t)
+	h := NewHandler(db)
+	for i, key := range keys {
+		if err := h.setState(testAddr, []byte(key), []byte{byte(i + 1)}); err != nil {
+			t.Fatalf("setState(%q): %v", key, err)
+		}
+	}
+	for i, key := range keys {
+		if v := db.GetPDXState(testAddr, StateKeySlot([]byte(key))); !bytes.Equal(v, []byte{byte(i + 1)}) {
+			t.Errorf("value of %q is %x, want %x", key, v, []byte{byte(i + 1)})
+		}
+	}
+
+	// Deleting one of them leaves the others in place.
+	if err := h.setState(testAddr, []byte(prefix), nil); err != nil {
+		t.Fatalf("delete %q: %v", prefix, err)
+	}
+	for i, key := range keys[1:] {
+		if v := db.GetPDXState(testAddr, StateKeySlot([]byte(key))); !bytes.Equal(v, []byte{byte(i + 2)}) {
+			t.Errorf("value of %q after deleting %q is %x, want %x", key, prefix, v, []byte{byte(i + 2)})
+		}
+	}
+}
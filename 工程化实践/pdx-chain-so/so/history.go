@@ -0,0 +1,321 @@
+package so
+
+import (
+	"bytes"
+	"strconv"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/public"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+)
+
+// HistoryOrder is the order in which a history query returns records.
+type HistoryOrder uint8
+
+const (
+	HistoryNewestFirst HistoryOrder = 0
+	HistoryOldestFirst HistoryOrder = 1
+)
+
+var keyMetaPrefix = []byte("pdx-so-key-meta")
+
+// keyMeta is stored next to every contract key and records the transaction
+// that modified the key last, it lets a history query tell the transaction
+// behind each recorded value.
+type keyMeta struct {
+	TxHash   common.Hash
+	IsDelete bool
+}
+
+// keyMetaSlot returns the PDX storage slot holding the keyMeta of key.
+func keyMetaSlot(key []byte) common.Hash {
+	return crypto.Keccak256Hash(keyMetaPrefix, key)
+}
+
+// writeKeyMeta records that the current transaction of db modified key.
+func writeKeyMeta(db *state.MStateDB, addr common.Address, key []byte, isDelete bool) error {
+	enc, err := rlp.EncodeToBytes(&keyMeta{TxHash: db.TxHash(), IsDelete: isDelete})
+	if err != nil {
+		return err
+	}
+	db.SetPDXState(addr, keyMetaSlot(key), enc)
+	return nil
+}
+
+// HistoryPage is one page of a history query as sent on the wire. Bookmark
+// is the block number the next page starts at, it is only valid when HasMore
+// is set.
+type HistoryPage struct {
+	Records  []*RecordElement
+	Bookmark uint64
+	HasMore  bool
+}
+
+// QueryResponseMetadata describes the page returned by a paginated query.
+type QueryResponseMetadata struct {
+	FetchedRecordsCount int32
+	Bookmark            string
+	HasMore             bool
+}
+
+// historyRequest is the decoded form of a SoCall_GET_HISTORY message. The
+// inputs are key, start, end, page size, bookmark and order, the block range
+// [start, end) is scanned and an empty bookmark starts from its first block.
+type historyRequest struct {
+	address  common.Address
+	key      []byte
+	start    uint64
+	end      uint64
+	pageSize uint64
+	bookmark []byte
+	order    HistoryOrder
+}
+
+func newHistoryInputs(key string, start, end uint64, pageSize int32, bookmark string, order HistoryOrder) ([][]byte, error) {
+	if pageSize < 0 {
+		return nil, SoCallError_Input_Error
+	}
+	var mark []byte
+	if bookmark != "" {
+		n, err := strconv.ParseUint(bookmark, 10, 64)
+		if err != nil {
+			return nil, SoCallError_History_Bookmark_Illegal
+		}
+		mark = common.Uint64ToByte(n)
+	}
+	return [][]byte{
+		[]byte(key),
+		common.Uint64ToByte(start),
+		common.Uint64ToByte(end),
+		common.Uint64ToByte(uint64(pageSize)),
+		mark,
+		{byte(order)},
+	}, nil
+}
+
+func decodeHistoryRequest(message *CallSoSendMessage) (*historyRequest, error) {
+	in := message.inputs
+	if len(in) != 6 {
+		return nil, SoCallError_Key_Value_NotMatch
+	}
+	if len(in[1]) != 8 || len(in[2]) != 8 || len(in[3]) != 8 || len(in[5]) != 1 {
+		return nil, SoCallError_Input_Error
+	}
+	req := &historyRequest{
+		address:  message.address,
+		key:      in[0],
+		start:    common.ByteToUint64(in[1]),
+		end:      common.ByteToUint64(in[2]),
+		pageSize: common.ByteToUint64(in[3]),
+		bookmark: in[4],
+		order:    HistoryOrder(in[5][0]),
+	}
+	if req.start > req.end {
+		return nil, SoCallError_Start_FinishNum_Illegal
+	}
+	if req.order != HistoryNewestFirst && req.order != HistoryOldestFirst {
+		return nil, SoCallError_Input_Error
+	}
+	if len(req.bookmark) != 0 {
+		if len(req.bookmark) != 8 {
+			return nil, SoCallError_History_Bookmark_Illegal
+		}
+		if n := common.ByteToUint64(req.bookmark); n < req.start || n >= req.end {
+			return nil, SoCallError_History_Bookmark_Illegal
+		}
+	}
+	return req, nil
+}
+
+// keyVersion is the value and metadata of a key as of one block.
+type keyVersion struct {
+	value []byte
+	meta  keyMeta
+}
+
+func (v *keyVersion) equal(o *keyVersion) bool {
+	return bytes.Equal(v.value, o.value) && v.meta == o.meta
+}
+
+// historyScanner reads the versions of one key from historical states.
+type historyScanner struct {
+	req      *historyRequest
+	versions map[uint64]*keyVersion
+	scanned  uint64
+}
+
+// version returns the key as of block num, it fails when the block or its
+// state is not available.
+func (s *historyScanner) version(num uint64) (*keyVersion, error) {
+	if v, ok := s.versions[num]; ok {
+		return v, nil
+	}
+	block := public.BC.GetBlockByNumber(num)
+	if block == nil {
+		return nil, SoCallError_History_Block_Unavailable
+	}
+	stateDb, err := public.BC.StateAt(block.Header().Root)
+	if err != nil {
+		return nil, SoCallError_History_Block_Unavailable
+	}
+	s.scanned++
+	v := &keyVersion{value: stateDb.GetPDXState(s.req.address, StateKeySlot(s.req.key))}
+	if enc := stateDb.GetPDXState(s.req.address, keyMetaSlot(s.req.key)); len(enc) > 0 {
+		if err := rlp.DecodeBytes(enc, &v.meta); err != nil {
+			return nil, SoCallError_History_Encode_Error
+		}
+	}
+	s.versions[num] = v
+	return v, nil
+}
+
+// record returns the modification made to the key in block num, or nil when
+// the key did not change in that block.
+func (s *historyScanner) record(num uint64) (*RecordElement, error) {
+	cur, err := s.version(num)
+	if err != nil {
+		return nil, err
+	}
+	prev := &keyVersion{}
+	if num > 0 {
+		if prev, err = s.version(num - 1); err != nil {
+			return nil, err
+		}
+	}
+	if cur.equal(prev) {
+		return nil, nil
+	}
+	return &RecordElement{
+		Value:    cur.value,
+		BlockNum: num,
+		TxHash:   cur.meta.TxHash,
+		IsDelete: len(cur.value) == 0,
+	}, nil
+}
+
+// handleGetHistory scans the requested block range for modifications of a key
+// and returns one rlp encoded HistoryPage. A page ends when the page size or
+// MaxSize is reached, HasMore and Bookmark then tell where to continue.
+func (h *Handler) handleGetHistory(message *CallSoSendMessage) *CallSoResMessage {
+	req, err := decodeHistoryRequest(message)
+	if err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: err,
+		}
+	}
+	if public.BC == nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Chain_Unavailable,
+		}
+	}
+
+	// blocks are visited from first to last and next returns the block
+	// following num in that order, ok is false past the end of the range.
+	first, last := req.start, req.end-1
+	next := func(num uint64) (uint64, bool) { return num + 1, num < last }
+	if req.order == HistoryNewestFirst {
+		first, last = req.end-1, req.start
+		next = func(num uint64) (uint64, bool) { return num - 1, num > last }
+	}
+	if len(req.bookmark) != 0 {
+		first = common.ByteToUint64(req.bookmark)
+	}
+
+	page := &HistoryPage{}
+	scanner := &historyScanner{req: req, versions: make(map[uint64]*keyVersion)}
+	var totalSize uint64
+	for num, more := first, req.start < req.end; more; {
+		scanned := scanner.scanned
+		rec, err := scanner.record(num)
+		if err == nil {
+			err = h.meter.scan(scanner.scanned - scanned)
+		}
+		if err != nil {
+			return &CallSoResMessage{
+				res: nil,
+				err: err,
+			}
+		}
+		num, more = next(num)
+		if rec == nil {
+			continue
+		}
+		page.Records = append(page.Records, rec)
+		totalSize += rec.Size()
+		if totalSize >= uint64(MaxSize) || uint64(len(page.Records)) == req.pageSize {
+			page.HasMore, page.Bookmark = more, num
+			break
+		}
+	}
+
+	data, err := rlp.EncodeToBytes(page)
+	if err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_History_Encode_Error,
+		}
+	}
+	return &CallSoResMessage{
+		res: data,
+		err: nil,
+	}
+}
+
+// HistoryQueryIterator iterates over the modifications of a key returned by
+// a history query. When created by GetHistoryForKey it fetches the following
+// pages on demand.
+type HistoryQueryIterator struct {
+	results []*RecordElement
+	current int
+	page    *HistoryPage
+	fetch   func(bookmark string) (*HistoryPage, error)
+	err     error
+}
+
+// HasNext returns true if the history iterator contains additional records.
+func (it *HistoryQueryIterator) HasNext() bool {
+	for it.current == len(it.results) && it.fetch != nil && it.page.HasMore && it.err == nil {
+		page, err := it.fetch(strconv.FormatUint(it.page.Bookmark, 10))
+		if err != nil {
+			it.err = err
+			return true
+		}
+		it.page, it.results, it.current = page, page.Records, 0
+	}
+	return it.err != nil || it.current < len(it.results)
+}
+
+// Next returns the next record in the history iterator.
+func (it *HistoryQueryIterator) Next() (*RecordElement, error) {
+	if !it.HasNext() {
+		return nil, ErrIteratorExhausted
+	}
+	if it.err != nil {
+		return nil, it.err
+	}
+	rec := it.results[it.current]
+	it.current++
+	return rec, nil
+}
+
+// Close closes the iterator, it should be called when done reading from the iterator.
+func (it *HistoryQueryIterator) Close() error {
+	it.results, it.page, it.fetch = nil, &HistoryPage{}, nil
+	it.current = 0
+	return nil
+}
+
+// NewHistoryQueryIterator returns an iterator over the given records.
+func NewHistoryQueryIterator(records []*RecordElement) *HistoryQueryIterator {
+	return &HistoryQueryIterator{results: records, page: &HistoryPage{Records: records}}
+}
+
+// NewPagedHistoryQueryIterator returns an iterator over page that calls
+// fetch with the bookmark of the last page for the following ones.
+func NewPagedHistoryQueryIterator(page *HistoryPage, fetch func(bookmark string) (*HistoryPage, error)) *HistoryQueryIterator {
+	return &HistoryQueryIterator{results: page.Records, page: page, fetch: fetch}
+}
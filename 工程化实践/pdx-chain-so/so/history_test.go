@@ -0,0 +1,155 @@
+package so
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/public"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/core/types"
+	"pdx-chain-so/pkg/pdx-chain/ethdb/memorydb"
+)
+
+// testChain is a public.PublicBlockChain whose blocks only carry a state
+// root, block n is written by the transaction numbered n.
+type testChain struct {
+	db    state.Database
+	roots []common.Hash
+}
+
+// newTestChain returns a chain with an empty genesis block and installs it
+// as public.BC until the test ends.
+func newTestChain(t *testing.T) *testChain {
+	c := &testChain{db: state.NewDatabase(memorydb.New())}
+	c.addBlock(t)
+	public.BC = c
+	t.Cleanup(func() { public.BC = nil })
+	return c
+}
+
+// addBlock commits a block writing the key/value pairs of kvs to testAddr,
+// see putStates.
+func (c *testChain) addBlock(t *testing.T, kvs ...string) {
+	t.Helper()
+	var parent common.Hash
+	if len(c.roots) > 0 {
+		parent = c.roots[len(c.roots)-1]
+	}
+	st, err := state.New(parent, c.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs, err := state.NewMStateDB(st, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs[0].Prepare(common.BytesToHash(common.Uint64ToByte(uint64(len(c.roots)))), common.Hash{}, 0)
+	if len(kvs) > 0 {
+		putStates(t, dbs[0], kvs...)
+	}
+	root, err := dbs[0].Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.roots = append(c.roots, root)
+}
+
+func (c *testChain) GetBlockByNumber(number uint64) *types.Block {
+	if number >= uint64(len(c.roots)) {
+		return nil
+	}
+	return types.NewBlockWithHeader(&types.Header{
+		Number: new(big.Int).SetUint64(number),
+		Root:   c.roots[number],
+	})
+}
+
+func (c *testChain) GetCommitBlock(height uint64) *types.Block {
+	return c.GetBlockByNumber(height)
+}
+
+func (c *testChain) StateAt(root common.Hash) (*state.StateDB, error) {
+	return state.New(root, c.db)
+}
+
+func (c *testChain) State() (*state.StateDB, error) {
+	return c.StateAt(c.roots[len(c.roots)-1])
+}
+
+// historyOf formats records as "block:value" strings, deletions as "block:-".
+func historyOf(t *testing.T, it HistoryQueryIteratorInterface) string {
+	t.Helper()
+	var recs []string
+	for it.HasNext() {
+		rec, err := it.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.TxHash != common.BytesToHash(common.Uint64ToByte(rec.BlockNum)) {
+			t.Errorf("record of block %d has tx %x", rec.BlockNum, rec.TxHash)
+		}
+		if rec.IsDelete {
+			recs = append(recs, fmt.Sprintf("%d:-", rec.BlockNum))
+		} else {
+			recs = append(recs, fmt.Sprintf("%d:%s", rec.BlockNum, rec.Value))
+		}
+	}
+	return strings.Join(recs, ",")
+}
+
+func TestGetHistoryForKey(t *testing.T) {
+	c := newTestChain(t)
+	c.addBlock(t, "k", "v1")
+	c.addBlock(t, "other", "x")
+	c.addBlock(t, "k", "v2")
+	c.addBlock(t, "k", "")
+	c.addBlock(t, "k", "v3")
+	stub := NewSoCallStub(NewHandler(newTestMStateDB(t)), nil, testAddr)
+
+	it, err := stub.GetHistoryForKey("k", 0, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := historyOf(t, it), "5:v3,4:-,3:v2,1:v1"; got != want {
+		t.Errorf("GetHistoryForKey = %q, want %q", got, want)
+	}
+
+	var pages []string
+	bookmark := ""
+	for {
+		it, meta, err := stub.GetHistoryForKeyWithPagination("k", 1, 5, 2, bookmark, HistoryOldestFirst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, historyOf(t, it))
+		if !meta.HasMore {
+			break
+		}
+		bookmark = meta.Bookmark
+	}
+	if got, want := strings.Join(pages, "|"), "1:v1,3:v2|4:-"; got != want {
+		t.Errorf("paged history = %q, want %q", got, want)
+	}
+}
+
+func TestGetHistoryForKeyUnavailableBlock(t *testing.T) {
+	c := newTestChain(t)
+	c.addBlock(t, "k", "v1")
+	stub := NewSoCallStub(NewHandler(newTestMStateDB(t)), nil, testAddr)
+
+	if _, err := stub.GetHistoryForKey("k", 0, 5); err != SoCallError_History_Block_Unavailable {
+		t.Errorf("history past the head = %v, want %v", err, SoCallError_History_Block_Unavailable)
+	}
+	_, _, err := stub.GetHistoryForKeyWithPagination("k", 0, 5, 0, "", HistoryOldestFirst)
+	if err != SoCallError_History_Block_Unavailable {
+		t.Errorf("oldest first history past the head = %v, want %v", err, SoCallError_History_Block_Unavailable)
+	}
+
+	public.BC = nil
+	if _, err := stub.GetHistoryForKey("k", 0, 2); err != SoCallError_Chain_Unavailable {
+		t.Errorf("history without a chain = %v, want %v", err, SoCallError_Chain_Unavailable)
+	}
+}
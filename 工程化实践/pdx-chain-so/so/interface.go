@@ -1,11 +1,35 @@
 package so
 
-import "container/list"
+import "pdx-chain-so/pkg/pdx-chain/common"
 
+// Call is implemented by a so.Run returns Success with the result of the
+// invocation, Error or NotFound for a business error, or FromError to pass
+// on an error of the stub.A panic is turned into an InternalError response.
 type Call interface {
+	Run(stub interface{}) Response
+}
+
+// LegacyCall is implemented by a so built before Response was introduced.
+// Registry.Load accepts it,a nil error becomes Success with the payload and
+// an error becomes the response of FromError.
+type LegacyCall interface {
 	Run(stub interface{}) ([]byte,error)
 }
 
+// Initializer is implemented by a so that sets up its state when it is
+// deployed.Init runs exactly once,in the deploy transaction,with the
+// arguments of the deployment.
+type Initializer interface {
+	Init(stub interface{}) Response
+}
+
+// Upgrader is implemented by a so that migrates the state written by older
+// versions.Upgrade runs on the new version in the upgrade transaction,
+// fromVersion is the version it replaces.
+type Upgrader interface {
+	Upgrade(stub interface{}, fromVersion string) Response
+}
+
 type StubInterface interface {
 	//GetArgs returns the arguments intended for the so Run as an array of byte arrays
 	GetArgs() [][]byte
@@ -14,18 +38,140 @@ type StubInterface interface {
 	//GetFunctionAndParameters returns the first argument as the function name
 	//and the rest of arguments as parameters in a string array.
 	GetFunctionAndParameters() (string,[][]byte)
+	//GetTxID returns the hex encoded hash of the transaction the so is
+	//invoked in.
+	GetTxID() string
+	//GetTxTimestamp returns the time of the block the transaction is
+	//included in,in seconds since the epoch.It is the same on every node.
+	GetTxTimestamp() (uint64,error)
+	//GetBlockNumber returns the number of the block the transaction is
+	//included in.
+	GetBlockNumber() (uint64,error)
+	//GetCreator returns the compressed SM2 public key the transaction was
+	//signed with,its jwt or certificate must name the same key.
+	GetCreator() ([]byte,error)
+	//GetCallerOrg returns the name of the consortium org the caller is
+	//registered with,or whose CA issued its certificate.
+	GetCallerOrg() (string,error)
+	//GetTransient returns the inputs passed off chain along with the
+	//transaction.They are never recorded in a block,private data values
+	//must be passed here instead of in the args.
+	GetTransient() (map[string][]byte,error)
 	//GetHistoryForKey returns a history of key values across time.
-	//For each historic key update,the historic value and associated block num.
-	GetHistoryForKey(key string,start,end uint64) (*list.Element,error)
+	//For each historic key update in the blocks [start,end),the historic
+	//value,associated block num,transaction id and delete flag are returned
+	//newest first.Further pages are fetched while iterating.
+	GetHistoryForKey(key string,start,end uint64) (HistoryQueryIteratorInterface,error)
+	//GetHistoryForKeyWithPagination returns one page of the history of key
+	//in the blocks [start,end).A pageSize of 0 only limits the page by
+	//MaxSize,the bookmark of the returned metadata continues the query.
+	GetHistoryForKeyWithPagination(key string, start, end uint64, pageSize int32, bookmark string, order HistoryOrder) (HistoryQueryIteratorInterface, *QueryResponseMetadata, error)
 	//GetState returns the value of the specified `key` from the
-	//ledger.Note that GetState doesn`t read data from the writest,which
-	//has not been committed to the state.
+	//ledger.GetState reads the pending writes of the invocation first,so a
+	//so sees its own writes before they are committed to the state.
 	GetState(key []byte) ([]byte,error)
-	//PutState puts the specified `key` and `value` into the state.simple keys
-	//must not be an empty string and must not start with a null character
+	//GetStateWithProof returns the value of `key` committed by the previous
+	//block with the Merkle proof of it against the state root of that
+	//block,for a client of the so to verify the value without trusting the
+	//node.The pending writes of the invocation are not seen.
+	GetStateWithProof(key []byte) (*StateProof,error)
+	//PutState puts the specified `key` and `value` into the write set of the
+	//invocation,which is committed to the state when the so returns without
+	//error and discarded otherwise.simple keys
+	//must not be an empty string and must not start with a null character,
+	//keys starting with a null character must be composite keys created by
+	//CreateCompositeKey.
 	PutState(key []byte,value []byte) error
 	//DelState records the specified `key` to be deleted in the state.
 	DelState(key []byte) error
-	//GetStateByRange(startKey,endKey string)
+	//PutState and DelState fail with SoCallError_Policy_Not_Satisfied
+	//unless the caller and endorsers of the transaction satisfy the policy
+	//governing the key.GetKeyPolicy returns that policy,nil if the key is
+	//unrestricted.
+	GetKeyPolicy(key string) (*Policy, error)
+	//SetKeyPolicy sets the policy of `key`,a nil policy removes it.The
+	//transaction must satisfy the policy currently governing `key`.
+	SetKeyPolicy(key string, policy *Policy) error
+	//SetPrefixPolicy sets the policy of the keys starting with `prefix`,a
+	//policy of the key itself or of a longer prefix takes precedence.
+	SetPrefixPolicy(prefix string, policy *Policy) error
+	//PutPrivateData puts `value` for `key` into the private data `collection`
+	//of the so.The value is encrypted for the member orgs of the collection
+	//and only its hash,salted with a salt derived from the transient input
+	//TransientSaltKey,is written to the state.The collection must be
+	//defined by DefineCollection and `value` should come from GetTransient.
+	PutPrivateData(collection string, key string, value []byte) error
+	//GetPrivateData returns the private value of `key` in `collection`.It is
+	//only available on nodes of the member orgs,the result of a transaction
+	//must therefore not depend on it.
+	GetPrivateData(collection string, key string) ([]byte, error)
+	//GetPrivateDataHash returns the hash of the private value of `key` in
+	//`collection` as recorded in the state,it is available on every node.
+	GetPrivateDataHash(collection string, key string) ([]byte, error)
+	//DelPrivateData records the specified `key` of `collection` to be deleted.
+	DelPrivateData(collection string, key string) error
+	//SetEvent emits an event named `name` with `payload` from the so.The
+	//event is recorded with the transaction and dropped if the invocation
+	//fails,subscribers receive it once the block is accepted.
+	SetEvent(name string,payload []byte) error
+	//InvokeContract runs the so deployed at `address` with `args` in the
+	//current transaction and returns its result.The changes of the callee
+	//are reverted when it fails,the caller decides whether to fail too.The
+	//error of a failed callee is the Err of its response.
+	//Calls are limited to MaxCallDepth nested invocations and a so must not
+	//be invoked while it is already on the call stack.
+	InvokeContract(address common.Address,args [][]byte) ([]byte,error)
+	//GetStateByRange returns a range iterator over a set of keys in the
+	//state.The iterator can be used to iterate over all keys between the
+	//startKey (inclusive) and endKey (exclusive) in key order.An empty
+	//startKey or endKey leaves that side of the range open.
+	GetStateByRange(startKey, endKey string) (StateQueryIteratorInterface, error)
+	//GetQueryResult runs a rich query on the JSON values of the so,see
+	//ParseQuery for the query syntax.Results are in key order and reflect the
+	//state committed by the previous blocks only,neither the pending writes
+	//of the invocation nor the writes of the current block are seen.It needs
+	//a node keeping a DocumentStore,whose content is local to the node,so it
+	//is only available to read-only queries (Registry.Query) and fails with
+	//SoCallError_Rich_Query_Read_Only in a transaction.
+	GetQueryResult(query string) (StateQueryIteratorInterface, error)
+	//GetQueryResultWithPagination returns one page of a rich query,a
+	//pageSize of 0 returns every result.The bookmark of the returned
+	//metadata continues the query.
+	GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (StateQueryIteratorInterface, *QueryResponseMetadata, error)
+	//GetStateByPrefix returns an iterator over all keys in the state that
+	//start with the given prefix, in key order.
+	GetStateByPrefix(prefix string) (StateQueryIteratorInterface, error)
+	//GetStateByPartialCompositeKey queries the state based on a given partial
+	//composite key.It returns an iterator over all composite keys whose
+	//prefix matches the given objectType and leading attributes.
+	GetStateByPartialCompositeKey(objectType string, keys []string) (StateQueryIteratorInterface, error)
+	//CreateCompositeKey combines the given `attributes` to form a composite
+	//key.The objectType and attributes are expected to have only valid utf8
+	//strings and should not contain U+0000 (nil byte) and U+10FFFF.
+	CreateCompositeKey(objectType string, attributes []string) (string, error)
+	//SplitCompositeKey splits the specified key into attributes on which the
+	//composite key was formed.
+	SplitCompositeKey(compositeKey string) (string, []string, error)
+}
+
+// StateQueryIteratorInterface allows a so to iterate over a set of
+// key/value pairs returned by a range query.
+type StateQueryIteratorInterface interface {
+	//HasNext returns true if the range query iterator contains additional keys and values.
+	HasNext() bool
+	//Next returns the next key and value in the range query iterator.
+	Next() (*KV, error)
+	//Close closes the iterator.
+	Close() error
 }
 
+// HistoryQueryIteratorInterface allows a so to iterate over a set of
+// key modifications returned by a history query.
+type HistoryQueryIteratorInterface interface {
+	//HasNext returns true if the history iterator contains additional records.
+	HasNext() bool
+	//Next returns the next record in the history iterator.
+	Next() (*RecordElement, error)
+	//Close closes the iterator.
+	Close() error
+}
@@ -0,0 +1,44 @@
+package so
+
+import "errors"
+
+var ErrIteratorExhausted = errors.New("iterator has no more results")
+
+// KV is a key/value pair returned by a state query.
+type KV struct {
+	Key   string
+	Value []byte
+}
+
+// StateQueryIterator iterates over the key/value pairs of a state query in key order.
+type StateQueryIterator struct {
+	results []*KV
+	current int
+}
+
+// NewStateQueryIterator returns an iterator over the given results.
+func NewStateQueryIterator(results []*KV) *StateQueryIterator {
+	return &StateQueryIterator{results: results}
+}
+
+// HasNext returns true if the range query iterator contains additional keys and values.
+func (it *StateQueryIterator) HasNext() bool {
+	return it.current < len(it.results)
+}
+
+// Next returns the next key and value in the range query iterator.
+func (it *StateQueryIterator) Next() (*KV, error) {
+	if !it.HasNext() {
+		return nil, ErrIteratorExhausted
+	}
+	kv := it.results[it.current]
+	it.current++
+	return kv, nil
+}
+
+// Close closes the iterator, it should be called when done reading from the iterator.
+func (it *StateQueryIterator) Close() error {
+	it.results = nil
+	it.current = 0
+	return nil
+}
@@ -0,0 +1,257 @@
+package so
+
+import (
+	"sort"
+	"strings"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+)
+
+var keyIndexPrefix = []byte("pdx-so-key-index")
+
+// keyIndexSlot is the reserved PDX storage slot of a contract that holds the
+// root node of the index of its live keys. State values themselves are
+// stored under StateKeySlot(key), which loses the key order, so range scans
+// walk this index instead.
+var keyIndexSlot = keyNodeSlot("")
+
+var stateKeyPrefix = []byte("pdx-so-state")
+
+// StateKeySlot returns the PDX storage slot holding the value of key in the
+// storage of a contract. Keys of any length get a slot of their own, and no
+// other prefix of a slot of the handler starts with stateKeyPrefix or is
+// one of its prefixes, so a key never addresses a reserved slot.
+func StateKeySlot(key []byte) common.Hash {
+	return crypto.Keccak256Hash(stateKeyPrefix, key)
+}
+
+// keyNodeSlot returns the slot of the index node of prefix.
+func keyNodeSlot(prefix string) common.Hash {
+	return crypto.Keccak256Hash(keyIndexPrefix, []byte(prefix))
+}
+
+// keyNode is a node of the key index, a radix tree over the keys of one
+// contract stored one node per slot. The node of prefix p holds the sorted
+// labels of its children, no two starting with the same byte, and the child
+// of label l is the node of p+l. Every path ending at a leaf is a key, a
+// path ending at an inner node is a key if its state value is set. Inner
+// nodes that are not keys and have a single child are merged into their
+// parent, so the shape of the tree only depends on the set of keys.
+//
+// Overwriting a live key leaves the index alone and adding or removing one
+// only rewrites the node it branches off at, so writers to different keys
+// of a contract rarely lock the same index slot. A range scan reads every
+// node it walks through, which makes it conflict with the writers adding or
+// removing keys inside its range.
+type keyNode struct {
+	prefix string
+	labels []string
+}
+
+// loadKeyNode reads the index node of prefix of the contract at addr, a
+// missing node has no children.
+func loadKeyNode(db *state.MStateDB, addr common.Address, prefix string) (*keyNode, error) {
+	n := &keyNode{prefix: prefix}
+	enc := db.GetPDXState(addr, keyNodeSlot(prefix))
+	if len(enc) == 0 {
+		return n, nil
+	}
+	if err := rlp.DecodeBytes(enc, &n.labels); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// store writes the node back into db, a node without children is cleared.
+func (n *keyNode) store(db *state.MStateDB, addr common.Address) error {
+	if len(n.labels) == 0 {
+		db.SetPDXState(addr, keyNodeSlot(n.prefix), []byte{})
+		return nil
+	}
+	enc, err := rlp.EncodeToBytes(n.labels)
+	if err != nil {
+		return err
+	}
+	db.SetPDXState(addr, keyNodeSlot(n.prefix), enc)
+	return nil
+}
+
+// search returns the position of the label starting with b, or of the label
+// it would be inserted at.
+func (n *keyNode) search(b byte) int {
+	return sort.Search(len(n.labels), func(i int) bool {
+		return n.labels[i][0] >= b
+	})
+}
+
+// lookup returns the position of the label the path of rest continues with,
+// ok is false if no label starts with the first byte of rest.
+func (n *keyNode) lookup(rest string) (i int, ok bool) {
+	i = n.search(rest[0])
+	return i, i < len(n.labels) && n.labels[i][0] == rest[0]
+}
+
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// hasKey reports whether key holds a value in the contract at addr.
+func hasKey(db *state.MStateDB, addr common.Address, key string) bool {
+	return len(db.GetPDXState(addr, StateKeySlot([]byte(key)))) != 0
+}
+
+// insertKey adds key to the index of addr.
+func insertKey(db *state.MStateDB, addr common.Address, key string) error {
+	n, err := loadKeyNode(db, addr, "")
+	if err != nil {
+		return err
+	}
+	for {
+		rest := key[len(n.prefix):]
+		i, ok := n.lookup(rest)
+		if !ok {
+			n.labels = append(n.labels, "")
+			copy(n.labels[i+1:], n.labels[i:])
+			n.labels[i] = rest
+			return n.store(db, addr)
+		}
+		label := n.labels[i]
+		c := commonPrefixLen(label, rest)
+		if c == len(label) {
+			if c == len(rest) {
+				//key是已有的内部节点,由其状态值标记为key
+				return nil
+			}
+			if n, err = loadKeyNode(db, addr, n.prefix+label); err != nil {
+				return err
+			}
+			continue
+		}
+		//在分叉处拆分标签,新建中间节点
+		mid := &keyNode{prefix: n.prefix + label[:c], labels: []string{label[c:]}}
+		if c < len(rest) {
+			if rest[c] < label[c] {
+				mid.labels = []string{rest[c:], label[c:]}
+			} else {
+				mid.labels = append(mid.labels, rest[c:])
+			}
+		}
+		n.labels[i] = label[:c]
+		if err := mid.store(db, addr); err != nil {
+			return err
+		}
+		return n.store(db, addr)
+	}
+}
+
+// removeKey drops key from the index of addr, its state value must already
+// be cleared.
+func removeKey(db *state.MStateDB, addr common.Address, key string) error {
+	var parents []*keyNode
+	var pos []int
+	n, err := loadKeyNode(db, addr, "")
+	if err != nil {
+		return err
+	}
+	for {
+		rest := key[len(n.prefix):]
+		i, ok := n.lookup(rest)
+		if !ok || !strings.HasPrefix(rest, n.labels[i]) {
+			return SoCallError_Key_Index_Error
+		}
+		parents, pos = append(parents, n), append(pos, i)
+		if len(n.labels[i]) == len(rest) {
+			break
+		}
+		if n, err = loadKeyNode(db, addr, n.prefix+n.labels[i]); err != nil {
+			return err
+		}
+	}
+	node, err := loadKeyNode(db, addr, key)
+	if err != nil {
+		return err
+	}
+	parent, i := parents[len(parents)-1], pos[len(pos)-1]
+	switch len(node.labels) {
+	case 0:
+		parent.labels = append(parent.labels[:i], parent.labels[i+1:]...)
+		if len(parents) > 1 && len(parent.labels) == 1 && !hasKey(db, addr, parent.prefix) {
+			//父节点只剩一个子节点且不是key,并入祖父节点
+			grand, j := parents[len(parents)-2], pos[len(pos)-2]
+			grand.labels[j] += parent.labels[0]
+			parent.labels = nil
+			if err := parent.store(db, addr); err != nil {
+				return err
+			}
+			return grand.store(db, addr)
+		}
+		return parent.store(db, addr)
+	case 1:
+		parent.labels[i] += node.labels[0]
+		node.labels = nil
+		if err := node.store(db, addr); err != nil {
+			return err
+		}
+		return parent.store(db, addr)
+	}
+	return nil
+}
+
+// updateKeyIndex records in the index of addr that key changed from holding
+// old to holding value, an empty value means the key is absent. The index
+// only changes when the key is added or removed.
+func updateKeyIndex(db *state.MStateDB, addr common.Address, key []byte, old, value []byte) error {
+	switch {
+	case len(old) == 0 && len(value) != 0:
+		return insertKey(db, addr, string(key))
+	case len(old) != 0 && len(value) == 0:
+		return removeKey(db, addr, string(key))
+	}
+	return nil
+}
+
+// keysBetween returns the keys of the contract at addr in [startKey, endKey)
+// in order. An empty startKey means the first key and an empty endKey means
+// past the last key.
+func keysBetween(db *state.MStateDB, addr common.Address, startKey, endKey string) ([]string, error) {
+	var keys []string
+	var walk func(n *keyNode) (bool, error)
+	walk = func(n *keyNode) (bool, error) {
+		for _, label := range n.labels {
+			path := n.prefix + label
+			if endKey != "" && path >= endKey {
+				return false, nil
+			}
+			//整棵子树都小于startKey时跳过
+			if path < startKey && !strings.HasPrefix(startKey, path) {
+				continue
+			}
+			child, err := loadKeyNode(db, addr, path)
+			if err != nil {
+				return false, err
+			}
+			if path >= startKey && (len(child.labels) == 0 || hasKey(db, addr, path)) {
+				keys = append(keys, path)
+			}
+			if more, err := walk(child); !more || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	root, err := loadKeyNode(db, addr, "")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := walk(root); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,112 @@
+package so
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+)
+
+func TestGetStateByRange(t *testing.T) {
+	db := newTestMStateDB(t)
+	putStates(t, db, "b", "2", "a", "1", "ab", "3", "abc", "4", "c", "5")
+	stub := NewSoCallStub(NewHandler(db), nil, testAddr)
+
+	tests := []struct {
+		start, end string
+		want       string
+	}{
+		{"", "", "a=1,ab=3,abc=4,b=2,c=5"},
+		{"ab", "", "ab=3,abc=4,b=2,c=5"},
+		{"aa", "b", "ab=3,abc=4"},
+		{"abb", "c", "abc=4,b=2"},
+		{"", "ab", "a=1"},
+		{"abc", "abc", ""},
+		{"d", "", ""},
+	}
+	for _, tt := range tests {
+		got := strings.Join(rangeKeys(t, stub, tt.start, tt.end), ",")
+		if got != tt.want {
+			t.Errorf("GetStateByRange(%q, %q) = %q, want %q", tt.start, tt.end, got, tt.want)
+		}
+	}
+	if _, err := stub.GetStateByRange("b", "a"); err == nil {
+		t.Error("GetStateByRange with start after end succeeded")
+	}
+}
+
+func TestKeyIndexRandom(t *testing.T) {
+	db := newTestMStateDB(t)
+	rnd := rand.New(rand.NewSource(1))
+	model := make(map[string]bool)
+	for i := 0; i < 2000; i++ {
+		//短字母表让key大量共享前缀,覆盖拆分和合并
+		key := make([]byte, 1+rnd.Intn(4))
+		for j := range key {
+			key[j] = "abc"[rnd.Intn(3)]
+		}
+		if rnd.Intn(3) == 0 {
+			delete(model, string(key))
+			putStates(t, db, string(key), "")
+		} else {
+			model[string(key)] = true
+			putStates(t, db, string(key), "v")
+		}
+	}
+	var want []string
+	for k := range model {
+		want = append(want, k)
+	}
+	sort.Strings(want)
+	got, err := keysBetween(db, testAddr, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("index keys = %v, want %v", got, want)
+	}
+	checkKeyNodes(t, db, "", model)
+
+	for _, k := range want {
+		putStates(t, db, k, "")
+	}
+	if enc := db.GetPDXState(testAddr, keyIndexSlot); len(enc) != 0 {
+		t.Errorf("index root is %x after deleting every key", enc)
+	}
+}
+
+// checkKeyNodes checks that the subtree of prefix is in its merged form.
+func checkKeyNodes(t *testing.T, db *state.MStateDB, prefix string, model map[string]bool) {
+	t.Helper()
+	n, err := loadKeyNode(db, testAddr, prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prefix != "" && len(n.labels) == 1 && !model[prefix] {
+		t.Errorf("node %q is not a key and has a single child", prefix)
+	}
+	for i, label := range n.labels {
+		if i > 0 && n.labels[i-1][0] >= label[0] {
+			t.Errorf("labels of node %q are not sorted: %q", prefix, n.labels)
+		}
+		checkKeyNodes(t, db, prefix+label, model)
+	}
+}
+
+func TestKeyIndexShape(t *testing.T) {
+	build := func(writes ...string) *state.MStateDB {
+		db := newTestMStateDB(t)
+		for i := 0; i < len(writes); i += 2 {
+			putStates(t, db, writes[i], writes[i+1])
+		}
+		return db
+	}
+	//写入顺序不同、中途增删过其他key,最终key集合相同时状态根应一致
+	a := build("a", "v", "abc", "v", "abd", "v", "b", "v", "ba", "v", "bab", "v", "ab", "v", "ab", "")
+	b := build("ab", "v", "bab", "v", "abd", "v", "ba", "v", "abc", "v", "b", "v", "a", "v", "ab", "")
+	if ra, rb := a.IntermediateRoot(false), b.IntermediateRoot(false); ra != rb {
+		t.Errorf("index depends on the order of writes: %x != %x", ra, rb)
+	}
+}
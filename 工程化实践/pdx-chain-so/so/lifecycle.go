@@ -0,0 +1,100 @@
+package so
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/params"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+)
+
+var SoCallError_Lifecycle_Unauthorized = errors.New("Caller is not a consortium admin")
+
+// contractVersionsSlot is the reserved PDX storage slot of a contract that
+// holds the versions it ran.
+var contractVersionsSlot = crypto.Keccak256Hash([]byte("pdx-so-contract-versions"))
+
+// ContractVersion records a version bound to a contract by Deploy or
+// Upgrade and the transaction that bound it.
+type ContractVersion struct {
+	Version     string
+	PluginHash  common.Hash
+	Symbol      string
+	BlockNumber uint64
+	TxID        common.Hash
+}
+
+// GetContractVersions returns the versions of the contract at addr, oldest
+// first.
+func GetContractVersions(db *state.MStateDB, addr common.Address) ([]*ContractVersion, error) {
+	enc := db.GetPDXState(addr, contractVersionsSlot)
+	if len(enc) == 0 {
+		return nil, nil
+	}
+	var versions []*ContractVersion
+	if err := rlp.DecodeBytes(enc, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// bindContract stores info as the contract bound to addr and records its
+// version, ctx may be nil.
+func bindContract(db *state.MStateDB, addr common.Address, ctx *TxContext, info *ContractInfo) error {
+	versions, err := GetContractVersions(db, addr)
+	if err != nil {
+		return err
+	}
+	v := &ContractVersion{
+		Version:    info.Version,
+		PluginHash: info.PluginHash,
+		Symbol:     info.Symbol,
+	}
+	if ctx != nil {
+		v.BlockNumber, v.TxID = ctx.BlockNumber, ctx.TxID
+	}
+	enc, err := rlp.EncodeToBytes(append(versions, v))
+	if err != nil {
+		return err
+	}
+	db.SetPDXState(addr, contractVersionsSlot, enc)
+	return putContractInfo(db, addr, info)
+}
+
+// AdminOrg returns the name of the consortium org that lists creator, a
+// compressed public key, as an admin.
+func AdminOrg(creator []byte) (string, error) {
+	if params.ConsortiumConf == nil {
+		return "", SoCallError_Org_Not_Found
+	}
+	key := hex.EncodeToString(creator)
+	for _, org := range params.ConsortiumConf.Orgs {
+		if containsPublicKey(org.Admins, key) {
+			return org.Name, nil
+		}
+	}
+	return "", SoCallError_Org_Not_Found
+}
+
+// authorizeLifecycle checks that the caller of the transaction described by
+// ctx may deploy, upgrade or disable contracts. Outside a consortium chain
+// anyone may.
+func authorizeLifecycle(ctx *TxContext) error {
+	if !params.Consortium {
+		return nil
+	}
+	if ctx == nil {
+		return SoCallError_TxContext_Unavailable
+	}
+	creator, err := ctx.Creator()
+	if err != nil {
+		return err
+	}
+	if _, err := AdminOrg(creator); err != nil {
+		return SoCallError_Lifecycle_Unauthorized
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package so
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+)
+
+// lifecycleContract records the calls of its lifecycle methods in its state.
+// An Init or Upgrade with the argument "fail" writes and then fails.
+type lifecycleContract struct {
+	testContract
+}
+
+func (lifecycleContract) Init(stub interface{}) Response {
+	s := stub.(StubInterface)
+	args := s.GetArgs()
+	s.PutState([]byte("init"), []byte("done"))
+	if len(args) > 0 && string(args[0]) == "fail" {
+		return Error("init failed on purpose")
+	}
+	return Success(nil)
+}
+
+func (lifecycleContract) Upgrade(stub interface{}, fromVersion string) Response {
+	s := stub.(StubInterface)
+	args := s.GetArgs()
+	s.PutState([]byte("from"), []byte(fromVersion))
+	if len(args) > 0 && string(args[0]) == "fail" {
+		return Error("upgrade failed on purpose")
+	}
+	return Success(nil)
+}
+
+// writeTestPlugin writes a plugin file with content to dir and registers
+// call for it with r, so Load finds it without opening the file.
+func writeTestPlugin(t *testing.T, r *Registry, dir, name, content string, call Call) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r.Register(crypto.Keccak256Hash([]byte(content)), "Contract", call)
+	return path
+}
+
+func testPluginDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "so-lifecycle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestDeployUpgradeDisable(t *testing.T) {
+	db := newTestMStateDB(t)
+	r := NewRegistry()
+	dir := testPluginDir(t)
+	v1 := writeTestPlugin(t, r, dir, "v1.so", "build 1", lifecycleContract{})
+	v2 := writeTestPlugin(t, r, dir, "v2.so", "build 2", lifecycleContract{})
+	ctx := &TxContext{BlockNumber: 7, TxID: common.HexToHash("0x7")}
+
+	if _, err := r.Deploy(db, testAddr, ctx, "1.0", v1, "Contract", nil); err != nil {
+		t.Fatal(err)
+	}
+	if getTestState(db, testAddr, "init") != "done" {
+		t.Error("Init did not run on deploy")
+	}
+	if _, err := r.Deploy(db, testAddr, ctx, "1.1", v1, "Contract", nil); err != SoCallError_Contract_Exists {
+		t.Errorf("second Deploy = %v, want %v", err, SoCallError_Contract_Exists)
+	}
+	if _, err := r.Upgrade(db, testAddr, ctx, "1.0", v2, "Contract", nil); err != SoCallError_Contract_Version {
+		t.Errorf("Upgrade to the same version = %v, want %v", err, SoCallError_Contract_Version)
+	}
+	if _, err := r.Upgrade(db, common.HexToAddress("0x11"), ctx, "2.0", v2, "Contract", nil); err != SoCallError_Contract_Not_Found {
+		t.Errorf("Upgrade of a missing contract = %v, want %v", err, SoCallError_Contract_Not_Found)
+	}
+
+	//升级失败时合约信息、版本记录与状态均不变
+	if _, err := r.Upgrade(db, testAddr, ctx, "2.0", v2, "Contract", testArgs("fail")); err == nil {
+		t.Fatal("failing Upgrade succeeded")
+	}
+	if info, _ := GetContractInfo(db, testAddr); info.Version != "1.0" || info.PluginHash != crypto.Keccak256Hash([]byte("build 1")) {
+		t.Errorf("contract after a failed upgrade = %+v", info)
+	}
+	if getTestState(db, testAddr, "from") != "" {
+		t.Error("the writes of a failed upgrade were kept")
+	}
+
+	upCtx := &TxContext{BlockNumber: 9, TxID: common.HexToHash("0x9")}
+	if _, err := r.Upgrade(db, testAddr, upCtx, "2.0", v2, "Contract", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := getTestState(db, testAddr, "from"); got != "1.0" {
+		t.Errorf("Upgrade ran from version %q, want 1.0", got)
+	}
+	versions, err := GetContractVersions(db, testAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ContractVersion{
+		{Version: "1.0", PluginHash: crypto.Keccak256Hash([]byte("build 1")), Symbol: "Contract", BlockNumber: 7, TxID: ctx.TxID},
+		{Version: "2.0", PluginHash: crypto.Keccak256Hash([]byte("build 2")), Symbol: "Contract", BlockNumber: 9, TxID: upCtx.TxID},
+	}
+	if len(versions) != len(want) {
+		t.Fatalf("versions = %d, want %d", len(versions), len(want))
+	}
+	for i := range want {
+		if *versions[i] != want[i] {
+			t.Errorf("version %d = %+v, want %+v", i, *versions[i], want[i])
+		}
+	}
+
+	if _, err := r.Invoke(db, testAddr, nil, testArgs("put", "k", "v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Disable(db, testAddr, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Invoke(db, testAddr, nil, testArgs("get", "k")); !errors.Is(err, SoCallError_Contract_Disabled) {
+		t.Errorf("Invoke of a disabled contract = %v, want %v", err, SoCallError_Contract_Disabled)
+	}
+	if _, err := r.Upgrade(db, testAddr, ctx, "3.0", v1, "Contract", nil); err != SoCallError_Contract_Disabled {
+		t.Errorf("Upgrade of a disabled contract = %v, want %v", err, SoCallError_Contract_Disabled)
+	}
+	if getTestState(db, testAddr, "k") != "v" {
+		t.Error("disabling a contract dropped its state")
+	}
+}
+
+func TestDeployInitFailure(t *testing.T) {
+	db := newTestMStateDB(t)
+	r := NewRegistry()
+	v1 := writeTestPlugin(t, r, testPluginDir(t), "v1.so", "build 1", lifecycleContract{})
+
+	if _, err := r.Deploy(db, testAddr, nil, "1.0", v1, "Contract", testArgs("fail")); err == nil {
+		t.Fatal("Deploy with a failing Init succeeded")
+	}
+	if info, _ := GetContractInfo(db, testAddr); info != nil {
+		t.Errorf("contract bound by a failed deploy: %+v", info)
+	}
+	if versions, _ := GetContractVersions(db, testAddr); len(versions) != 0 {
+		t.Errorf("versions recorded by a failed deploy: %d", len(versions))
+	}
+	if getTestState(db, testAddr, "init") != "" {
+		t.Error("the writes of a failed Init were kept")
+	}
+	//失败的部署不占用地址
+	if _, err := r.Deploy(db, testAddr, nil, "1.0", v1, "Contract", nil); err != nil {
+		t.Errorf("Deploy after a failed deploy = %v", err)
+	}
+}
+
+func TestLifecycleAuthorization(t *testing.T) {
+	admin := newTestIdentity(t, "admin", false, nil)
+	ca1, _ := newTestConsortium(t, admin.pub())
+	user := newTestIdentity(t, "user", false, ca1)
+	db := newTestMStateDB(t)
+	r := NewRegistry()
+	v1 := writeTestPlugin(t, r, testPluginDir(t), "v1.so", "build 1", lifecycleContract{})
+
+	userCtx := &TxContext{Timestamp: testTime, Signer: user.pub(), Cert: user.pem}
+	if _, err := r.Deploy(db, testAddr, userCtx, "1.0", v1, "Contract", nil); err != SoCallError_Lifecycle_Unauthorized {
+		t.Errorf("Deploy by a member = %v, want %v", err, SoCallError_Lifecycle_Unauthorized)
+	}
+	if _, err := r.Deploy(db, testAddr, nil, "1.0", v1, "Contract", nil); err != SoCallError_TxContext_Unavailable {
+		t.Errorf("Deploy without a context = %v, want %v", err, SoCallError_TxContext_Unavailable)
+	}
+	if info, _ := GetContractInfo(db, testAddr); info != nil {
+		t.Fatal("an unauthorized deploy bound the contract")
+	}
+
+	adminCtx := &TxContext{Timestamp: testTime, Signer: admin.pub()}
+	if _, err := r.Deploy(db, testAddr, adminCtx, "1.0", v1, "Contract", nil); err != nil {
+		t.Fatalf("Deploy by the admin = %v", err)
+	}
+	if _, err := r.Upgrade(db, testAddr, userCtx, "2.0", v1, "Contract", nil); err != SoCallError_Lifecycle_Unauthorized {
+		t.Errorf("Upgrade by a member = %v, want %v", err, SoCallError_Lifecycle_Unauthorized)
+	}
+	if err := r.Disable(db, testAddr, userCtx); err != SoCallError_Lifecycle_Unauthorized {
+		t.Errorf("Disable by a member = %v, want %v", err, SoCallError_Lifecycle_Unauthorized)
+	}
+	if info, _ := GetContractInfo(db, testAddr); info.Status != ContractActive || info.Version != "1.0" {
+		t.Errorf("contract after unauthorized changes = %+v", info)
+	}
+	if err := r.Disable(db, testAddr, adminCtx); err != nil {
+		t.Errorf("Disable by the admin = %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package so
+
+import (
+	"errors"
+
+	"pdx-chain-so/pkg/pdx-chain/params"
+)
+
+var SoCallError_Out_Of_Gas = errors.New("Contract execution ran out of gas")
+
+// GasSchedule prices the operations of a contract invocation.
+type GasSchedule struct {
+	Invoke       uint64 // per contract invocation, nested ones included
+	Read         uint64 // per state read
+	ReadByte     uint64 // per byte of a value read
+	RangeKey     uint64 // per key/value pair returned by a range query
+	Write        uint64 // per state write or delete
+	WriteByte    uint64 // per byte of a key and value written
+	HistoryBlock uint64 // per block scanned by a history query
+	Event        uint64 // per event emitted
+	EventByte    uint64 // per byte of an event name and payload
+}
+
+// DefaultGasSchedule is the schedule used by a new Registry.
+var DefaultGasSchedule = GasSchedule{
+	Invoke:       700,
+	Read:         200,
+	ReadByte:     3,
+	RangeKey:     100,
+	Write:        5000,
+	WriteByte:    20,
+	HistoryBlock: 400,
+	Event:        375,
+	EventByte:    8,
+}
+
+// Meter counts the operations of one transaction and the gas they cost.
+// The gas limit is enforced even if params.Gasless is set, the node then
+// charges no fee for the gas used but still reports it.
+type Meter struct {
+	schedule  GasSchedule
+	limit     uint64
+	gasUsed   uint64
+	exhausted bool
+
+	// Gasless records params.Gasless when the meter was created.
+	Gasless bool
+
+	Invocations   uint64
+	Reads         uint64
+	BytesRead     uint64
+	Writes        uint64
+	BytesWritten  uint64
+	HistoryBlocks uint64
+	Events        uint64
+}
+
+// NewMeter returns a meter pricing operations by schedule, a limit of 0
+// leaves the gas unlimited.
+func NewMeter(schedule GasSchedule, limit uint64) *Meter {
+	return &Meter{
+		schedule: schedule,
+		limit:    limit,
+		Gasless:  params.Gasless,
+	}
+}
+
+// GasUsed returns the gas used so far.
+func (m *Meter) GasUsed() uint64 {
+	return m.gasUsed
+}
+
+// GasLimit returns the gas limit, 0 if the gas is unlimited.
+func (m *Meter) GasLimit() uint64 {
+	return m.limit
+}
+
+// Exhausted reports whether the gas limit was reached, every following
+// operation then fails with SoCallError_Out_Of_Gas.
+func (m *Meter) Exhausted() bool {
+	return m != nil && m.exhausted
+}
+
+// use adds gas to the gas used. A nil meter meters nothing.
+func (m *Meter) use(gas uint64) error {
+	if m == nil {
+		return nil
+	}
+	if m.exhausted {
+		return SoCallError_Out_Of_Gas
+	}
+	if m.limit > 0 && gas > m.limit-m.gasUsed {
+		m.gasUsed, m.exhausted = m.limit, true
+		return SoCallError_Out_Of_Gas
+	}
+	m.gasUsed += gas
+	return nil
+}
+
+func (m *Meter) invoke() error {
+	if m == nil {
+		return nil
+	}
+	m.Invocations++
+	return m.use(m.schedule.Invoke)
+}
+
+func (m *Meter) read(size int) error {
+	if m == nil {
+		return nil
+	}
+	m.Reads++
+	m.BytesRead += uint64(size)
+	return m.use(m.schedule.Read + uint64(size)*m.schedule.ReadByte)
+}
+
+func (m *Meter) readRange(pairs int, size int) error {
+	if m == nil {
+		return nil
+	}
+	m.Reads += uint64(pairs)
+	m.BytesRead += uint64(size)
+	return m.use(m.schedule.Read + uint64(pairs)*m.schedule.RangeKey + uint64(size)*m.schedule.ReadByte)
+}
+
+func (m *Meter) write(size int) error {
+	if m == nil {
+		return nil
+	}
+	m.Writes++
+	m.BytesWritten += uint64(size)
+	return m.use(m.schedule.Write + uint64(size)*m.schedule.WriteByte)
+}
+
+func (m *Meter) scan(blocks uint64) error {
+	if m == nil {
+		return nil
+	}
+	m.HistoryBlocks += blocks
+	return m.use(blocks * m.schedule.HistoryBlock)
+}
+
+func (m *Meter) event(size int) error {
+	if m == nil {
+		return nil
+	}
+	m.Events++
+	return m.use(m.schedule.Event + uint64(size)*m.schedule.EventByte)
+}
@@ -0,0 +1,187 @@
+package so
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/params"
+)
+
+var testSchedule = GasSchedule{
+	Invoke:       1,
+	Read:         10,
+	ReadByte:     1,
+	RangeKey:     5,
+	Write:        100,
+	WriteByte:    2,
+	HistoryBlock: 7,
+	Event:        50,
+	EventByte:    3,
+}
+
+func TestMeter(t *testing.T) {
+	m := NewMeter(testSchedule, 0)
+	m.invoke()
+	m.read(4)
+	m.readRange(2, 6)
+	m.write(5)
+	m.scan(3)
+	m.event(2)
+	if want := uint64(1 + (10 + 4) + (10 + 2*5 + 6) + (100 + 2*5) + 3*7 + (50 + 3*2)); m.GasUsed() != want {
+		t.Errorf("GasUsed = %d, want %d", m.GasUsed(), want)
+	}
+	if m.Invocations != 1 || m.Reads != 3 || m.BytesRead != 10 || m.Writes != 1 || m.BytesWritten != 5 || m.HistoryBlocks != 3 || m.Events != 1 {
+		t.Errorf("counters = %+v", m)
+	}
+
+	var none *Meter
+	if err := none.write(100); err != nil || none.Exhausted() {
+		t.Errorf("nil meter = %v", err)
+	}
+}
+
+func TestMeterLimit(t *testing.T) {
+	m := NewMeter(testSchedule, 120)
+	if err := m.write(5); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.write(5); err != SoCallError_Out_Of_Gas {
+		t.Errorf("write past the limit = %v, want %v", err, SoCallError_Out_Of_Gas)
+	}
+	if !m.Exhausted() || m.GasUsed() != m.GasLimit() {
+		t.Errorf("exhausted %v, gas used %d of %d", m.Exhausted(), m.GasUsed(), m.GasLimit())
+	}
+	if err := m.invoke(); err != SoCallError_Out_Of_Gas {
+		t.Errorf("operation after exhaustion = %v", err)
+	}
+}
+
+func TestInvokeOutOfGas(t *testing.T) {
+	db := newTestMStateDB(t)
+	r := NewRegistry()
+	r.Schedule = testSchedule
+	deployTestContract(t, r, db, testAddr)
+
+	ctx := &TxContext{GasLimit: 1000}
+	res, err := r.Invoke(db, testAddr, ctx, testArgs("put", "k", "v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//调用、键策略的读取和写入
+	if want := uint64(1 + 10 + 100 + 2*2); res.Meter.GasUsed() != want || res.Meter.Writes != 1 {
+		t.Errorf("gas used %d, want %d", res.Meter.GasUsed(), want)
+	}
+
+	//gas在写入时耗尽,写入与事件全部回滚
+	ctx.GasLimit = 50
+	res, err = r.Invoke(db, testAddr, ctx, testArgs("put", "k", "new"))
+	if !errors.Is(err, SoCallError_Out_Of_Gas) || res.Meter.GasUsed() != 50 || len(res.RWSet.NsRWSets) != 0 {
+		t.Errorf("invocation out of gas = %v, gas used %d", err, res.Meter.GasUsed())
+	}
+	if getTestState(db, testAddr, "k") != "v" {
+		t.Error("write of an invocation out of gas was kept")
+	}
+	logs := len(db.Logs())
+	if _, err := r.Invoke(db, testAddr, ctx, testArgs("event", "e", string(make([]byte, 100)))); !errors.Is(err, SoCallError_Out_Of_Gas) {
+		t.Errorf("event out of gas = %v", err)
+	}
+	if len(db.Logs()) != logs {
+		t.Error("event of an invocation out of gas was kept")
+	}
+
+	//合约忽略了读取时的gas耗尽
+	ctx.GasLimit = 3
+	res, err = r.Invoke(db, testAddr, ctx, testArgs("get", "k"))
+	if !errors.Is(err, SoCallError_Out_Of_Gas) {
+		t.Errorf("read out of gas = %v", err)
+	}
+}
+
+// Tests that writes are charged when they are buffered, so a contract
+// writing in a loop stops at the write crossing the gas limit.
+func TestMeterBufferedWrites(t *testing.T) {
+	db := newTestMStateDB(t)
+	m := NewMeter(testSchedule, 1000)
+	stub := NewSoCallStub(NewHandlerWithMeter(db, m), nil, testAddr)
+
+	//每次写入读取键策略(10)并写入两字节的键和一字节的值(100+2*3)
+	const perWrite = 10 + 100 + 2*3
+	failed := -1
+	for i := 0; i < 100; i++ {
+		if err := stub.PutState([]byte(fmt.Sprintf("k%d", i%10)), []byte("v")); err != nil {
+			if err != SoCallError_Out_Of_Gas {
+				t.Fatalf("write %d: %v", i, err)
+			}
+			failed = i
+			break
+		}
+	}
+	if want := 1000 / perWrite; failed != want {
+		t.Errorf("write %d ran out of gas, want write %d", failed, want)
+	}
+	if !m.Exhausted() || m.GasUsed() != m.GasLimit() {
+		t.Errorf("exhausted %v, gas used %d of %d", m.Exhausted(), m.GasUsed(), m.GasLimit())
+	}
+	if err := stub.DelState([]byte("k0")); err != SoCallError_Out_Of_Gas {
+		t.Errorf("delete after exhaustion = %v, want %v", err, SoCallError_Out_Of_Gas)
+	}
+	if err := stub.PutPrivateData("collection", "k0", nil); err != SoCallError_Out_Of_Gas {
+		t.Errorf("private write after exhaustion = %v, want %v", err, SoCallError_Out_Of_Gas)
+	}
+	if n := len(stub.RWSet().Writes); n != failed {
+		t.Errorf("%d writes buffered, want %d", n, failed)
+	}
+
+	//提交不再重复计费
+	m = NewMeter(testSchedule, 0)
+	stub = NewSoCallStub(NewHandlerWithMeter(db, m), nil, testAddr)
+	if err := stub.PutState([]byte("k"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	used := m.GasUsed()
+	if err := stub.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if m.GasUsed() != used || m.Writes != 1 {
+		t.Errorf("commit charged %d gas, %d writes", m.GasUsed()-used, m.Writes)
+	}
+}
+
+func TestMeterGasless(t *testing.T) {
+	defer func(gasless bool) { params.Gasless = gasless }(params.Gasless)
+	params.Gasless = true
+
+	db := newTestMStateDB(t)
+	r := NewRegistry()
+	r.Schedule = testSchedule
+	deployTestContract(t, r, db, testAddr)
+
+	res, err := r.Invoke(db, testAddr, &TxContext{GasLimit: 1000}, testArgs("put", "k", "v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Meter.Gasless || res.Meter.GasUsed() == 0 || res.Meter.Writes != 1 {
+		t.Errorf("gasless meter = %+v", res.Meter)
+	}
+	if _, err := r.Invoke(db, testAddr, &TxContext{GasLimit: 50}, testArgs("put", "k", "new")); !errors.Is(err, SoCallError_Out_Of_Gas) {
+		t.Errorf("gasless invocation past the limit = %v, want %v", err, SoCallError_Out_Of_Gas)
+	}
+}
+
+func TestMeterHistory(t *testing.T) {
+	c := newTestChain(t)
+	c.addBlock(t, "k", "v1")
+	c.addBlock(t, "k", "v2")
+	m := NewMeter(testSchedule, 0)
+	stub := NewSoCallStub(NewHandlerWithMeter(newTestMStateDB(t), m), nil, testAddr)
+
+	it, err := stub.GetHistoryForKey("k", 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	historyOf(t, it)
+	if m.HistoryBlocks == 0 || m.GasUsed() < m.HistoryBlocks*testSchedule.HistoryBlock {
+		t.Errorf("history scan metered %d blocks, gas used %d", m.HistoryBlocks, m.GasUsed())
+	}
+}
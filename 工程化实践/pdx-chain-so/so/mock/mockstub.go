@@ -0,0 +1,778 @@
+// Package mock provides an in-memory implementation of so.StubInterface so
+// that SO contracts can be unit tested without a chain.
+package mock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/core/types"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/ethdb/memorydb"
+	"pdx-chain-so/so"
+)
+
+var (
+	ErrTxInProgress = errors.New("mock: a transaction is already in progress")
+	ErrNoTx         = errors.New("mock: no transaction in progress")
+)
+
+var _ so.StubInterface = (*MockStub)(nil)
+
+// TestingT is the subset of *testing.T used by the state assertions.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// MockStub is an in-memory so.StubInterface. Every mocked transaction is
+// executed in its own simulated block, the block number is advanced by
+// MockTransactionStart, so history queries work as they do on chain. The
+// state changes and events of a failed invocation are discarded, in nested
+// invocations through InvokeContract as well.
+type MockStub struct {
+	Name     string
+	Address  common.Address
+	Contract so.Call
+
+	// State holds the committed key/value pairs of the contract.
+	State map[string][]byte
+
+	// PrivateData holds the private values of the contract by collection
+	// and key. The mock is a member of every collection.
+	PrivateData map[string]map[string][]byte
+	// Transient holds the off-chain inputs of every mocked transaction,
+	// private data is only written with a so.TransientSaltKey in it.
+	Transient map[string][]byte
+
+	// Creator and CreatorOrg are returned as the caller identity, Timestamp
+	// as the block time of every mocked transaction.
+	Creator    []byte
+	CreatorOrg string
+	Timestamp  uint64
+
+	// EndorserOrgs are the orgs endorsing the mocked transactions, together
+	// with CreatorOrg they approve the transactions checked by key policies.
+	EndorserOrgs []string
+
+	// KeyPolicies and PrefixPolicies hold the policies of single keys and of
+	// key prefixes.
+	KeyPolicies    map[string]*so.Policy
+	PrefixPolicies map[string]*so.Policy
+
+	args     [][]byte
+	txID     common.Hash
+	txCount  uint64
+	blockNum uint64
+	inTx     bool
+
+	// Events holds the events emitted by the transactions of this mock, by
+	// the contracts it invoked included, in the order they were emitted.
+	Events []*types.Log
+
+	// Invokables holds the mocks InvokeContract can run, by address.
+	Invokables map[common.Address]*MockStub
+
+	// history holds every modification of a key, oldest first.
+	history map[string][]*so.RecordElement
+	// privateHashes holds the salted hashes of the private values by
+	// collection and key joined with U+0000.
+	privateHashes map[string]common.Hash
+	// tx is the transaction in progress, shared with the invoked mocks.
+	tx *mockTx
+	// callers holds the addresses of the contracts on the call stack below
+	// this one, while it is invoked by another mock.
+	callers []common.Address
+}
+
+// mockTx records what is needed to undo the invocations of a transaction.
+type mockTx struct {
+	undo   []func()
+	events []*types.Log
+}
+
+// NewMockStub returns a MockStub for contract. The contract address is
+// derived from name.
+func NewMockStub(name string, contract so.Call) *MockStub {
+	return &MockStub{
+		Name:        name,
+		Address:     common.BytesToAddress(crypto.Keccak256([]byte(name))),
+		Contract:    contract,
+		State:       make(map[string][]byte),
+		PrivateData: make(map[string]map[string][]byte),
+
+		KeyPolicies:    make(map[string]*so.Policy),
+		PrefixPolicies: make(map[string]*so.Policy),
+		Invokables:     make(map[common.Address]*MockStub),
+		history:        make(map[string][]*so.RecordElement),
+		privateHashes:  make(map[string]common.Hash),
+	}
+}
+
+// MockPeerContract makes the contract mocked by peer available to
+// InvokeContract under the address of peer.
+func (s *MockStub) MockPeerContract(peer *MockStub) {
+	s.Invokables[peer.Address] = peer
+}
+
+// MockTransactionStart opens a transaction with the given id in a new
+// simulated block.
+func (s *MockStub) MockTransactionStart(txID common.Hash) error {
+	if s.inTx {
+		return ErrTxInProgress
+	}
+	s.inTx = true
+	s.txID = txID
+	s.tx = &mockTx{}
+	s.txCount++
+	s.blockNum++
+	return nil
+}
+
+// MockTransactionEnd closes the transaction opened by MockTransactionStart.
+func (s *MockStub) MockTransactionEnd(txID common.Hash) error {
+	if !s.inTx || s.txID != txID {
+		return ErrNoTx
+	}
+	s.Events = append(s.Events, s.tx.events...)
+	s.inTx = false
+	s.args = nil
+	s.tx = nil
+	return nil
+}
+
+// MockInvoke runs the contract with fn and args in a new transaction and
+// returns the payload of its response, or the Err of a failed response.
+func (s *MockStub) MockInvoke(fn string, args ...[]byte) ([]byte, error) {
+	txID := crypto.Keccak256Hash([]byte(s.Name), common.Uint64ToByte(s.txCount+1))
+	return s.MockInvokeWithTxID(txID, fn, args...)
+}
+
+// MockInvokeWithTxID runs the contract with fn and args in a new transaction
+// with the given id.
+func (s *MockStub) MockInvokeWithTxID(txID common.Hash, fn string, args ...[]byte) ([]byte, error) {
+	if err := s.MockTransactionStart(txID); err != nil {
+		return nil, err
+	}
+	defer s.MockTransactionEnd(txID)
+
+	res := s.run(append([][]byte{[]byte(fn)}, args...))
+	if !res.IsSuccess() {
+		return nil, res.Err()
+	}
+	return res.Payload, nil
+}
+
+// MockInvokeResponse runs the contract with fn and args in a new
+// transaction and returns its response.
+func (s *MockStub) MockInvokeResponse(fn string, args ...[]byte) so.Response {
+	txID := crypto.Keccak256Hash([]byte(s.Name), common.Uint64ToByte(s.txCount+1))
+	if err := s.MockTransactionStart(txID); err != nil {
+		return so.FromError(err)
+	}
+	defer s.MockTransactionEnd(txID)
+
+	return s.run(append([][]byte{[]byte(fn)}, args...))
+}
+
+// InvokeContract runs the mock registered for address by MockPeerContract in
+// the current transaction.
+func (s *MockStub) InvokeContract(address common.Address, args [][]byte) ([]byte, error) {
+	if !s.inTx {
+		return nil, ErrNoTx
+	}
+	callers := append(s.callers[:len(s.callers):len(s.callers)], s.Address)
+	if len(callers) >= so.MaxCallDepth {
+		return nil, so.SoCallError_Call_Depth
+	}
+	for _, caller := range callers {
+		if caller == address {
+			return nil, so.SoCallError_Reentrant_Call
+		}
+	}
+	peer, ok := s.Invokables[address]
+	if !ok {
+		return nil, so.SoCallError_Contract_Not_Found
+	}
+
+	peer.inTx, peer.txID, peer.blockNum, peer.tx, peer.callers = true, s.txID, s.blockNum, s.tx, callers
+	defer func() {
+		peer.inTx, peer.args, peer.tx, peer.callers = false, nil, nil, nil
+	}()
+	res := peer.run(args)
+	if !res.IsSuccess() {
+		return nil, res.Err()
+	}
+	return res.Payload, nil
+}
+
+// MockInit runs the Init of the contract with args in a new transaction, as
+// a deployment does. A contract that is not a so.Initializer succeeds.
+func (s *MockStub) MockInit(args ...[]byte) so.Response {
+	return s.mockLifecycle(args, func() so.Response {
+		if init, ok := s.Contract.(so.Initializer); ok {
+			return init.Init(s)
+		}
+		return so.Success(nil)
+	})
+}
+
+// MockUpgrade replaces the contract by contract and runs its Upgrade with
+// fromVersion and args in a new transaction, as an upgrade does. The
+// previous contract is kept when the upgrade fails.
+func (s *MockStub) MockUpgrade(contract so.Call, fromVersion string, args ...[]byte) so.Response {
+	previous := s.Contract
+	s.Contract = contract
+	res := s.mockLifecycle(args, func() so.Response {
+		if up, ok := contract.(so.Upgrader); ok {
+			return up.Upgrade(s, fromVersion)
+		}
+		return so.Success(nil)
+	})
+	if !res.IsSuccess() {
+		s.Contract = previous
+	}
+	return res
+}
+
+func (s *MockStub) mockLifecycle(args [][]byte, hook func() so.Response) so.Response {
+	txID := crypto.Keccak256Hash([]byte(s.Name), common.Uint64ToByte(s.txCount+1))
+	if err := s.MockTransactionStart(txID); err != nil {
+		return so.FromError(err)
+	}
+	defer s.MockTransactionEnd(txID)
+
+	return s.call(args, hook)
+}
+
+// run runs the contract with args in the current transaction.
+func (s *MockStub) run(args [][]byte) so.Response {
+	return s.call(args, func() so.Response { return s.Contract.Run(s) })
+}
+
+// call runs fn with args as the arguments of the current transaction. When
+// fn fails, its changes and those of the contracts it invoked are undone,
+// as on chain, a panic is turned into an InternalError response.
+func (s *MockStub) call(args [][]byte, fn func() so.Response) (res so.Response) {
+	tx := s.tx
+	undo, events := len(tx.undo), len(tx.events)
+	tx.undo = append(tx.undo, s.snapshot())
+
+	defer func() {
+		if r := recover(); r != nil {
+			res = so.FromError(fmt.Errorf("%w: %v", so.SoCallError_Contract_Panic, r))
+		}
+		if !res.IsSuccess() {
+			for i := len(tx.undo) - 1; i >= undo; i-- {
+				tx.undo[i]()
+			}
+			tx.undo, tx.events = tx.undo[:undo], tx.events[:events]
+		}
+	}()
+	s.args = args
+	return fn()
+}
+
+// snapshot copies the state, history, private data and policy maps and
+// returns a function restoring them when an invocation fails.
+func (s *MockStub) snapshot() func() {
+	state := make(map[string][]byte, len(s.State))
+	for k, v := range s.State {
+		state[k] = v
+	}
+	history := make(map[string][]*so.RecordElement, len(s.history))
+	for k, v := range s.history {
+		history[k] = v[:len(v):len(v)]
+	}
+	private := make(map[string]map[string][]byte, len(s.PrivateData))
+	for c, values := range s.PrivateData {
+		private[c] = make(map[string][]byte, len(values))
+		for k, v := range values {
+			private[c][k] = v
+		}
+	}
+	privateHashes := make(map[string]common.Hash, len(s.privateHashes))
+	for k, h := range s.privateHashes {
+		privateHashes[k] = h
+	}
+	keyPolicies := make(map[string]*so.Policy, len(s.KeyPolicies))
+	for k, p := range s.KeyPolicies {
+		keyPolicies[k] = p
+	}
+	prefixPolicies := make(map[string]*so.Policy, len(s.PrefixPolicies))
+	for k, p := range s.PrefixPolicies {
+		prefixPolicies[k] = p
+	}
+	return func() {
+		s.State, s.history, s.PrivateData, s.privateHashes = state, history, private, privateHashes
+		s.KeyPolicies, s.PrefixPolicies = keyPolicies, prefixPolicies
+	}
+}
+
+// BlockNumber returns the number of the current simulated block.
+func (s *MockStub) BlockNumber() uint64 {
+	return s.blockNum
+}
+
+// AssertState reports a test error unless key holds expected.
+func (s *MockStub) AssertState(t TestingT, key string, expected []byte) {
+	t.Helper()
+	v, ok := s.State[key]
+	if !ok {
+		t.Errorf("mock %s: state %q is absent, want %x", s.Name, key, expected)
+		return
+	}
+	if !bytes.Equal(v, expected) {
+		t.Errorf("mock %s: state %q is %x, want %x", s.Name, key, v, expected)
+	}
+}
+
+// AssertStateAbsent reports a test error if key holds a value.
+func (s *MockStub) AssertStateAbsent(t TestingT, key string) {
+	t.Helper()
+	if v, ok := s.State[key]; ok {
+		t.Errorf("mock %s: state %q is %x, want absent", s.Name, key, v)
+	}
+}
+
+func (s *MockStub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *MockStub) GetStringArgs() []string {
+	strargs := make([]string, 0, len(s.args))
+	for _, barg := range s.args {
+		strargs = append(strargs, string(barg))
+	}
+	return strargs
+}
+
+func (s *MockStub) GetFunctionAndParameters() (string, [][]byte) {
+	if len(s.args) == 0 {
+		return "", [][]byte{}
+	}
+	return string(s.args[0]), s.args[1:]
+}
+
+func (s *MockStub) GetTxID() string {
+	return s.txID.Hex()
+}
+
+func (s *MockStub) GetTxTimestamp() (uint64, error) {
+	return s.Timestamp, nil
+}
+
+func (s *MockStub) GetBlockNumber() (uint64, error) {
+	return s.blockNum, nil
+}
+
+func (s *MockStub) GetCreator() ([]byte, error) {
+	if len(s.Creator) == 0 {
+		return nil, so.SoCallError_Creator_Unavailable
+	}
+	return s.Creator, nil
+}
+
+func (s *MockStub) GetCallerOrg() (string, error) {
+	if len(s.Creator) == 0 {
+		return "", so.SoCallError_Creator_Unavailable
+	}
+	if s.CreatorOrg == "" {
+		return "", so.SoCallError_Org_Not_Found
+	}
+	return s.CreatorOrg, nil
+}
+
+func (s *MockStub) GetTransient() (map[string][]byte, error) {
+	return s.Transient, nil
+}
+
+func (s *MockStub) GetState(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, so.SoCallError_Input_Error
+	}
+	v, ok := s.State[string(key)]
+	if !ok {
+		return nil, so.SoCallError_NoResult
+	}
+	return v, nil
+}
+
+// GetStateWithProof proves the value of key in a state holding State as the
+// storage of the contract. Unlike a node, the mock sees the writes of the
+// transaction in progress, the root of the proof is only known to the mock.
+func (s *MockStub) GetStateWithProof(key []byte) (*so.StateProof, error) {
+	if len(key) == 0 {
+		return nil, so.SoCallError_Input_Error
+	}
+	st, err := state.New(common.Hash{}, state.NewDatabase(memorydb.New()))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.State {
+		st.SetPDXState(s.Address, so.StateKeySlot([]byte(k)), v)
+	}
+	p := &so.StateProof{
+		BlockNumber: s.blockNum,
+		Root:        st.IntermediateRoot(false),
+		Value:       s.State[string(key)],
+	}
+	if p.Proof, err = st.GetPDXProof(s.Address, so.StateKeySlot(key)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *MockStub) PutState(key []byte, value []byte) error {
+	if err := s.validateKey(key); err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return s.DelState(key)
+	}
+	if err := s.checkPolicy(string(key)); err != nil {
+		return err
+	}
+	s.State[string(key)] = common.CopyBytes(value)
+	s.record(string(key), common.CopyBytes(value))
+	return nil
+}
+
+func (s *MockStub) DelState(key []byte) error {
+	if err := s.validateKey(key); err != nil {
+		return err
+	}
+	if err := s.checkPolicy(string(key)); err != nil {
+		return err
+	}
+	if _, ok := s.State[string(key)]; !ok {
+		return nil
+	}
+	delete(s.State, string(key))
+	s.record(string(key), []byte{})
+	return nil
+}
+
+// checkPolicy fails unless CreatorOrg and EndorserOrgs satisfy the policy
+// governing key.
+func (s *MockStub) checkPolicy(key string) error {
+	policy, _ := s.GetKeyPolicy(key)
+	if policy == nil {
+		return nil
+	}
+	orgs := s.EndorserOrgs
+	if len(s.Creator) > 0 && s.CreatorOrg != "" {
+		orgs = append([]string{s.CreatorOrg}, orgs...)
+	}
+	if !policy.Satisfied(orgs) {
+		return so.SoCallError_Policy_Not_Satisfied
+	}
+	return nil
+}
+
+func (s *MockStub) GetKeyPolicy(key string) (*so.Policy, error) {
+	if p, ok := s.KeyPolicies[key]; ok {
+		return p, nil
+	}
+	var (
+		policy *so.Policy
+		best   = -1
+	)
+	for prefix, p := range s.PrefixPolicies {
+		if strings.HasPrefix(key, prefix) && len(prefix) > best {
+			policy, best = p, len(prefix)
+		}
+	}
+	return policy, nil
+}
+
+func (s *MockStub) SetKeyPolicy(key string, policy *so.Policy) error {
+	if err := s.validateKey([]byte(key)); err != nil {
+		return err
+	}
+	if err := s.checkPolicy(key); err != nil {
+		return err
+	}
+	if policy == nil {
+		delete(s.KeyPolicies, key)
+		return nil
+	}
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	s.KeyPolicies[key] = policy
+	return nil
+}
+
+func (s *MockStub) SetPrefixPolicy(prefix string, policy *so.Policy) error {
+	if !s.inTx {
+		return ErrNoTx
+	}
+	if prefix == "" {
+		return so.SoCallError_Input_Error
+	}
+	if err := s.checkPolicy(prefix); err != nil {
+		return err
+	}
+	if policy == nil {
+		delete(s.PrefixPolicies, prefix)
+		return nil
+	}
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	s.PrefixPolicies[prefix] = policy
+	return nil
+}
+
+func (s *MockStub) PutPrivateData(collection string, key string, value []byte) error {
+	if collection == "" {
+		return so.SoCallError_Input_Error
+	}
+	if err := s.validateKey([]byte(key)); err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return s.DelPrivateData(collection, key)
+	}
+	salt, err := so.PrivateDataSalt(s.Transient[so.TransientSaltKey], collection, key)
+	if err != nil {
+		return err
+	}
+	if s.PrivateData[collection] == nil {
+		s.PrivateData[collection] = make(map[string][]byte)
+	}
+	s.PrivateData[collection][key] = common.CopyBytes(value)
+	s.privateHashes[collection+"\x00"+key] = so.PrivateDataHash(salt, value)
+	return nil
+}
+
+func (s *MockStub) GetPrivateData(collection string, key string) ([]byte, error) {
+	v, ok := s.PrivateData[collection][key]
+	if !ok {
+		return nil, so.SoCallError_NoResult
+	}
+	return v, nil
+}
+
+func (s *MockStub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	hash, ok := s.privateHashes[collection+"\x00"+key]
+	if !ok {
+		return nil, so.SoCallError_NoResult
+	}
+	return hash.Bytes(), nil
+}
+
+func (s *MockStub) DelPrivateData(collection string, key string) error {
+	if collection == "" {
+		return so.SoCallError_Input_Error
+	}
+	if err := s.validateKey([]byte(key)); err != nil {
+		return err
+	}
+	delete(s.PrivateData[collection], key)
+	delete(s.privateHashes, collection+"\x00"+key)
+	return nil
+}
+
+func (s *MockStub) SetEvent(name string, payload []byte) error {
+	if !s.inTx {
+		return ErrNoTx
+	}
+	if name == "" {
+		return so.SoCallError_Input_Error
+	}
+	s.tx.events = append(s.tx.events, &types.Log{
+		Address:     s.Address,
+		Name:        name,
+		Payload:     common.CopyBytes(payload),
+		BlockNumber: s.blockNum,
+		TxHash:      s.txID,
+		Index:       uint(len(s.tx.events)),
+	})
+	return nil
+}
+
+func (s *MockStub) validateKey(key []byte) error {
+	if !s.inTx {
+		return ErrNoTx
+	}
+	if len(key) == 0 {
+		return so.SoCallError_Input_Error
+	}
+	if key[0] == 0 {
+		if _, _, err := so.SplitCompositeKey(string(key)); err != nil {
+			return so.SoCallError_Key_Namespace_Reserved
+		}
+	}
+	return nil
+}
+
+// record appends a modification of key to its history, repeated writes in
+// one block keep the last value only.
+func (s *MockStub) record(key string, value []byte) {
+	rec := &so.RecordElement{
+		Value:    value,
+		BlockNum: s.blockNum,
+		TxHash:   s.txID,
+		IsDelete: len(value) == 0,
+	}
+	hist := s.history[key]
+	if n := len(hist); n > 0 && hist[n-1].BlockNum == s.blockNum {
+		hist[n-1] = rec
+		return
+	}
+	s.history[key] = append(hist, rec)
+}
+
+func (s *MockStub) GetStateByRange(startKey, endKey string) (so.StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = "\x01"
+	}
+	if (len(startKey) > 0 && startKey[0] == 0) || (len(endKey) > 0 && endKey[0] == 0) {
+		return nil, so.SoCallError_Key_Namespace_Reserved
+	}
+	return s.rangeQuery(startKey, endKey)
+}
+
+func (s *MockStub) GetStateByPrefix(prefix string) (so.StateQueryIteratorInterface, error) {
+	end := []byte(prefix)
+	for len(end) > 0 && end[len(end)-1] == 0xff {
+		end = end[:len(end)-1]
+	}
+	if len(end) > 0 {
+		end[len(end)-1]++
+	}
+	return s.GetStateByRange(prefix, string(end))
+}
+
+func (s *MockStub) GetStateByPartialCompositeKey(objectType string, attributes []string) (so.StateQueryIteratorInterface, error) {
+	partial, err := so.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return s.rangeQuery(partial, partial+string(rune(utf8.MaxRune)))
+}
+
+func (s *MockStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return so.CreateCompositeKey(objectType, attributes)
+}
+
+func (s *MockStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	return so.SplitCompositeKey(compositeKey)
+}
+
+// rangeQuery returns the pairs in [startKey, endKey) in key order, an empty
+// endKey leaves the range open.
+func (s *MockStub) rangeQuery(startKey, endKey string) (so.StateQueryIteratorInterface, error) {
+	if endKey != "" && startKey > endKey {
+		return nil, so.SoCallError_Range_Illegal
+	}
+	keys := make([]string, 0, len(s.State))
+	for k := range s.State {
+		if k >= startKey && (endKey == "" || k < endKey) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	results := make([]*so.KV, 0, len(keys))
+	for _, k := range keys {
+		results = append(results, &so.KV{Key: k, Value: s.State[k]})
+	}
+	return so.NewStateQueryIterator(results), nil
+}
+
+// GetQueryResult runs a rich query on State. Unlike a node, the mock sees
+// the writes of the transaction in progress.
+func (s *MockStub) GetQueryResult(query string) (so.StateQueryIteratorInterface, error) {
+	it, _, err := s.GetQueryResultWithPagination(query, 0, "")
+	return it, err
+}
+
+func (s *MockStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (so.StateQueryIteratorInterface, *so.QueryResponseMetadata, error) {
+	if pageSize < 0 {
+		return nil, nil, so.SoCallError_Input_Error
+	}
+	q, err := so.ParseQuery(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := make([]string, 0, len(s.State))
+	for k := range s.State {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]*so.KV, len(keys))
+	for i, k := range keys {
+		kvs[i] = &so.KV{Key: k, Value: s.State[k]}
+	}
+	results, md := q.Select(kvs, pageSize, bookmark)
+	return so.NewStateQueryIterator(results), md, nil
+}
+
+func (s *MockStub) GetHistoryForKey(key string, start, end uint64) (so.HistoryQueryIteratorInterface, error) {
+	records, _, err := s.historyPage(key, start, end, 0, "", so.HistoryNewestFirst)
+	if err != nil {
+		return nil, err
+	}
+	return so.NewHistoryQueryIterator(records), nil
+}
+
+func (s *MockStub) GetHistoryForKeyWithPagination(key string, start, end uint64, pageSize int32, bookmark string, order so.HistoryOrder) (so.HistoryQueryIteratorInterface, *so.QueryResponseMetadata, error) {
+	records, metadata, err := s.historyPage(key, start, end, pageSize, bookmark, order)
+	if err != nil {
+		return nil, nil, err
+	}
+	return so.NewHistoryQueryIterator(records), metadata, nil
+}
+
+// historyPage returns the modifications of key in the blocks [start, end) in the
+// given order, paginated the same way as SOCallStub does.
+func (s *MockStub) historyPage(key string, start, end uint64, pageSize int32, bookmark string, order so.HistoryOrder) ([]*so.RecordElement, *so.QueryResponseMetadata, error) {
+	if len(key) == 0 || pageSize < 0 {
+		return nil, nil, so.SoCallError_Input_Error
+	}
+	if start > end {
+		return nil, nil, so.SoCallError_Start_FinishNum_Illegal
+	}
+	if order != so.HistoryNewestFirst && order != so.HistoryOldestFirst {
+		return nil, nil, so.SoCallError_Input_Error
+	}
+	var records []*so.RecordElement
+	for _, rec := range s.history[key] {
+		if rec.BlockNum >= start && rec.BlockNum < end {
+			records = append(records, rec)
+		}
+	}
+	if order == so.HistoryNewestFirst {
+		for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+			records[i], records[j] = records[j], records[i]
+		}
+	}
+	if bookmark != "" {
+		mark, err := strconv.ParseUint(bookmark, 10, 64)
+		if err != nil || mark < start || mark >= end {
+			return nil, nil, so.SoCallError_History_Bookmark_Illegal
+		}
+		for len(records) > 0 && ((order == so.HistoryOldestFirst && records[0].BlockNum < mark) ||
+			(order == so.HistoryNewestFirst && records[0].BlockNum > mark)) {
+			records = records[1:]
+		}
+	}
+	metadata := &so.QueryResponseMetadata{}
+	if pageSize > 0 && len(records) > int(pageSize) {
+		next := records[pageSize].BlockNum
+		records = records[:pageSize]
+		metadata.HasMore = true
+		metadata.Bookmark = strconv.FormatUint(next, 10)
+	}
+	metadata.FetchedRecordsCount = int32(len(records))
+	return records, metadata, nil
+}
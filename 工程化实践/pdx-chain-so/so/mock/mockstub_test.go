@@ -0,0 +1,319 @@
+package mock
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"pdx-chain-so/so"
+)
+
+// testContract runs the function named by the first argument of an
+// invocation, see the cases of Run.
+type testContract struct{}
+
+func (testContract) Run(stub interface{}) so.Response {
+	s := stub.(so.StubInterface)
+	fn, args := s.GetFunctionAndParameters()
+	switch fn {
+	case "put":
+		for i := 0; i+1 < len(args); i += 2 {
+			if err := s.PutState(args[i], args[i+1]); err != nil {
+				return so.FromError(err)
+			}
+		}
+		return so.Success(nil)
+	case "get":
+		v, err := s.GetState(args[0])
+		if err != nil {
+			return so.FromError(err)
+		}
+		return so.Success(v)
+	case "del":
+		if err := s.DelState(args[0]); err != nil {
+			return so.FromError(err)
+		}
+		return so.Success(nil)
+	case "putThenFail":
+		s.PutState(args[0], args[1])
+		s.SetEvent("written", args[0])
+		return so.Error("failed on purpose")
+	case "putThenPanic":
+		s.PutState(args[0], args[1])
+		panic("boom")
+	case "putPrivate":
+		transient, _ := s.GetTransient()
+		if err := s.PutPrivateData(string(args[0]), string(args[1]), transient["value"]); err != nil {
+			return so.FromError(err)
+		}
+		return so.Success(nil)
+	case "event":
+		if err := s.SetEvent(string(args[0]), args[1]); err != nil {
+			return so.FromError(err)
+		}
+		return so.Success(nil)
+	case "invoke":
+		peer := NewMockStub(string(args[0]), nil).Address
+		v, err := s.InvokeContract(peer, args[1:])
+		if err != nil {
+			return so.FromError(err)
+		}
+		return so.Success(v)
+	case "invokeIgnoringError":
+		peer := NewMockStub(string(args[0]), nil).Address
+		s.PutState([]byte("caller"), []byte("written"))
+		s.InvokeContract(peer, args[1:])
+		return so.Success(nil)
+	}
+	return so.Error("unknown function " + fn)
+}
+
+func TestMockStubState(t *testing.T) {
+	stub := NewMockStub("state", testContract{})
+	if _, err := stub.MockInvoke("put", []byte("a"), []byte("1"), []byte("b"), []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	stub.AssertState(t, "a", []byte("1"))
+	if v, err := stub.MockInvoke("get", []byte("b")); err != nil || string(v) != "2" {
+		t.Errorf("get b = %q, %v", v, err)
+	}
+	if _, err := stub.MockInvoke("del", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	stub.AssertStateAbsent(t, "a")
+	if _, err := stub.MockInvoke("get", []byte("a")); !errors.Is(err, so.SoCallError_NoResult) {
+		t.Errorf("get of a deleted key = %v, want %v", err, so.SoCallError_NoResult)
+	}
+	if err := stub.PutState([]byte("x"), []byte("1")); err != ErrNoTx {
+		t.Errorf("PutState outside a transaction = %v, want %v", err, ErrNoTx)
+	}
+	if _, err := stub.MockInvoke("put", []byte("\x00bad"), []byte("1")); err == nil {
+		t.Error("put of a malformed composite key succeeded")
+	}
+}
+
+func TestMockStubRollback(t *testing.T) {
+	stub := NewMockStub("rollback", testContract{})
+	if _, err := stub.MockInvoke("put", []byte("k"), []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	res := stub.MockInvokeResponse("putThenFail", []byte("k"), []byte("new"))
+	if res.IsSuccess() || res.Status != so.BusinessError {
+		t.Errorf("putThenFail = %+v, want a business error", res)
+	}
+	stub.AssertState(t, "k", []byte("old"))
+
+	res = stub.MockInvokeResponse("putThenPanic", []byte("k"), []byte("new"))
+	if res.Status != so.InternalError || !strings.Contains(res.Message, "boom") {
+		t.Errorf("putThenPanic = %+v, want an internal error", res)
+	}
+	stub.AssertState(t, "k", []byte("old"))
+	if len(stub.Events) != 0 {
+		t.Errorf("events of failed invocations were kept: %v", stub.Events)
+	}
+
+	it, err := stub.GetHistoryForKey("k", 0, stub.BlockNumber()+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for it.HasNext() {
+		it.Next()
+		n++
+	}
+	if n != 1 {
+		t.Errorf("history of k has %d records, want 1", n)
+	}
+}
+
+func TestMockStubEvents(t *testing.T) {
+	stub := NewMockStub("events", testContract{})
+	for _, name := range []string{"first", "second"} {
+		if _, err := stub.MockInvoke("event", []byte(name), []byte("payload")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(stub.Events) != 2 || stub.Events[0].Name != "first" || stub.Events[1].Name != "second" {
+		t.Fatalf("events = %v", stub.Events)
+	}
+	if e := stub.Events[1]; e.BlockNumber != 2 || e.Address != stub.Address || string(e.Payload) != "payload" {
+		t.Errorf("second event = %+v", e)
+	}
+	if _, err := stub.MockInvoke("event", []byte(""), nil); !errors.Is(err, so.SoCallError_Input_Error) {
+		t.Errorf("event without a name = %v", err)
+	}
+}
+
+func TestMockStubInvokeContract(t *testing.T) {
+	caller := NewMockStub("caller", testContract{})
+	callee := NewMockStub("callee", testContract{})
+	caller.MockPeerContract(callee)
+	callee.MockPeerContract(caller)
+
+	if _, err := caller.MockInvoke("invoke", []byte("callee"), []byte("put"), []byte("k"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	callee.AssertState(t, "k", []byte("v"))
+	caller.AssertStateAbsent(t, "k")
+
+	//被调合约失败时只回滚其自身的修改
+	if _, err := caller.MockInvoke("invokeIgnoringError", []byte("callee"), []byte("putThenFail"), []byte("k"), []byte("lost")); err != nil {
+		t.Fatal(err)
+	}
+	callee.AssertState(t, "k", []byte("v"))
+	caller.AssertState(t, "caller", []byte("written"))
+
+	_, err := caller.MockInvoke("invoke", []byte("callee"), []byte("invoke"), []byte("caller"), []byte("get"), []byte("k"))
+	if !errors.Is(err, so.SoCallError_Reentrant_Call) {
+		t.Errorf("reentrant call = %v, want %v", err, so.SoCallError_Reentrant_Call)
+	}
+	if _, err := caller.MockInvoke("invoke", []byte("nobody")); !errors.Is(err, so.SoCallError_Contract_Not_Found) {
+		t.Errorf("call of an unknown contract = %v, want %v", err, so.SoCallError_Contract_Not_Found)
+	}
+}
+
+func TestMockStubHistoryPagination(t *testing.T) {
+	stub := NewMockStub("history", testContract{})
+	for _, v := range []string{"1", "2", "3"} {
+		if _, err := stub.MockInvoke("put", []byte("k"), []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stub.MockInvoke("del", []byte("k"))
+
+	var got []string
+	bookmark := ""
+	for {
+		it, meta, err := stub.GetHistoryForKeyWithPagination("k", 0, stub.BlockNumber()+1, 3, bookmark, so.HistoryOldestFirst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for it.HasNext() {
+			rec, _ := it.Next()
+			if rec.IsDelete {
+				got = append(got, "-")
+			} else {
+				got = append(got, string(rec.Value))
+			}
+		}
+		if !meta.HasMore {
+			break
+		}
+		bookmark = meta.Bookmark
+	}
+	if strings.Join(got, ",") != "1,2,3,-" {
+		t.Errorf("history = %v, want [1 2 3 -]", got)
+	}
+	if _, _, err := stub.GetHistoryForKeyWithPagination("k", 0, 2, 0, "9", so.HistoryOldestFirst); err != so.SoCallError_History_Bookmark_Illegal {
+		t.Errorf("bookmark outside the range = %v", err)
+	}
+}
+
+func TestMockStubRangeQueries(t *testing.T) {
+	stub := NewMockStub("range", testContract{})
+	car, _ := stub.CreateCompositeKey("car", []string{"red", "1"})
+	if _, err := stub.MockInvoke("put", []byte("a1"), []byte("1"), []byte("a2"), []byte("2"), []byte("b"), []byte("3"), []byte(car), []byte("4")); err != nil {
+		t.Fatal(err)
+	}
+	keys := func(it so.StateQueryIteratorInterface, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ks []string
+		for it.HasNext() {
+			kv, _ := it.Next()
+			ks = append(ks, kv.Key)
+		}
+		return strings.Join(ks, ",")
+	}
+	if got := keys(stub.GetStateByRange("", "")); got != "a1,a2,b" {
+		t.Errorf("GetStateByRange = %q", got)
+	}
+	if got := keys(stub.GetStateByPrefix("a")); got != "a1,a2" {
+		t.Errorf("GetStateByPrefix = %q", got)
+	}
+	if got := keys(stub.GetStateByPartialCompositeKey("car", []string{"red"})); got != car {
+		t.Errorf("GetStateByPartialCompositeKey = %q", got)
+	}
+	if _, err := stub.GetStateByRange("b", "a"); err != so.SoCallError_Range_Illegal {
+		t.Errorf("inverted range = %v", err)
+	}
+}
+
+func TestMockStubKeyPolicy(t *testing.T) {
+	stub := NewMockStub("policy", testContract{})
+	stub.PrefixPolicies["owned/"] = &so.Policy{Orgs: []string{"org1", "org2"}, Threshold: 2}
+	stub.Creator, stub.CreatorOrg = []byte{2}, "org1"
+
+	if _, err := stub.MockInvoke("put", []byte("owned/k"), []byte("v")); !errors.Is(err, so.SoCallError_Policy_Not_Satisfied) {
+		t.Errorf("put without endorsement = %v, want %v", err, so.SoCallError_Policy_Not_Satisfied)
+	}
+	stub.EndorserOrgs = []string{"org2"}
+	if _, err := stub.MockInvoke("put", []byte("owned/k"), []byte("v")); err != nil {
+		t.Errorf("put endorsed by both orgs = %v", err)
+	}
+	if _, err := stub.MockInvoke("put", []byte("free"), []byte("v")); err != nil {
+		t.Errorf("put outside the policy = %v", err)
+	}
+}
+
+func TestMockStubLifecycle(t *testing.T) {
+	stub := NewMockStub("lifecycle", testContract{})
+	if res := stub.MockInit(); !res.IsSuccess() {
+		t.Errorf("MockInit of a contract without Init = %+v", res)
+	}
+	previous := stub.Contract
+	if res := stub.MockUpgrade(failingUpgrade{}, "1.0"); res.IsSuccess() {
+		t.Error("failing upgrade succeeded")
+	}
+	if stub.Contract != previous {
+		t.Error("failed upgrade replaced the contract")
+	}
+}
+
+type failingUpgrade struct{ testContract }
+
+func (failingUpgrade) Upgrade(stub interface{}, fromVersion string) so.Response {
+	return so.Error("cannot upgrade from " + fromVersion)
+}
+
+func TestMockStubStateProof(t *testing.T) {
+	stub := NewMockStub("proof", testContract{})
+	if _, err := stub.MockInvoke("put", []byte("k"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	p, err := stub.GetStateWithProof([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Verify(stub.Address, []byte("k")); err != nil || string(p.Value) != "v" {
+		t.Errorf("proof of k: value %q, verify %v", p.Value, err)
+	}
+	p.Value = []byte("forged")
+	if err := p.Verify(stub.Address, []byte("k")); err == nil {
+		t.Error("proof of a forged value verified")
+	}
+}
+
+func TestMockStubPrivateData(t *testing.T) {
+	stub := NewMockStub("private", testContract{})
+	stub.Transient = map[string][]byte{"value": []byte("42")}
+	if _, err := stub.MockInvoke("putPrivate", []byte("secret"), []byte("k")); !errors.Is(err, so.SoCallError_Private_Salt_Missing) {
+		t.Errorf("private write without a salt secret = %v, want %v", err, so.SoCallError_Private_Salt_Missing)
+	}
+
+	secret := []byte("0123456789abcdef")
+	stub.Transient[so.TransientSaltKey] = secret
+	if _, err := stub.MockInvoke("putPrivate", []byte("secret"), []byte("k")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := stub.GetPrivateData("secret", "k"); err != nil || string(v) != "42" {
+		t.Errorf("GetPrivateData = %q, %v", v, err)
+	}
+	salt, _ := so.PrivateDataSalt(secret, "secret", "k")
+	if h, err := stub.GetPrivateDataHash("secret", "k"); err != nil || string(h) != string(so.PrivateDataHash(salt, []byte("42")).Bytes()) {
+		t.Errorf("GetPrivateDataHash = %x, %v", h, err)
+	}
+}
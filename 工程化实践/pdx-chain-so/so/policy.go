@@ -0,0 +1,289 @@
+package so
+
+import (
+	"errors"
+	"sort"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/params"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+)
+
+var (
+	SoCallError_Policy_Illegal       = errors.New("Key policy is illegal")
+	SoCallError_Policy_Not_Satisfied = errors.New("Key policy is not satisfied by the transaction")
+)
+
+var keyPolicyPrefix = []byte("pdx-so-key-policy")
+
+// keyPolicySlot returns the PDX storage slot holding the key policies of a
+// contract.
+func keyPolicySlot() common.Hash {
+	return crypto.Keccak256Hash(keyPolicyPrefix)
+}
+
+// Policy restricts the writes of a key to the transactions approved by
+// Threshold distinct orgs of Orgs. An org approves a transaction when the
+// caller or one of the endorsers belongs to it, so "only org A may write" is
+// {Orgs: [A], Threshold: 1} and "2 of orgs A, B, C must endorse" is
+// {Orgs: [A, B, C], Threshold: 2}.
+type Policy struct {
+	Orgs      []string
+	Threshold uint64
+}
+
+// Validate checks that the policy can be satisfied by the consortium. The
+// orgs must be distinct, a repeated org would count towards the threshold
+// once only.
+func (p *Policy) Validate() error {
+	if len(p.Orgs) == 0 || p.Threshold == 0 || p.Threshold > uint64(len(p.Orgs)) {
+		return SoCallError_Policy_Illegal
+	}
+	for i, name := range p.Orgs {
+		if name == "" {
+			return SoCallError_Policy_Illegal
+		}
+		for _, other := range p.Orgs[:i] {
+			if other == name {
+				return SoCallError_Policy_Illegal
+			}
+		}
+	}
+	if params.ConsortiumConf != nil {
+		for _, name := range p.Orgs {
+			found := false
+			for _, org := range params.ConsortiumConf.Orgs {
+				if org.Name == name {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return SoCallError_Policy_Illegal
+			}
+		}
+	}
+	return nil
+}
+
+// Satisfied reports whether the approving orgs meet the policy.
+func (p *Policy) Satisfied(orgs []string) bool {
+	var n uint64
+	for _, name := range p.Orgs {
+		for _, org := range orgs {
+			if org == name {
+				n++
+				break
+			}
+		}
+	}
+	return n >= p.Threshold
+}
+
+// ApprovingOrgs returns the consortium orgs of the caller and the endorsers
+// of the transaction described by ctx, identities outside the consortium
+// are skipped.
+func ApprovingOrgs(ctx *TxContext) []string {
+	if ctx == nil {
+		return nil
+	}
+	var orgs []string
+	add := func(org string, err error) {
+		if err != nil {
+			return
+		}
+		for _, o := range orgs {
+			if o == org {
+				return
+			}
+		}
+		orgs = append(orgs, org)
+	}
+	add(ctx.CallerOrg())
+	for _, endorser := range ctx.Endorsers {
+		add(CallerOrg(endorser))
+	}
+	return orgs
+}
+
+// KeyPolicy binds a policy to a key, or to every key starting with Key when
+// Prefix is set.
+type KeyPolicy struct {
+	Key    string
+	Prefix bool
+	Policy *Policy
+}
+
+// keyPolicies is the policy table of a contract, sorted by key.
+type keyPolicies []*KeyPolicy
+
+// lookup returns the policy governing key: the policy of the key itself,
+// else the policy of the longest prefix of key, nil if there is none.
+func (ps keyPolicies) lookup(key string) *KeyPolicy {
+	var match *KeyPolicy
+	for _, kp := range ps {
+		switch {
+		case !kp.Prefix && kp.Key == key:
+			return kp
+		case kp.Prefix && len(kp.Key) <= len(key) && key[:len(kp.Key)] == kp.Key:
+			if match == nil || len(kp.Key) > len(match.Key) {
+				match = kp
+			}
+		}
+	}
+	return match
+}
+
+// set replaces the policy of key, a nil policy removes it.
+func (ps keyPolicies) set(key string, prefix bool, policy *Policy) keyPolicies {
+	out := make(keyPolicies, 0, len(ps)+1)
+	for _, kp := range ps {
+		if kp.Key != key || kp.Prefix != prefix {
+			out = append(out, kp)
+		}
+	}
+	if policy != nil {
+		out = append(out, &KeyPolicy{Key: key, Prefix: prefix, Policy: policy})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Key != out[j].Key {
+			return out[i].Key < out[j].Key
+		}
+		return !out[i].Prefix && out[j].Prefix
+	})
+	return out
+}
+
+func decodeKeyPolicies(enc []byte) (keyPolicies, error) {
+	if len(enc) == 0 {
+		return nil, nil
+	}
+	var ps keyPolicies
+	if err := rlp.DecodeBytes(enc, &ps); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// writeKeyPolicy updates the policy table of the contract at addr.
+func writeKeyPolicy(db *state.MStateDB, addr common.Address, key string, prefix bool, policy *Policy) error {
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+	}
+	ps, err := decodeKeyPolicies(db.GetPDXState(addr, keyPolicySlot()))
+	if err != nil {
+		return err
+	}
+	ps = ps.set(key, prefix, policy)
+	if len(ps) == 0 {
+		db.SetPDXState(addr, keyPolicySlot(), []byte{})
+		return nil
+	}
+	enc, err := rlp.EncodeToBytes(ps)
+	if err != nil {
+		return err
+	}
+	db.SetPDXState(addr, keyPolicySlot(), enc)
+	return nil
+}
+
+// SetKeyPolicy sets the policy of key of the contract at addr, a nil policy
+// removes it. It is meant for admin transactions and is not checked against
+// the policy in place, contracts use SOCallStub.SetKeyPolicy instead.
+func SetKeyPolicy(db *state.MStateDB, addr common.Address, key string, policy *Policy) error {
+	if key == "" {
+		return SoCallError_Input_Error
+	}
+	return writeKeyPolicy(db, addr, key, false, policy)
+}
+
+// SetPrefixPolicy sets the policy of the keys starting with prefix of the
+// contract at addr, as SetKeyPolicy does.
+func SetPrefixPolicy(db *state.MStateDB, addr common.Address, prefix string, policy *Policy) error {
+	if prefix == "" {
+		return SoCallError_Input_Error
+	}
+	return writeKeyPolicy(db, addr, prefix, true, policy)
+}
+
+// GetKeyPolicy returns the policy governing key of the contract at addr,
+// nil if the key is unrestricted.
+func GetKeyPolicy(db *state.MStateDB, addr common.Address, key string) (*Policy, error) {
+	ps, err := decodeKeyPolicies(db.GetPDXState(addr, keyPolicySlot()))
+	if err != nil {
+		return nil, err
+	}
+	if kp := ps.lookup(key); kp != nil {
+		return kp.Policy, nil
+	}
+	return nil, nil
+}
+
+// handleGetKeyPolicy returns the encoded policy governing a key. The input
+// is the key.
+func (h *Handler) handleGetKeyPolicy(message *CallSoSendMessage) *CallSoResMessage {
+	enc := h.db.GetPDXState(message.address, keyPolicySlot())
+	if err := h.meter.read(len(enc)); err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: err,
+		}
+	}
+	ps, err := decodeKeyPolicies(enc)
+	if err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: err,
+		}
+	}
+	kp := ps.lookup(string(message.inputs[0]))
+	if kp == nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_NoResult,
+		}
+	}
+	res, err := rlp.EncodeToBytes(kp.Policy)
+	return &CallSoResMessage{
+		res: res,
+		err: err,
+	}
+}
+
+// handleSetKeyPolicy updates the policy table. The inputs are the key, "1"
+// for a prefix policy or "0" for a key policy, and the encoded policy, which
+// is empty to remove the policy.
+func (h *Handler) handleSetKeyPolicy(message *CallSoSendMessage) *CallSoResMessage {
+	if len(message.inputs) != 3 {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Key_Value_NotMatch,
+		}
+	}
+	if err := h.meter.write(len(message.inputs[0]) + len(message.inputs[2])); err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: err,
+		}
+	}
+	var policy *Policy
+	if len(message.inputs[2]) > 0 {
+		policy = new(Policy)
+		if err := rlp.DecodeBytes(message.inputs[2], policy); err != nil {
+			return &CallSoResMessage{
+				res: nil,
+				err: SoCallError_Policy_Illegal,
+			}
+		}
+	}
+	prefix := string(message.inputs[1]) == "1"
+	err := writeKeyPolicy(h.db, message.address, string(message.inputs[0]), prefix, policy)
+	return &CallSoResMessage{
+		res: nil,
+		err: err,
+	}
+}
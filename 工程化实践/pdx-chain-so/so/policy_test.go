@@ -0,0 +1,118 @@
+package so
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/params"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	newTestConsortium(t, nil)
+	tests := []struct {
+		policy Policy
+		valid  bool
+	}{
+		{Policy{Orgs: []string{"org1"}, Threshold: 1}, true},
+		{Policy{Orgs: []string{"org1", "org2"}, Threshold: 2}, true},
+		{Policy{Orgs: []string{"org1", "org1"}, Threshold: 2}, false},
+		{Policy{Orgs: []string{"org1", "org2", "org1"}, Threshold: 1}, false},
+		{Policy{Orgs: []string{"org1", ""}, Threshold: 1}, false},
+		{Policy{Orgs: []string{"org1"}, Threshold: 2}, false},
+		{Policy{Orgs: []string{"org1"}, Threshold: 0}, false},
+		{Policy{Threshold: 1}, false},
+		{Policy{Orgs: []string{"org3"}, Threshold: 1}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.policy.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %v", tt.policy, err, tt.valid)
+		}
+	}
+}
+
+func TestPolicySatisfied(t *testing.T) {
+	p := &Policy{Orgs: []string{"a", "b", "c"}, Threshold: 2}
+	tests := []struct {
+		orgs []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"a"}, false},
+		{[]string{"a", "b"}, true},
+		{[]string{"a", "x"}, false},
+		{[]string{"c", "b", "x"}, true},
+	}
+	for _, tt := range tests {
+		if got := p.Satisfied(tt.orgs); got != tt.want {
+			t.Errorf("Satisfied(%q) = %v, want %v", tt.orgs, got, tt.want)
+		}
+	}
+}
+
+func TestKeyPolicyLookup(t *testing.T) {
+	db := newTestMStateDB(t)
+	any1 := &Policy{Orgs: []string{"org1"}, Threshold: 1}
+	any2 := &Policy{Orgs: []string{"org2"}, Threshold: 1}
+	both := &Policy{Orgs: []string{"org1", "org2"}, Threshold: 2}
+	for _, err := range []error{
+		SetPrefixPolicy(db, testAddr, "a", any1),
+		SetPrefixPolicy(db, testAddr, "ab", any2),
+		SetKeyPolicy(db, testAddr, "abc", both),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for key, want := range map[string]*Policy{"a": any1, "ax": any1, "ab": any2, "abd": any2, "abc": both, "b": nil} {
+		if got, err := GetKeyPolicy(db, testAddr, key); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("GetKeyPolicy(%q) = %+v, %v, want %+v", key, got, err, want)
+		}
+	}
+	if err := SetKeyPolicy(db, testAddr, "abc", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := GetKeyPolicy(db, testAddr, "abc"); got == nil || got.Orgs[0] != "org2" {
+		t.Errorf("policy of abc after removal = %+v, want the prefix policy of ab", got)
+	}
+	if err := SetKeyPolicy(db, testAddr, "k", &Policy{Orgs: []string{"org1", "org1"}, Threshold: 2}); err != SoCallError_Policy_Illegal {
+		t.Errorf("SetKeyPolicy with a repeated org = %v, want %v", err, SoCallError_Policy_Illegal)
+	}
+}
+
+func TestPutStatePolicy(t *testing.T) {
+	ca1, _ := newTestConsortium(t, nil)
+	user := newTestIdentity(t, "user", false, ca1)
+	endorser := newTestIdentity(t, "endorser", false, nil)
+	old := params.OrgNameMapNodePublicKeys
+	params.OrgNameMapNodePublicKeys = map[string][]string{"org2": {hex.EncodeToString(endorser.pub())}}
+	defer func() { params.OrgNameMapNodePublicKeys = old }()
+
+	db := newTestMStateDB(t)
+	if err := SetPrefixPolicy(db, testAddr, "owned/", &Policy{Orgs: []string{"org1", "org2"}, Threshold: 2}); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+	deployTestContract(t, r, db, testAddr)
+
+	caller := &TxContext{Timestamp: testTime, Signer: user.pub(), Cert: user.pem}
+	if _, err := r.Invoke(db, testAddr, caller, testArgs("put", "owned/k", "v")); !errors.Is(err, SoCallError_Policy_Not_Satisfied) {
+		t.Errorf("write approved by org1 alone = %v, want %v", err, SoCallError_Policy_Not_Satisfied)
+	}
+	if _, err := r.Invoke(db, testAddr, caller, testArgs("put", "free", "v")); err != nil {
+		t.Errorf("write outside the policy = %v", err)
+	}
+	//调用者自己背书不算第二个组织
+	caller.Endorsers = [][]byte{user.pub()}
+	if _, err := r.Invoke(db, testAddr, caller, testArgs("put", "owned/k", "v")); !errors.Is(err, SoCallError_Policy_Not_Satisfied) {
+		t.Errorf("write endorsed by the caller = %v, want %v", err, SoCallError_Policy_Not_Satisfied)
+	}
+	caller.Endorsers = [][]byte{endorser.pub()}
+	if _, err := r.Invoke(db, testAddr, caller, testArgs("put", "owned/k", "v")); err != nil {
+		t.Errorf("write endorsed by org2 = %v", err)
+	}
+	if getTestState(db, testAddr, "owned/k") != "v" {
+		t.Error("endorsed write is missing")
+	}
+}
@@ -0,0 +1,478 @@
+package so
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm2"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm3"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm4"
+	"pdx-chain-so/pkg/pdx-chain/params"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+)
+
+var (
+	SoCallError_Collection_Not_Found  = errors.New("Private data collection is not defined")
+	SoCallError_Collection_Exists     = errors.New("Private data collection is already defined")
+	SoCallError_Collection_Illegal    = errors.New("Private data collection is illegal")
+	SoCallError_Private_Not_Member    = errors.New("Node is not a member of the private data collection")
+	SoCallError_Private_Data_Missing  = errors.New("Private data is not available on this node")
+	SoCallError_Private_Data_Mismatch = errors.New("Private data does not match its on-chain hash")
+	SoCallError_Private_Salt_Missing  = errors.New("Transient salt secret of private data is missing")
+)
+
+// TransientSaltKey is the transient input holding the secret the salts of
+// the private values written by a transaction are derived from. The client
+// picks it at random for every transaction and passes it off chain along
+// with the private values, so the hashes in state cannot be matched
+// against guessed values.
+const TransientSaltKey = "pdx-private-salt"
+
+// minSaltSecret is the minimum length of the salt secret in bytes.
+const minSaltSecret = 16
+
+// privateSaltSize is the size of the salt of a private value.
+const privateSaltSize = 32
+
+var (
+	collectionPrefix  = []byte("pdx-so-collection")
+	privateHashPrefix = []byte("pdx-so-private-hash")
+)
+
+// collectionSlot returns the PDX storage slot holding the CollectionConfig
+// of the collection name.
+func collectionSlot(name string) common.Hash {
+	return crypto.Keccak256Hash(collectionPrefix, []byte(name))
+}
+
+// privateHashSlot returns the PDX storage slot holding the hash of the
+// private value of key in collection.
+func privateHashSlot(collection, key string) common.Hash {
+	return crypto.Keccak256Hash(privateHashPrefix, []byte(collection), []byte{0}, []byte(key))
+}
+
+// PrivateDataSalt derives the salt of the private value of key in
+// collection from the salt secret of the transaction writing it.
+func PrivateDataSalt(secret []byte, collection, key string) ([]byte, error) {
+	if len(secret) < minSaltSecret {
+		return nil, SoCallError_Private_Salt_Missing
+	}
+	return sm3.Sm3Sum(bytes.Join([][]byte{secret, []byte(collection), []byte(key)}, []byte{0})), nil
+}
+
+// PrivateDataHash returns the hash of a private value and its salt as stored
+// in state.
+func PrivateDataHash(salt, value []byte) common.Hash {
+	return common.BytesToHash(sm3.Sm3Sum(append(common.CopyBytes(salt), value...)))
+}
+
+// WrappedKey is the key of a collection encrypted with SM2 for one node.
+type WrappedKey struct {
+	PublicKey []byte // compressed SM2 public key of the node
+	Key       []byte
+}
+
+// CollectionConfig defines a private data collection of a contract. The
+// values of the collection are encrypted with an SM4 key that is wrapped for
+// every node of the member orgs, only the hashes of the values are kept in
+// state.
+type CollectionConfig struct {
+	Name       string
+	MemberOrgs []string
+	Keys       []*WrappedKey
+}
+
+// NewCollectionConfig generates the key of a collection shared by orgs and
+// wraps it for the node keys of those orgs in params.OrgNameMapNodePublicKeys.
+// It is run off chain by an admin, the config is then stored by a
+// transaction calling DefineCollection.
+func NewCollectionConfig(name string, orgs []string, random io.Reader) (*CollectionConfig, error) {
+	if name == "" || len(orgs) == 0 {
+		return nil, SoCallError_Collection_Illegal
+	}
+	key := make([]byte, sm4.BlockSize)
+	if _, err := io.ReadFull(random, key); err != nil {
+		return nil, err
+	}
+	cfg := &CollectionConfig{Name: name, MemberOrgs: orgs}
+	for _, org := range orgs {
+		nodeKeys := params.OrgNameMapNodePublicKeys[org]
+		if len(nodeKeys) == 0 {
+			return nil, SoCallError_Collection_Illegal
+		}
+		for _, nodeKey := range nodeKeys {
+			pub, err := parsePublicKeyHex(nodeKey)
+			if err != nil {
+				return nil, err
+			}
+			wrapped, err := sm2.Encrypt(pub, key, random)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Keys = append(cfg.Keys, &WrappedKey{PublicKey: sm2.Compress(pub), Key: wrapped})
+		}
+	}
+	return cfg, nil
+}
+
+// parsePublicKeyHex decodes a compressed or uncompressed SM2 public key.
+func parsePublicKeyHex(s string) (*sm2.PublicKey, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(b) == 33:
+		if pub := sm2.Decompress(b); pub != nil {
+			return pub, nil
+		}
+	case len(b) == 65 && b[0] == 4:
+		x, y := elliptic.Unmarshal(sm2.P256Sm2(), b)
+		if x != nil {
+			return &sm2.PublicKey{Curve: sm2.P256Sm2(), X: x, Y: y}, nil
+		}
+	}
+	return nil, SoCallError_Creator_Illegal
+}
+
+// DefineCollection stores the config of a new collection of the contract at
+// addr.
+func DefineCollection(db *state.MStateDB, addr common.Address, cfg *CollectionConfig) error {
+	if cfg.Name == "" || len(cfg.Keys) == 0 {
+		return SoCallError_Collection_Illegal
+	}
+	old, err := GetCollectionConfig(db, addr, cfg.Name)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		return SoCallError_Collection_Exists
+	}
+	enc, err := rlp.EncodeToBytes(cfg)
+	if err != nil {
+		return err
+	}
+	db.SetPDXState(addr, collectionSlot(cfg.Name), enc)
+	return nil
+}
+
+// GetCollectionConfig returns the collection name of the contract at addr,
+// or nil if there is none.
+func GetCollectionConfig(db *state.MStateDB, addr common.Address, name string) (*CollectionConfig, error) {
+	enc := db.GetPDXState(addr, collectionSlot(name))
+	if len(enc) == 0 {
+		return nil, nil
+	}
+	cfg := new(CollectionConfig)
+	if err := rlp.DecodeBytes(enc, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// VerifyPrivateData reports whether value with salt is the private value of
+// key in the collection of the contract at addr, as recorded by its on-chain
+// hash. Members of the collection get the salt from PrivateData.Get.
+func VerifyPrivateData(db *state.MStateDB, addr common.Address, collection, key string, salt, value []byte) bool {
+	hash := db.GetPDXState(addr, privateHashSlot(collection, key))
+	return len(hash) > 0 && len(value) > 0 && common.BytesToHash(hash) == PrivateDataHash(salt, value)
+}
+
+// PrivateStore keeps the encrypted private values a node is entitled to,
+// outside of the state. Values are addressed by their hash as well, so a
+// value written by a reverted invocation never shadows the committed one.
+type PrivateStore interface {
+	Put(addr common.Address, collection, key string, hash common.Hash, ciphertext []byte) error
+	// Get returns nil if the value is not in the store.
+	Get(addr common.Address, collection, key string, hash common.Hash) ([]byte, error)
+}
+
+type privateStoreKey struct {
+	addr       common.Address
+	collection string
+	key        string
+	hash       common.Hash
+}
+
+// MemPrivateStore is a PrivateStore held in memory.
+type MemPrivateStore struct {
+	mu     sync.RWMutex
+	values map[privateStoreKey][]byte
+}
+
+func NewMemPrivateStore() *MemPrivateStore {
+	return &MemPrivateStore{
+		values: make(map[privateStoreKey][]byte),
+	}
+}
+
+func (s *MemPrivateStore) Put(addr common.Address, collection, key string, hash common.Hash, ciphertext []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[privateStoreKey{addr, collection, key, hash}] = common.CopyBytes(ciphertext)
+	return nil
+}
+
+func (s *MemPrivateStore) Get(addr common.Address, collection, key string, hash common.Hash) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.values[privateStoreKey{addr, collection, key, hash}], nil
+}
+
+// PrivateData gives a node access to the collections its SM2 key is a
+// member of.
+type PrivateData struct {
+	key   *sm2.PrivateKey
+	store PrivateStore
+
+	mu   sync.Mutex
+	keys map[common.Hash][]byte // collection key by hash of the wrapped key
+}
+
+func NewPrivateData(key *sm2.PrivateKey, store PrivateStore) *PrivateData {
+	return &PrivateData{
+		key:   key,
+		store: store,
+		keys:  make(map[common.Hash][]byte),
+	}
+}
+
+// collectionKey unwraps the key of cfg, ok is false if the node is not a
+// member of the collection.
+func (p *PrivateData) collectionKey(cfg *CollectionConfig) (key []byte, ok bool, err error) {
+	pub := sm2.Compress(&sm2.PublicKey{Curve: p.key.Curve, X: p.key.X, Y: p.key.Y})
+	for _, wk := range cfg.Keys {
+		if string(wk.PublicKey) != string(pub) {
+			continue
+		}
+		id := crypto.Keccak256Hash(wk.Key)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if key, ok := p.keys[id]; ok {
+			return key, true, nil
+		}
+		key, err := sm2.Decrypt(p.key, wk.Key)
+		if err != nil {
+			return nil, false, err
+		}
+		p.keys[id] = key
+		return key, true, nil
+	}
+	return nil, false, nil
+}
+
+// encrypt seals value with the collection key, the random nonce is
+// prepended to the ciphertext.
+func (p *PrivateData) encrypt(key, value []byte, random io.Reader) ([]byte, error) {
+	aead, err := newPrivateAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(random, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, value, nil), nil
+}
+
+func (p *PrivateData) decrypt(key, ciphertext []byte) ([]byte, error) {
+	aead, err := newPrivateAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, SoCallError_Private_Data_Mismatch
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, nil)
+}
+
+// Get returns the committed private value of key in the collection of the
+// contract at addr together with its salt, so the member org can prove the
+// value to others with VerifyPrivateData.
+func (p *PrivateData) Get(db *state.MStateDB, addr common.Address, collection, key string) (salt, value []byte, err error) {
+	cfg, err := GetCollectionConfig(db, addr, collection)
+	if err != nil || cfg == nil {
+		return nil, nil, SoCallError_Collection_Not_Found
+	}
+	hash := db.GetPDXState(addr, privateHashSlot(collection, key))
+	if len(hash) == 0 {
+		return nil, nil, SoCallError_NoResult
+	}
+	return p.get(addr, cfg, key, common.BytesToHash(hash))
+}
+
+// get decrypts the salt and value of key in the collection cfg stored under
+// hash and checks them against it.
+func (p *PrivateData) get(addr common.Address, cfg *CollectionConfig, key string, hash common.Hash) (salt, value []byte, err error) {
+	ckey, ok, err := p.collectionKey(cfg)
+	if err != nil || !ok {
+		return nil, nil, SoCallError_Private_Not_Member
+	}
+	ciphertext, err := p.store.Get(addr, cfg.Name, key, hash)
+	if err != nil || ciphertext == nil {
+		return nil, nil, SoCallError_Private_Data_Missing
+	}
+	plain, err := p.decrypt(ckey, ciphertext)
+	if err != nil || len(plain) <= privateSaltSize {
+		return nil, nil, SoCallError_Private_Data_Mismatch
+	}
+	salt, value = plain[:privateSaltSize], plain[privateSaltSize:]
+	if PrivateDataHash(salt, value) != hash {
+		return nil, nil, SoCallError_Private_Data_Mismatch
+	}
+	return salt, value, nil
+}
+
+func newPrivateAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// handlePutPrivateData records the salted hash of a private value in state
+// and keeps the encrypted salt and value in the private store when the node
+// is a member of the collection. The inputs are collection, key, salt and
+// value, an empty value deletes the key.
+func (h *Handler) handlePutPrivateData(message *CallSoSendMessage) *CallSoResMessage {
+	if len(message.inputs) != 4 {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Key_Value_NotMatch,
+		}
+	}
+	collection, key, salt, value := string(message.inputs[0]), string(message.inputs[1]), message.inputs[2], message.inputs[3]
+	if key == "" || (len(value) > 0 && len(salt) != privateSaltSize) {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Input_Error,
+		}
+	}
+	cfg, err := GetCollectionConfig(h.db, message.address, collection)
+	if err != nil || cfg == nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Collection_Not_Found,
+		}
+	}
+	//写入在SOCallStub缓冲时已计费
+	slot := privateHashSlot(collection, key)
+	if len(value) == 0 {
+		h.db.SetPDXState(message.address, slot, []byte{})
+		return &CallSoResMessage{
+			err: nil,
+		}
+	}
+	hash := PrivateDataHash(salt, value)
+	h.db.SetPDXState(message.address, slot, hash.Bytes())
+
+	//只有成员组织的节点保存密文,非成员节点不落盘任何明文
+	if h.private != nil {
+		ckey, ok, err := h.private.collectionKey(cfg)
+		if err != nil {
+			return &CallSoResMessage{
+				res: nil,
+				err: err,
+			}
+		}
+		if ok {
+			ciphertext, err := h.private.encrypt(ckey, append(common.CopyBytes(salt), value...), rand.Reader)
+			if err == nil {
+				err = h.private.store.Put(message.address, collection, key, hash, ciphertext)
+			}
+			if err != nil {
+				return &CallSoResMessage{
+					res: nil,
+					err: err,
+				}
+			}
+		}
+	}
+	return &CallSoResMessage{
+		err: nil,
+	}
+}
+
+// handleGetPrivateData decrypts the private value of key in a collection
+// and checks it against the hash in state. The inputs are collection and
+// key.
+func (h *Handler) handleGetPrivateData(message *CallSoSendMessage) *CallSoResMessage {
+	if len(message.inputs) != 2 {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Key_Value_NotMatch,
+		}
+	}
+	collection, key := string(message.inputs[0]), string(message.inputs[1])
+	hash := h.db.GetPDXState(message.address, privateHashSlot(collection, key))
+	if err := h.meter.read(len(hash)); err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: err,
+		}
+	}
+	cfg, err := GetCollectionConfig(h.db, message.address, collection)
+	if err != nil || cfg == nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Collection_Not_Found,
+		}
+	}
+	if len(hash) == 0 {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_NoResult,
+		}
+	}
+	if h.private == nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Private_Not_Member,
+		}
+	}
+	_, value, err := h.private.get(message.address, cfg, key, common.BytesToHash(hash))
+	return &CallSoResMessage{
+		res: value,
+		err: err,
+	}
+}
+
+// handleGetPrivateDataHash returns the hash in state of the private value of
+// key in a collection. The inputs are collection and key.
+func (h *Handler) handleGetPrivateDataHash(message *CallSoSendMessage) *CallSoResMessage {
+	if len(message.inputs) != 2 {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Key_Value_NotMatch,
+		}
+	}
+	hash := h.db.GetPDXState(message.address, privateHashSlot(string(message.inputs[0]), string(message.inputs[1])))
+	if err := h.meter.read(len(hash)); err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: err,
+		}
+	}
+	if len(hash) == 0 {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_NoResult,
+		}
+	}
+	return &CallSoResMessage{
+		res: hash,
+		err: nil,
+	}
+}
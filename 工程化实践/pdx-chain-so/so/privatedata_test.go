@@ -0,0 +1,135 @@
+package so
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm2"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm3"
+	"pdx-chain-so/pkg/pdx-chain/params"
+)
+
+// newTestNodeKeys returns a node key for each of org1 and org2 and installs
+// them as the node keys of the orgs until the test ends.
+func newTestNodeKeys(t *testing.T) (key1, key2 *sm2.PrivateKey) {
+	t.Helper()
+	keys := make([]*sm2.PrivateKey, 2)
+	nodeKeys := make(map[string][]string)
+	for i, org := range []string{"org1", "org2"} {
+		key, err := sm2.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+		nodeKeys[org] = []string{hex.EncodeToString(sm2.Compress((*sm2.PublicKey)(&key.PublicKey)))}
+	}
+	old := params.OrgNameMapNodePublicKeys
+	params.OrgNameMapNodePublicKeys = nodeKeys
+	t.Cleanup(func() { params.OrgNameMapNodePublicKeys = old })
+	return keys[0], keys[1]
+}
+
+var errDiskFull = errors.New("disk full")
+
+// failingStore is a PrivateStore that cannot store values.
+type failingStore struct{ MemPrivateStore }
+
+func (*failingStore) Put(addr common.Address, collection, key string, hash common.Hash, ciphertext []byte) error {
+	return errDiskFull
+}
+
+func TestPrivateData(t *testing.T) {
+	key1, key2 := newTestNodeKeys(t)
+	db := newTestMStateDB(t)
+	cfg, err := NewCollectionConfig("secret", []string{"org1"}, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DefineCollection(db, testAddr, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	member, other := NewRegistry(), NewRegistry()
+	member.PrivateData = NewPrivateData(key1, NewMemPrivateStore())
+	otherStore := NewMemPrivateStore()
+	other.PrivateData = NewPrivateData(key2, otherStore)
+	deployTestContract(t, member, db, testAddr)
+	deployTestContract(t, other, db, testAddr)
+
+	secret := []byte("0123456789abcdef")
+	ctx := &TxContext{Transient: map[string][]byte{TransientSaltKey: secret, "value": []byte("42")}}
+	for _, r := range []*Registry{member, other} {
+		if _, err := r.Invoke(db, testAddr, ctx, testArgs("putPrivate", "secret", "k")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//链上只有加盐哈希
+	salt, _ := PrivateDataSalt(secret, "secret", "k")
+	hash := db.GetPDXState(testAddr, privateHashSlot("secret", "k"))
+	if common.BytesToHash(hash) != PrivateDataHash(salt, []byte("42")) || common.BytesToHash(hash) == common.BytesToHash(sm3.Sm3Sum([]byte("42"))) {
+		t.Errorf("hash in state = %x", hash)
+	}
+	if len(otherStore.values) != 0 {
+		t.Error("a node outside the collection stored the private value")
+	}
+
+	res, err := member.Invoke(db, testAddr, ctx, testArgs("getPrivate", "secret", "k"))
+	if err != nil || string(res.Payload) != "42" {
+		t.Errorf("GetPrivateData of a member = %q, %v", res.Payload, err)
+	}
+	if _, err := other.Invoke(db, testAddr, ctx, testArgs("getPrivate", "secret", "k")); !errors.Is(err, SoCallError_Private_Not_Member) {
+		t.Errorf("GetPrivateData of another org = %v, want %v", err, SoCallError_Private_Not_Member)
+	}
+
+	gotSalt, value, err := member.PrivateData.Get(db, testAddr, "secret", "k")
+	if err != nil || string(value) != "42" {
+		t.Fatalf("Get = %q, %v", value, err)
+	}
+	if !VerifyPrivateData(db, testAddr, "secret", "k", gotSalt, value) {
+		t.Error("the value of a member does not verify")
+	}
+	if VerifyPrivateData(db, testAddr, "secret", "k", gotSalt, []byte("43")) || VerifyPrivateData(db, testAddr, "secret", "k", nil, value) {
+		t.Error("a guessed value verified")
+	}
+}
+
+func TestPrivateDataErrors(t *testing.T) {
+	key1, _ := newTestNodeKeys(t)
+	db := newTestMStateDB(t)
+	cfg, err := NewCollectionConfig("secret", []string{"org1"}, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DefineCollection(db, testAddr, cfg); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry()
+	deployTestContract(t, r, db, testAddr)
+
+	for _, secret := range [][]byte{nil, []byte("short")} {
+		ctx := &TxContext{Transient: map[string][]byte{"value": []byte("42")}}
+		if secret != nil {
+			ctx.Transient[TransientSaltKey] = secret
+		}
+		if _, err := r.Invoke(db, testAddr, ctx, testArgs("putPrivate", "secret", "k")); !errors.Is(err, SoCallError_Private_Salt_Missing) {
+			t.Errorf("write with salt secret %q = %v, want %v", secret, err, SoCallError_Private_Salt_Missing)
+		}
+	}
+
+	//成员节点存储失败时交易失败
+	r.PrivateData = NewPrivateData(key1, &failingStore{})
+	ctx := &TxContext{Transient: map[string][]byte{TransientSaltKey: []byte("0123456789abcdef"), "value": []byte("42")}}
+	if _, err := r.Invoke(db, testAddr, ctx, testArgs("putPrivate", "secret", "k")); err == nil || !strings.Contains(err.Error(), errDiskFull.Error()) {
+		t.Errorf("write to a failing store = %v", err)
+	}
+	if len(db.GetPDXState(testAddr, privateHashSlot("secret", "k"))) != 0 {
+		t.Error("hash of a failed write was kept")
+	}
+	if _, err := r.Invoke(db, testAddr, ctx, testArgs("putPrivate", "unknown", "k")); !errors.Is(err, SoCallError_Collection_Not_Found) {
+		t.Errorf("write to an unknown collection = %v", err)
+	}
+}
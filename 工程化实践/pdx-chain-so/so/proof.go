@@ -0,0 +1,99 @@
+package so
+
+import (
+	"errors"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/public"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+)
+
+var SoCallError_Proof_Unavailable = errors.New("State proof is not available")
+
+// StateProof is the value of a key of a so as of a block, with the Merkle
+// proof of it against the state root of the block. A client trusting the
+// header of block BlockNumber checks that Root is the Root of the header
+// and verifies the value with Verify.
+type StateProof struct {
+	BlockNumber uint64
+	Root        common.Hash
+	Value       []byte
+	Proof       *state.PDXProof
+}
+
+// Verify checks that the proof proves Value as the value of key in the
+// state of the so at address, an empty Value proves the key is absent.
+func (p *StateProof) Verify(address common.Address, key []byte) error {
+	if p.Proof == nil {
+		return SoCallError_Proof_Unavailable
+	}
+	return state.VerifyPDXProof(p.Root, address, StateKeySlot(key), p.Value, p.Proof)
+}
+
+// handleGetStateWithProof returns the rlp encoded StateProof of the key in
+// inputs[0] as of the block numbered by inputs[1].
+func (h *Handler) handleGetStateWithProof(message *CallSoSendMessage) *CallSoResMessage {
+	if len(message.inputs) != 2 || len(message.inputs[1]) != 8 {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Key_Value_NotMatch,
+		}
+	}
+	if public.BC == nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Chain_Unavailable,
+		}
+	}
+	num := common.ByteToUint64(message.inputs[1])
+	block := public.BC.GetBlockByNumber(num)
+	if block == nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Chain_Unavailable,
+		}
+	}
+	root := block.Header().Root
+	stateDb, err := public.BC.StateAt(root)
+	if err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Chain_Unavailable,
+		}
+	}
+	key := StateKeySlot(message.inputs[0])
+	p := &StateProof{BlockNumber: num, Root: root, Value: stateDb.GetPDXState(message.address, key)}
+	if p.Proof, err = stateDb.GetPDXProof(message.address, key); err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Proof_Unavailable,
+		}
+	}
+	data, err := rlp.EncodeToBytes(p)
+	if err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Proof_Unavailable,
+		}
+	}
+	//证明节点按读取计费
+	if err := h.meter.read(len(data)); err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: err,
+		}
+	}
+	return &CallSoResMessage{
+		res: data,
+		err: nil,
+	}
+}
+
+func decodeStateProof(data []byte) (*StateProof, error) {
+	p := new(StateProof)
+	if err := rlp.DecodeBytes(data, p); err != nil {
+		return nil, SoCallError_Proof_Unavailable
+	}
+	return p, nil
+}
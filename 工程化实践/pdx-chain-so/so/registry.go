@@ -0,0 +1,538 @@
+package so
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"plugin"
+	"reflect"
+	"sync"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+)
+
+var (
+	SoCallError_Contract_Exists     = errors.New("Contract already deployed at that address")
+	SoCallError_Contract_Not_Found  = errors.New("No contract deployed at that address")
+	SoCallError_Contract_Disabled   = errors.New("Contract is disabled")
+	SoCallError_Contract_Not_Loaded = errors.New("Contract plugin is not loaded on this node")
+	SoCallError_Contract_Version    = errors.New("Contract version is illegal")
+	SoCallError_Plugin_Symbol       = errors.New("Plugin symbol does not implement so.Call")
+	SoCallError_Plugin_Changed      = errors.New("Plugin file changed at a path already loaded")
+	SoCallError_Invoke_Unavailable  = errors.New("Contract invocation is not available")
+	SoCallError_Call_Depth          = errors.New("Contract call depth exceeded")
+	SoCallError_Reentrant_Call      = errors.New("Contract is already on the call stack")
+	SoCallError_Contract_Panic      = errors.New("Contract panicked")
+)
+
+// SoCallError_Contract_Unavailable is the error of an invocation of a
+// contract running in its own process when the process is not connected or
+// is lost during the invocation. It reaches the host as a NodeFault.
+var SoCallError_Contract_Unavailable = errors.New("Contract process is not connected")
+
+// NodeFault is the error of an invocation the node failed to run, such as
+// one of a contract whose process is gone. It says nothing about the
+// transaction, other nodes may run it fine, so the host must not record it
+// as the result of the transaction but stop processing the block until the
+// fault is fixed. A Call reports a fault by panicking with a *NodeFault,
+// the registry reverts the invocation and returns the fault as its error.
+type NodeFault struct {
+	Err error
+}
+
+func (f *NodeFault) Error() string {
+	return "node fault: " + f.Err.Error()
+}
+
+func (f *NodeFault) Unwrap() error {
+	return f.Err
+}
+
+// MaxCallDepth is the maximum number of nested contract invocations in one
+// transaction, the invocation started by the transaction included.
+var MaxCallDepth = 8
+
+// ContractStatus is the lifecycle status of a deployed contract.
+type ContractStatus uint8
+
+const (
+	ContractActive   ContractStatus = 1
+	ContractDisabled ContractStatus = 2
+)
+
+// contractInfoSlot is the reserved PDX storage slot of a contract that holds
+// its ContractInfo.
+var contractInfoSlot = crypto.Keccak256Hash([]byte("pdx-so-contract-info"))
+
+// ContractInfo binds a contract address to the plugin it runs. It is stored
+// in state under the contract address, so every node can check that it runs
+// the same plugin build.
+type ContractInfo struct {
+	Version    string
+	PluginHash common.Hash // keccak256 of the plugin file
+	Symbol     string      // exported symbol implementing so.Call
+	Status     ContractStatus
+}
+
+// pluginKey identifies a contract loaded from a plugin.
+type pluginKey struct {
+	hash   common.Hash
+	symbol string
+}
+
+// Registry loads compiled contract plugins and routes invocations of a
+// contract address to the plugin bound to it in state.
+type Registry struct {
+	mu     sync.RWMutex
+	loaded map[pluginKey]Call
+
+	// Schedule prices the operations of the invocations run by the registry.
+	Schedule GasSchedule
+	// PrivateData gives the invocations access to the private data
+	// collections the node is a member of, nil for none.
+	PrivateData *PrivateData
+	// Documents serves the rich queries of the invocations run by Query,
+	// nil if the node keeps no DocumentStore.
+	Documents *DocumentStore
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		loaded:   make(map[pluginKey]Call),
+		Schedule: DefaultGasSchedule,
+	}
+}
+
+// Load opens the plugin at path, looks up symbol and checks that it
+// implements so.Call or so.LegacyCall. It returns the hash of the plugin
+// file.
+func (r *Registry) Load(path string, symbol string) (common.Hash, error) {
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	hash := crypto.Keccak256Hash(code)
+	key := pluginKey{hash: hash, symbol: symbol}
+
+	r.mu.RLock()
+	_, ok := r.loaded[key]
+	r.mu.RUnlock()
+	if ok {
+		return hash, nil
+	}
+
+	p, err := openPlugin(path, hash)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	sym, err := p.Lookup(symbol)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	call, ok := asCall(sym)
+	if !ok {
+		//变量符号是指向合约的指针,如 var X = contractapi.MustNewContract(...)
+		if v := reflect.ValueOf(sym); v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Ptr && !v.Elem().IsNil() {
+			call, ok = asCall(v.Elem().Interface())
+		}
+	}
+	if !ok {
+		return common.Hash{}, fmt.Errorf("%w: %s is %T", SoCallError_Plugin_Symbol, symbol, sym)
+	}
+	r.Register(hash, symbol, call)
+	return hash, nil
+}
+
+// asCall returns the contract implemented by sym, a LegacyCall is adapted
+// to Call.
+func asCall(sym interface{}) (Call, bool) {
+	switch c := sym.(type) {
+	case Call:
+		return c, true
+	case LegacyCall:
+		return legacyCall{c}, true
+	}
+	return nil, false
+}
+
+// legacyCall runs a LegacyCall as a Call.
+type legacyCall struct {
+	LegacyCall
+}
+
+func (c legacyCall) Run(stub interface{}) Response {
+	payload, err := c.LegacyCall.Run(stub)
+	if err != nil {
+		return FromError(err)
+	}
+	return Success(payload)
+}
+
+// openedPlugins maps the real path of every plugin file opened by the
+// process to the hash the file had then. Go caches plugins by path and
+// never opens one twice, so a file changed at an opened path would run the
+// old code under the new hash.
+var (
+	openedMu      sync.Mutex
+	openedPlugins = make(map[string]common.Hash)
+)
+
+// openPlugin opens the plugin at path whose file hashes to hash. It fails
+// if another file was opened at the same path before, an upgrade has to
+// ship the new build under a path of its own.
+func openPlugin(path string, hash common.Hash) (*plugin.Plugin, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	if real, err = filepath.Abs(real); err != nil {
+		return nil, err
+	}
+	openedMu.Lock()
+	defer openedMu.Unlock()
+	if h, ok := openedPlugins[real]; ok && h != hash {
+		return nil, fmt.Errorf("%w: %s", SoCallError_Plugin_Changed, path)
+	}
+	p, err := plugin.Open(real)
+	if err != nil {
+		return nil, err
+	}
+	openedPlugins[real] = hash
+	return p, nil
+}
+
+// Register makes an already loaded contract available under the given
+// plugin hash and symbol.
+func (r *Registry) Register(hash common.Hash, symbol string, call Call) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loaded[pluginKey{hash: hash, symbol: symbol}] = call
+}
+
+// Deploy loads the plugin at path, binds it to addr with the given version
+// and runs the Init of the contract, if it implements Initializer, with
+// args in the transaction described by ctx. On a consortium chain the
+// caller must be an admin of an org. The binding is undone when Init fails,
+// the returned result is never nil.
+func (r *Registry) Deploy(db *state.MStateDB, addr common.Address, ctx *TxContext, version string, path string, symbol string, args [][]byte) (*InvokeResult, error) {
+	return r.lifecycle(db, addr, ctx, args, func() (lifecycleHook, error) {
+		if version == "" {
+			return nil, SoCallError_Contract_Version
+		}
+		info, err := GetContractInfo(db, addr)
+		if err != nil {
+			return nil, err
+		}
+		if info != nil {
+			return nil, SoCallError_Contract_Exists
+		}
+		hash, err := r.Load(path, symbol)
+		if err != nil {
+			return nil, err
+		}
+		err = bindContract(db, addr, ctx, &ContractInfo{
+			Version:    version,
+			PluginHash: hash,
+			Symbol:     symbol,
+			Status:     ContractActive,
+		})
+		return func(call Call, stub *SOCallStub) Response {
+			if init, ok := call.(Initializer); ok {
+				return init.Init(stub)
+			}
+			return Success(nil)
+		}, err
+	})
+}
+
+// Upgrade binds the plugin at path to the already deployed contract at addr
+// and runs the Upgrade of the new version, if it implements Upgrader, with
+// the replaced version and args so it can migrate the contract state. It
+// is authorized and undone on failure as Deploy is.
+func (r *Registry) Upgrade(db *state.MStateDB, addr common.Address, ctx *TxContext, version string, path string, symbol string, args [][]byte) (*InvokeResult, error) {
+	return r.lifecycle(db, addr, ctx, args, func() (lifecycleHook, error) {
+		info, err := GetContractInfo(db, addr)
+		if err != nil {
+			return nil, err
+		}
+		if info == nil {
+			return nil, SoCallError_Contract_Not_Found
+		}
+		if info.Status != ContractActive {
+			return nil, SoCallError_Contract_Disabled
+		}
+		if version == "" || version == info.Version {
+			return nil, SoCallError_Contract_Version
+		}
+		hash, err := r.Load(path, symbol)
+		if err != nil {
+			return nil, err
+		}
+		from := info.Version
+		info.Version, info.PluginHash, info.Symbol = version, hash, symbol
+		err = bindContract(db, addr, ctx, info)
+		return func(call Call, stub *SOCallStub) Response {
+			if up, ok := call.(Upgrader); ok {
+				return up.Upgrade(stub, from)
+			}
+			return Success(nil)
+		}, err
+	})
+}
+
+// Disable stops the contract at addr from being invoked, it is authorized
+// as Deploy is.
+func (r *Registry) Disable(db *state.MStateDB, addr common.Address, ctx *TxContext) error {
+	if err := authorizeLifecycle(ctx); err != nil {
+		return err
+	}
+	info, err := GetContractInfo(db, addr)
+	if err != nil {
+		return err
+	}
+	if info == nil {
+		return SoCallError_Contract_Not_Found
+	}
+	info.Status = ContractDisabled
+	return putContractInfo(db, addr, info)
+}
+
+// lifecycleHook runs the lifecycle method of a contract in place of Run.
+type lifecycleHook func(call Call, stub *SOCallStub) Response
+
+// lifecycle authorizes the caller, lets bind update the contract info and
+// runs the hook it returns as a top level invocation.
+func (r *Registry) lifecycle(db *state.MStateDB, addr common.Address, ctx *TxContext, args [][]byte, bind func() (lifecycleHook, error)) (*InvokeResult, error) {
+	result, handler := r.newInvocation(db, ctx)
+	if err := authorizeLifecycle(ctx); err != nil {
+		result.Response = FromError(err)
+		return result, err
+	}
+	snap := db.Snapshot()
+	hook, err := bind()
+	if err != nil {
+		db.RevertToSnapshot(snap)
+		result.Response = FromError(err)
+		return result, result.Err()
+	}
+	if err := catchFault(func() { result.Response = r.execute(handler, addr, ctx, args, nil, hook) }); err != nil {
+		db.RevertToSnapshot(snap)
+		return faultResult(result, err)
+	}
+	if !result.IsSuccess() {
+		db.RevertToSnapshot(snap)
+		result.RWSet = &TxRWSet{}
+		return result, result.Err()
+	}
+	return result, nil
+}
+
+// InvokeResult is the outcome of a transaction invoking a contract.
+type InvokeResult struct {
+	// Response is the response of the contract, or the response of the
+	// error that stopped the invocation.
+	Response
+	// Meter holds the gas used up to the gas limit, also when the
+	// invocation failed.
+	Meter *Meter
+	// RWSet holds the reads and writes of the successful invocations, it is
+	// empty when the invocation failed.
+	RWSet *TxRWSet
+}
+
+// Invoke runs the contract bound to addr with args on db in the transaction
+// described by ctx, ctx may be nil when no transaction context is available.
+// The writes of an invocation are buffered and committed to db in one batch
+// when it succeeds, a failed or panicking invocation leaves no state changes
+// or events behind. The error is the Err of the response or a *NodeFault,
+// the returned result is never nil.
+func (r *Registry) Invoke(db *state.MStateDB, addr common.Address, ctx *TxContext, args [][]byte) (*InvokeResult, error) {
+	result, handler := r.newInvocation(db, ctx)
+	snap := db.Snapshot()
+	if err := catchFault(func() { result.Response = r.invoke(handler, addr, ctx, args, nil) }); err != nil {
+		db.RevertToSnapshot(snap)
+		return faultResult(result, err)
+	}
+	if !result.IsSuccess() {
+		result.RWSet = &TxRWSet{}
+		return result, result.Err()
+	}
+	return result, nil
+}
+
+// Query runs the contract bound to addr with args on db like Invoke, but
+// read-only: the state changes and events of the invocation are reverted
+// even when it succeeds. Only queries may run the rich queries of
+// GetQueryResult, which read the node-local Documents and so are not
+// deterministic across nodes. The returned result is never nil.
+func (r *Registry) Query(db *state.MStateDB, addr common.Address, ctx *TxContext, args [][]byte) (*InvokeResult, error) {
+	result, handler := r.newInvocation(db, ctx)
+	handler.readOnly = true
+	handler.docs = r.Documents
+	snap := db.Snapshot()
+	err := catchFault(func() { result.Response = r.invoke(handler, addr, ctx, args, nil) })
+	db.RevertToSnapshot(snap)
+	if err != nil {
+		return faultResult(result, err)
+	}
+	if !result.IsSuccess() {
+		result.RWSet = &TxRWSet{}
+		return result, result.Err()
+	}
+	return result, nil
+}
+
+// catchFault runs fn and returns the *NodeFault it panicked with.
+func catchFault(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fault, ok := r.(*NodeFault)
+			if !ok {
+				panic(r)
+			}
+			err = fault
+		}
+	}()
+	fn()
+	return nil
+}
+
+// faultResult returns result as failed by fault.
+func faultResult(result *InvokeResult, fault error) (*InvokeResult, error) {
+	result.Response = FromError(fault)
+	result.RWSet = &TxRWSet{}
+	return result, fault
+}
+
+// newInvocation returns the result and the handler of a top level
+// invocation in the transaction described by ctx.
+func (r *Registry) newInvocation(db *state.MStateDB, ctx *TxContext) (*InvokeResult, *Handler) {
+	var limit uint64
+	if ctx != nil {
+		limit = ctx.GasLimit
+	}
+	result := &InvokeResult{
+		Meter: NewMeter(r.Schedule, limit),
+		RWSet: &TxRWSet{},
+	}
+	handler := NewHandlerWithMeter(db, result.Meter)
+	handler.rwset = result.RWSet
+	handler.private = r.PrivateData
+	return result, handler
+}
+
+// invoke runs the contract bound to addr on top of the contracts in callers,
+// which are the invocations it is nested in, outermost first.
+func (r *Registry) invoke(handler *Handler, addr common.Address, ctx *TxContext, args [][]byte, callers []common.Address) Response {
+	return r.execute(handler, addr, ctx, args, callers, func(call Call, stub *SOCallStub) Response {
+		return call.Run(stub)
+	})
+}
+
+// execute runs hook on the contract bound to addr as invoke does.
+func (r *Registry) execute(handler *Handler, addr common.Address, ctx *TxContext, args [][]byte, callers []common.Address, hook lifecycleHook) Response {
+	if len(callers) >= MaxCallDepth {
+		return FromError(SoCallError_Call_Depth)
+	}
+	for _, caller := range callers {
+		if caller == addr {
+			return FromError(SoCallError_Reentrant_Call)
+		}
+	}
+	if err := handler.meter.invoke(); err != nil {
+		return FromError(err)
+	}
+	call, err := r.contract(handler.db, addr)
+	if err != nil {
+		return FromError(err)
+	}
+	stub := NewSoCallStubWithContext(handler, args, addr, ctx)
+	stub.registry = r
+	stub.callers = append(callers[:len(callers):len(callers)], addr)
+
+	snap := handler.db.Snapshot()
+	res := run(func() Response { return hook(call, stub) })
+	if res.IsSuccess() && handler.meter.Exhausted() {
+		//合约忽略了gas耗尽的错误,仍按失败处理
+		res = FromError(SoCallError_Out_Of_Gas)
+	}
+	if res.IsSuccess() {
+		if err := stub.Commit(); err != nil {
+			res = FromError(err)
+		}
+	}
+	if !res.IsSuccess() {
+		//执行失败,丢弃写集并回滚嵌套调用已提交的状态和事件
+		handler.db.RevertToSnapshot(snap)
+		return res
+	}
+	if handler.rwset != nil {
+		handler.rwset.add(stub.ws.rwset)
+	}
+	return res
+}
+
+// run calls the contract and turns a panic into an InternalError response.
+func run(fn func() Response) (res Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r == state.ErrMStateDBDeadLock {
+				//并行执行的死锁由InvokeBatch回滚后重新执行
+				panic(r)
+			}
+			if _, ok := r.(*NodeFault); ok {
+				//节点故障不是交易的结果,交给顶层调用返回
+				panic(r)
+			}
+			res = FromError(fmt.Errorf("%w: %v", SoCallError_Contract_Panic, r))
+		}
+	}()
+	return fn()
+}
+
+// contract returns the loaded contract bound to addr in db.
+func (r *Registry) contract(db *state.MStateDB, addr common.Address) (Call, error) {
+	info, err := GetContractInfo(db, addr)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, SoCallError_Contract_Not_Found
+	}
+	if info.Status != ContractActive {
+		return nil, SoCallError_Contract_Disabled
+	}
+	r.mu.RLock()
+	call, ok := r.loaded[pluginKey{hash: info.PluginHash, symbol: info.Symbol}]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, SoCallError_Contract_Not_Loaded
+	}
+	return call, nil
+}
+
+// GetContractInfo returns the contract bound to addr, or nil if there is none.
+func GetContractInfo(db *state.MStateDB, addr common.Address) (*ContractInfo, error) {
+	enc := db.GetPDXState(addr, contractInfoSlot)
+	if len(enc) == 0 {
+		return nil, nil
+	}
+	info := new(ContractInfo)
+	if err := rlp.DecodeBytes(enc, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func putContractInfo(db *state.MStateDB, addr common.Address, info *ContractInfo) error {
+	enc, err := rlp.EncodeToBytes(info)
+	if err != nil {
+		return err
+	}
+	db.SetPDXState(addr, contractInfoSlot, enc)
+	return nil
+}
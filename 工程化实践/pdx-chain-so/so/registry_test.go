@@ -0,0 +1,320 @@
+package so
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+)
+
+// testContract runs the function named by the first argument of an
+// invocation, see the cases of Run. Contract addresses are passed in hex.
+type testContract struct{}
+
+func (testContract) Run(stub interface{}) Response {
+	s := stub.(StubInterface)
+	fn, args := s.GetFunctionAndParameters()
+	switch fn {
+	case "put":
+		for i := 0; i+1 < len(args); i += 2 {
+			if err := s.PutState(args[i], args[i+1]); err != nil {
+				return FromError(err)
+			}
+		}
+		return Success(nil)
+	case "get":
+		v, err := s.GetState(args[0])
+		if err != nil {
+			return FromError(err)
+		}
+		return Success(v)
+	case "putIgnoringError":
+		s.PutState(args[0], args[1])
+		return Success(nil)
+	case "putThenFail":
+		s.PutState(args[0], args[1])
+		s.SetEvent("written", args[0])
+		return Error("failed on purpose")
+	case "putThenPanic":
+		s.PutState(args[0], args[1])
+		panic("boom")
+	case "putPrivate":
+		//私有数据的值取自瞬态输入
+		transient, err := s.GetTransient()
+		if err != nil {
+			return FromError(err)
+		}
+		if err := s.PutPrivateData(string(args[0]), string(args[1]), transient["value"]); err != nil {
+			return FromError(err)
+		}
+		return Success(nil)
+	case "getPrivate":
+		v, err := s.GetPrivateData(string(args[0]), string(args[1]))
+		if err != nil {
+			return FromError(err)
+		}
+		return Success(v)
+	case "query":
+		it, err := s.GetQueryResult(string(args[0]))
+		if err != nil {
+			return FromError(err)
+		}
+		var keys []string
+		for it.HasNext() {
+			kv, _ := it.Next()
+			keys = append(keys, kv.Key)
+		}
+		return Success([]byte(strings.Join(keys, ",")))
+	case "event":
+		if err := s.SetEvent(string(args[0]), args[1]); err != nil {
+			return FromError(err)
+		}
+		return Success(nil)
+	case "invoke":
+		v, err := s.InvokeContract(common.HexToAddress(string(args[0])), args[1:])
+		if err != nil {
+			return FromError(err)
+		}
+		return Success(v)
+	case "invokeIgnoringError":
+		s.PutState([]byte("caller"), []byte("written"))
+		s.SetEvent("caller", nil)
+		s.InvokeContract(common.HexToAddress(string(args[0])), args[1:])
+		return Success(nil)
+	}
+	return Error("unknown function " + fn)
+}
+
+// deployTestContract binds a testContract registered with r to addr.
+func deployTestContract(t *testing.T, r *Registry, db *state.MStateDB, addr common.Address) {
+	t.Helper()
+	hash := crypto.Keccak256Hash([]byte("test contract"))
+	r.Register(hash, "Contract", testContract{})
+	if err := putContractInfo(db, addr, &ContractInfo{Version: "1.0", PluginHash: hash, Symbol: "Contract", Status: ContractActive}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testArgs returns the arguments of an invocation.
+func testArgs(args ...string) [][]byte {
+	out := make([][]byte, len(args))
+	for i, a := range args {
+		out[i] = []byte(a)
+	}
+	return out
+}
+
+// getTestState returns the committed value of key in the contract at addr.
+func getTestState(db *state.MStateDB, addr common.Address, key string) string {
+	return string(db.GetPDXState(addr, StateKeySlot([]byte(key))))
+}
+
+func TestLoadChangedPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "so-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "contract.so")
+	if err := ioutil.WriteFile(path, []byte("build 1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	//模拟进程已从该路径打开过第一版插件
+	real, _ := filepath.EvalSymlinks(path)
+	openedMu.Lock()
+	openedPlugins[real] = crypto.Keccak256Hash([]byte("build 1"))
+	openedMu.Unlock()
+	defer func() {
+		openedMu.Lock()
+		delete(openedPlugins, real)
+		openedMu.Unlock()
+	}()
+
+	if err := ioutil.WriteFile(path, []byte("build 2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRegistry().Load(path, "Contract"); !errors.Is(err, SoCallError_Plugin_Changed) {
+		t.Errorf("Load of a changed plugin = %v, want %v", err, SoCallError_Plugin_Changed)
+	}
+	link := filepath.Join(dir, "link.so")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRegistry().Load(link, "Contract"); !errors.Is(err, SoCallError_Plugin_Changed) {
+		t.Errorf("Load of a changed plugin through a link = %v, want %v", err, SoCallError_Plugin_Changed)
+	}
+}
+
+func TestLoadRegisteredPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "so-plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "contract.so")
+	if err := ioutil.WriteFile(path, []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRegistry()
+	if _, err := r.Load(path, "Contract"); err == nil {
+		t.Fatal("Load of a file that is not a plugin succeeded")
+	}
+	real, _ := filepath.EvalSymlinks(path)
+	openedMu.Lock()
+	_, opened := openedPlugins[real]
+	openedMu.Unlock()
+	if opened {
+		t.Error("a plugin that failed to open was recorded")
+	}
+
+	//已注册的插件按哈希命中,不再打开文件
+	hash := crypto.Keccak256Hash([]byte("not a plugin"))
+	r.Register(hash, "Contract", nil)
+	if got, err := r.Load(path, "Contract"); err != nil || got != hash {
+		t.Errorf("Load of a registered plugin = %x, %v", got, err)
+	}
+}
+
+func TestInvokeContract(t *testing.T) {
+	db := newTestMStateDB(t)
+	r := NewRegistry()
+	caller, callee := common.HexToAddress("0xca"), common.HexToAddress("0xce")
+	deployTestContract(t, r, db, caller)
+	deployTestContract(t, r, db, callee)
+
+	res, err := r.Invoke(db, caller, nil, testArgs("invoke", callee.Hex(), "put", "k", "v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getTestState(db, callee, "k") != "v" || getTestState(db, caller, "k") != "" {
+		t.Error("the write of the callee went to the wrong contract")
+	}
+	if len(res.RWSet.NsRWSets) != 2 {
+		t.Errorf("read/write set covers %d contracts, want 2", len(res.RWSet.NsRWSets))
+	}
+	if v, err := r.Invoke(db, caller, nil, testArgs("invoke", callee.Hex(), "get", "k")); err != nil || string(v.Payload) != "v" {
+		t.Errorf("payload of a nested get = %q, %v", v.Payload, err)
+	}
+
+	//被调合约失败时只回滚其自身的修改和事件
+	logs := len(db.Logs())
+	if _, err := r.Invoke(db, caller, nil, testArgs("invokeIgnoringError", callee.Hex(), "putThenFail", "k", "lost")); err != nil {
+		t.Fatal(err)
+	}
+	if getTestState(db, callee, "k") != "v" || getTestState(db, caller, "caller") != "written" {
+		t.Error("a failed callee was not reverted on its own")
+	}
+	if got := db.Logs()[logs:]; len(got) != 1 || got[0].Name != "caller" {
+		t.Errorf("events after a failed callee = %v, want the event of the caller", got)
+	}
+	if _, err := r.Invoke(db, caller, nil, testArgs("invokeIgnoringError", callee.Hex(), "putThenPanic", "k", "lost")); err != nil {
+		t.Fatal(err)
+	}
+	if getTestState(db, callee, "k") != "v" {
+		t.Error("a panicking callee was not reverted")
+	}
+
+	//调用方失败时被调合约已提交的修改一并回滚
+	_, err = r.Invoke(db, caller, nil, testArgs("invoke", callee.Hex(), "invoke", caller.Hex(), "put", "k", "v"))
+	if !errors.Is(err, SoCallError_Reentrant_Call) {
+		t.Errorf("reentrant call = %v, want %v", err, SoCallError_Reentrant_Call)
+	}
+	if _, err := r.Invoke(db, caller, nil, testArgs("invoke", common.HexToAddress("0xbad").Hex())); !errors.Is(err, SoCallError_Contract_Not_Found) {
+		t.Errorf("call of an unknown contract = %v, want %v", err, SoCallError_Contract_Not_Found)
+	}
+
+	stub := NewSoCallStub(NewHandler(db), testArgs("invoke", callee.Hex()), caller)
+	if res := (testContract{}).Run(stub); !errors.Is(res.Err(), SoCallError_Invoke_Unavailable) {
+		t.Errorf("call without a registry = %v, want %v", res.Err(), SoCallError_Invoke_Unavailable)
+	}
+}
+
+func TestInvokeContractDepth(t *testing.T) {
+	db := newTestMStateDB(t)
+	r := NewRegistry()
+	defer func(depth int) { MaxCallDepth = depth }(MaxCallDepth)
+	MaxCallDepth = 3
+
+	addrs := make([]common.Address, 4)
+	for i := range addrs {
+		addrs[i] = common.BigToAddress(big.NewInt(int64(0x100 + i)))
+		deployTestContract(t, r, db, addrs[i])
+	}
+	//args 依次调用 addrs[1:n],最后一个合约写入 k
+	chain := func(n int) [][]byte {
+		var args []string
+		for _, addr := range addrs[1:n] {
+			args = append(args, "invoke", addr.Hex())
+		}
+		return testArgs(append(args, "put", "k", "v")...)
+	}
+	if _, err := r.Invoke(db, addrs[0], nil, chain(3)); err != nil {
+		t.Fatalf("call at the depth limit = %v", err)
+	}
+	if getTestState(db, addrs[2], "k") != "v" {
+		t.Error("write at the depth limit is missing")
+	}
+	if _, err := r.Invoke(db, addrs[0], nil, chain(4)); !errors.Is(err, SoCallError_Call_Depth) {
+		t.Errorf("call past the depth limit = %v, want %v", err, SoCallError_Call_Depth)
+	}
+	if getTestState(db, addrs[3], "k") != "" {
+		t.Error("write past the depth limit was kept")
+	}
+}
+
+// legacyContract returns the result of a contract built before Response.
+type legacyContract struct {
+	payload []byte
+	err     error
+}
+
+func (c legacyContract) Run(stub interface{}) ([]byte, error) {
+	return c.payload, c.err
+}
+
+func TestLegacyCall(t *testing.T) {
+	if _, ok := asCall(struct{}{}); ok {
+		t.Error("asCall accepted a symbol without Run")
+	}
+	call, ok := asCall(testContract{})
+	if _, legacy := call.(legacyCall); !ok || legacy {
+		t.Errorf("asCall(Call) = %T, %v", call, ok)
+	}
+
+	db := newTestMStateDB(t)
+	r := NewRegistry()
+	tests := []struct {
+		contract legacyContract
+		status   int32
+	}{
+		{legacyContract{payload: []byte("ok")}, OK},
+		{legacyContract{}, OK},
+		{legacyContract{err: SoCallError_NoResult}, errorStatus[SoCallError_NoResult]},
+		{legacyContract{err: errors.New("failed")}, InternalError},
+	}
+	for i, tt := range tests {
+		call, ok := asCall(tt.contract)
+		if !ok {
+			t.Fatalf("asCall(%+v) failed", tt.contract)
+		}
+		addr := common.BigToAddress(big.NewInt(int64(0x200 + i)))
+		hash := crypto.Keccak256Hash(addr.Bytes())
+		r.Register(hash, "Legacy", call)
+		if err := putContractInfo(db, addr, &ContractInfo{Version: "1.0", PluginHash: hash, Symbol: "Legacy", Status: ContractActive}); err != nil {
+			t.Fatal(err)
+		}
+		res, _ := r.Invoke(db, addr, nil, nil)
+		if res.Status != tt.status || string(res.Payload) != string(tt.contract.payload) {
+			t.Errorf("legacy contract %+v = %+v, want status %d", tt.contract, res.Response, tt.status)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package remote
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"pdx-chain-so/so"
+	"pdx-chain-so/so/sopb"
+)
+
+// Contract is the so.Call of a contract running in a process. Its
+// invocations fail with a so.NodeFault wrapping
+// so.SoCallError_Contract_Unavailable while no process is connected, and
+// when the process is lost or runs out of time during the invocation.
+type Contract struct {
+	name   string
+	server *Server
+
+	mu    sync.Mutex
+	conn  *conn
+	token string
+}
+
+func (c *Contract) Run(stub interface{}) so.Response {
+	return c.invoke(sopb.SoMessage_INVOKE, stub, nil)
+}
+
+// Init runs the Init of the contract, a contract without one succeeds.
+func (c *Contract) Init(stub interface{}) so.Response {
+	return c.invoke(sopb.SoMessage_INIT, stub, nil)
+}
+
+// Upgrade runs the Upgrade of the contract, a contract without one
+// succeeds.
+func (c *Contract) Upgrade(stub interface{}, fromVersion string) so.Response {
+	return c.invoke(sopb.SoMessage_UPGRADE, stub, []byte(fromVersion))
+}
+
+// Connected reports whether a process serves the contract.
+func (c *Contract) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// NewToken returns the one-time token the next process of the contract
+// must register with, it replaces any token handed out before. Launch
+// passes it to the process it starts, a host starting the process itself
+// sets it as shim.EnvContractToken.
+func (c *Contract) NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = hex.EncodeToString(b)
+	return c.token, nil
+}
+
+// claim uses up the token if it is the one handed out, so a process
+// registering under the name of the contract without it can't take over
+// the proxy.
+func (c *Contract) claim(token string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == "" || subtle.ConstantTimeCompare([]byte(c.token), []byte(token)) != 1 {
+		return false
+	}
+	c.token = ""
+	return true
+}
+
+func (c *Contract) attach(conn *conn) {
+	c.mu.Lock()
+	old := c.conn
+	c.conn = conn
+	c.mu.Unlock()
+	if old != nil {
+		old.close(fmt.Errorf("replaced by a new process of %s", c.name))
+	}
+}
+
+func (c *Contract) detach(conn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+}
+
+// invoke starts an invocation of the given type in the process and serves
+// its stub calls until it completes.
+func (c *Contract) invoke(typ sopb.SoMessage_Type, stub interface{}, payload []byte) so.Response {
+	st, ok := stub.(so.StubInterface)
+	if !ok {
+		return so.FromError(fmt.Errorf("%w: stub is %T", so.SoCallError_Input_Error, stub))
+	}
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+	if conn == nil {
+		panic(&so.NodeFault{Err: so.SoCallError_Contract_Unavailable})
+	}
+
+	id, replies := conn.open()
+	defer conn.release(id)
+	defer func() {
+		if r := recover(); r != nil {
+			//处理请求时退出(如并行执行的死锁),先结束进程中的调用
+			res := so.FromError(fmt.Errorf("%w: %v", so.SoCallError_Contract_Unavailable, r))
+			conn.send(&sopb.SoMessage{Type: sopb.SoMessage_ERROR, Id: id, Status: res.Status, Message: res.Message})
+			panic(r)
+		}
+	}()
+	err := conn.send(&sopb.SoMessage{
+		Type:    typ,
+		Id:      id,
+		Txid:    st.GetTxID(),
+		Inputs:  st.GetArgs(),
+		Payload: payload,
+	})
+	if err != nil {
+		panic(unavailable(err))
+	}
+	var timeout <-chan time.Time
+	if c.server.Timeout > 0 {
+		timer := time.NewTimer(c.server.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		select {
+		case msg := <-replies:
+			if msg.Type == sopb.SoMessage_COMPLETED {
+				return so.Response{Status: msg.Status, Message: msg.Message, Payload: msg.Payload}
+			}
+			reply := serve(st, msg)
+			reply.Id = id
+			if err := conn.send(reply); err != nil {
+				panic(unavailable(err))
+			}
+		case <-conn.done:
+			panic(unavailable(conn.err))
+		case <-timeout:
+			panic(unavailable(fmt.Errorf("timed out after %v", c.server.Timeout)))
+		}
+	}
+}
+
+// unavailable returns the node fault of an invocation that lost its process
+// because of err.
+func unavailable(err error) *so.NodeFault {
+	return &so.NodeFault{Err: fmt.Errorf("%w: %v", so.SoCallError_Contract_Unavailable, err)}
+}
+
+// conn is the stream of a connected process. The messages it receives are
+// delivered to the invocation they belong to.
+type conn struct {
+	stream sopb.ContractSupport_RegisterServer
+	sendMu sync.Mutex
+
+	mu       sync.Mutex
+	next     uint64
+	inflight map[uint64]chan *sopb.SoMessage
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newConn(stream sopb.ContractSupport_RegisterServer) *conn {
+	return &conn{
+		stream:   stream,
+		inflight: make(map[uint64]chan *sopb.SoMessage),
+		done:     make(chan struct{}),
+	}
+}
+
+func (c *conn) send(msg *sopb.SoMessage) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.stream.Send(msg)
+}
+
+// open allocates the id of a new invocation and the channel its messages
+// are delivered to.
+func (c *conn) open() (uint64, chan *sopb.SoMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next++
+	//进程每次只发出一个请求,缓冲一条消息即可
+	ch := make(chan *sopb.SoMessage, 1)
+	c.inflight[c.next] = ch
+	return c.next, ch
+}
+
+func (c *conn) release(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inflight, id)
+}
+
+// deliver hands msg to its invocation, messages of finished or unknown
+// invocations are dropped.
+func (c *conn) deliver(msg *sopb.SoMessage) {
+	c.mu.Lock()
+	ch, ok := c.inflight[msg.Id]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case ch <- msg:
+	default:
+		//违反协议的进程,丢弃多余的消息
+	}
+}
+
+// close fails the invocations in flight with err.
+func (c *conn) close(err error) {
+	c.once.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
@@ -0,0 +1,398 @@
+package remote
+
+import (
+	gocrypto "crypto"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm2"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/ethdb/memorydb"
+	"pdx-chain-so/so"
+	"pdx-chain-so/so/shim"
+)
+
+// remoteContract runs the function named by the first argument, see the
+// cases of Run.
+type remoteContract struct{}
+
+func (remoteContract) Init(stub interface{}) so.Response {
+	s := stub.(so.StubInterface)
+	if err := s.PutState([]byte("init"), []byte("done")); err != nil {
+		return so.FromError(err)
+	}
+	return so.Success(nil)
+}
+
+func (remoteContract) Run(stub interface{}) so.Response {
+	s := stub.(so.StubInterface)
+	fn, args := s.GetFunctionAndParameters()
+	switch fn {
+	case "put":
+		if err := s.PutState(args[0], args[1]); err != nil {
+			return so.FromError(err)
+		}
+		s.SetEvent("put", args[0])
+		return so.Success(nil)
+	case "get":
+		v, err := s.GetState(args[0])
+		if err != nil {
+			return so.FromError(err)
+		}
+		return so.Success(v)
+	case "del":
+		if err := s.DelState(args[0]); err != nil {
+			return so.FromError(err)
+		}
+		return so.Success(nil)
+	case "range":
+		it, err := s.GetStateByRange("", "")
+		if err != nil {
+			return so.FromError(err)
+		}
+		var kvs []string
+		for it.HasNext() {
+			kv, err := it.Next()
+			if err != nil {
+				return so.FromError(err)
+			}
+			kvs = append(kvs, kv.Key+"="+string(kv.Value))
+		}
+		return so.Success([]byte(strings.Join(kvs, ",")))
+	case "transient":
+		transient, err := s.GetTransient()
+		if err != nil {
+			return so.FromError(err)
+		}
+		return so.Success(transient[string(args[0])])
+	case "block":
+		num, err := s.GetBlockNumber()
+		if err != nil {
+			return so.FromError(err)
+		}
+		return so.Success(common.Uint64ToByte(num))
+	case "putThenFail":
+		s.PutState(args[0], args[1])
+		return so.Error("failed on purpose")
+	case "panic":
+		panic("boom")
+	case "sleep":
+		time.Sleep(time.Second)
+		return so.Success(nil)
+	}
+	return so.Error("unknown function " + fn)
+}
+
+type certSigner struct {
+	*sm2.PrivateKey
+}
+
+func (s certSigner) Public() gocrypto.PublicKey {
+	return (*sm2.PublicKey)(&s.PrivateKey.PublicKey)
+}
+
+// writeCert writes a key and a certificate for it signed by the CA key, or
+// self-signed when ca is nil, to dir/name.key and dir/name.pem.
+func writeCert(t *testing.T, dir, name string, serial int64, usage x509.KeyUsage, ca *x509.Certificate, caKey *sm2.PrivateKey) (*x509.Certificate, *sm2.PrivateKey) {
+	t.Helper()
+	key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		SignatureAlgorithm:    x509.SM2WithSM3,
+		BasicConstraintsValid: true,
+		IsCA:                  ca == nil,
+		KeyUsage:              usage,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{"node"},
+	}
+	tmpl.Subject.CommonName = name
+	parent, signer := tmpl, certSigner{key}
+	if ca != nil {
+		parent, signer = ca, certSigner{caKey}
+	}
+	certPem, err := x509.CreateCertificateToPem(tmpl, parent, (*sm2.PublicKey)(&key.PublicKey), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPem, err := x509.WritePrivateKeyToPem(key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".pem"), certPem, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ReadCertificateFromPem(certPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+// testNode is a Server with a connected contract process deployed at
+// testAddr of db.
+type testNode struct {
+	srv      *Server
+	registry *so.Registry
+	db       *state.MStateDB
+	dir      string
+	addr     string
+}
+
+var testAddr = common.HexToAddress("0x10")
+
+func newTestNode(t *testing.T) *testNode {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "so-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	ca, caKey := writeCert(t, dir, "ca", 1, x509.KeyUsageCertSign|x509.KeyUsageDigitalSignature, nil, nil)
+	writeCert(t, dir, "sign", 2, x509.KeyUsageDigitalSignature, ca, caKey)
+	writeCert(t, dir, "enc", 3, x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment, ca, caKey)
+	writeCert(t, dir, "contract", 4, x509.KeyUsageDigitalSignature, ca, caKey)
+
+	path := func(name string) string { return filepath.Join(dir, name) }
+	creds, err := ServerCredentials(path("sign.pem"), path("sign.key"), path("enc.pem"), path("enc.key"), path("ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	srv := NewServer()
+	go srv.Serve(lis, creds)
+
+	st, err := state.New(common.Hash{}, state.NewDatabase(memorydb.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs, err := state.NewMStateDB(st, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs[0].Prepare(common.HexToHash("0x01"), common.Hash{}, 0)
+	return &testNode{srv: srv, registry: so.NewRegistry(), db: dbs[0], dir: dir, addr: lis.Addr().String()}
+}
+
+// dial runs a contract process registering as name with token in the
+// background, the returned channel receives the error it stops with.
+func (n *testNode) dial(t *testing.T, name, token string, call so.Call) chan error {
+	t.Helper()
+	creds, err := shim.ClientCredentials(filepath.Join(n.dir, "contract.pem"), filepath.Join(n.dir, "contract.key"), filepath.Join(n.dir, "ca.pem"), "node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- shim.Serve(n.addr, name, token, creds, call) }()
+	return done
+}
+
+// start runs a contract process registering as name with a token of the
+// node in the background and waits until it is connected.
+func (n *testNode) start(t *testing.T, name string, call so.Call) chan error {
+	t.Helper()
+	token, err := n.srv.Contract(name).NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := n.dial(t, name, token, call)
+	for i := 0; !n.srv.Contract(name).Connected(); i++ {
+		select {
+		case err := <-done:
+			t.Fatalf("contract process of %s stopped: %v", name, err)
+		case <-time.After(10 * time.Millisecond):
+		}
+		if i == 500 {
+			t.Fatalf("contract process of %s did not connect", name)
+		}
+	}
+	return done
+}
+
+// deploy binds the proxy of name to testAddr as a plugin would be.
+func (n *testNode) deploy(t *testing.T, name string) {
+	t.Helper()
+	exe := filepath.Join(n.dir, name)
+	if err := ioutil.WriteFile(exe, []byte("executable of "+name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	n.registry.Register(crypto.Keccak256Hash([]byte("executable of "+name)), name, n.srv.Contract(name))
+	if _, err := n.registry.Deploy(n.db, testAddr, nil, "1.0", exe, name, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (n *testNode) invoke(ctx *so.TxContext, args ...string) (*so.InvokeResult, error) {
+	in := make([][]byte, len(args))
+	for i, a := range args {
+		in[i] = []byte(a)
+	}
+	return n.registry.Invoke(n.db, testAddr, ctx, in)
+}
+
+func (n *testNode) state(key string) string {
+	return string(n.db.GetPDXState(testAddr, so.StateKeySlot([]byte(key))))
+}
+
+func TestRemoteContract(t *testing.T) {
+	n := newTestNode(t)
+	n.start(t, "simple", remoteContract{})
+	n.deploy(t, "simple")
+	if n.state("init") != "done" {
+		t.Error("Init did not run in the process")
+	}
+
+	if _, err := n.invoke(nil, "put", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.invoke(nil, "put", "b", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if n.state("a") != "1" {
+		t.Errorf("state of a = %q", n.state("a"))
+	}
+	if res, err := n.invoke(nil, "get", "a"); err != nil || string(res.Payload) != "1" {
+		t.Errorf("get a = %q, %v", res.Payload, err)
+	}
+	if res, err := n.invoke(nil, "range"); err != nil || string(res.Payload) != "a=1,b=2,init=done" {
+		t.Errorf("range = %q, %v", res.Payload, err)
+	}
+	if _, err := n.invoke(nil, "del", "a"); err != nil || n.state("a") != "" {
+		t.Errorf("del a = %v, state %q", err, n.state("a"))
+	}
+	ctx := &so.TxContext{BlockNumber: 42, Transient: map[string][]byte{"secret": []byte("s3"), "other": []byte("x")}}
+	if res, err := n.invoke(ctx, "transient", "secret"); err != nil || string(res.Payload) != "s3" {
+		t.Errorf("transient secret = %q, %v", res.Payload, err)
+	}
+	if res, err := n.invoke(ctx, "block"); err != nil || common.ByteToUint64(res.Payload) != 42 {
+		t.Errorf("block number = %x, %v", res.Payload, err)
+	}
+
+	//进程中失败或崩溃的调用与插件一样回滚,进程继续服务
+	res, err := n.invoke(nil, "putThenFail", "c", "3")
+	if err == nil || res.Message != "failed on purpose" || n.state("c") != "" {
+		t.Errorf("putThenFail = %+v, %v, state %q", res.Response, err, n.state("c"))
+	}
+	if _, err := n.invoke(nil, "panic"); !errors.Is(err, so.SoCallError_Contract_Panic) {
+		t.Errorf("panic = %v, want %v", err, so.SoCallError_Contract_Panic)
+	}
+	if res, err := n.invoke(nil, "get", "b"); err != nil || string(res.Payload) != "2" {
+		t.Errorf("get b after a panic = %q, %v", res.Payload, err)
+	}
+}
+
+func TestRemoteContractUnavailable(t *testing.T) {
+	n := newTestNode(t)
+	n.srv.Timeout = 100 * time.Millisecond
+	exe := filepath.Join(n.dir, "absent")
+	if err := ioutil.WriteFile(exe, []byte("absent"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	n.registry.Register(crypto.Keccak256Hash([]byte("absent")), "absent", n.srv.Contract("absent"))
+	if _, err := n.registry.Deploy(n.db, testAddr, nil, "1.0", exe, "absent", nil); !errors.Is(err, so.SoCallError_Contract_Unavailable) {
+		t.Errorf("Deploy without a process = %v, want %v", err, so.SoCallError_Contract_Unavailable)
+	}
+
+	var fault *so.NodeFault
+	if _, err := n.registry.Deploy(n.db, testAddr, nil, "1.0", exe, "absent", nil); !errors.As(err, &fault) {
+		t.Errorf("Deploy without a process = %v, want a node fault", err)
+	}
+
+	n.start(t, "slow", remoteContract{})
+	n.deploy(t, "slow")
+	//超时是节点故障,不是交易结果,写入被回滚
+	if _, err := n.invoke(nil, "put", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.invoke(nil, "sleep"); !errors.As(err, &fault) || !errors.Is(err, so.SoCallError_Contract_Unavailable) {
+		t.Errorf("invocation past the timeout = %v, want a node fault of %v", err, so.SoCallError_Contract_Unavailable)
+	}
+	//之前的交易结束后释放锁,批量执行的交易才能读取合约信息
+	n.db.UnLockAccounts(false)
+	batch := []*so.Invocation{
+		{Address: testAddr, Ctx: &so.TxContext{TxID: common.HexToHash("0x02")}, Args: [][]byte{[]byte("put"), []byte("b"), []byte("2")}},
+		{Address: testAddr, Ctx: &so.TxContext{TxID: common.HexToHash("0x03")}, Args: [][]byte{[]byte("sleep")}},
+	}
+	if results, err := n.registry.InvokeBatch([]*state.MStateDB{n.db}, common.Hash{}, batch); !errors.As(err, &fault) || results != nil {
+		t.Errorf("batch with a node fault = %v, %v, want a node fault", results, err)
+	}
+}
+
+// Tests that only the process holding the token handed out for a name can
+// register as that name.
+func TestRemoteContractRegistration(t *testing.T) {
+	n := newTestNode(t)
+	first := n.start(t, "simple", remoteContract{})
+	n.deploy(t, "simple")
+
+	for _, token := range []string{"", "forged"} {
+		select {
+		case err := <-n.dial(t, "simple", token, remoteContract{}):
+			if err == nil || !strings.Contains(err.Error(), "rejected") {
+				t.Errorf("registration with token %q = %v, want a rejection", token, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("registration with token %q was not rejected", token)
+		}
+	}
+	//被拒绝的注册不影响已连接的进程
+	if _, err := n.invoke(nil, "put", "a", "1"); err != nil {
+		t.Fatalf("invoke after rejected registrations: %v", err)
+	}
+	select {
+	case err := <-first:
+		t.Fatalf("process stopped by a rejected registration: %v", err)
+	default:
+	}
+
+	//新令牌的进程接管代理,旧进程被断开
+	token, err := n.srv.Contract("simple").NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := n.dial(t, "simple", token, remoteContract{})
+	select {
+	case <-first:
+	case <-time.After(5 * time.Second):
+		t.Fatal("replaced process is still connected")
+	}
+	if _, err := n.invoke(nil, "get", "a"); err != nil {
+		t.Errorf("invoke after the takeover: %v", err)
+	}
+	//令牌只能使用一次
+	select {
+	case err := <-n.dial(t, "simple", token, remoteContract{}):
+		if err == nil || !strings.Contains(err.Error(), "rejected") {
+			t.Errorf("second registration with a used token = %v, want a rejection", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second registration with a used token was not rejected")
+	}
+	select {
+	case err := <-second:
+		t.Fatalf("process stopped by a reused token: %v", err)
+	default:
+	}
+}
@@ -0,0 +1,233 @@
+package remote
+
+import (
+	"sort"
+	"strconv"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+	"pdx-chain-so/so"
+	"pdx-chain-so/so/sopb"
+)
+
+// serve runs the stub call of the process in msg on the stub of the node
+// and returns the RESPONSE or ERROR message answering it. The inputs and
+// payloads of the requests are encoded as written by the shim package.
+func serve(st so.StubInterface, msg *sopb.SoMessage) *sopb.SoMessage {
+	payload, err := call(st, msg.Type, msg.Inputs)
+	if err != nil {
+		res := so.FromError(err)
+		return &sopb.SoMessage{Type: sopb.SoMessage_ERROR, Status: res.Status, Message: res.Message}
+	}
+	return &sopb.SoMessage{Type: sopb.SoMessage_RESPONSE, Payload: payload}
+}
+
+func call(st so.StubInterface, typ sopb.SoMessage_Type, in [][]byte) ([]byte, error) {
+	switch typ {
+	case sopb.SoMessage_GET_STATE:
+		if len(in) != 1 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		return st.GetState(in[0])
+	case sopb.SoMessage_GET_STATE_WITH_PROOF:
+		if len(in) != 1 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		p, err := st.GetStateWithProof(in[0])
+		if err != nil {
+			return nil, err
+		}
+		return rlp.EncodeToBytes(p)
+	case sopb.SoMessage_PUT_STATE:
+		if len(in) != 2 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		return nil, st.PutState(in[0], in[1])
+	case sopb.SoMessage_DEL_STATE:
+		if len(in) != 1 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		return nil, st.DelState(in[0])
+	case sopb.SoMessage_GET_HISTORY:
+		return getHistory(st, in)
+	case sopb.SoMessage_GET_STATE_BY_RANGE:
+		if len(in) != 2 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		return encodeKVs(st.GetStateByRange(string(in[0]), string(in[1])))
+	case sopb.SoMessage_GET_STATE_BY_PREFIX:
+		if len(in) != 1 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		return encodeKVs(st.GetStateByPrefix(string(in[0])))
+	case sopb.SoMessage_GET_STATE_BY_PARTIAL_COMPOSITE_KEY:
+		if len(in) < 1 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		attrs := make([]string, len(in)-1)
+		for i, a := range in[1:] {
+			attrs[i] = string(a)
+		}
+		return encodeKVs(st.GetStateByPartialCompositeKey(string(in[0]), attrs))
+	case sopb.SoMessage_GET_QUERY_RESULT:
+		return getQueryResult(st, in)
+	case sopb.SoMessage_SET_EVENT:
+		if len(in) != 2 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		return nil, st.SetEvent(string(in[0]), in[1])
+	case sopb.SoMessage_PUT_PRIVATE_DATA:
+		if len(in) != 3 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		return nil, st.PutPrivateData(string(in[0]), string(in[1]), in[2])
+	case sopb.SoMessage_DEL_PRIVATE_DATA:
+		if len(in) != 2 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		return nil, st.DelPrivateData(string(in[0]), string(in[1]))
+	case sopb.SoMessage_GET_PRIVATE_DATA:
+		if len(in) != 2 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		return st.GetPrivateData(string(in[0]), string(in[1]))
+	case sopb.SoMessage_GET_PRIVATE_DATA_HASH:
+		if len(in) != 2 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		return st.GetPrivateDataHash(string(in[0]), string(in[1]))
+	case sopb.SoMessage_GET_KEY_POLICY:
+		if len(in) != 1 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		policy, err := st.GetKeyPolicy(string(in[0]))
+		if err != nil || policy == nil {
+			return nil, err
+		}
+		return rlp.EncodeToBytes(policy)
+	case sopb.SoMessage_SET_KEY_POLICY, sopb.SoMessage_SET_PREFIX_POLICY:
+		if len(in) != 2 {
+			return nil, so.SoCallError_Key_Value_NotMatch
+		}
+		var policy *so.Policy
+		if len(in[1]) != 0 {
+			policy = new(so.Policy)
+			if err := rlp.DecodeBytes(in[1], policy); err != nil {
+				return nil, so.SoCallError_Policy_Illegal
+			}
+		}
+		if typ == sopb.SoMessage_SET_PREFIX_POLICY {
+			return nil, st.SetPrefixPolicy(string(in[0]), policy)
+		}
+		return nil, st.SetKeyPolicy(string(in[0]), policy)
+	case sopb.SoMessage_INVOKE_CONTRACT:
+		if len(in) < 1 || len(in[0]) != common.AddressLength {
+			return nil, so.SoCallError_Input_Error
+		}
+		return st.InvokeContract(common.BytesToAddress(in[0]), in[1:])
+	case sopb.SoMessage_GET_TX_TIMESTAMP:
+		ts, err := st.GetTxTimestamp()
+		if err != nil {
+			return nil, err
+		}
+		return common.Uint64ToByte(ts), nil
+	case sopb.SoMessage_GET_BLOCK_NUMBER:
+		num, err := st.GetBlockNumber()
+		if err != nil {
+			return nil, err
+		}
+		return common.Uint64ToByte(num), nil
+	case sopb.SoMessage_GET_CREATOR:
+		return st.GetCreator()
+	case sopb.SoMessage_GET_CALLER_ORG:
+		org, err := st.GetCallerOrg()
+		return []byte(org), err
+	case sopb.SoMessage_GET_TRANSIENT:
+		transient, err := st.GetTransient()
+		if err != nil {
+			return nil, err
+		}
+		//按键排序编码,与读取顺序无关
+		kvs := make([]*so.KV, 0, len(transient))
+		for k, v := range transient {
+			kvs = append(kvs, &so.KV{Key: k, Value: v})
+		}
+		sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+		return rlp.EncodeToBytes(kvs)
+	}
+	return nil, so.SoCallError_Input_Error
+}
+
+// getHistory serves GET_HISTORY, the inputs are key, start, end, page size,
+// bookmark and order. It returns an rlp encoded so.HistoryPage.
+func getHistory(st so.StubInterface, in [][]byte) ([]byte, error) {
+	if len(in) != 6 {
+		return nil, so.SoCallError_Key_Value_NotMatch
+	}
+	if len(in[1]) != 8 || len(in[2]) != 8 || len(in[3]) != 8 || len(in[5]) != 1 {
+		return nil, so.SoCallError_Input_Error
+	}
+	it, md, err := st.GetHistoryForKeyWithPagination(string(in[0]),
+		common.ByteToUint64(in[1]), common.ByteToUint64(in[2]),
+		int32(common.ByteToUint64(in[3])), string(in[4]), so.HistoryOrder(in[5][0]))
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	page := &so.HistoryPage{HasMore: md.HasMore}
+	for it.HasNext() {
+		rec, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		page.Records = append(page.Records, rec)
+	}
+	if md.HasMore {
+		if page.Bookmark, err = strconv.ParseUint(md.Bookmark, 10, 64); err != nil {
+			return nil, so.SoCallError_History_Bookmark_Illegal
+		}
+	}
+	return rlp.EncodeToBytes(page)
+}
+
+// getQueryResult serves GET_QUERY_RESULT, the inputs are the query, the
+// page size and the bookmark. It returns an rlp encoded so.QueryPage.
+func getQueryResult(st so.StubInterface, in [][]byte) ([]byte, error) {
+	if len(in) != 3 || len(in[1]) != 8 {
+		return nil, so.SoCallError_Key_Value_NotMatch
+	}
+	it, md, err := st.GetQueryResultWithPagination(string(in[0]), int32(common.ByteToUint64(in[1])), string(in[2]))
+	if err != nil {
+		return nil, err
+	}
+	results, err := drain(it)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(&so.QueryPage{Results: results, Bookmark: md.Bookmark, HasMore: md.HasMore})
+}
+
+// encodeKVs returns the results of a range query as rlp encoded []*so.KV.
+func encodeKVs(it so.StateQueryIteratorInterface, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	results, err := drain(it)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(results)
+}
+
+func drain(it so.StateQueryIteratorInterface) ([]*so.KV, error) {
+	defer it.Close()
+	var results []*so.KV
+	for it.HasNext() {
+		kv, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, kv)
+	}
+	return results, nil
+}
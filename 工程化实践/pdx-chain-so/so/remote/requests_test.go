@@ -0,0 +1,70 @@
+package remote
+
+import (
+	"bytes"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+	"pdx-chain-so/so"
+	"pdx-chain-so/so/mock"
+	"pdx-chain-so/so/sopb"
+)
+
+func TestServeTransient(t *testing.T) {
+	stub := mock.NewMockStub("remote", nil)
+	stub.Transient = map[string][]byte{"b": []byte("2"), "a": []byte("1"), "c": nil}
+
+	msg := serve(stub, &sopb.SoMessage{Type: sopb.SoMessage_GET_TRANSIENT, Id: 7})
+	if msg.Type != sopb.SoMessage_RESPONSE {
+		t.Fatalf("GET_TRANSIENT answered %s %q", msg.Type, msg.Message)
+	}
+	var kvs []*so.KV
+	if err := rlp.DecodeBytes(msg.Payload, &kvs); err != nil {
+		t.Fatal(err)
+	}
+	//按键排序,编码与map的遍历顺序无关
+	want := []so.KV{{Key: "a", Value: []byte("1")}, {Key: "b", Value: []byte("2")}, {Key: "c"}}
+	if len(kvs) != len(want) {
+		t.Fatalf("transient = %d entries, want %d", len(kvs), len(want))
+	}
+	for i := range want {
+		if kvs[i].Key != want[i].Key || !bytes.Equal(kvs[i].Value, want[i].Value) {
+			t.Errorf("entry %d = %s=%q, want %s=%q", i, kvs[i].Key, kvs[i].Value, want[i].Key, want[i].Value)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if again := serve(stub, &sopb.SoMessage{Type: sopb.SoMessage_GET_TRANSIENT}); !bytes.Equal(again.Payload, msg.Payload) {
+			t.Fatal("the encoding of the transient input changes between calls")
+		}
+	}
+
+	stub.Transient = nil
+	msg = serve(stub, &sopb.SoMessage{Type: sopb.SoMessage_GET_TRANSIENT})
+	if err := rlp.DecodeBytes(msg.Payload, &kvs); err != nil || len(kvs) != 0 {
+		t.Errorf("empty transient = %v, %v", kvs, err)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	stub := mock.NewMockStub("remote", nil)
+	tests := []struct {
+		typ    sopb.SoMessage_Type
+		inputs [][]byte
+		err    error
+	}{
+		{sopb.SoMessage_GET_STATE, nil, so.SoCallError_Key_Value_NotMatch},
+		{sopb.SoMessage_PUT_STATE, [][]byte{[]byte("k")}, so.SoCallError_Key_Value_NotMatch},
+		{sopb.SoMessage_DEL_STATE, [][]byte{[]byte("k"), []byte("v")}, so.SoCallError_Key_Value_NotMatch},
+		{sopb.SoMessage_GET_HISTORY, [][]byte{[]byte("k"), nil, nil, nil, nil, nil}, so.SoCallError_Input_Error},
+		{sopb.SoMessage_INVOKE_CONTRACT, [][]byte{[]byte("short")}, so.SoCallError_Input_Error},
+		{sopb.SoMessage_REGISTER, nil, so.SoCallError_Input_Error},
+		{sopb.SoMessage_GET_STATE, [][]byte{nil}, so.SoCallError_Input_Error},
+	}
+	for _, tt := range tests {
+		msg := serve(stub, &sopb.SoMessage{Type: tt.typ, Inputs: tt.inputs})
+		want := so.FromError(tt.err)
+		if msg.Type != sopb.SoMessage_ERROR || msg.Status != want.Status || msg.Message != want.Message {
+			t.Errorf("%s with %d inputs answered %s %d %q, want ERROR %d %q", tt.typ, len(tt.inputs), msg.Type, msg.Status, msg.Message, want.Status, want.Message)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Package remote runs SO contracts in processes of their own, so a failing
+// contract cannot take the node down with it.
+//
+// A contract process is built from an unchanged so.Call with the shim
+// package and dials the ContractSupport service of the node. The node side
+// is a Server: it accepts the processes over SM2 TLS and gives every
+// contract a so.Call proxy, which forwards the invocations to the process
+// and serves the stub calls of the process with the stub of the node. The
+// writes, key policies, gas and read-write set of a remote contract are thus
+// handled exactly as for a plugin.
+//
+//	srv := remote.NewServer()
+//	creds, _ := remote.ServerCredentials(signCert, signKey, encCert, encKey, caCert)
+//	go srv.Serve(lis, creds)
+//	srv.Env = []string{shim.EnvPeerAddress + "=" + lis.Addr().String(), ...}
+//	srv.Launch(registry, "/contracts/simple", "Simple")
+//	registry.Deploy(db, addr, ctx, "1.0", "/contracts/simple", "Simple", args)
+package remote
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/gmtls"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/gmtls/gmcredentials"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/so"
+	"pdx-chain-so/so/shim"
+	"pdx-chain-so/so/sopb"
+)
+
+// Server accepts contract processes on the ContractSupport stream.
+type Server struct {
+	mu        sync.Mutex
+	contracts map[string]*Contract
+
+	// Timeout bounds the time of one invocation of a remote contract, zero
+	// for no bound. An invocation running out of time fails with a
+	// so.NodeFault, which stops the node processing the block. Whether an
+	// invocation runs out of time depends on the node, so it must stay zero
+	// on consensus nodes, a slow node would otherwise stall on blocks the
+	// others accept.
+	Timeout time.Duration
+	// Env is added to the environment of the processes started by Launch,
+	// it holds the address of the server and the TLS settings of the shim.
+	Env []string
+}
+
+func NewServer() *Server {
+	return &Server{contracts: make(map[string]*Contract)}
+}
+
+// ServerCredentials returns the SM2 TLS credentials of a server with the
+// given signing and encryption key pairs. Contract processes must present
+// a certificate issued by the CA in caFile.
+func ServerCredentials(signCertFile, signKeyFile, encCertFile, encKeyFile, caFile string) (credentials.TransportCredentials, error) {
+	signCert, err := gmtls.LoadX509KeyPair(signCertFile, signKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	encCert, err := gmtls.LoadX509KeyPair(encCertFile, encKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("remote: no certificate in %s", caFile)
+	}
+	return gmcredentials.NewTLS(&gmtls.Config{
+		GMSupport:    &gmtls.GMSupport{},
+		ClientAuth:   gmtls.RequireAndVerifyClientCert,
+		Certificates: []gmtls.Certificate{signCert, encCert},
+		ClientCAs:    pool,
+	}), nil
+}
+
+// Serve accepts contract processes on lis until it fails.
+func (s *Server) Serve(lis net.Listener, creds credentials.TransportCredentials) error {
+	gs := grpc.NewServer(grpc.Creds(creds))
+	sopb.RegisterContractSupportServer(gs, s)
+	return gs.Serve(lis)
+}
+
+// Contract returns the proxy of the contract registered by its process as
+// name. The proxy exists before the process connects and survives it, a
+// restarted process registering with a new token takes over the proxy.
+func (s *Server) Contract(name string) *Contract {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.contracts[name]
+	if !ok {
+		c = &Contract{name: name, server: s}
+		s.contracts[name] = c
+	}
+	return c
+}
+
+// Launch starts the contract executable at path as a process registering
+// as name, and registers its proxy with registry under the hash of the
+// executable and name as symbol. A contract deployed with path and name as
+// plugin and symbol then runs in the process. Only the process started
+// last gets the token the registration of name is accepted with, so no
+// other process can take over the proxy.
+func (s *Server) Launch(registry *so.Registry, path string, name string) (*exec.Cmd, error) {
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := s.Contract(name)
+	registry.Register(crypto.Keccak256Hash(code), name, c)
+	token, err := c.NewToken()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(path)
+	cmd.Env = append(append(os.Environ(), s.Env...), shim.EnvContractName+"="+name, shim.EnvContractToken+"="+token)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	go cmd.Wait()
+	return cmd, nil
+}
+
+// Register serves the stream of one contract process, it implements
+// sopb.ContractSupportServer. The process must present the token handed out
+// by Contract.NewToken for its name, a registration without it is rejected
+// and leaves the connected process in place.
+func (s *Server) Register(stream sopb.ContractSupport_RegisterServer) error {
+	msg, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if msg.Type != sopb.SoMessage_REGISTER || len(msg.Payload) == 0 || len(msg.Inputs) != 1 {
+		return fmt.Errorf("remote: expected REGISTER, got %s", msg.Type)
+	}
+	c := s.Contract(string(msg.Payload))
+	if !c.claim(string(msg.Inputs[0])) {
+		return fmt.Errorf("remote: registration of %s rejected, the token is not the one handed out", msg.Payload)
+	}
+	conn := newConn(stream)
+	if err := conn.send(&sopb.SoMessage{Type: sopb.SoMessage_REGISTERED}); err != nil {
+		return err
+	}
+	c.attach(conn)
+	defer c.detach(conn)
+
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				conn.close(err)
+				return
+			}
+			conn.deliver(msg)
+		}
+	}()
+	//连接断开或被新进程取代时返回
+	<-conn.done
+	return conn.err
+}
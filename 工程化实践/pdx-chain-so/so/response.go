@@ -0,0 +1,191 @@
+package so
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors of contracts dispatching the function named by their first
+// argument, such as the contracts built by contractapi.
+var (
+	SoCallError_Unknown_Function = errors.New("Contract function is not defined")
+	SoCallError_Argument_Count   = errors.New("Contract function argument count does not match")
+	SoCallError_Argument_Illegal = errors.New("Contract function argument is illegal")
+)
+
+// Status codes of a Response. The range of a code tells who is to blame for
+// a failure:
+//
+//	200-399 success
+//	400-499 input errors, the transaction is rejected by the so runtime
+//	500-599 infrastructure errors of the node or of the contract code
+//	600-699 business errors returned by the contract
+const (
+	OK int32 = 200
+
+	InternalError int32 = 500
+
+	BusinessError    int32 = 600
+	BusinessNotFound int32 = 604
+)
+
+// Response is the outcome of a contract invocation.
+type Response struct {
+	Status  int32
+	Message string
+	Payload []byte
+}
+
+// Success returns a successful response carrying payload.
+func Success(payload []byte) Response {
+	return Response{Status: OK, Payload: payload}
+}
+
+// Error returns a business error response.
+func Error(msg string) Response {
+	return Response{Status: BusinessError, Message: msg}
+}
+
+// NotFound returns a business error response for a missing object.
+func NotFound(msg string) Response {
+	return Response{Status: BusinessNotFound, Message: msg}
+}
+
+// FromError returns the response of err. A SoCallError_* value, wrapped
+// or not, gets its stable status code, any other error is treated as an
+// infrastructure error. A contract passes on the errors of the stub with
+// it.
+func FromError(err error) Response {
+	var serr *StatusError
+	if errors.As(err, &serr) {
+		return Response{Status: serr.Status, Message: serr.Message}
+	}
+	if status, ok := ErrorStatus(err); ok {
+		return Response{Status: status, Message: err.Error()}
+	}
+	return Response{Status: InternalError, Message: err.Error()}
+}
+
+// ErrorStatus returns the status code of the SoCallError_* value err is or
+// wraps, ok is false for any other error.
+func ErrorStatus(err error) (status int32, ok bool) {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if status, ok = errorStatus[e]; ok {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
+func (r Response) IsSuccess() bool {
+	return r.Status >= 200 && r.Status < 400
+}
+
+func (r Response) IsInputError() bool {
+	return r.Status >= 400 && r.Status < 500
+}
+
+func (r Response) IsInfrastructureError() bool {
+	return r.Status >= 500 && r.Status < 600
+}
+
+func (r Response) IsBusinessError() bool {
+	return r.Status >= 600 && r.Status < 700
+}
+
+// Err returns nil for a successful response. A failed response with the
+// code and message of a SoCallError_* value returns that value, any other
+// returns a *StatusError.
+func (r Response) Err() error {
+	if r.IsSuccess() {
+		return nil
+	}
+	if e := statusErrors[r.Status]; e != nil && e.Error() == r.Message {
+		return e
+	}
+	return &StatusError{Status: r.Status, Message: r.Message}
+}
+
+// StatusError is the error of a failed Response.
+type StatusError struct {
+	Status  int32
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s (status %d)", e.Message, e.Status)
+}
+
+// Unwrap returns the SoCallError_* value the message was derived from.
+func (e *StatusError) Unwrap() error {
+	if se := statusErrors[e.Status]; se != nil && strings.HasPrefix(e.Message, se.Error()) {
+		return se
+	}
+	return nil
+}
+
+// errorStatus holds the stable status codes of the SoCallError_* values,
+// codes must never be reused or changed.
+var errorStatus = map[error]int32{
+	SoCallError_Input_Error:              400,
+	SoCallError_Creator_Unavailable:      401,
+	SoCallError_Creator_Illegal:          402,
+	SoCallError_Policy_Not_Satisfied:     403,
+	SoCallError_NoResult:                 404,
+	SoCallError_Key_Value_NotMatch:       405,
+	SoCallError_Start_FinishNum_Illegal:  406,
+	SoCallError_History_Bookmark_Illegal: 407,
+	SoCallError_History_Limit_Reached:    408,
+	SoCallError_Contract_Exists:          409,
+	SoCallError_Range_Illegal:            410,
+	SoCallError_Composite_Key_Illegal:    411,
+	SoCallError_Key_Namespace_Reserved:   412,
+	SoCallError_Contract_Not_Found:       413,
+	SoCallError_Contract_Disabled:        414,
+	SoCallError_Contract_Version:         415,
+	SoCallError_Org_Not_Found:            416,
+	SoCallError_Policy_Illegal:           417,
+	SoCallError_Collection_Not_Found:     418,
+	SoCallError_Collection_Exists:        419,
+	SoCallError_Collection_Illegal:       420,
+	SoCallError_Private_Not_Member:       421,
+	SoCallError_Call_Depth:               422,
+	SoCallError_Reentrant_Call:           423,
+	SoCallError_Unknown_Function:         424,
+	SoCallError_Argument_Count:           425,
+	SoCallError_Argument_Illegal:         426,
+	SoCallError_Query_Illegal:            427,
+	SoCallError_Index_Illegal:            428,
+	SoCallError_Index_Exists:             430,
+	SoCallError_Out_Of_Gas:               429,
+	SoCallError_Lifecycle_Unauthorized:   431,
+	SoCallError_Private_Salt_Missing:     432,
+	SoCallError_Rich_Query_Read_Only:     433,
+
+	SoCallError_Contract_Panic:            500,
+	SoCallError_History_Encode_Error:      501,
+	SoCallError_Range_Encode_Error:        502,
+	SoCallError_Chain_Unavailable:         503,
+	SoCallError_Key_Index_Error:           504,
+	SoCallError_Contract_Not_Loaded:       505,
+	SoCallError_Plugin_Symbol:             506,
+	SoCallError_Invoke_Unavailable:        507,
+	SoCallError_TxContext_Unavailable:     508,
+	SoCallError_Private_Data_Missing:      509,
+	SoCallError_Private_Data_Mismatch:     510,
+	SoCallError_Rich_Query_Unavailable:    511,
+	SoCallError_Query_Encode_Error:        512,
+	SoCallError_Contract_Unavailable:      513,
+	SoCallError_Proof_Unavailable:         514,
+	SoCallError_History_Block_Unavailable: 515,
+	SoCallError_Plugin_Changed:            516,
+}
+
+var statusErrors = func() map[int32]error {
+	m := make(map[int32]error, len(errorStatus))
+	for e, status := range errorStatus {
+		m[status] = e
+	}
+	return m
+}()
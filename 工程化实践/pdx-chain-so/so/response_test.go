@@ -0,0 +1,62 @@
+package so
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorStatusUnique(t *testing.T) {
+	if len(statusErrors) != len(errorStatus) {
+		t.Fatalf("%d errors share %d status codes", len(errorStatus), len(statusErrors))
+	}
+	for e, status := range errorStatus {
+		if res := FromError(e); !res.IsInputError() && !res.IsInfrastructureError() {
+			t.Errorf("%v has status %d outside the error ranges", e, status)
+		}
+	}
+}
+
+func TestFromError(t *testing.T) {
+	wrapped := fmt.Errorf("%w: key k", SoCallError_NoResult)
+	tests := []struct {
+		err    error
+		status int32
+		kind   func(Response) bool
+	}{
+		{SoCallError_Input_Error, 400, Response.IsInputError},
+		{wrapped, 404, Response.IsInputError},
+		{SoCallError_Contract_Panic, 500, Response.IsInfrastructureError},
+		{errors.New("disk full"), InternalError, Response.IsInfrastructureError},
+		{&StatusError{Status: BusinessNotFound, Message: "no car"}, BusinessNotFound, Response.IsBusinessError},
+	}
+	for _, tt := range tests {
+		res := FromError(tt.err)
+		if res.Status != tt.status || !tt.kind(res) || res.IsSuccess() {
+			t.Errorf("FromError(%v) = %+v, want status %d", tt.err, res, tt.status)
+		}
+	}
+
+	if err := FromError(SoCallError_NoResult).Err(); err != SoCallError_NoResult {
+		t.Errorf("Err of a stub error = %v, want the error itself", err)
+	}
+	if err := FromError(wrapped).Err(); !errors.Is(err, SoCallError_NoResult) || err.Error() != wrapped.Error()+" (status 404)" {
+		t.Errorf("Err of a wrapped stub error = %v", err)
+	}
+	if err := Error("sold out").Err(); err.Error() != "sold out (status 600)" || errors.Unwrap(err) != nil {
+		t.Errorf("Err of a business error = %v", err)
+	}
+	if err := Success(nil).Err(); err != nil {
+		t.Errorf("Err of a success = %v", err)
+	}
+	if !NotFound("no car").IsBusinessError() {
+		t.Error("NotFound is not a business error")
+	}
+}
+
+func TestContractPanic(t *testing.T) {
+	res := run(func() Response { panic("boom") })
+	if res.Status != errorStatus[SoCallError_Contract_Panic] || !errors.Is(res.Err(), SoCallError_Contract_Panic) {
+		t.Errorf("response of a panic = %+v", res)
+	}
+}
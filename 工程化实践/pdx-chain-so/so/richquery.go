@@ -0,0 +1,450 @@
+package so
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/core/state"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+)
+
+var (
+	SoCallError_Query_Illegal          = errors.New("Rich query is illegal")
+	SoCallError_Index_Illegal          = errors.New("Document index is illegal")
+	SoCallError_Index_Exists           = errors.New("Document index is already defined")
+	SoCallError_Rich_Query_Unavailable = errors.New("Rich queries are not available on this node")
+	SoCallError_Query_Encode_Error     = errors.New("Rich query result encode error")
+	SoCallError_Rich_Query_Read_Only   = errors.New("Rich queries are only available to read-only queries")
+)
+
+var docIndexPrefix = []byte("pdx-so-doc-index")
+
+// docIndexSlot returns the PDX storage slot holding the document indexes of
+// a contract.
+func docIndexSlot() common.Hash {
+	return crypto.Keccak256Hash(docIndexPrefix)
+}
+
+// IndexDef declares an index over JSON fields of the documents of a
+// contract, nested fields are addressed with dots as in "owner.name".
+type IndexDef struct {
+	Name   string
+	Fields []string
+}
+
+// DefineIndex declares an index of the contract at addr, it is usually
+// called when the contract is deployed. Nodes keeping a DocumentStore build
+// the index the next time they apply a block.
+func DefineIndex(db *state.MStateDB, addr common.Address, def *IndexDef) error {
+	if def.Name == "" || len(def.Fields) == 0 {
+		return SoCallError_Index_Illegal
+	}
+	for _, f := range def.Fields {
+		if f == "" {
+			return SoCallError_Index_Illegal
+		}
+	}
+	defs, err := GetIndexes(db, addr)
+	if err != nil {
+		return err
+	}
+	for _, d := range defs {
+		if d.Name == def.Name {
+			return SoCallError_Index_Exists
+		}
+	}
+	enc, err := rlp.EncodeToBytes(append(defs, def))
+	if err != nil {
+		return err
+	}
+	db.SetPDXState(addr, docIndexSlot(), enc)
+	return nil
+}
+
+// GetIndexes returns the indexes of the contract at addr in the order they
+// were defined.
+func GetIndexes(db *state.MStateDB, addr common.Address) ([]*IndexDef, error) {
+	enc := db.GetPDXState(addr, docIndexSlot())
+	if len(enc) == 0 {
+		return nil, nil
+	}
+	var defs []*IndexDef
+	if err := rlp.DecodeBytes(enc, &defs); err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
+
+// Query is a parsed rich query. A query is a JSON object whose "selector"
+// maps field paths to a value, which must be equal, or to an object of
+// operators: $eq, $ne, $gt, $gte, $lt, $lte, $in and $exists. The
+// selector may also hold $and and $or arrays of selectors. Only values that
+// are JSON objects are matched.
+//
+//	{"selector": {"owner": "tom", "age": {"$gte": 18}}}
+type Query struct {
+	selector *selector
+}
+
+type selector struct {
+	conds []*condition
+	and   []*selector
+	or    []*selector
+}
+
+type condition struct {
+	path  []string
+	op    string
+	value interface{}
+}
+
+// ParseQuery parses a rich query.
+func ParseQuery(query string) (*Query, error) {
+	var q struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	if err := json.Unmarshal([]byte(query), &q); err != nil {
+		return nil, fmt.Errorf("%w: %v", SoCallError_Query_Illegal, err)
+	}
+	if q.Selector == nil {
+		return nil, fmt.Errorf("%w: missing selector", SoCallError_Query_Illegal)
+	}
+	sel, err := parseSelector(q.Selector)
+	if err != nil {
+		return nil, err
+	}
+	return &Query{selector: sel}, nil
+}
+
+func parseSelector(m map[string]interface{}) (*selector, error) {
+	sel := &selector{}
+	fields := make([]string, 0, len(m))
+	for f := range m {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	for _, f := range fields {
+		v := m[f]
+		switch f {
+		case "$and", "$or":
+			list, ok := v.([]interface{})
+			if !ok || len(list) == 0 {
+				return nil, fmt.Errorf("%w: %s needs an array of selectors", SoCallError_Query_Illegal, f)
+			}
+			for _, item := range list {
+				sm, ok := item.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%w: %s needs an array of selectors", SoCallError_Query_Illegal, f)
+				}
+				sub, err := parseSelector(sm)
+				if err != nil {
+					return nil, err
+				}
+				if f == "$and" {
+					sel.and = append(sel.and, sub)
+				} else {
+					sel.or = append(sel.or, sub)
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(f, "$") {
+			return nil, fmt.Errorf("%w: unknown operator %s", SoCallError_Query_Illegal, f)
+		}
+		path := strings.Split(f, ".")
+		ops, ok := v.(map[string]interface{})
+		if !ok || !isOperatorObject(ops) {
+			sel.conds = append(sel.conds, &condition{path: path, op: "$eq", value: v})
+			continue
+		}
+		names := make([]string, 0, len(ops))
+		for op := range ops {
+			names = append(names, op)
+		}
+		sort.Strings(names)
+		for _, op := range names {
+			arg := ops[op]
+			switch op {
+			case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+			case "$in":
+				if _, ok := arg.([]interface{}); !ok {
+					return nil, fmt.Errorf("%w: $in needs an array", SoCallError_Query_Illegal)
+				}
+			case "$exists":
+				if _, ok := arg.(bool); !ok {
+					return nil, fmt.Errorf("%w: $exists needs a bool", SoCallError_Query_Illegal)
+				}
+			default:
+				return nil, fmt.Errorf("%w: unknown operator %s", SoCallError_Query_Illegal, op)
+			}
+			sel.conds = append(sel.conds, &condition{path: path, op: op, value: arg})
+		}
+	}
+	return sel, nil
+}
+
+func isOperatorObject(m map[string]interface{}) bool {
+	if len(m) == 0 {
+		return false
+	}
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether value is a JSON object selected by the query.
+func (q *Query) Match(value []byte) bool {
+	doc, ok := decodeDocument(value)
+	return ok && q.selector.match(doc)
+}
+
+// Select returns the page of kvs, which must be in key order, selected by
+// the query. The page starts after the key in bookmark and holds up to
+// pageSize results, all of them if pageSize is 0.
+func (q *Query) Select(kvs []*KV, pageSize int32, bookmark string) ([]*KV, *QueryResponseMetadata) {
+	results := []*KV{}
+	md := &QueryResponseMetadata{}
+	for _, kv := range kvs {
+		if bookmark != "" && kv.Key <= bookmark {
+			continue
+		}
+		if !q.Match(kv.Value) {
+			continue
+		}
+		if pageSize > 0 && int32(len(results)) == pageSize {
+			md.HasMore = true
+			break
+		}
+		results = append(results, kv)
+	}
+	md.FetchedRecordsCount = int32(len(results))
+	if md.HasMore {
+		md.Bookmark = results[len(results)-1].Key
+	}
+	return results, md
+}
+
+func decodeDocument(value []byte) (map[string]interface{}, bool) {
+	if len(value) == 0 || value[0] != '{' {
+		return nil, false
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(value, &doc); err != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+func (sel *selector) match(doc map[string]interface{}) bool {
+	for _, c := range sel.conds {
+		if !c.match(doc) {
+			return false
+		}
+	}
+	for _, sub := range sel.and {
+		if !sub.match(doc) {
+			return false
+		}
+	}
+	if len(sel.or) == 0 {
+		return true
+	}
+	for _, sub := range sel.or {
+		if sub.match(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *condition) match(doc map[string]interface{}) bool {
+	v, ok := lookupField(doc, c.path)
+	return c.matchValue(v, ok)
+}
+
+// matchValue reports whether the field value v, ok is false if the field
+// is missing, meets the condition.
+func (c *condition) matchValue(v interface{}, ok bool) bool {
+	switch c.op {
+	case "$exists":
+		return ok == c.value.(bool)
+	case "$ne":
+		return !ok || compareJSON(v, c.value) != 0
+	}
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "$eq":
+		return compareJSON(v, c.value) == 0
+	case "$gt":
+		return sameRank(v, c.value) && compareJSON(v, c.value) > 0
+	case "$gte":
+		return sameRank(v, c.value) && compareJSON(v, c.value) >= 0
+	case "$lt":
+		return sameRank(v, c.value) && compareJSON(v, c.value) < 0
+	case "$lte":
+		return sameRank(v, c.value) && compareJSON(v, c.value) <= 0
+	case "$in":
+		for _, item := range c.value.([]interface{}) {
+			if compareJSON(v, item) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func lookupField(doc map[string]interface{}, path []string) (interface{}, bool) {
+	var v interface{} = doc
+	for _, p := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonRank orders the JSON types: null, bools, numbers, strings, arrays
+// and objects.
+func jsonRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	case []interface{}:
+		return 4
+	}
+	return 5
+}
+
+func sameRank(a, b interface{}) bool {
+	return jsonRank(a) == jsonRank(b)
+}
+
+// compareJSON totally orders decoded JSON values, arrays and objects are
+// compared by their encoding, which sorts object keys.
+func compareJSON(a, b interface{}) int {
+	ra, rb := jsonRank(a), jsonRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch x := a.(type) {
+	case nil:
+		return 0
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	case float64:
+		y := b.(float64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(x, b.(string))
+	}
+	ea, _ := json.Marshal(a)
+	eb, _ := json.Marshal(b)
+	return bytes.Compare(ea, eb)
+}
+
+// QueryPage is one page of a rich query as sent on the wire. Bookmark is
+// the last key of the page, it is only valid when HasMore is set.
+type QueryPage struct {
+	Results  []*KV
+	Bookmark string
+	HasMore  bool
+}
+
+// handleGetQueryResult runs a rich query against the DocumentStore of the
+// node and returns one rlp encoded QueryPage. The inputs are the query, the
+// page size and the bookmark. The store is local to the node, so only
+// read-only queries run by Registry.Query may use it, a transaction would
+// get different results on different nodes.
+func (h *Handler) handleGetQueryResult(message *CallSoSendMessage) *CallSoResMessage {
+	if len(message.inputs) != 3 || len(message.inputs[1]) != 8 {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Key_Value_NotMatch,
+		}
+	}
+	if !h.readOnly {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Rich_Query_Read_Only,
+		}
+	}
+	if h.docs == nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Rich_Query_Unavailable,
+		}
+	}
+	q, err := ParseQuery(string(message.inputs[0]))
+	if err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: err,
+		}
+	}
+	pageSize := int32(common.ByteToUint64(message.inputs[1]))
+	results, md, err := h.docs.query(message.address, q, pageSize, string(message.inputs[2]))
+	if err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: err,
+		}
+	}
+	size := 0
+	for _, kv := range results {
+		size += len(kv.Key) + len(kv.Value)
+	}
+	if err := h.meter.readRange(len(results), size); err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: err,
+		}
+	}
+	data, err := rlp.EncodeToBytes(&QueryPage{Results: results, Bookmark: md.Bookmark, HasMore: md.HasMore})
+	if err != nil {
+		return &CallSoResMessage{
+			res: nil,
+			err: SoCallError_Query_Encode_Error,
+		}
+	}
+	return &CallSoResMessage{
+		res: data,
+		err: nil,
+	}
+}
@@ -0,0 +1,97 @@
+package so
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	illegal := []string{
+		`not json`,
+		`{}`,
+		`{"selector": {"$nor": []}}`,
+		`{"selector": {"age": {"$regex": "x"}}}`,
+		`{"selector": {"age": {"$in": 1}}}`,
+		`{"selector": {"age": {"$exists": "yes"}}}`,
+		`{"selector": {"$and": {"age": 1}}}`,
+		`{"selector": {"$or": []}}`,
+		`{"selector": {"$or": [1]}}`,
+	}
+	for _, q := range illegal {
+		if _, err := ParseQuery(q); !errors.Is(err, SoCallError_Query_Illegal) {
+			t.Errorf("ParseQuery(%s) = %v, want %v", q, err, SoCallError_Query_Illegal)
+		}
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	doc := []byte(`{"name": "tom", "age": 30, "tags": ["a"], "owner": {"org": "org1"}, "ok": true, "none": null}`)
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{`{"selector": {}}`, true},
+		{`{"selector": {"name": "tom"}}`, true},
+		{`{"selector": {"name": "bob"}}`, false},
+		{`{"selector": {"age": 30, "name": "tom"}}`, true},
+		{`{"selector": {"age": {"$gt": 29, "$lte": 30}}}`, true},
+		{`{"selector": {"age": {"$gte": 31}}}`, false},
+		{`{"selector": {"age": {"$lt": "31"}}}`, false},
+		{`{"selector": {"name": {"$gt": "a", "$lt": "z"}}}`, true},
+		{`{"selector": {"name": {"$ne": "bob"}}}`, true},
+		{`{"selector": {"name": {"$in": ["bob", "tom"]}}}`, true},
+		{`{"selector": {"name": {"$in": ["bob"]}}}`, false},
+		{`{"selector": {"owner.org": "org1"}}`, true},
+		{`{"selector": {"owner": {"org": "org1"}}}`, true},
+		{`{"selector": {"owner.name": {"$exists": false}}}`, true},
+		{`{"selector": {"none": {"$exists": true}}}`, true},
+		{`{"selector": {"missing": {"$exists": true}}}`, false},
+		{`{"selector": {"tags": ["a"]}}`, true},
+		{`{"selector": {"ok": true}}`, true},
+		{`{"selector": {"$or": [{"name": "bob"}, {"age": 30}]}}`, true},
+		{`{"selector": {"$and": [{"name": "tom"}, {"age": 31}]}}`, false},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%s): %v", tt.query, err)
+		}
+		if got := q.Match(doc); got != tt.want {
+			t.Errorf("%s matches %v, want %v", tt.query, got, tt.want)
+		}
+	}
+	q, _ := ParseQuery(`{"selector": {}}`)
+	for _, value := range []string{"", "plain", "[1]", "{broken"} {
+		if q.Match([]byte(value)) {
+			t.Errorf("%q is matched as a document", value)
+		}
+	}
+}
+
+func TestQuerySelect(t *testing.T) {
+	q, _ := ParseQuery(`{"selector": {"n": {"$gte": 2}}}`)
+	var kvs []*KV
+	for _, kv := range [][2]string{{"a", `{"n": 1}`}, {"b", `{"n": 2}`}, {"c", "plain"}, {"d", `{"n": 3}`}, {"e", `{"n": 4}`}} {
+		kvs = append(kvs, &KV{Key: kv[0], Value: []byte(kv[1])})
+	}
+	var pages []string
+	bookmark := ""
+	for {
+		results, md := q.Select(kvs, 2, bookmark)
+		page := ""
+		for _, kv := range results {
+			page += kv.Key
+		}
+		pages = append(pages, page)
+		if int(md.FetchedRecordsCount) != len(results) {
+			t.Errorf("FetchedRecordsCount = %d for %d results", md.FetchedRecordsCount, len(results))
+		}
+		if !md.HasMore {
+			break
+		}
+		bookmark = md.Bookmark
+	}
+	if len(pages) != 2 || pages[0] != "bd" || pages[1] != "e" {
+		t.Errorf("pages = %q, want [bd e]", pages)
+	}
+}
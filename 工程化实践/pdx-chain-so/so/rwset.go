@@ -0,0 +1,254 @@
+package so
+
+import (
+	"sort"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+)
+
+// KVRead records a key read from committed state together with the hash of
+// the value seen, the zero hash when the key was absent.
+type KVRead struct {
+	Key       string
+	ValueHash common.Hash
+}
+
+// KVWrite records a pending write of a key, an empty value deletes the key.
+type KVWrite struct {
+	Key      string
+	Value    []byte
+	IsDelete bool
+}
+
+// PrivateWrite records a pending write of a private data key. Only the hash
+// of the value is kept, an empty hash deletes the key.
+type PrivateWrite struct {
+	Collection string
+	Key        string
+	ValueHash  common.Hash
+	IsDelete   bool
+}
+
+// RangeQueryInfo records a range query and the committed keys it returned.
+type RangeQueryInfo struct {
+	StartKey string
+	EndKey   string
+	Reads    []*KVRead
+}
+
+// NsRWSet is the read/write set of the invocations of one contract.
+type NsRWSet struct {
+	Address      common.Address
+	Reads        []*KVRead
+	RangeQueries []*RangeQueryInfo
+	Writes       []*KVWrite
+	// PrivateWrites are the writes of private data collections.
+	PrivateWrites []*PrivateWrite
+}
+
+// TxRWSet is the read/write set of a transaction, one NsRWSet per contract
+// in the order the contracts were first invoked. Only successful
+// invocations contribute to it.
+type TxRWSet struct {
+	NsRWSets []*NsRWSet
+}
+
+func newKVRead(key string, value []byte) *KVRead {
+	read := &KVRead{Key: key}
+	if len(value) > 0 {
+		read.ValueHash = crypto.Keccak256Hash(value)
+	}
+	return read
+}
+
+// ns returns the NsRWSet of addr, it is created when missing.
+func (set *TxRWSet) ns(addr common.Address) *NsRWSet {
+	for _, ns := range set.NsRWSets {
+		if ns.Address == addr {
+			return ns
+		}
+	}
+	ns := &NsRWSet{Address: addr}
+	set.NsRWSets = append(set.NsRWSets, ns)
+	return ns
+}
+
+// add merges the read/write set of an invocation. A key read again keeps
+// the first recorded read, a key written again keeps the last write.
+func (set *TxRWSet) add(inv *NsRWSet) {
+	ns := set.ns(inv.Address)
+	for _, read := range inv.Reads {
+		if !containsRead(ns.Reads, read.Key) && !containsWrite(ns.Writes, read.Key) {
+			ns.Reads = append(ns.Reads, read)
+		}
+	}
+	ns.RangeQueries = append(ns.RangeQueries, inv.RangeQueries...)
+	for _, write := range inv.Writes {
+		replaced := false
+		for i, w := range ns.Writes {
+			if w.Key == write.Key {
+				ns.Writes[i], replaced = write, true
+				break
+			}
+		}
+		if !replaced {
+			ns.Writes = append(ns.Writes, write)
+		}
+	}
+	sort.Slice(ns.Writes, func(i, j int) bool { return ns.Writes[i].Key < ns.Writes[j].Key })
+
+	for _, write := range inv.PrivateWrites {
+		replaced := false
+		for i, w := range ns.PrivateWrites {
+			if w.Collection == write.Collection && w.Key == write.Key {
+				ns.PrivateWrites[i], replaced = write, true
+				break
+			}
+		}
+		if !replaced {
+			ns.PrivateWrites = append(ns.PrivateWrites, write)
+		}
+	}
+	sort.Slice(ns.PrivateWrites, func(i, j int) bool { return ns.PrivateWrites[i].less(ns.PrivateWrites[j]) })
+}
+
+func (w *PrivateWrite) less(o *PrivateWrite) bool {
+	if w.Collection != o.Collection {
+		return w.Collection < o.Collection
+	}
+	return w.Key < o.Key
+}
+
+func containsRead(reads []*KVRead, key string) bool {
+	for _, r := range reads {
+		if r.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func containsWrite(writes []*KVWrite, key string) bool {
+	for _, w := range writes {
+		if w.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSet buffers the writes of an invocation and logs its reads of
+// committed state.
+type writeSet struct {
+	writes  map[string][]byte
+	private map[privateKey]privateValue
+	rwset   *NsRWSet
+}
+
+type privateKey struct {
+	collection string
+	key        string
+}
+
+// privateValue is a pending private value with its salt, an empty value
+// deletes the key.
+type privateValue struct {
+	salt  []byte
+	value []byte
+}
+
+func newWriteSet(addr common.Address) *writeSet {
+	return &writeSet{
+		writes:  make(map[string][]byte),
+		private: make(map[privateKey]privateValue),
+		rwset:   &NsRWSet{Address: addr},
+	}
+}
+
+// get returns the pending value of key, ok is false if key was not written.
+func (ws *writeSet) get(key string) (value []byte, ok bool) {
+	value, ok = ws.writes[key]
+	return
+}
+
+func (ws *writeSet) put(key string, value []byte) {
+	ws.writes[key] = common.CopyBytes(value)
+}
+
+// read logs a read of committed state, keys read before or written by the
+// invocation are not logged again.
+func (ws *writeSet) read(key string, value []byte) {
+	if _, ok := ws.writes[key]; ok || containsRead(ws.rwset.Reads, key) {
+		return
+	}
+	ws.rwset.Reads = append(ws.rwset.Reads, newKVRead(key, value))
+}
+
+// readRange logs a range query over committed state and merges the pending
+// writes in [startKey, endKey) into its results.
+func (ws *writeSet) readRange(startKey, endKey string, committed []*KV) []*KV {
+	info := &RangeQueryInfo{StartKey: startKey, EndKey: endKey}
+	merged := make(map[string][]byte, len(committed))
+	for _, kv := range committed {
+		info.Reads = append(info.Reads, newKVRead(kv.Key, kv.Value))
+		merged[kv.Key] = kv.Value
+	}
+	ws.rwset.RangeQueries = append(ws.rwset.RangeQueries, info)
+
+	for k, v := range ws.writes {
+		if k >= startKey && (endKey == "" || k < endKey) {
+			merged[k] = v
+		}
+	}
+	results := make([]*KV, 0, len(merged))
+	for k, v := range merged {
+		if len(v) > 0 {
+			results = append(results, &KV{Key: k, Value: v})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Key < results[j].Key })
+	return results
+}
+
+// sortedWrites returns the pending writes in key order, which is the order
+// they are committed in.
+func (ws *writeSet) sortedWrites() []*KVWrite {
+	writes := make([]*KVWrite, 0, len(ws.writes))
+	for k, v := range ws.writes {
+		writes = append(writes, &KVWrite{Key: k, Value: v, IsDelete: len(v) == 0})
+	}
+	sort.Slice(writes, func(i, j int) bool { return writes[i].Key < writes[j].Key })
+	return writes
+}
+
+// getPrivate returns the pending private value of key in collection, ok is
+// false if it was not written.
+func (ws *writeSet) getPrivate(collection, key string) (pv privateValue, ok bool) {
+	pv, ok = ws.private[privateKey{collection, key}]
+	return
+}
+
+func (ws *writeSet) putPrivate(collection, key string, salt, value []byte) {
+	ws.private[privateKey{collection, key}] = privateValue{common.CopyBytes(salt), common.CopyBytes(value)}
+}
+
+// sortedPrivateWrites returns the pending private writes in collection and
+// key order together with their salts and values, which are never part of
+// the read/write set.
+func (ws *writeSet) sortedPrivateWrites() ([]*PrivateWrite, []privateValue) {
+	writes := make([]*PrivateWrite, 0, len(ws.private))
+	for k, pv := range ws.private {
+		w := &PrivateWrite{Collection: k.collection, Key: k.key, IsDelete: len(pv.value) == 0}
+		if len(pv.value) > 0 {
+			w.ValueHash = PrivateDataHash(pv.salt, pv.value)
+		}
+		writes = append(writes, w)
+	}
+	sort.Slice(writes, func(i, j int) bool { return writes[i].less(writes[j]) })
+	values := make([]privateValue, len(writes))
+	for i, w := range writes {
+		values[i] = ws.private[privateKey{w.Collection, w.Key}]
+	}
+	return writes, values
+}
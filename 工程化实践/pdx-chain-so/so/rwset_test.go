@@ -0,0 +1,99 @@
+package so
+
+import (
+	"errors"
+	"testing"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+)
+
+func TestWriteSetReadYourWrites(t *testing.T) {
+	db := newTestMStateDB(t)
+	putStates(t, db, "k", "old", "gone", "x")
+
+	stub := NewSoCallStub(NewHandler(db), nil, testAddr)
+	if v, err := stub.GetState([]byte("k")); err != nil || string(v) != "old" {
+		t.Fatalf("GetState = %q, %v", v, err)
+	}
+	stub.PutState([]byte("k"), []byte("new"))
+	stub.PutState([]byte("n"), []byte("1"))
+	stub.DelState([]byte("gone"))
+	if v, err := stub.GetState([]byte("k")); err != nil || string(v) != "new" {
+		t.Errorf("GetState of a pending write = %q, %v", v, err)
+	}
+	if _, err := stub.GetState([]byte("gone")); err != SoCallError_NoResult {
+		t.Errorf("GetState of a pending delete = %v, want %v", err, SoCallError_NoResult)
+	}
+	if got := rangeKeys(t, stub, "", ""); len(got) != 2 || got[0] != "k=new" || got[1] != "n=1" {
+		t.Errorf("range over pending writes = %q", got)
+	}
+	if getTestState(db, testAddr, "k") != "old" {
+		t.Error("a pending write reached the state before Commit")
+	}
+
+	set := stub.RWSet()
+	if len(set.Reads) != 1 || set.Reads[0].Key != "k" || set.Reads[0].ValueHash != crypto.Keccak256Hash([]byte("old")) {
+		t.Errorf("reads = %+v", set.Reads)
+	}
+	if len(set.RangeQueries) != 1 || len(set.RangeQueries[0].Reads) != 2 {
+		t.Errorf("range queries = %+v", set.RangeQueries)
+	}
+	var keys []string
+	for _, w := range set.Writes {
+		keys = append(keys, w.Key)
+	}
+	if len(keys) != 3 || keys[0] != "gone" || !set.Writes[0].IsDelete || keys[1] != "k" || keys[2] != "n" {
+		t.Errorf("writes = %q", keys)
+	}
+
+	if err := stub.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if getTestState(db, testAddr, "k") != "new" || getTestState(db, testAddr, "gone") != "" {
+		t.Error("Commit did not write the pending writes")
+	}
+}
+
+func TestInvokeRWSet(t *testing.T) {
+	db := newTestMStateDB(t)
+	r := NewRegistry()
+	callee := common.HexToAddress("0xce")
+	deployTestContract(t, r, db, testAddr)
+	deployTestContract(t, r, db, callee)
+
+	res, err := r.Invoke(db, testAddr, nil, testArgs("put", "b", "2", "a", "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.RWSet.NsRWSets) != 1 {
+		t.Fatalf("read/write set = %+v", res.RWSet)
+	}
+	if ws := res.RWSet.NsRWSets[0].Writes; len(ws) != 2 || ws[0].Key != "a" || ws[1].Key != "b" {
+		t.Errorf("writes are not in key order: %+v", ws)
+	}
+
+	res, err = r.Invoke(db, testAddr, nil, testArgs("get", "missing"))
+	if !errors.Is(err, SoCallError_NoResult) || len(res.RWSet.NsRWSets) != 0 {
+		t.Errorf("failed get = %v, read/write set %+v", err, res.RWSet)
+	}
+
+	//失败的被调合约不计入读写集
+	res, err = r.Invoke(db, testAddr, nil, testArgs("invokeIgnoringError", callee.Hex(), "putThenFail", "k", "v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sets := res.RWSet.NsRWSets; len(sets) != 1 || sets[0].Address != testAddr {
+		t.Errorf("read/write set after a failed callee = %+v", sets)
+	}
+
+	for _, fn := range []string{"putThenFail", "putThenPanic"} {
+		res, err := r.Invoke(db, testAddr, nil, testArgs(fn, "a", "lost"))
+		if err == nil || len(res.RWSet.NsRWSets) != 0 {
+			t.Errorf("%s = %v, read/write set %+v", fn, err, res.RWSet)
+		}
+		if getTestState(db, testAddr, "a") != "1" {
+			t.Errorf("write of %s was kept", fn)
+		}
+	}
+}
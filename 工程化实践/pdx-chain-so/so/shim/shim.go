@@ -0,0 +1,212 @@
+// Package shim runs an SO contract in a process of its own. The process
+// connects back to the node over SM2 TLS and runs the invocations the node
+// sends it, the stub calls of the contract are forwarded to the node. A
+// contract written against so.Call runs unchanged:
+//
+//	func main() {
+//		if err := shim.Start(&SimpleDemo{}); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+package shim
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/gmtls"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/gmtls/gmcredentials"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/so"
+	"pdx-chain-so/so/sopb"
+)
+
+// Environment variables read by Start, the node sets them for the
+// processes it launches.
+const (
+	// EnvPeerAddress is the host:port of the ContractSupport service.
+	EnvPeerAddress = "SO_PEER_ADDRESS"
+	// EnvContractName is the name the contract registers as.
+	EnvContractName = "SO_CONTRACT_NAME"
+	// EnvContractToken is the one-time token the node accepts the
+	// registration of the process with.
+	EnvContractToken = "SO_CONTRACT_TOKEN"
+	// EnvRootCert is the CA certificate file the node is verified with.
+	EnvRootCert = "SO_TLS_ROOT_CERT"
+	// EnvCert and EnvKey are the certificate and key files the process
+	// authenticates with.
+	EnvCert = "SO_TLS_CERT"
+	EnvKey  = "SO_TLS_KEY"
+	// EnvServerName is the name in the certificate of the node, the host of
+	// EnvPeerAddress if unset.
+	EnvServerName = "SO_TLS_SERVER_NAME"
+)
+
+// Start connects to the node as configured by the environment and runs the
+// invocations of call until the connection is lost.
+func Start(call so.Call) error {
+	creds, err := ClientCredentials(os.Getenv(EnvCert), os.Getenv(EnvKey), os.Getenv(EnvRootCert), os.Getenv(EnvServerName))
+	if err != nil {
+		return err
+	}
+	return Serve(os.Getenv(EnvPeerAddress), os.Getenv(EnvContractName), os.Getenv(EnvContractToken), creds, call)
+}
+
+// ClientCredentials returns the SM2 TLS credentials of a contract process
+// authenticating with the given key pair and trusting the CA in caFile.
+func ClientCredentials(certFile, keyFile, caFile, serverName string) (credentials.TransportCredentials, error) {
+	cert, err := gmtls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("shim: no certificate in %s", caFile)
+	}
+	return gmcredentials.NewTLS(&gmtls.Config{
+		GMSupport:    &gmtls.GMSupport{},
+		ServerName:   serverName,
+		Certificates: []gmtls.Certificate{cert},
+		RootCAs:      pool,
+	}), nil
+}
+
+// Serve registers call as name with the node at address, presenting the
+// token the node handed out for the process, and runs its invocations until
+// the connection is lost.
+func Serve(address string, name string, token string, creds credentials.TransportCredentials, call so.Call) error {
+	if address == "" || name == "" {
+		return fmt.Errorf("shim: %s and %s must be set", EnvPeerAddress, EnvContractName)
+	}
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stream, err := sopb.NewContractSupportClient(conn).Register(context.Background())
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&sopb.SoMessage{Type: sopb.SoMessage_REGISTER, Payload: []byte(name), Inputs: [][]byte{[]byte(token)}}); err != nil {
+		return err
+	}
+	msg, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if msg.Type != sopb.SoMessage_REGISTERED {
+		return fmt.Errorf("shim: expected REGISTERED, got %s", msg.Type)
+	}
+
+	h := &handler{
+		stream:   stream,
+		call:     call,
+		inflight: make(map[uint64]chan *sopb.SoMessage),
+		done:     make(chan struct{}),
+	}
+	defer close(h.done)
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		switch msg.Type {
+		case sopb.SoMessage_INVOKE, sopb.SoMessage_INIT, sopb.SoMessage_UPGRADE:
+			go h.invoke(msg, h.open(msg.Id))
+		case sopb.SoMessage_RESPONSE, sopb.SoMessage_ERROR:
+			h.deliver(msg)
+		}
+	}
+}
+
+// handler runs the invocations sent on the stream, each in its own
+// goroutine, and routes the replies of the node to them.
+type handler struct {
+	stream sopb.ContractSupport_RegisterClient
+	sendMu sync.Mutex
+	call   so.Call
+
+	mu       sync.Mutex
+	inflight map[uint64]chan *sopb.SoMessage
+	done     chan struct{}
+}
+
+func (h *handler) send(msg *sopb.SoMessage) error {
+	h.sendMu.Lock()
+	defer h.sendMu.Unlock()
+	return h.stream.Send(msg)
+}
+
+func (h *handler) open(id uint64) chan *sopb.SoMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch := make(chan *sopb.SoMessage, 1)
+	h.inflight[id] = ch
+	return ch
+}
+
+func (h *handler) deliver(msg *sopb.SoMessage) {
+	h.mu.Lock()
+	ch, ok := h.inflight[msg.Id]
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case ch <- msg:
+	default:
+	}
+}
+
+// invoke runs the invocation started by msg and sends its response.
+func (h *handler) invoke(msg *sopb.SoMessage, replies chan *sopb.SoMessage) {
+	defer func() {
+		h.mu.Lock()
+		delete(h.inflight, msg.Id)
+		h.mu.Unlock()
+	}()
+	stub := &Stub{handler: h, id: msg.Id, txID: msg.Txid, args: msg.Inputs, replies: replies}
+	res := run(func() so.Response {
+		switch msg.Type {
+		case sopb.SoMessage_INIT:
+			if init, ok := h.call.(so.Initializer); ok {
+				return init.Init(stub)
+			}
+			return so.Success(nil)
+		case sopb.SoMessage_UPGRADE:
+			if up, ok := h.call.(so.Upgrader); ok {
+				return up.Upgrade(stub, string(msg.Payload))
+			}
+			return so.Success(nil)
+		}
+		return h.call.Run(stub)
+	})
+	h.send(&sopb.SoMessage{
+		Type:    sopb.SoMessage_COMPLETED,
+		Id:      msg.Id,
+		Payload: res.Payload,
+		Status:  res.Status,
+		Message: res.Message,
+	})
+}
+
+// run calls the contract and turns a panic into an InternalError response,
+// as the registry of the node does for plugins.
+func run(fn func() so.Response) (res so.Response) {
+	defer func() {
+		if r := recover(); r != nil {
+			res = so.FromError(fmt.Errorf("%w: %v", so.SoCallError_Contract_Panic, r))
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,305 @@
+package shim
+
+import (
+	"errors"
+	"strconv"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/rlp"
+	"pdx-chain-so/so"
+	"pdx-chain-so/so/sopb"
+)
+
+var errConnectionLost = errors.New("shim: connection to the node is lost")
+
+// Stub is the so.StubInterface of an invocation in a contract process. The
+// arguments, the transaction id and composite keys are served locally,
+// every other call is a request to the stub of the node.
+type Stub struct {
+	handler *handler
+	id      uint64
+	txID    string
+	args    [][]byte
+	replies chan *sopb.SoMessage
+}
+
+var _ so.StubInterface = (*Stub)(nil)
+
+// request sends a request of the invocation and waits for its reply. An
+// ERROR reply returns the error of the stub of the node.
+func (s *Stub) request(typ sopb.SoMessage_Type, inputs ...[]byte) ([]byte, error) {
+	err := s.handler.send(&sopb.SoMessage{Type: typ, Id: s.id, Inputs: inputs})
+	if err != nil {
+		return nil, errConnectionLost
+	}
+	select {
+	case msg := <-s.replies:
+		if msg.Type == sopb.SoMessage_ERROR {
+			return nil, so.Response{Status: msg.Status, Message: msg.Message}.Err()
+		}
+		return msg.Payload, nil
+	case <-s.handler.done:
+		return nil, errConnectionLost
+	}
+}
+
+func (s *Stub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *Stub) GetStringArgs() []string {
+	args := make([]string, len(s.args))
+	for i, a := range s.args {
+		args[i] = string(a)
+	}
+	return args
+}
+
+func (s *Stub) GetFunctionAndParameters() (string, [][]byte) {
+	if len(s.args) == 0 {
+		return "", [][]byte{}
+	}
+	return string(s.args[0]), s.args[1:]
+}
+
+func (s *Stub) GetTxID() string {
+	return s.txID
+}
+
+func (s *Stub) GetTxTimestamp() (uint64, error) {
+	return s.requestUint64(sopb.SoMessage_GET_TX_TIMESTAMP)
+}
+
+func (s *Stub) GetBlockNumber() (uint64, error) {
+	return s.requestUint64(sopb.SoMessage_GET_BLOCK_NUMBER)
+}
+
+func (s *Stub) requestUint64(typ sopb.SoMessage_Type) (uint64, error) {
+	res, err := s.request(typ)
+	if err != nil {
+		return 0, err
+	}
+	if len(res) != 8 {
+		return 0, so.SoCallError_Input_Error
+	}
+	return common.ByteToUint64(res), nil
+}
+
+func (s *Stub) GetCreator() ([]byte, error) {
+	return s.request(sopb.SoMessage_GET_CREATOR)
+}
+
+func (s *Stub) GetCallerOrg() (string, error) {
+	res, err := s.request(sopb.SoMessage_GET_CALLER_ORG)
+	return string(res), err
+}
+
+func (s *Stub) GetTransient() (map[string][]byte, error) {
+	res, err := s.request(sopb.SoMessage_GET_TRANSIENT)
+	if err != nil {
+		return nil, err
+	}
+	var kvs []*so.KV
+	if err := rlp.DecodeBytes(res, &kvs); err != nil {
+		return nil, so.SoCallError_Input_Error
+	}
+	transient := make(map[string][]byte, len(kvs))
+	for _, kv := range kvs {
+		transient[kv.Key] = kv.Value
+	}
+	return transient, nil
+}
+
+func (s *Stub) GetState(key []byte) ([]byte, error) {
+	return s.request(sopb.SoMessage_GET_STATE, key)
+}
+
+func (s *Stub) GetStateWithProof(key []byte) (*so.StateProof, error) {
+	res, err := s.request(sopb.SoMessage_GET_STATE_WITH_PROOF, key)
+	if err != nil {
+		return nil, err
+	}
+	p := new(so.StateProof)
+	if err := rlp.DecodeBytes(res, p); err != nil {
+		return nil, so.SoCallError_Proof_Unavailable
+	}
+	return p, nil
+}
+
+func (s *Stub) PutState(key []byte, value []byte) error {
+	_, err := s.request(sopb.SoMessage_PUT_STATE, key, value)
+	return err
+}
+
+func (s *Stub) DelState(key []byte) error {
+	_, err := s.request(sopb.SoMessage_DEL_STATE, key)
+	return err
+}
+
+func (s *Stub) GetKeyPolicy(key string) (*so.Policy, error) {
+	res, err := s.request(sopb.SoMessage_GET_KEY_POLICY, []byte(key))
+	if err != nil || len(res) == 0 {
+		return nil, err
+	}
+	policy := new(so.Policy)
+	if err := rlp.DecodeBytes(res, policy); err != nil {
+		return nil, so.SoCallError_Policy_Illegal
+	}
+	return policy, nil
+}
+
+func (s *Stub) SetKeyPolicy(key string, policy *so.Policy) error {
+	return s.setPolicy(sopb.SoMessage_SET_KEY_POLICY, key, policy)
+}
+
+func (s *Stub) SetPrefixPolicy(prefix string, policy *so.Policy) error {
+	return s.setPolicy(sopb.SoMessage_SET_PREFIX_POLICY, prefix, policy)
+}
+
+// setPolicy sends a policy rlp encoded, a nil policy as empty bytes.
+func (s *Stub) setPolicy(typ sopb.SoMessage_Type, key string, policy *so.Policy) error {
+	var enc []byte
+	if policy != nil {
+		var err error
+		if enc, err = rlp.EncodeToBytes(policy); err != nil {
+			return err
+		}
+	}
+	_, err := s.request(typ, []byte(key), enc)
+	return err
+}
+
+func (s *Stub) PutPrivateData(collection string, key string, value []byte) error {
+	_, err := s.request(sopb.SoMessage_PUT_PRIVATE_DATA, []byte(collection), []byte(key), value)
+	return err
+}
+
+func (s *Stub) GetPrivateData(collection string, key string) ([]byte, error) {
+	return s.request(sopb.SoMessage_GET_PRIVATE_DATA, []byte(collection), []byte(key))
+}
+
+func (s *Stub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	return s.request(sopb.SoMessage_GET_PRIVATE_DATA_HASH, []byte(collection), []byte(key))
+}
+
+func (s *Stub) DelPrivateData(collection string, key string) error {
+	_, err := s.request(sopb.SoMessage_DEL_PRIVATE_DATA, []byte(collection), []byte(key))
+	return err
+}
+
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	_, err := s.request(sopb.SoMessage_SET_EVENT, []byte(name), payload)
+	return err
+}
+
+func (s *Stub) InvokeContract(address common.Address, args [][]byte) ([]byte, error) {
+	return s.request(sopb.SoMessage_INVOKE_CONTRACT, append([][]byte{address.Bytes()}, args...)...)
+}
+
+func (s *Stub) GetHistoryForKey(key string, start, end uint64) (so.HistoryQueryIteratorInterface, error) {
+	page, err := s.getHistoryPage(key, start, end, 0, "", so.HistoryNewestFirst)
+	if err != nil {
+		return nil, err
+	}
+	return so.NewPagedHistoryQueryIterator(page, func(bookmark string) (*so.HistoryPage, error) {
+		return s.getHistoryPage(key, start, end, 0, bookmark, so.HistoryNewestFirst)
+	}), nil
+}
+
+func (s *Stub) GetHistoryForKeyWithPagination(key string, start, end uint64, pageSize int32, bookmark string, order so.HistoryOrder) (so.HistoryQueryIteratorInterface, *so.QueryResponseMetadata, error) {
+	page, err := s.getHistoryPage(key, start, end, pageSize, bookmark, order)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata := &so.QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(page.Records)),
+		HasMore:             page.HasMore,
+	}
+	if page.HasMore {
+		metadata.Bookmark = strconv.FormatUint(page.Bookmark, 10)
+	}
+	return so.NewHistoryQueryIterator(page.Records), metadata, nil
+}
+
+func (s *Stub) getHistoryPage(key string, start, end uint64, pageSize int32, bookmark string, order so.HistoryOrder) (*so.HistoryPage, error) {
+	if pageSize < 0 {
+		return nil, so.SoCallError_Input_Error
+	}
+	res, err := s.request(sopb.SoMessage_GET_HISTORY,
+		[]byte(key),
+		common.Uint64ToByte(start),
+		common.Uint64ToByte(end),
+		common.Uint64ToByte(uint64(pageSize)),
+		[]byte(bookmark),
+		[]byte{byte(order)},
+	)
+	if err != nil {
+		return nil, err
+	}
+	page := new(so.HistoryPage)
+	if err := rlp.DecodeBytes(res, page); err != nil {
+		return nil, so.SoCallError_History_Encode_Error
+	}
+	return page, nil
+}
+
+func (s *Stub) GetStateByRange(startKey, endKey string) (so.StateQueryIteratorInterface, error) {
+	return s.getKVs(sopb.SoMessage_GET_STATE_BY_RANGE, []byte(startKey), []byte(endKey))
+}
+
+func (s *Stub) GetStateByPrefix(prefix string) (so.StateQueryIteratorInterface, error) {
+	return s.getKVs(sopb.SoMessage_GET_STATE_BY_PREFIX, []byte(prefix))
+}
+
+func (s *Stub) GetStateByPartialCompositeKey(objectType string, attributes []string) (so.StateQueryIteratorInterface, error) {
+	inputs := [][]byte{[]byte(objectType)}
+	for _, a := range attributes {
+		inputs = append(inputs, []byte(a))
+	}
+	return s.getKVs(sopb.SoMessage_GET_STATE_BY_PARTIAL_COMPOSITE_KEY, inputs...)
+}
+
+func (s *Stub) getKVs(typ sopb.SoMessage_Type, inputs ...[]byte) (so.StateQueryIteratorInterface, error) {
+	res, err := s.request(typ, inputs...)
+	if err != nil {
+		return nil, err
+	}
+	var results []*so.KV
+	if err := rlp.DecodeBytes(res, &results); err != nil {
+		return nil, so.SoCallError_Range_Encode_Error
+	}
+	return so.NewStateQueryIterator(results), nil
+}
+
+func (s *Stub) GetQueryResult(query string) (so.StateQueryIteratorInterface, error) {
+	it, _, err := s.GetQueryResultWithPagination(query, 0, "")
+	return it, err
+}
+
+func (s *Stub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (so.StateQueryIteratorInterface, *so.QueryResponseMetadata, error) {
+	if pageSize < 0 {
+		return nil, nil, so.SoCallError_Input_Error
+	}
+	res, err := s.request(sopb.SoMessage_GET_QUERY_RESULT, []byte(query), common.Uint64ToByte(uint64(pageSize)), []byte(bookmark))
+	if err != nil {
+		return nil, nil, err
+	}
+	page := new(so.QueryPage)
+	if err := rlp.DecodeBytes(res, page); err != nil {
+		return nil, nil, so.SoCallError_Query_Encode_Error
+	}
+	metadata := &so.QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(page.Results)),
+		Bookmark:            page.Bookmark,
+		HasMore:             page.HasMore,
+	}
+	return so.NewStateQueryIterator(page.Results), metadata, nil
+}
+
+func (s *Stub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return so.CreateCompositeKey(objectType, attributes)
+}
+
+func (s *Stub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	return so.SplitCompositeKey(compositeKey)
+}
@@ -0,0 +1,405 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: so.proto
+
+package sopb
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type SoMessage_Type int32
+
+const (
+	SoMessage_UNDEFINED SoMessage_Type = 0
+	// Requests of the contract, numbered as the messages of the
+	// in-process handler where it has one.
+	SoMessage_GET_STATE                          SoMessage_Type = 1
+	SoMessage_PUT_STATE                          SoMessage_Type = 2
+	SoMessage_DEL_STATE                          SoMessage_Type = 4
+	SoMessage_GET_HISTORY                        SoMessage_Type = 5
+	SoMessage_GET_STATE_BY_RANGE                 SoMessage_Type = 6
+	SoMessage_SET_EVENT                          SoMessage_Type = 7
+	SoMessage_PUT_PRIVATE_DATA                   SoMessage_Type = 8
+	SoMessage_GET_PRIVATE_DATA                   SoMessage_Type = 9
+	SoMessage_GET_PRIVATE_DATA_HASH              SoMessage_Type = 10
+	SoMessage_GET_KEY_POLICY                     SoMessage_Type = 11
+	SoMessage_SET_KEY_POLICY                     SoMessage_Type = 12
+	SoMessage_GET_QUERY_RESULT                   SoMessage_Type = 13
+	SoMessage_DEL_PRIVATE_DATA                   SoMessage_Type = 14
+	SoMessage_GET_STATE_BY_PREFIX                SoMessage_Type = 15
+	SoMessage_GET_STATE_BY_PARTIAL_COMPOSITE_KEY SoMessage_Type = 16
+	SoMessage_SET_PREFIX_POLICY                  SoMessage_Type = 17
+	SoMessage_INVOKE_CONTRACT                    SoMessage_Type = 18
+	SoMessage_GET_TX_TIMESTAMP                   SoMessage_Type = 19
+	SoMessage_GET_BLOCK_NUMBER                   SoMessage_Type = 20
+	SoMessage_GET_CREATOR                        SoMessage_Type = 21
+	SoMessage_GET_CALLER_ORG                     SoMessage_Type = 22
+	SoMessage_GET_STATE_WITH_PROOF               SoMessage_Type = 23
+	SoMessage_GET_TRANSIENT                      SoMessage_Type = 24
+	// Control messages.
+	SoMessage_REGISTER   SoMessage_Type = 32
+	SoMessage_REGISTERED SoMessage_Type = 33
+	SoMessage_INVOKE     SoMessage_Type = 34
+	SoMessage_INIT       SoMessage_Type = 35
+	SoMessage_UPGRADE    SoMessage_Type = 36
+	SoMessage_COMPLETED  SoMessage_Type = 37
+	SoMessage_RESPONSE   SoMessage_Type = 38
+	SoMessage_ERROR      SoMessage_Type = 39
+)
+
+var SoMessage_Type_name = map[int32]string{
+	0:  "UNDEFINED",
+	1:  "GET_STATE",
+	2:  "PUT_STATE",
+	4:  "DEL_STATE",
+	5:  "GET_HISTORY",
+	6:  "GET_STATE_BY_RANGE",
+	7:  "SET_EVENT",
+	8:  "PUT_PRIVATE_DATA",
+	9:  "GET_PRIVATE_DATA",
+	10: "GET_PRIVATE_DATA_HASH",
+	11: "GET_KEY_POLICY",
+	12: "SET_KEY_POLICY",
+	13: "GET_QUERY_RESULT",
+	14: "DEL_PRIVATE_DATA",
+	15: "GET_STATE_BY_PREFIX",
+	16: "GET_STATE_BY_PARTIAL_COMPOSITE_KEY",
+	17: "SET_PREFIX_POLICY",
+	18: "INVOKE_CONTRACT",
+	19: "GET_TX_TIMESTAMP",
+	20: "GET_BLOCK_NUMBER",
+	21: "GET_CREATOR",
+	22: "GET_CALLER_ORG",
+	23: "GET_STATE_WITH_PROOF",
+	24: "GET_TRANSIENT",
+	32: "REGISTER",
+	33: "REGISTERED",
+	34: "INVOKE",
+	35: "INIT",
+	36: "UPGRADE",
+	37: "COMPLETED",
+	38: "RESPONSE",
+	39: "ERROR",
+}
+
+var SoMessage_Type_value = map[string]int32{
+	"UNDEFINED":                          0,
+	"GET_STATE":                          1,
+	"PUT_STATE":                          2,
+	"DEL_STATE":                          4,
+	"GET_HISTORY":                        5,
+	"GET_STATE_BY_RANGE":                 6,
+	"SET_EVENT":                          7,
+	"PUT_PRIVATE_DATA":                   8,
+	"GET_PRIVATE_DATA":                   9,
+	"GET_PRIVATE_DATA_HASH":              10,
+	"GET_KEY_POLICY":                     11,
+	"SET_KEY_POLICY":                     12,
+	"GET_QUERY_RESULT":                   13,
+	"DEL_PRIVATE_DATA":                   14,
+	"GET_STATE_BY_PREFIX":                15,
+	"GET_STATE_BY_PARTIAL_COMPOSITE_KEY": 16,
+	"SET_PREFIX_POLICY":                  17,
+	"INVOKE_CONTRACT":                    18,
+	"GET_TX_TIMESTAMP":                   19,
+	"GET_BLOCK_NUMBER":                   20,
+	"GET_CREATOR":                        21,
+	"GET_CALLER_ORG":                     22,
+	"GET_STATE_WITH_PROOF":               23,
+	"GET_TRANSIENT":                      24,
+	"REGISTER":                           32,
+	"REGISTERED":                         33,
+	"INVOKE":                             34,
+	"INIT":                               35,
+	"UPGRADE":                            36,
+	"COMPLETED":                          37,
+	"RESPONSE":                           38,
+	"ERROR":                              39,
+}
+
+func (x SoMessage_Type) String() string {
+	return proto.EnumName(SoMessage_Type_name, int32(x))
+}
+
+func (SoMessage_Type) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_ead6f9c22e920688, []int{0, 0}
+}
+
+// SoMessage is sent in both directions on the stream between the node and
+// a contract process. The node starts an invocation with INVOKE, INIT or
+// UPGRADE, the contract calls its stub with the request types, each
+// answered by RESPONSE or ERROR, and ends the invocation with COMPLETED.
+// Every message of an invocation carries its id.
+type SoMessage struct {
+	Type SoMessage_Type `protobuf:"varint,1,opt,name=type,proto3,enum=sopb.SoMessage_Type" json:"type,omitempty"`
+	// id of the invocation, unique among the invocations in flight on the
+	// stream.
+	Id uint64 `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`
+	// txid is the hex encoded hash of the transaction, set on INVOKE, INIT
+	// and UPGRADE.
+	Txid string `protobuf:"bytes,3,opt,name=txid,proto3" json:"txid,omitempty"`
+	// inputs are the arguments of a request or of an invocation, or the
+	// registration token of the process on REGISTER.
+	Inputs [][]byte `protobuf:"bytes,4,rep,name=inputs,proto3" json:"inputs,omitempty"`
+	// payload is the result of a request, the payload of a COMPLETED
+	// response, the name of the contract on REGISTER or the version
+	// replaced on UPGRADE.
+	Payload []byte `protobuf:"bytes,5,opt,name=payload,proto3" json:"payload,omitempty"`
+	// status and message describe the error of an ERROR message or the
+	// response of a COMPLETED invocation.
+	Status               int32    `protobuf:"varint,6,opt,name=status,proto3" json:"status,omitempty"`
+	Message              string   `protobuf:"bytes,7,opt,name=message,proto3" json:"message,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SoMessage) Reset()         { *m = SoMessage{} }
+func (m *SoMessage) String() string { return proto.CompactTextString(m) }
+func (*SoMessage) ProtoMessage()    {}
+func (*SoMessage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_ead6f9c22e920688, []int{0}
+}
+
+func (m *SoMessage) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SoMessage.Unmarshal(m, b)
+}
+func (m *SoMessage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SoMessage.Marshal(b, m, deterministic)
+}
+func (m *SoMessage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SoMessage.Merge(m, src)
+}
+func (m *SoMessage) XXX_Size() int {
+	return xxx_messageInfo_SoMessage.Size(m)
+}
+func (m *SoMessage) XXX_DiscardUnknown() {
+	xxx_messageInfo_SoMessage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SoMessage proto.InternalMessageInfo
+
+func (m *SoMessage) GetType() SoMessage_Type {
+	if m != nil {
+		return m.Type
+	}
+	return SoMessage_UNDEFINED
+}
+
+func (m *SoMessage) GetId() uint64 {
+	if m != nil {
+		return m.Id
+	}
+	return 0
+}
+
+func (m *SoMessage) GetTxid() string {
+	if m != nil {
+		return m.Txid
+	}
+	return ""
+}
+
+func (m *SoMessage) GetInputs() [][]byte {
+	if m != nil {
+		return m.Inputs
+	}
+	return nil
+}
+
+func (m *SoMessage) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *SoMessage) GetStatus() int32 {
+	if m != nil {
+		return m.Status
+	}
+	return 0
+}
+
+func (m *SoMessage) GetMessage() string {
+	if m != nil {
+		return m.Message
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterEnum("sopb.SoMessage_Type", SoMessage_Type_name, SoMessage_Type_value)
+	proto.RegisterType((*SoMessage)(nil), "sopb.SoMessage")
+}
+
+func init() { proto.RegisterFile("so.proto", fileDescriptor_ead6f9c22e920688) }
+
+var fileDescriptor_ead6f9c22e920688 = []byte{
+	// 573 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x93, 0xdf, 0x6e, 0xda, 0x4c,
+	0x10, 0xc5, 0x63, 0x62, 0xfe, 0x4d, 0x08, 0x6c, 0x26, 0x24, 0xf1, 0xf7, 0x5d, 0x51, 0xda, 0xa6,
+	0xbe, 0x42, 0x55, 0xfa, 0x04, 0x8e, 0x99, 0xc0, 0x2a, 0xc6, 0x76, 0x67, 0x97, 0x34, 0x5c, 0x59,
+	0xa4, 0xa0, 0x08, 0xa9, 0x8d, 0x2d, 0xec, 0x48, 0xcd, 0x23, 0xf5, 0xd1, 0xfa, 0x16, 0xd5, 0x12,
+	0x9c, 0x0a, 0xee, 0xfc, 0x3b, 0x3b, 0x67, 0xe6, 0x8c, 0x57, 0x0b, 0x8d, 0x3c, 0x1d, 0x64, 0xeb,
+	0xb4, 0x48, 0xd1, 0xce, 0xd3, 0xec, 0xa1, 0xff, 0xbb, 0x06, 0x4d, 0x95, 0x4e, 0x96, 0x79, 0x3e,
+	0x7f, 0x5c, 0xa2, 0x0b, 0x76, 0xf1, 0x92, 0x2d, 0x1d, 0xab, 0x67, 0xb9, 0xed, 0xab, 0xee, 0xc0,
+	0x94, 0x0c, 0xde, 0x8e, 0x07, 0xfa, 0x25, 0x5b, 0xf2, 0xa6, 0x02, 0xdb, 0x50, 0x59, 0x2d, 0x9c,
+	0x4a, 0xcf, 0x72, 0x6d, 0xae, 0xac, 0x16, 0x88, 0x60, 0x17, 0xbf, 0x56, 0x0b, 0xe7, 0xb0, 0x67,
+	0xb9, 0x4d, 0xde, 0x7c, 0xe3, 0x39, 0xd4, 0x56, 0x4f, 0xd9, 0x73, 0x91, 0x3b, 0x76, 0xef, 0xd0,
+	0x6d, 0xf1, 0x96, 0xd0, 0x81, 0x7a, 0x36, 0x7f, 0xf9, 0x91, 0xce, 0x17, 0x4e, 0xb5, 0x67, 0xb9,
+	0x2d, 0x2e, 0xd1, 0x38, 0xf2, 0x62, 0x5e, 0x3c, 0xe7, 0x4e, 0xad, 0x67, 0xb9, 0x55, 0xde, 0x92,
+	0x71, 0xfc, 0x7c, 0xcd, 0xe0, 0xd4, 0x37, 0x03, 0x4a, 0xec, 0xff, 0xb1, 0xc1, 0x36, 0xb1, 0xf0,
+	0x18, 0x9a, 0xd3, 0x70, 0x48, 0x37, 0x32, 0xa4, 0xa1, 0x38, 0x30, 0x38, 0x22, 0x9d, 0x28, 0xed,
+	0x69, 0x12, 0x96, 0xc1, 0x78, 0x5a, 0x62, 0xc5, 0xe0, 0x90, 0x82, 0x2d, 0xda, 0xd8, 0x81, 0x23,
+	0x53, 0x3c, 0x96, 0x4a, 0x47, 0x3c, 0x13, 0x55, 0x3c, 0x07, 0x7c, 0x73, 0x27, 0xd7, 0xb3, 0x84,
+	0xbd, 0x70, 0x44, 0xa2, 0x66, 0x7c, 0x8a, 0x74, 0x42, 0x77, 0x14, 0x6a, 0x51, 0xc7, 0x2e, 0x08,
+	0xd3, 0x35, 0x66, 0x79, 0x67, 0x0a, 0x87, 0x9e, 0xf6, 0x44, 0xc3, 0xa8, 0x23, 0xda, 0x53, 0x9b,
+	0xf8, 0x1f, 0x9c, 0xed, 0xab, 0xc9, 0xd8, 0x53, 0x63, 0x01, 0x88, 0xd0, 0x36, 0x47, 0xb7, 0x34,
+	0x4b, 0xe2, 0x28, 0x90, 0xfe, 0x4c, 0x1c, 0x19, 0x4d, 0xed, 0x6a, 0xad, 0xb2, 0xf1, 0xd7, 0x29,
+	0xf1, 0x2c, 0x61, 0x52, 0xd3, 0x40, 0x8b, 0x63, 0xa3, 0x9a, 0x5d, 0x76, 0xc6, 0xb5, 0xf1, 0x02,
+	0x4e, 0x77, 0x36, 0x88, 0x99, 0x6e, 0xe4, 0xbd, 0xe8, 0xe0, 0x25, 0xf4, 0x77, 0x0f, 0x3c, 0xd6,
+	0xd2, 0x0b, 0x12, 0x3f, 0x9a, 0xc4, 0x91, 0x92, 0x9a, 0xcc, 0x4c, 0x21, 0xf0, 0x0c, 0x4e, 0x14,
+	0xe9, 0xad, 0xaf, 0xcc, 0x70, 0x82, 0xa7, 0xd0, 0x91, 0xe1, 0x5d, 0x74, 0x4b, 0x89, 0x1f, 0x85,
+	0x9a, 0x3d, 0x5f, 0x0b, 0x2c, 0x83, 0xe9, 0xfb, 0x44, 0xcb, 0x09, 0x29, 0xed, 0x4d, 0x62, 0x71,
+	0x5a, 0xaa, 0xd7, 0x41, 0xe4, 0xdf, 0x26, 0xe1, 0x74, 0x72, 0x4d, 0x2c, 0xba, 0xe5, 0xbf, 0xf6,
+	0x99, 0x3c, 0x1d, 0xb1, 0x38, 0x2b, 0xb7, 0xf7, 0xbd, 0x20, 0x20, 0x4e, 0x22, 0x1e, 0x89, 0x73,
+	0x74, 0xa0, 0xfb, 0x2f, 0xe4, 0x37, 0xa9, 0xc7, 0x49, 0xcc, 0x51, 0x74, 0x23, 0x2e, 0xf0, 0x04,
+	0x8e, 0x37, 0xa3, 0xd8, 0x0b, 0x95, 0x34, 0xb7, 0xe0, 0x60, 0x0b, 0x1a, 0x4c, 0x23, 0xa9, 0x34,
+	0xb1, 0xe8, 0x61, 0x1b, 0xa0, 0x24, 0x1a, 0x8a, 0x77, 0x08, 0x50, 0x7b, 0x0d, 0x2c, 0xfa, 0xd8,
+	0x00, 0x5b, 0x86, 0x52, 0x8b, 0xf7, 0x78, 0x04, 0xf5, 0x69, 0x3c, 0x62, 0x6f, 0x48, 0xe2, 0x83,
+	0xb9, 0x55, 0xb3, 0x7d, 0x40, 0x9a, 0x86, 0xe2, 0xe3, 0x6b, 0x3f, 0x15, 0x47, 0xa1, 0x22, 0x71,
+	0x89, 0x4d, 0xa8, 0x12, 0x73, 0xc4, 0xe2, 0xd3, 0x15, 0x41, 0xc7, 0x4f, 0x9f, 0x8a, 0xf5, 0xfc,
+	0x7b, 0xa1, 0x9e, 0xb3, 0x2c, 0x5d, 0x17, 0x78, 0x05, 0x0d, 0x5e, 0x3e, 0xae, 0xf2, 0x62, 0xb9,
+	0xc6, 0xce, 0xde, 0x73, 0xf9, 0x7f, 0x5f, 0xe8, 0x1f, 0xb8, 0xd6, 0x67, 0xeb, 0xa1, 0xb6, 0x79,
+	0x7f, 0x5f, 0xfe, 0x0e, 0x00, 0x54, 0x1a, 0x9b, 0xb6, 0x8b, 0x03, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// ContractSupportClient is the client API for ContractSupport service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type ContractSupportClient interface {
+	Register(ctx context.Context, opts ...grpc.CallOption) (ContractSupport_RegisterClient, error)
+}
+
+type contractSupportClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewContractSupportClient(cc grpc.ClientConnInterface) ContractSupportClient {
+	return &contractSupportClient{cc}
+}
+
+func (c *contractSupportClient) Register(ctx context.Context, opts ...grpc.CallOption) (ContractSupport_RegisterClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_ContractSupport_serviceDesc.Streams[0], "/sopb.ContractSupport/Register", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &contractSupportRegisterClient{stream}
+	return x, nil
+}
+
+type ContractSupport_RegisterClient interface {
+	Send(*SoMessage) error
+	Recv() (*SoMessage, error)
+	grpc.ClientStream
+}
+
+type contractSupportRegisterClient struct {
+	grpc.ClientStream
+}
+
+func (x *contractSupportRegisterClient) Send(m *SoMessage) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *contractSupportRegisterClient) Recv() (*SoMessage, error) {
+	m := new(SoMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ContractSupportServer is the server API for ContractSupport service.
+type ContractSupportServer interface {
+	Register(ContractSupport_RegisterServer) error
+}
+
+// UnimplementedContractSupportServer can be embedded to have forward compatible implementations.
+type UnimplementedContractSupportServer struct {
+}
+
+func (*UnimplementedContractSupportServer) Register(srv ContractSupport_RegisterServer) error {
+	return status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+
+func RegisterContractSupportServer(s *grpc.Server, srv ContractSupportServer) {
+	s.RegisterService(&_ContractSupport_serviceDesc, srv)
+}
+
+func _ContractSupport_Register_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ContractSupportServer).Register(&contractSupportRegisterServer{stream})
+}
+
+type ContractSupport_RegisterServer interface {
+	Send(*SoMessage) error
+	Recv() (*SoMessage, error)
+	grpc.ServerStream
+}
+
+type contractSupportRegisterServer struct {
+	grpc.ServerStream
+}
+
+func (x *contractSupportRegisterServer) Send(m *SoMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *contractSupportRegisterServer) Recv() (*SoMessage, error) {
+	m := new(SoMessage)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _ContractSupport_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "sopb.ContractSupport",
+	HandlerType: (*ContractSupportServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Register",
+			Handler:       _ContractSupport_Register_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "so.proto",
+}
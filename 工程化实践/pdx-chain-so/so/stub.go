@@ -1,15 +1,22 @@
 package so
 
 import (
-	"container/list"
 	"pdx-chain-so/pkg/pdx-chain/common"
 	"pdx-chain-so/pkg/pdx-chain/rlp"
+	"strconv"
 )
 
 type SOCallStub struct {
 	handler *Handler
 	args    [][]byte
 	address  common.Address
+	ctx     *TxContext
+	ws      *writeSet
+
+	// registry and callers are set when the stub is created by a Registry,
+	// callers holds the contracts on the call stack, this one included.
+	registry *Registry
+	callers  []common.Address
 }
 
 func NewSoCallStub(handler *Handler,args [][]byte,address common.Address) *SOCallStub {
@@ -17,10 +24,26 @@ func NewSoCallStub(handler *Handler,args [][]byte,address common.Address) *SOCal
 		handler: handler,
 		args: args,
 		address: address,
+		ws: newWriteSet(address),
 	}
 }
 
+// NewSoCallStubWithContext returns a stub for a contract invoked in the
+// transaction described by ctx.
+func NewSoCallStubWithContext(handler *Handler, args [][]byte, address common.Address, ctx *TxContext) *SOCallStub {
+	stub := NewSoCallStub(handler, args, address)
+	stub.ctx = ctx
+	return stub
+}
+
 func (s *SOCallStub) GetState(key []byte) ([]byte,error) {
+	//先读本次调用尚未提交的写入
+	if v, ok := s.ws.get(string(key)); ok {
+		if len(v) == 0 {
+			return nil, SoCallError_NoResult
+		}
+		return v, nil
+	}
 	mess := &CallSoSendMessage{
 		inputs: [][]byte{key},
 		callType: SoCall_GET_STATE,
@@ -28,29 +51,317 @@ func (s *SOCallStub) GetState(key []byte) ([]byte,error) {
 	}
 
 	res := s.handler.handle(mess)
+	if res.err == nil || res.err == SoCallError_NoResult {
+		s.ws.read(string(key), res.res)
+	}
 	return res.res,res.err
 }
 
+func (s *SOCallStub) GetStateWithProof(key []byte) (*StateProof, error) {
+	num, err := s.GetBlockNumber()
+	if err != nil {
+		return nil, err
+	}
+	if num == 0 {
+		//创世块之前没有已提交的状态
+		return nil, SoCallError_Proof_Unavailable
+	}
+	mess := &CallSoSendMessage{
+		inputs:   [][]byte{key, common.Uint64ToByte(num - 1)},
+		callType: SoCall_GET_STATE_WITH_PROOF,
+		address:  s.address,
+	}
+	res := s.handler.handle(mess)
+	if res.err != nil {
+		return nil, res.err
+	}
+	return decodeStateProof(res.res)
+}
+
 func (s *SOCallStub) PutState(key []byte,value []byte) error {
+	if res := validityKey(key); res != nil {
+		return res.err
+	}
+	if err := s.checkPolicy(string(key)); err != nil {
+		return err
+	}
+	//写入缓冲时即计费,超出gas上限的写入不再进入写集
+	if err := s.handler.meter.write(len(key) + len(value)); err != nil {
+		return err
+	}
+	s.ws.put(string(key), value)
+	return nil
+}
+
+func (s *SOCallStub) DelState(key []byte) error {
+	if res := validityKey(key); res != nil {
+		return res.err
+	}
+	if err := s.checkPolicy(string(key)); err != nil {
+		return err
+	}
+	if err := s.handler.meter.write(len(key)); err != nil {
+		return err
+	}
+	s.ws.put(string(key), nil)
+	return nil
+}
+
+// Commit writes the pending writes of the invocation to the state in one
+// Socall_PUT_STATES batch, in key order. The writes were charged to the
+// meter when they were buffered. A host running a contract without
+// a Registry calls it once Run succeeded, on failure the stub is dropped.
+func (s *SOCallStub) Commit() error {
+	writes := s.ws.sortedWrites()
+	s.ws.rwset.Writes = writes
+	if len(writes) == 0 {
+		return s.commitPrivate()
+	}
+	inputs := make([][]byte, 0, 2*len(writes))
+	for _, w := range writes {
+		inputs = append(inputs, []byte(w.Key), w.Value)
+	}
 	mess := &CallSoSendMessage{
-		inputs: [][]byte{key,value},
-		callType: SoCall_PUT_STATE,
-		address: s.address,
+		inputs:   inputs,
+		callType: Socall_PUT_STATES,
+		address:  s.address,
+	}
+	res := s.handler.handle(mess)
+	if res.err != nil {
+		return res.err
+	}
+	return s.commitPrivate()
+}
+
+// commitPrivate writes the pending private writes, the hashes go to the
+// state and the values to the private store of member nodes.
+func (s *SOCallStub) commitPrivate() error {
+	writes, values := s.ws.sortedPrivateWrites()
+	s.ws.rwset.PrivateWrites = writes
+	for i, w := range writes {
+		mess := &CallSoSendMessage{
+			inputs:   [][]byte{[]byte(w.Collection), []byte(w.Key), values[i].salt, values[i].value},
+			callType: SoCall_PUT_PRIVATE_DATA,
+			address:  s.address,
+		}
+		if res := s.handler.handle(mess); res.err != nil {
+			return res.err
+		}
+	}
+	return nil
+}
+
+// RWSet returns the reads of committed state and the pending writes of the
+// invocation so far.
+func (s *SOCallStub) RWSet() *NsRWSet {
+	privateWrites, _ := s.ws.sortedPrivateWrites()
+	return &NsRWSet{
+		Address:      s.address,
+		Reads:        s.ws.rwset.Reads,
+		RangeQueries: s.ws.rwset.RangeQueries,
+		Writes:       s.ws.sortedWrites(),
+
+		PrivateWrites: privateWrites,
+	}
+}
+
+// checkPolicy fails unless the caller and endorsers of the transaction
+// satisfy the policy governing key.
+func (s *SOCallStub) checkPolicy(key string) error {
+	policy, err := s.GetKeyPolicy(key)
+	if err != nil {
+		return err
+	}
+	if policy != nil && !policy.Satisfied(ApprovingOrgs(s.ctx)) {
+		return SoCallError_Policy_Not_Satisfied
+	}
+	return nil
+}
+
+func (s *SOCallStub) GetKeyPolicy(key string) (*Policy, error) {
+	mess := &CallSoSendMessage{
+		inputs:   [][]byte{[]byte(key)},
+		callType: SoCall_GET_KEY_POLICY,
+		address:  s.address,
+	}
+	res := s.handler.handle(mess)
+	if res.err == SoCallError_NoResult {
+		return nil, nil
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	policy := new(Policy)
+	if err := rlp.DecodeBytes(res.res, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (s *SOCallStub) SetKeyPolicy(key string, policy *Policy) error {
+	if res := validityKey([]byte(key)); res != nil {
+		return res.err
+	}
+	return s.setKeyPolicy(key, "0", policy)
+}
+
+func (s *SOCallStub) SetPrefixPolicy(prefix string, policy *Policy) error {
+	if prefix == "" {
+		return SoCallError_Input_Error
+	}
+	return s.setKeyPolicy(prefix, "1", policy)
+}
+
+// setKeyPolicy replaces a policy, the transaction must satisfy the policy
+// currently governing key.
+func (s *SOCallStub) setKeyPolicy(key string, prefix string, policy *Policy) error {
+	if err := s.checkPolicy(key); err != nil {
+		return err
+	}
+	var enc []byte
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+		var err error
+		if enc, err = rlp.EncodeToBytes(policy); err != nil {
+			return err
+		}
+	}
+	mess := &CallSoSendMessage{
+		inputs:   [][]byte{[]byte(key), []byte(prefix), enc},
+		callType: SoCall_SET_KEY_POLICY,
+		address:  s.address,
 	}
 	res := s.handler.handle(mess)
 	return res.err
 }
 
-func (s *SOCallStub) DelState(key []byte) error {
+func (s *SOCallStub) GetQueryResult(query string) (StateQueryIteratorInterface, error) {
+	page, err := s.getQueryPage(query, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return NewStateQueryIterator(page.Results), nil
+}
+
+func (s *SOCallStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (StateQueryIteratorInterface, *QueryResponseMetadata, error) {
+	if pageSize < 0 {
+		return nil, nil, SoCallError_Input_Error
+	}
+	page, err := s.getQueryPage(query, pageSize, bookmark)
+	if err != nil {
+		return nil, nil, err
+	}
+	md := &QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(page.Results)),
+		Bookmark:            page.Bookmark,
+		HasMore:             page.HasMore,
+	}
+	return NewStateQueryIterator(page.Results), md, nil
+}
+
+// getQueryPage runs a rich query, the pending writes of the invocation are
+// not seen by it.
+func (s *SOCallStub) getQueryPage(query string, pageSize int32, bookmark string) (*QueryPage, error) {
 	mess := &CallSoSendMessage{
-		inputs: [][]byte{key},
-		callType: SoCall_DEL_STATE,
-		address: s.address,
+		inputs:   [][]byte{[]byte(query), common.Uint64ToByte(uint64(pageSize)), []byte(bookmark)},
+		callType: SoCall_GET_QUERY_RESULT,
+		address:  s.address,
+	}
+	res := s.handler.handle(mess)
+	if res.err != nil {
+		return nil, res.err
+	}
+	page := new(QueryPage)
+	if err := rlp.DecodeBytes(res.res, page); err != nil {
+		return nil, SoCallError_Query_Encode_Error
+	}
+	return page, nil
+}
+
+func (s *SOCallStub) PutPrivateData(collection string, key string, value []byte) error {
+	if collection == "" {
+		return SoCallError_Input_Error
+	}
+	if res := validityKey([]byte(key)); res != nil {
+		return res.err
+	}
+	var salt []byte
+	if len(value) > 0 {
+		//盐值由交易的瞬态输入派生,不上链
+		transient, err := s.GetTransient()
+		if err != nil {
+			return err
+		}
+		if salt, err = PrivateDataSalt(transient[TransientSaltKey], collection, key); err != nil {
+			return err
+		}
+	}
+	if err := s.handler.meter.write(len(key) + len(value)); err != nil {
+		return err
+	}
+	s.ws.putPrivate(collection, key, salt, value)
+	return nil
+}
+
+func (s *SOCallStub) DelPrivateData(collection string, key string) error {
+	return s.PutPrivateData(collection, key, nil)
+}
+
+func (s *SOCallStub) GetPrivateData(collection string, key string) ([]byte, error) {
+	if pv, ok := s.ws.getPrivate(collection, key); ok {
+		if len(pv.value) == 0 {
+			return nil, SoCallError_NoResult
+		}
+		return pv.value, nil
+	}
+	mess := &CallSoSendMessage{
+		inputs:   [][]byte{[]byte(collection), []byte(key)},
+		callType: SoCall_GET_PRIVATE_DATA,
+		address:  s.address,
+	}
+	res := s.handler.handle(mess)
+	return res.res, res.err
+}
+
+func (s *SOCallStub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	if pv, ok := s.ws.getPrivate(collection, key); ok {
+		if len(pv.value) == 0 {
+			return nil, SoCallError_NoResult
+		}
+		return PrivateDataHash(pv.salt, pv.value).Bytes(), nil
+	}
+	mess := &CallSoSendMessage{
+		inputs:   [][]byte{[]byte(collection), []byte(key)},
+		callType: SoCall_GET_PRIVATE_DATA_HASH,
+		address:  s.address,
+	}
+	res := s.handler.handle(mess)
+	return res.res, res.err
+}
+
+func (s *SOCallStub) SetEvent(name string, payload []byte) error {
+	mess := &CallSoSendMessage{
+		inputs:   [][]byte{[]byte(name), payload},
+		callType: SoCall_SET_EVENT,
+		address:  s.address,
 	}
 	res := s.handler.handle(mess)
 	return res.err
 }
 
+func (s *SOCallStub) InvokeContract(address common.Address, args [][]byte) ([]byte, error) {
+	if s.registry == nil {
+		return nil, SoCallError_Invoke_Unavailable
+	}
+	res := s.registry.invoke(s.handler, address, s.ctx, args, s.callers)
+	if !res.IsSuccess() {
+		return nil, res.Err()
+	}
+	return res.Payload, nil
+}
+
 func (s *SOCallStub) GetArgs() [][]byte {
 	return s.args
 }
@@ -75,22 +386,150 @@ func (s *SOCallStub) GetFunctionAndParameters() (function string,params [][]byte
 	return
 }
 
-func (s *SOCallStub) GetHistoryForKey(key string,start,end uint64) (*list.Element,error) {
+func (s *SOCallStub) GetTxID() string {
+	if s.ctx != nil && s.ctx.TxID != (common.Hash{}) {
+		return s.ctx.TxID.Hex()
+	}
+	return s.handler.db.TxHash().Hex()
+}
+
+func (s *SOCallStub) GetTxTimestamp() (uint64, error) {
+	if s.ctx == nil {
+		return 0, SoCallError_TxContext_Unavailable
+	}
+	return s.ctx.Timestamp, nil
+}
+
+func (s *SOCallStub) GetBlockNumber() (uint64, error) {
+	if s.ctx == nil {
+		return 0, SoCallError_TxContext_Unavailable
+	}
+	return s.ctx.BlockNumber, nil
+}
+
+func (s *SOCallStub) GetCreator() ([]byte, error) {
+	if s.ctx == nil {
+		return nil, SoCallError_TxContext_Unavailable
+	}
+	return s.ctx.Creator()
+}
+
+func (s *SOCallStub) GetTransient() (map[string][]byte, error) {
+	if s.ctx == nil {
+		return nil, SoCallError_TxContext_Unavailable
+	}
+	return s.ctx.Transient, nil
+}
+
+func (s *SOCallStub) GetCallerOrg() (string, error) {
+	if s.ctx == nil {
+		return "", SoCallError_TxContext_Unavailable
+	}
+	return s.ctx.CallerOrg()
+}
+
+func (s *SOCallStub) GetHistoryForKey(key string, start, end uint64) (HistoryQueryIteratorInterface, error) {
+	page, err := s.getHistoryPage(key, start, end, 0, "", HistoryNewestFirst)
+	if err != nil {
+		return nil, err
+	}
+	return NewPagedHistoryQueryIterator(page, func(bookmark string) (*HistoryPage, error) {
+		return s.getHistoryPage(key, start, end, 0, bookmark, HistoryNewestFirst)
+	}), nil
+}
+
+func (s *SOCallStub) GetHistoryForKeyWithPagination(key string, start, end uint64, pageSize int32, bookmark string, order HistoryOrder) (HistoryQueryIteratorInterface, *QueryResponseMetadata, error) {
+	page, err := s.getHistoryPage(key, start, end, pageSize, bookmark, order)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata := &QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(page.Records)),
+		HasMore:             page.HasMore,
+	}
+	if page.HasMore {
+		metadata.Bookmark = strconv.FormatUint(page.Bookmark, 10)
+	}
+	return &HistoryQueryIterator{results: page.Records, page: page}, metadata, nil
+}
+
+func (s *SOCallStub) getHistoryPage(key string, start, end uint64, pageSize int32, bookmark string, order HistoryOrder) (*HistoryPage, error) {
+	inputs, err := newHistoryInputs(key, start, end, pageSize, bookmark, order)
+	if err != nil {
+		return nil, err
+	}
 	mess := &CallSoSendMessage{
-		inputs: [][]byte{[]byte(key),common.Uint64ToByte(start),common.Uint64ToByte(end)},
+		inputs:   inputs,
 		callType: SoCall_GET_HISTORY,
-		address: s.address,
+		address:  s.address,
 	}
 	res := s.handler.handle(mess)
-	if len(res.res) > 0 {
-		return nil,res.err
+	if res.err != nil {
+		return nil, res.err
+	}
+	page := new(HistoryPage)
+	if err := rlp.DecodeBytes(res.res, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (s *SOCallStub) GetStateByRange(startKey, endKey string) (StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = emptyKeySubstitute
 	}
-	histList := new(list.List)
-	err := rlp.DecodeBytes(res.res,histList)
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, err
+	}
+	return s.getStateByRange(startKey, endKey)
+}
+
+func (s *SOCallStub) GetStateByPrefix(prefix string) (StateQueryIteratorInterface, error) {
+	return s.GetStateByRange(prefix, prefixEnd(prefix))
+}
+
+func (s *SOCallStub) GetStateByPartialCompositeKey(objectType string, attributes []string) (StateQueryIteratorInterface, error) {
+	partialCompositeKey, err := CreateCompositeKey(objectType, attributes)
 	if err != nil {
 		return nil, err
 	}
+	return s.getStateByRange(partialCompositeKey, partialCompositeKey+string(maxUnicodeRuneValue))
+}
+
+func (s *SOCallStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return CreateCompositeKey(objectType, attributes)
+}
+
+func (s *SOCallStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	return SplitCompositeKey(compositeKey)
+}
 
-	ele := histList.Front()
-	return ele,nil
-}
\ No newline at end of file
+func (s *SOCallStub) getStateByRange(startKey, endKey string) (StateQueryIteratorInterface, error) {
+	mess := &CallSoSendMessage{
+		inputs:   [][]byte{[]byte(startKey), []byte(endKey)},
+		callType: SoCall_GET_STATE_BY_RANGE,
+		address:  s.address,
+	}
+	res := s.handler.handle(mess)
+	if res.err != nil {
+		return nil, res.err
+	}
+	var results []*KV
+	if err := rlp.DecodeBytes(res.res, &results); err != nil {
+		return nil, err
+	}
+	return NewStateQueryIterator(s.ws.readRange(startKey, endKey, results)), nil
+}
+
+// prefixEnd returns the smallest key greater than every key starting with
+// prefix, or "" when no such key exists.
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,208 @@
+package so
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pdx-chain-so/pkg/pdx-chain/common"
+	"pdx-chain-so/pkg/pdx-chain/crypto"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm2"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/params"
+)
+
+var (
+	SoCallError_TxContext_Unavailable = errors.New("Transaction context is not available")
+	SoCallError_Creator_Unavailable   = errors.New("Transaction has no caller identity")
+	SoCallError_Creator_Illegal       = errors.New("Caller identity is illegal")
+	SoCallError_Org_Not_Found         = errors.New("Caller does not belong to any consortium org")
+)
+
+// TxContext describes the transaction a contract is invoked in. The caller
+// is the key the host verified the transaction signature with. An SM2
+// signed jwt or a certificate issued by a consortium CA may bind that key
+// to an identity, the token wins when both are set.
+type TxContext struct {
+	TxID        common.Hash
+	BlockNumber uint64
+	Timestamp   uint64 // block time in seconds since the epoch
+	Signer      []byte // compressed public key the host verified the transaction signature with
+	Token       string // SM2 jwt carrying the caller public key in "ak"
+	Cert        []byte // PEM or DER encoded certificate of the caller, optionally followed by its intermediate CAs
+	GasLimit    uint64 // gas available to the invocation, 0 for no limit
+	// Transient holds the inputs passed to the node off chain along with
+	// the transaction, such as private data values and TransientSaltKey.
+	// They are never recorded in a block.
+	Transient map[string][]byte
+	// Endorsers holds the compressed public keys of the nodes or users whose
+	// endorsement signatures the host verified for the transaction.
+	Endorsers [][]byte
+}
+
+// Creator returns the compressed SM2 public key of the caller. The "ak" of
+// the token or the key of the certificate must be the signer of the
+// transaction, and the certificate must chain up to a CA of a consortium
+// org as of the block time.
+func (ctx *TxContext) Creator() ([]byte, error) {
+	if len(ctx.Signer) == 0 {
+		return nil, SoCallError_Creator_Unavailable
+	}
+	key := ctx.Signer
+	switch {
+	case ctx.Token != "":
+		_, ak, err := crypto.ParseTokenSM2(ctx.Token)
+		if err != nil {
+			return nil, SoCallError_Creator_Illegal
+		}
+		key = ak
+	case len(ctx.Cert) > 0:
+		certKey, _, err := verifyCert(ctx.Cert, ctx.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		key = certKey
+	}
+	//身份只能取自宿主已验证过交易签名的公钥
+	if !bytes.Equal(key, ctx.Signer) {
+		return nil, SoCallError_Creator_Illegal
+	}
+	return key, nil
+}
+
+// CallerOrg returns the name of the consortium org of the caller. A caller
+// identified by a certificate belongs to the org whose CA issued it, other
+// callers to the org their key is registered with.
+func (ctx *TxContext) CallerOrg() (string, error) {
+	creator, err := ctx.Creator()
+	if err != nil {
+		return "", err
+	}
+	if ctx.Token == "" && len(ctx.Cert) > 0 {
+		_, org, err := verifyCert(ctx.Cert, ctx.Timestamp)
+		return org, err
+	}
+	return CallerOrg(creator)
+}
+
+// verifyCert checks that the first certificate of cert chains up to the
+// user or node CA of a consortium org at time timestamp, through the
+// certificates following it if needed. It returns the compressed public key
+// of the certificate and the name of the org.
+func verifyCert(cert []byte, timestamp uint64) ([]byte, string, error) {
+	if params.ConsortiumConf == nil {
+		return nil, "", SoCallError_Creator_Illegal
+	}
+	certs, err := parseCerts(cert)
+	if err != nil || len(certs) == 0 {
+		return nil, "", SoCallError_Creator_Illegal
+	}
+	var key []byte
+	switch pub := certs[0].PublicKey.(type) {
+	case *sm2.PublicKey:
+		key = sm2.Compress(pub)
+	case *ecdsa.PublicKey:
+		key = sm2.Compress((*sm2.PublicKey)(pub))
+	default:
+		return nil, "", SoCallError_Creator_Illegal
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	for _, org := range params.ConsortiumConf.Orgs {
+		roots, err := orgCertPool(org)
+		if err != nil {
+			return nil, "", err
+		}
+		_, err = certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			//按区块时间校验有效期,各节点结果一致
+			CurrentTime: time.Unix(int64(timestamp), 0),
+			KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err == nil {
+			return key, org.Name, nil
+		}
+	}
+	return nil, "", SoCallError_Creator_Illegal
+}
+
+// parseCerts decodes the PEM blocks of data, or data itself when it is DER.
+func parseCerts(data []byte) ([]*x509.Certificate, error) {
+	if !strings.HasPrefix(string(data), "-----BEGIN") {
+		c, err := x509.ParseCertificate(data)
+		if err != nil {
+			return nil, err
+		}
+		return []*x509.Certificate{c}, nil
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, data = pem.Decode(data); block == nil {
+			return certs, nil
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+}
+
+// orgCertPool returns the user and node CAs of org, read from the files
+// listed in the consortium config relative to params.ConsortiumDir.
+func orgCertPool(org params.Org) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, name := range append(append([]string{}, org.UserCa...), org.NodeCa...) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(params.ConsortiumDir, name)
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := parseCerts(data)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range certs {
+			pool.AddCert(c)
+		}
+	}
+	return pool, nil
+}
+
+// CallerOrg returns the name of the consortium org that creator, a compressed
+// public key, is registered with as a user or a node. Orgs are checked in
+// the order of the consortium config.
+func CallerOrg(creator []byte) (string, error) {
+	if params.ConsortiumConf == nil {
+		return "", SoCallError_Org_Not_Found
+	}
+	key := hex.EncodeToString(creator)
+	for _, org := range params.ConsortiumConf.Orgs {
+		if containsPublicKey(params.OrgNameMapUserPublicKeys[org.Name], key) ||
+			containsPublicKey(params.OrgNameMapNodePublicKeys[org.Name], key) {
+			return org.Name, nil
+		}
+	}
+	return "", SoCallError_Org_Not_Found
+}
+
+func containsPublicKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(strings.TrimPrefix(k, "0x"), key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package so
+
+import (
+	"crypto"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/sm2"
+	"pdx-chain-so/pkg/pdx-chain/crypto/gmsm/x509"
+	"pdx-chain-so/pkg/pdx-chain/crypto/jwt-go"
+	"pdx-chain-so/pkg/pdx-chain/params"
+)
+
+// testIdentity is a key pair with a certificate.
+type testIdentity struct {
+	key  *sm2.PrivateKey
+	cert *x509.Certificate
+	pem  []byte
+}
+
+func (id *testIdentity) pub() []byte {
+	return sm2.Compress((*sm2.PublicKey)(&id.key.PublicKey))
+}
+
+// certSigner signs certificates with key, the x509 package only picks SM2
+// with SM3 for a signer whose public key is an *sm2.PublicKey.
+type certSigner struct {
+	*sm2.PrivateKey
+}
+
+func (s certSigner) Public() crypto.PublicKey {
+	return (*sm2.PublicKey)(&s.PrivateKey.PublicKey)
+}
+
+var testSerial int64
+
+// newTestIdentity returns a new key with a certificate for it signed by
+// parent, or self-signed when parent is nil. Certificates are valid during
+// the year 2020.
+func newTestIdentity(t *testing.T, name string, isCA bool, parent *testIdentity) *testIdentity {
+	t.Helper()
+	key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testSerial++
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(testSerial),
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		SignatureAlgorithm:    x509.SM2WithSM3,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		SubjectKeyId:          []byte(name),
+	}
+	tmpl.Subject.CommonName = name
+	if isCA {
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	}
+	signer, issuer := certSigner{key}, tmpl
+	if parent != nil {
+		signer, issuer = certSigner{parent.key}, parent.cert
+	}
+	enc, err := x509.CreateCertificateToPem(tmpl, issuer, (*sm2.PublicKey)(&key.PublicKey), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ReadCertificateFromPem(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdentity{key: key, cert: cert, pem: enc}
+}
+
+// testTime is a block time at which the test certificates are valid.
+var testTime = uint64(time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC).Unix())
+
+// newTestConsortium installs a consortium of org1 and org2 whose user CAs
+// are returned, the admin of org1 is admin. The config is restored when the
+// test ends.
+func newTestConsortium(t *testing.T, admin []byte) (ca1, ca2 *testIdentity) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "so-consortium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca1 = newTestIdentity(t, "org1 ca", true, nil)
+	ca2 = newTestIdentity(t, "org2 ca", true, nil)
+	for name, ca := range map[string]*testIdentity{"ca1.pem": ca1, "ca2.pem": ca2} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), ca.pem, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conf, confDir, consortium := params.ConsortiumConf, params.ConsortiumDir, params.Consortium
+	params.ConsortiumConf = &params.ConsortiumConfObj{Orgs: []params.Org{
+		{Name: "org1", UserCa: []string{"ca1.pem"}, Admins: []string{hex.EncodeToString(admin)}},
+		{Name: "org2", UserCa: []string{"ca2.pem"}},
+	}}
+	params.ConsortiumDir, params.Consortium = dir, true
+	t.Cleanup(func() {
+		params.ConsortiumConf, params.ConsortiumDir, params.Consortium = conf, confDir, consortium
+		os.RemoveAll(dir)
+	})
+	return ca1, ca2
+}
+
+func TestCreatorFromCert(t *testing.T) {
+	ca1, _ := newTestConsortium(t, nil)
+	user := newTestIdentity(t, "user", false, ca1)
+
+	ctx := &TxContext{Timestamp: testTime, Signer: user.pub(), Cert: user.pem}
+	if creator, err := ctx.Creator(); err != nil || hex.EncodeToString(creator) != hex.EncodeToString(user.pub()) {
+		t.Errorf("Creator = %x, %v, want %x", creator, err, user.pub())
+	}
+	if org, err := ctx.CallerOrg(); err != nil || org != "org1" {
+		t.Errorf("CallerOrg = %q, %v, want org1", org, err)
+	}
+	if orgs := ApprovingOrgs(ctx); len(orgs) != 1 || orgs[0] != "org1" {
+		t.Errorf("ApprovingOrgs = %v, want [org1]", orgs)
+	}
+
+	//经中间CA签发,证书链随证书一并提供
+	inter := newTestIdentity(t, "org1 intermediate", true, ca1)
+	leaf := newTestIdentity(t, "leaf", false, inter)
+	ctx = &TxContext{Timestamp: testTime, Signer: leaf.pub(), Cert: append(append([]byte{}, leaf.pem...), inter.pem...)}
+	if org, err := ctx.CallerOrg(); err != nil || org != "org1" {
+		t.Errorf("CallerOrg through an intermediate CA = %q, %v, want org1", org, err)
+	}
+
+	//只有签名公钥时以其为身份
+	ctx = &TxContext{Signer: user.pub()}
+	if creator, err := ctx.Creator(); err != nil || string(creator) != string(user.pub()) {
+		t.Errorf("Creator of a signer alone = %x, %v", creator, err)
+	}
+	if _, err := (&TxContext{Cert: user.pem, Timestamp: testTime}).Creator(); err != SoCallError_Creator_Unavailable {
+		t.Errorf("Creator without a signer = %v, want %v", err, SoCallError_Creator_Unavailable)
+	}
+}
+
+func TestCreatorForgedCert(t *testing.T) {
+	admin := newTestIdentity(t, "admin", false, nil)
+	ca1, _ := newTestConsortium(t, admin.pub())
+	user := newTestIdentity(t, "user", false, ca1)
+	attacker := newTestIdentity(t, "attacker", false, nil)
+
+	//自签证书声称持有管理员公钥
+	forged := newTestIdentity(t, "admin", false, nil)
+	forgedPem, err := x509.CreateCertificateToPem(forged.cert, forged.cert, (*sm2.PublicKey)(&admin.key.PublicKey), certSigner{forged.key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//与org1 CA同名的伪造CA签发的证书
+	fakeCA := newTestIdentity(t, "org1 ca", true, nil)
+	fakeUser := newTestIdentity(t, "user", false, fakeCA)
+
+	tests := []struct {
+		name string
+		ctx  *TxContext
+	}{
+		{"self-signed cert of the admin key", &TxContext{Timestamp: testTime, Signer: admin.pub(), Cert: forgedPem}},
+		{"self-signed cert signed by the attacker", &TxContext{Timestamp: testTime, Signer: attacker.pub(), Cert: attacker.pem}},
+		{"cert of another key", &TxContext{Timestamp: testTime, Signer: attacker.pub(), Cert: user.pem}},
+		{"cert of a fake CA", &TxContext{Timestamp: testTime, Signer: fakeUser.pub(), Cert: fakeUser.pem}},
+		{"fake CA passed as intermediate", &TxContext{Timestamp: testTime, Signer: fakeUser.pub(), Cert: append(append([]byte{}, fakeUser.pem...), fakeCA.pem...)}},
+		{"expired cert", &TxContext{Timestamp: uint64(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC).Unix()), Signer: user.pub(), Cert: user.pem}},
+		{"garbage cert", &TxContext{Timestamp: testTime, Signer: user.pub(), Cert: []byte("not a certificate")}},
+	}
+	for _, tt := range tests {
+		if creator, err := tt.ctx.Creator(); err != SoCallError_Creator_Illegal {
+			t.Errorf("%s: Creator = %x, %v, want %v", tt.name, creator, err, SoCallError_Creator_Illegal)
+		}
+		if org, err := tt.ctx.CallerOrg(); err == nil {
+			t.Errorf("%s: CallerOrg = %q", tt.name, org)
+		}
+		if orgs := ApprovingOrgs(tt.ctx); len(orgs) != 0 {
+			t.Errorf("%s: ApprovingOrgs = %v", tt.name, orgs)
+		}
+		if err := authorizeLifecycle(tt.ctx); err == nil {
+			t.Errorf("%s: lifecycle authorized", tt.name)
+		}
+	}
+
+	if err := authorizeLifecycle(&TxContext{Timestamp: testTime, Signer: admin.pub()}); err != nil {
+		t.Errorf("lifecycle of the admin signer = %v", err)
+	}
+}
+
+func TestCreatorFromToken(t *testing.T) {
+	user, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ak := sm2.Compress((*sm2.PublicKey)(&user.PublicKey))
+	token, err := jwt.NewWithClaims(jwt.SM2Signing, jwt.MapClaims{"ak": hex.EncodeToString(ak)}).SignedString(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creator, err := (&TxContext{Signer: ak, Token: token}).Creator(); err != nil || string(creator) != string(ak) {
+		t.Errorf("Creator of a token = %x, %v", creator, err)
+	}
+	//他人的token被重放
+	if _, err := (&TxContext{Signer: sm2.Compress((*sm2.PublicKey)(&other.PublicKey)), Token: token}).Creator(); err != SoCallError_Creator_Illegal {
+		t.Errorf("Creator of a replayed token = %v, want %v", err, SoCallError_Creator_Illegal)
+	}
+}